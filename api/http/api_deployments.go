@@ -39,6 +39,7 @@ import (
 	"github.com/mendersoftware/deployments/app"
 	dconfig "github.com/mendersoftware/deployments/config"
 	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/storage"
 	"github.com/mendersoftware/deployments/store"
 	"github.com/mendersoftware/deployments/utils"
 )
@@ -80,6 +81,7 @@ const (
 	ParamPerPage      = "per_page"
 	ParamSort         = "sort"
 	ParamID           = "id"
+	ParamResumable    = "resumable"
 )
 
 const Redacted = "REDACTED"
@@ -1351,10 +1353,15 @@ func (d *DeploymentsApiHandlers) getDeploymentForDevice(
 	ctx := r.Context()
 	l := requestlog.GetRequestLogger(r)
 
+	if resumable, _ := strconv.ParseBool(r.URL.Query().Get(ParamResumable)); resumable {
+		ctx = app.ResumableDownloadWithContext(ctx)
+	}
 	deployment, err := d.app.GetDeploymentForDeviceWithCurrent(ctx, idata.Subject, request)
 	if err != nil {
 		if err == app.ErrConflictingRequestData {
 			d.view.RenderError(w, r, err, http.StatusConflict, l)
+		} else if errors.Is(err, model.ErrDeploymentDeadlinePassed) {
+			d.view.RenderError(w, r, err, http.StatusGone, l)
 		} else {
 			d.view.RenderInternalError(w, r, err, l)
 		}
@@ -1687,6 +1694,50 @@ func (d *DeploymentsApiHandlers) PutDeploymentLogForDevice(w rest.ResponseWriter
 	d.view.RenderEmptySuccessResponse(w)
 }
 
+// CheckDownloadResumeForDevice checks whether the device can resume the
+// interrupted download of the artifact of the deployment.
+func (d *DeploymentsApiHandlers) CheckDownloadResumeForDevice(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	did := r.PathParam("id")
+
+	idata := identity.FromContext(ctx)
+	if idata == nil {
+		d.view.RenderError(w, r, ErrMissingIdentity, http.StatusBadRequest, l)
+		return
+	}
+
+	var req storage.ResumeRequest
+	if err := r.DecodeJsonPayload(&req); err != nil {
+		d.view.RenderError(w, r, err, http.StatusBadRequest, l)
+		return
+	}
+	if req.ETag == "" || req.Size <= 0 {
+		d.view.RenderError(w, r,
+			errors.New("etag and size of the download are required"),
+			http.StatusBadRequest, l)
+		return
+	}
+
+	err := d.app.CheckArtifactResume(ctx, did, idata.Subject, req)
+	switch {
+	case err == nil:
+		d.view.RenderEmptySuccessResponse(w)
+	case err == app.ErrStorageNotFound:
+		d.view.RenderErrorNotFound(w, r, l)
+	case err == app.ErrDeploymentAborted, errors.Is(err, storage.ErrObjectChanged):
+		d.view.RenderError(w, r, err, http.StatusConflict, l)
+	case errors.Is(err, storage.ErrInvalidRange):
+		d.view.RenderError(w, r, err, http.StatusRequestedRangeNotSatisfiable, l)
+	default:
+		d.view.RenderInternalError(w, r, err, l)
+	}
+}
+
 func (d *DeploymentsApiHandlers) GetDeploymentLogForDevice(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 	l := requestlog.GetRequestLogger(r)
@@ -1918,6 +1969,31 @@ func (d *DeploymentsApiHandlers) GetTenantStorageSettingsHandler(
 	d.view.RenderSuccessGet(w, settings)
 }
 
+func (d *DeploymentsApiHandlers) GetTenantStorageEndpointsHandler(
+	w rest.ResponseWriter,
+	r *rest.Request,
+) {
+	l := requestlog.GetRequestLogger(r)
+
+	tenantID := r.PathParam("tenant")
+
+	ctx := identity.WithContext(
+		r.Context(),
+		&identity.Identity{Tenant: tenantID},
+	)
+
+	endpoints, err := d.app.GetStorageEndpoints(ctx)
+	if errors.Is(err, storage.ErrEndpointsNotSupported) {
+		rest_utils.RestErrWithLog(w, r, l, err, http.StatusNotImplemented)
+		return
+	} else if err != nil {
+		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		return
+	}
+
+	d.view.RenderSuccessGet(w, endpoints)
+}
+
 func (d *DeploymentsApiHandlers) PutTenantStorageSettingsHandler(
 	w rest.ResponseWriter,
 	r *rest.Request,
@@ -35,6 +35,7 @@ import (
 	"github.com/mendersoftware/deployments/app"
 	mapp "github.com/mendersoftware/deployments/app/mocks"
 	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/storage"
 	"github.com/mendersoftware/deployments/store"
 	"github.com/mendersoftware/deployments/utils/restutil/view"
 	h "github.com/mendersoftware/deployments/utils/testing"
@@ -1216,9 +1217,11 @@ func TestGetDeploymentForDevice(t *testing.T) {
 			return req
 		}(),
 		App: func() *mapp.App {
-			app := new(mapp.App)
-			app.On("GetDeploymentForDeviceWithCurrent",
-				contextMatcher(),
+			mApp := new(mapp.App)
+			mApp.On("GetDeploymentForDeviceWithCurrent",
+				mock.MatchedBy(func(ctx context.Context) bool {
+					return !app.ResumableDownloadFromContext(ctx)
+				}),
 				uuid.NewSHA1(uuid.NameSpaceOID, []byte("device")).String(),
 				&model.DeploymentNextRequest{
 					DeviceProvides: &model.InstalledDeviceDeployment{
@@ -1237,7 +1240,53 @@ func TestGetDeploymentForDevice(t *testing.T) {
 					},
 				},
 			}, nil)
-			return app
+			return mApp
+		}(),
+
+		StatusCode: http.StatusOK,
+		Error:      nil,
+	}, {
+		Name: "ok, resumable download",
+
+		Request: func() *http.Request {
+			req, _ := http.NewRequestWithContext(
+				identity.WithContext(context.Background(), &identity.Identity{
+					Subject:  uuid.NewSHA1(uuid.NameSpaceOID, []byte("device")).String(),
+					IsDevice: true,
+				}),
+				http.MethodGet,
+				"http://localhost"+ApiUrlDevicesDeploymentsNext+
+					"?device_type=bagelShins&artifact_name=bagelOS1.0.1&resumable=true",
+				nil,
+			)
+			return req
+		}(),
+		App: func() *mapp.App {
+			mApp := new(mapp.App)
+			mApp.On("GetDeploymentForDeviceWithCurrent",
+				mock.MatchedBy(app.ResumableDownloadFromContext),
+				uuid.NewSHA1(uuid.NameSpaceOID, []byte("device")).String(),
+				&model.DeploymentNextRequest{
+					DeviceProvides: &model.InstalledDeviceDeployment{
+						ArtifactName: "bagelOS1.0.1",
+						DeviceType:   "bagelShins",
+					},
+				},
+			).Return(&model.DeploymentInstructions{
+				ID: uuid.NewSHA1(uuid.NameSpaceURL, []byte("deployment")).String(),
+				Artifact: model.ArtifactDeploymentInstructions{
+					ArtifactName:          "bagelOS1.1.0",
+					DeviceTypesCompatible: []string{"bagelShins", "raspberryPlanck"},
+					Source: model.Link{
+						Uri:    "https://localhost/bucket/head/bagelOS1.0.1",
+						Expire: time.Now().Add(time.Hour),
+						Header: map[string]string{"If-Match": `"abc"`},
+					},
+					ETag: `"abc"`,
+					Size: 1024,
+				},
+			}, nil)
+			return mApp
 		}(),
 
 		StatusCode: http.StatusOK,
@@ -1646,6 +1695,138 @@ func TestGetDeploymentForDevice(t *testing.T) {
 	}
 }
 
+func TestCheckDownloadResumeForDevice(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.NewSHA1(uuid.NameSpaceOID, []byte("device")).String()
+	deploymentID := uuid.NewSHA1(uuid.NameSpaceURL, []byte("deployment")).String()
+	resume := storage.ResumeRequest{ETag: `"abc"`, Size: 1024, Offset: 512}
+
+	testCases := []struct {
+		Name string
+
+		Body     interface{}
+		Identity *identity.Identity
+		AppErr   error
+
+		StatusCode int
+		Error      error
+	}{{
+		Name: "ok",
+
+		Body:     resume,
+		Identity: &identity.Identity{Subject: deviceID, IsDevice: true},
+
+		StatusCode: http.StatusNoContent,
+	}, {
+		Name: "error/artifact changed",
+
+		Body:     resume,
+		Identity: &identity.Identity{Subject: deviceID, IsDevice: true},
+		AppErr:   storage.ErrObjectChanged,
+
+		StatusCode: http.StatusConflict,
+		Error:      storage.ErrObjectChanged,
+	}, {
+		Name: "error/deployment aborted",
+
+		Body:     resume,
+		Identity: &identity.Identity{Subject: deviceID, IsDevice: true},
+		AppErr:   app.ErrDeploymentAborted,
+
+		StatusCode: http.StatusConflict,
+		Error:      app.ErrDeploymentAborted,
+	}, {
+		Name: "error/invalid range",
+
+		Body:     resume,
+		Identity: &identity.Identity{Subject: deviceID, IsDevice: true},
+		AppErr:   storage.ErrInvalidRange,
+
+		StatusCode: http.StatusRequestedRangeNotSatisfiable,
+		Error:      storage.ErrInvalidRange,
+	}, {
+		Name: "error/not found",
+
+		Body:     resume,
+		Identity: &identity.Identity{Subject: deviceID, IsDevice: true},
+		AppErr:   app.ErrStorageNotFound,
+
+		StatusCode: http.StatusNotFound,
+		Error:      view.ErrNotFound,
+	}, {
+		Name: "error/internal",
+
+		Body:     resume,
+		Identity: &identity.Identity{Subject: deviceID, IsDevice: true},
+		AppErr:   errors.New("internal error"),
+
+		StatusCode: http.StatusInternalServerError,
+		Error:      errors.New("internal error"),
+	}, {
+		Name: "error/missing etag",
+
+		Body:     storage.ResumeRequest{Size: 1024, Offset: 512},
+		Identity: &identity.Identity{Subject: deviceID, IsDevice: true},
+
+		StatusCode: http.StatusBadRequest,
+		Error:      errors.New("etag and size of the download are required"),
+	}, {
+		Name: "error/missing identity",
+
+		Body: resume,
+
+		StatusCode: http.StatusBadRequest,
+		Error:      ErrMissingIdentity,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			app := new(mapp.App)
+			defer app.AssertExpectations(t)
+			if tc.StatusCode != http.StatusBadRequest {
+				app.On("CheckArtifactResume",
+					contextMatcher(),
+					deploymentID,
+					deviceID,
+					resume,
+				).Return(tc.AppErr)
+			}
+
+			ctx := context.Background()
+			if tc.Identity != nil {
+				ctx = identity.WithContext(ctx, tc.Identity)
+			}
+			b, _ := json.Marshal(tc.Body)
+			req, _ := http.NewRequestWithContext(ctx,
+				http.MethodPost,
+				"http://localhost"+strings.Replace(
+					ApiUrlDevicesDownloadResume, "#id", deploymentID, 1),
+				bytes.NewReader(b),
+			)
+			req.Header.Set("Content-Type", "application/json")
+
+			handlers := NewDeploymentsApiHandlers(nil, &view.RESTView{}, app)
+			routes := NewDeploymentsResourceRoutes(handlers)
+			router, _ := rest.MakeRouter(routes...)
+			api := rest.NewApi()
+			api.SetApp(router)
+			w := httptest.NewRecorder()
+			api.MakeHandler().ServeHTTP(w, req)
+
+			assert.Equal(t, tc.StatusCode, w.Code)
+			if tc.Error != nil {
+				var apiErr rest_utils.ApiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				if assert.NoError(t, err) {
+					assert.EqualError(t, &apiErr, tc.Error.Error())
+				}
+			}
+		})
+	}
+}
+
 func TestGetTenantStorageSettings(t *testing.T) {
 	testCases := map[string]struct {
 		tenantID   string
@@ -1718,6 +1899,70 @@ func TestGetTenantStorageSettings(t *testing.T) {
 	}
 }
 
+func TestGetTenantStorageEndpoints(t *testing.T) {
+	testCases := map[string]struct {
+		tenantID   string
+		endpoints  *model.StorageEndpoints
+		err        error
+		httpStatus int
+	}{
+		"ok": {
+			tenantID: "tenant1",
+			endpoints: &model.StorageEndpoints{
+				Client:  "http://minio:9000/bucket",
+				Presign: "https://artifacts.example.com/bucket",
+			},
+			httpStatus: http.StatusOK,
+		},
+		"error/not supported": {
+			tenantID:   "tenant1",
+			err:        storage.ErrEndpointsNotSupported,
+			httpStatus: http.StatusNotImplemented,
+		},
+		"error": {
+			tenantID:   "",
+			err:        errors.New("generic error"),
+			httpStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			app := &mapp.App{}
+			app.On("GetStorageEndpoints",
+				mock.MatchedBy(func(ctx context.Context) bool {
+					id := identity.FromContext(ctx)
+					return id != nil && id.Tenant == tc.tenantID
+				}),
+			).Return(tc.endpoints, tc.err)
+
+			restView := new(view.RESTView)
+			d := NewDeploymentsApiHandlers(nil, restView, app)
+			api := setUpRestTest(
+				ApiUrlInternalTenantStorageEndpoints,
+				rest.Get,
+				d.GetTenantStorageEndpointsHandler,
+			)
+			url := strings.Replace(ApiUrlInternalTenantStorageEndpoints, "#tenant", tc.tenantID, -1)
+			req, _ := http.NewRequest(
+				"GET",
+				"http://localhost"+url,
+				nil,
+			)
+			recorded := test.RunRequest(t, api.MakeHandler(), req)
+			recorded.CodeIs(tc.httpStatus)
+
+			if tc.httpStatus == http.StatusOK {
+				endpoints := &model.StorageEndpoints{}
+				err := json.Unmarshal(recorded.Recorder.Body.Bytes(), endpoints)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.endpoints, endpoints)
+			}
+			app.AssertExpectations(t)
+		})
+	}
+}
+
 func TestPutTenantStorageSettings(t *testing.T) {
 	testCases := map[string]struct {
 		tenantID   string
@@ -65,11 +65,13 @@ const (
 	ApiUrlDevicesDeploymentsNext  = ApiUrlDevices + "/device/deployments/next"
 	ApiUrlDevicesDeploymentStatus = ApiUrlDevices + "/device/deployments/#id/status"
 	ApiUrlDevicesDeploymentsLog   = ApiUrlDevices + "/device/deployments/#id/log"
+	ApiUrlDevicesDownloadResume   = ApiUrlDevices + "/device/deployments/#id/download/resume"
 	ApiUrlDevicesDownloadConfig   = ApiUrlDevices +
 		"/download/configuration/#deployment_id/#device_type/#device_id"
 
 	ApiUrlInternalAlive                    = ApiUrlInternal + "/alive"
 	ApiUrlInternalHealth                   = ApiUrlInternal + "/health"
+	ApiUrlInternalMetrics                  = ApiUrlInternal + "/metrics"
 	ApiUrlInternalTenants                  = ApiUrlInternal + "/tenants"
 	ApiUrlInternalTenantDeployments        = ApiUrlInternal + "/tenants/#tenant/deployments"
 	ApiUrlInternalTenantDeploymentsDevices = ApiUrlInternal + "/tenants/#tenant/deployments/devices"
@@ -78,6 +80,8 @@ const (
 	ApiUrlInternalTenantArtifacts       = ApiUrlInternal + "/tenants/#tenant/artifacts"
 	ApiUrlInternalTenantStorageSettings = ApiUrlInternal +
 		"/tenants/#tenant/storage/settings"
+	ApiUrlInternalTenantStorageEndpoints = ApiUrlInternal +
+		"/tenants/#tenant/storage/endpoints"
 	ApiUrlInternalDeviceConfigurationDeployments = ApiUrlInternal +
 		"/tenants/#tenant/configuration/deployments/#deployment_id/devices/#device_id"
 	ApiUrlInternalDeviceDeploymentLastStatusDeployments = ApiUrlInternal +
@@ -201,6 +205,8 @@ func NewDeploymentsResourceRoutes(controller *DeploymentsApiHandlers) []*rest.Ro
 			controller.PutDeploymentStatusForDevice),
 		rest.Put(ApiUrlDevicesDeploymentsLog,
 			controller.PutDeploymentLogForDevice),
+		rest.Post(ApiUrlDevicesDownloadResume,
+			controller.CheckDownloadResumeForDevice),
 		rest.Get(ApiUrlDevicesDownloadConfig,
 			controller.DownloadConfiguration),
 
@@ -241,6 +247,8 @@ func TenantRoutes(controller *DeploymentsApiHandlers) []*rest.Route {
 		// per-tenant storage settings
 		rest.Get(ApiUrlInternalTenantStorageSettings, controller.GetTenantStorageSettingsHandler),
 		rest.Put(ApiUrlInternalTenantStorageSettings, controller.PutTenantStorageSettingsHandler),
+		rest.Get(ApiUrlInternalTenantStorageEndpoints,
+			controller.GetTenantStorageEndpointsHandler),
 	}
 }
 
@@ -113,6 +113,7 @@ type App interface {
 	// Storage Settings
 	GetStorageSettings(ctx context.Context) (*model.StorageSettings, error)
 	SetStorageSettings(ctx context.Context, storageSettings *model.StorageSettings) error
+	GetStorageEndpoints(ctx context.Context) (*model.StorageEndpoints, error)
 
 	// images
 	ListImages(
@@ -156,6 +157,8 @@ type App interface {
 		deviceID string) (bool, error)
 	UpdateDeviceDeploymentStatus(ctx context.Context, deploymentID string,
 		deviceID string, state model.DeviceDeploymentState) error
+	CheckArtifactResume(ctx context.Context, deploymentID string,
+		deviceID string, req storage.ResumeRequest) error
 	GetDeviceStatusesForDeployment(ctx context.Context,
 		deploymentID string) ([]model.DeviceDeployment, error)
 	GetDevicesListForDeployment(ctx context.Context,
@@ -193,6 +196,7 @@ type Deployments struct {
 	workflowsClient workflows.Client
 	inventoryClient inventory.Client
 	reportingClient reporting.Client
+	timeOrderedIDs  bool
 }
 
 // Compile-time check
@@ -320,11 +324,10 @@ func (d *Deployments) handleArtifact(ctx context.Context,
 
 	tee := io.TeeReader(artifactReader, pW)
 
-	uid, err := uuid.Parse(multipartUploadMsg.ArtifactID)
-	if err != nil {
-		uid, _ = uuid.NewRandom()
+	artifactID := d.newArtifactID()
+	if uid, err := uuid.Parse(multipartUploadMsg.ArtifactID); err == nil {
+		artifactID = uid.String()
 	}
-	artifactID := uid.String()
 
 	ch := make(chan error)
 	// create goroutine for artifact upload
@@ -494,8 +497,7 @@ func (d *Deployments) GenerateConfigurationImage(
 func (d *Deployments) handleRawFile(ctx context.Context,
 	multipartMsg *model.MultipartGenerateImageMsg) (filePath string, err error) {
 	l := log.FromContext(ctx)
-	uid, _ := uuid.NewRandom()
-	artifactID := uid.String()
+	artifactID := d.newArtifactID()
 	multipartMsg.ArtifactID = artifactID
 	filePath = model.ImagePathFromContext(ctx, artifactID+fileSuffixTmp)
 
@@ -671,7 +673,7 @@ func (d *Deployments) EditImage(ctx context.Context, imageID string,
 }
 
 // DownloadLink presigned GET link to download image file.
-// Returns error if image have not been uploaded.
+// Returns nil if the image or the image file does not exist.
 func (d *Deployments) DownloadLink(ctx context.Context, imageID string,
 	expire time.Duration) (*model.Link, error) {
 
@@ -690,7 +692,10 @@ func (d *Deployments) DownloadLink(ctx context.Context, imageID string,
 	}
 	imagePath := model.ImagePathFromContext(ctx, imageID)
 	_, err = d.objectStorage.StatObject(ctx, imagePath)
-	if err != nil {
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		// The image file was removed from the storage.
+		return nil, nil
+	} else if err != nil {
 		return nil, errors.Wrap(err, "Searching for image file")
 	}
 
@@ -717,7 +722,7 @@ func (d *Deployments) UploadLink(
 		return nil, err
 	}
 
-	artifactID := uuid.New().String()
+	artifactID := d.newArtifactID()
 	path := model.ImagePathFromContext(ctx, artifactID) + fileSuffixTmp
 	if skipVerify {
 		path = model.ImagePathFromContext(ctx, artifactID)
@@ -1458,12 +1463,26 @@ func (d *Deployments) getDeploymentInstructions(
 		return nil, err
 	}
 
+	expire, err := deployment.LinkExpire(DefaultUpdateDownloadLinkExpire, time.Now())
+	if errors.Is(err, model.ErrDeploymentDeadlinePassed) {
+		// abort the deployment for the device, so that it does not
+		// receive the expired deployment again
+		if errAbort := d.UpdateDeviceDeploymentStatus(ctx, deviceDeployment.DeploymentId,
+			deviceDeployment.DeviceId, model.DeviceDeploymentState{
+				Status: model.DeviceDeploymentStatusAborted,
+			}); errAbort != nil && errAbort != ErrDeploymentAborted {
+			l.Errorf("failed to abort the expired device deployment: %s", errAbort)
+		}
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
 	imagePath := model.ImagePathFromContext(ctx, deviceDeployment.Image.Id)
-	link, err := d.objectStorage.GetRequest(
+	link, err := d.deviceDownloadLink(
 		ctx,
 		imagePath,
 		deviceDeployment.Image.Name+model.ArtifactFileSuffix,
-		DefaultUpdateDownloadLinkExpire,
+		expire,
 	)
 	if err != nil {
 		return nil, errors.Wrap(err, "Generating download link for the device")
@@ -1475,15 +1494,92 @@ func (d *Deployments) getDeploymentInstructions(
 			ID: deviceDeployment.Image.Id,
 			ArtifactName: deviceDeployment.Image.
 				ArtifactMeta.Name,
-			Source: *link,
+			Source: link.Link,
 			DeviceTypesCompatible: deviceDeployment.Image.
 				ArtifactMeta.DeviceTypesCompatible,
+			ETag: link.ETag,
+			Size: link.Size,
 		},
 	}
 
 	return instructions, nil
 }
 
+type resumableDownloadContextKey struct{}
+
+// ResumableDownloadWithContext makes the deployment instructions returned
+// for the context carry a resumable download link, if the storage supports
+// it. The source of a resumable link must be requested with the header of
+// the link, so devices must opt in explicitly.
+func ResumableDownloadWithContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, resumableDownloadContextKey{}, true)
+}
+
+func ResumableDownloadFromContext(ctx context.Context) bool {
+	resumable, _ := ctx.Value(resumableDownloadContextKey{}).(bool)
+	return resumable
+}
+
+// deviceDownloadLink returns a resumable link for downloading the artifact
+// at imagePath if the device asked for one (see
+// ResumableDownloadWithContext) and the storage supports it, and a plain
+// presigned link without ETag and Size otherwise.
+func (d *Deployments) deviceDownloadLink(
+	ctx context.Context,
+	imagePath, filename string,
+	expire time.Duration,
+) (*storage.ResumableLink, error) {
+	presigner, ok := d.objectStorage.(storage.ResumablePresigner)
+	if ok && ResumableDownloadFromContext(ctx) {
+		link, err := presigner.PresignResumable(ctx, imagePath, storage.PresignOptions{
+			Expire:   expire,
+			Filename: filename,
+		})
+		if err == nil {
+			return link, nil
+		} else if !errors.Is(err, storage.ErrResumeNotSupported) {
+			return nil, err
+		}
+	}
+	link, err := d.objectStorage.GetRequest(ctx, imagePath, filename, expire)
+	if err != nil {
+		return nil, err
+	}
+	return &storage.ResumableLink{Link: *link}, nil
+}
+
+// CheckArtifactResume checks whether the device can resume the partial
+// download of the artifact of deployment deploymentID described by req.
+// It returns storage.ErrObjectChanged if the artifact was replaced since
+// the device started the download, and storage.ErrInvalidRange if the
+// offset is not within the artifact.
+func (d *Deployments) CheckArtifactResume(ctx context.Context, deploymentID string,
+	deviceID string, req storage.ResumeRequest) error {
+
+	dd, err := d.db.GetDeviceDeployment(ctx, deploymentID, deviceID, false)
+	if err == mongo.ErrStorageNotFound {
+		return ErrStorageNotFound
+	} else if err != nil {
+		return err
+	}
+	if dd.Status == model.DeviceDeploymentStatusAborted {
+		return ErrDeploymentAborted
+	} else if dd.Image == nil {
+		return ErrStorageNotFound
+	}
+
+	ctx, err = d.contextWithStorageSettings(ctx)
+	if err != nil {
+		return err
+	}
+	err = storage.CheckResume(ctx, d.objectStorage,
+		model.ImagePathFromContext(ctx, dd.Image.Id), req)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return errors.Wrap(storage.ErrObjectChanged, err.Error())
+	}
+	return err
+}
+
 func (d *Deployments) saveDeviceDeploymentRequest(ctx context.Context, deviceID string,
 	deviceDeployment *model.DeviceDeployment, request *model.DeploymentNextRequest) error {
 	if deviceDeployment.Request != nil {
@@ -1982,6 +2078,30 @@ func (d *Deployments) GetStorageSettings(ctx context.Context) (*model.StorageSet
 	return settings, nil
 }
 
+// GetStorageEndpoints returns the endpoints resolved by the object storage
+// for the storage settings of the tenant, for diagnosing misconfigured
+// storage endpoints.
+func (d *Deployments) GetStorageEndpoints(
+	ctx context.Context,
+) (*model.StorageEndpoints, error) {
+	resolver, ok := d.objectStorage.(storage.EndpointResolver)
+	if !ok {
+		return nil, storage.ErrEndpointsNotSupported
+	}
+	ctx, err := d.contextWithStorageSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client, presign, err := resolver.ResolvedEndpoints(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to resolve the storage endpoints")
+	}
+	return &model.StorageEndpoints{
+		Client:  client,
+		Presign: presign,
+	}, nil
+}
+
 func (d *Deployments) SetStorageSettings(
 	ctx context.Context,
 	storageSettings *model.StorageSettings,
@@ -2006,6 +2126,24 @@ func (d *Deployments) WithReporting(c reporting.Client) *Deployments {
 	return d
 }
 
+// WithTimeOrderedIDs names new artifacts with time-ordered (version 7)
+// UUIDs instead of random (version 4) UUIDs, such that the storage can
+// partition the artifacts by their creation date.
+func (d *Deployments) WithTimeOrderedIDs() *Deployments {
+	d.timeOrderedIDs = true
+	return d
+}
+
+// newArtifactID returns the ID of a new artifact.
+func (d *Deployments) newArtifactID() string {
+	if d.timeOrderedIDs {
+		if id, err := uuid.NewV7(); err == nil {
+			return id.String()
+		}
+	}
+	return uuid.NewString()
+}
+
 func (d *Deployments) haveReporting() bool {
 	return d.reportingClient != nil
 }
@@ -17,8 +17,12 @@ package app
 import (
 	"context"
 	"path"
+	"strings"
 	"time"
 
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/pkg/errors"
+
 	"github.com/mendersoftware/deployments/model"
 	"github.com/mendersoftware/deployments/storage"
 	"github.com/mendersoftware/deployments/store"
@@ -53,7 +57,7 @@ func (d *Deployments) cleanupExpiredLink(
 			objectPath = path.Join(link.TenantID, objectPath)
 		}
 		err = d.objectStorage.DeleteObject(ctx, objectPath)
-		if err != nil && err != storage.ErrObjectNotFound {
+		if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
 			break
 		}
 		statusNew := link.Status
@@ -127,3 +131,167 @@ func (d *Deployments) CleanupExpiredUploads(
 	}
 	return err
 }
+
+// ReconcileOptions are the options of Reconcile.
+type ReconcileOptions struct {
+	// Delete deletes the orphaned objects; otherwise they are reported
+	// only (dry run).
+	Delete bool
+	// MinAge is the minimum age of the objects and images considered,
+	// so that artifacts uploaded while reconciling, which are stored
+	// before their image is created, are not reported.
+	MinAge time.Duration
+}
+
+// ReconcileObject is an object without an image in the database.
+type ReconcileObject struct {
+	Path         string     `json:"path"`
+	Size         *int64     `json:"size,omitempty"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+}
+
+// ReconcileReport is the result of Reconcile.
+type ReconcileReport struct {
+	TenantID string `json:"tenant_id,omitempty"`
+	DryRun   bool   `json:"dry_run"`
+
+	ObjectsScanned int `json:"objects_scanned"`
+	ImagesScanned  int `json:"images_scanned"`
+
+	// OrphanedObjects are the artifact objects without an image.
+	OrphanedObjects []ReconcileObject `json:"orphaned_objects"`
+	// DeletedObjects is the number of orphaned objects deleted.
+	DeletedObjects int `json:"deleted_objects"`
+	// DanglingImages are the IDs of the images without an artifact
+	// object; the images are never modified.
+	DanglingImages []string `json:"dangling_images"`
+}
+
+// Reconcile compares the artifact objects of the tenant in the context with
+// the images in the database, reporting the objects without an image and
+// the images without an object; with the Delete option, the orphaned
+// objects are deleted. The objects are listed a page at a time and merged
+// with the images sorted by ID, so the memory used does not depend on the
+// number of artifacts. Objects other than artifacts, such as pending
+// uploads, are ignored.
+func (d *Deployments) Reconcile(
+	ctx context.Context,
+	opts ReconcileOptions,
+) (*ReconcileReport, error) {
+	ctx, err := d.contextWithStorageSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	walker, ok := d.objectStorage.(storage.ObjectWalker)
+	if !ok {
+		return nil, storage.ErrListingNotSupported
+	}
+	report := &ReconcileReport{
+		DryRun:          !opts.Delete,
+		OrphanedObjects: []ReconcileObject{},
+		DanglingImages:  []string{},
+	}
+	if id := identity.FromContext(ctx); id != nil {
+		report.TenantID = id.Tenant
+	}
+	prefix := model.ImagePathFromContext(ctx, "")
+	if prefix != "" {
+		prefix += "/"
+	}
+	cutoff := time.Now().Add(-opts.MinAge)
+
+	it, err := d.db.FindImageIDs(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to scan images")
+	}
+	defer it.Close(ctx)
+	var (
+		image model.Image
+		more  bool
+	)
+	nextImage := func() (err error) {
+		more, err = it.Next(ctx)
+		if more && err == nil {
+			image = model.Image{}
+			err = it.Decode(&image)
+			report.ImagesScanned++
+		}
+		if err != nil {
+			err = errors.Wrap(err, "failed to scan images")
+		}
+		return err
+	}
+	danglingImage := func() error {
+		if image.Modified != nil && image.Modified.After(cutoff) {
+			return nil
+		}
+		// Confirm that the object is missing, the object may have been
+		// uploaded after it was listed.
+		_, err := d.objectStorage.StatObject(ctx,
+			model.ImagePathFromContext(ctx, image.Id))
+		switch {
+		case errors.Is(err, storage.ErrObjectNotFound):
+			report.DanglingImages = append(report.DanglingImages, image.Id)
+		case err != nil:
+			return errors.Wrapf(err, "failed to check object of image %s", image.Id)
+		}
+		return nil
+	}
+	if err = nextImage(); err != nil {
+		return nil, err
+	}
+
+	err = walker.WalkObjects(ctx, prefix, 0, func(obj *storage.ObjectInfo) error {
+		name := strings.TrimPrefix(obj.Path, prefix)
+		if name == "" || strings.Contains(name, "/") ||
+			strings.HasSuffix(name, fileSuffixTmp) {
+			// Not an artifact: pending uploads and the objects
+			// of other tenants.
+			return nil
+		}
+		report.ObjectsScanned++
+		for more && image.Id < name {
+			if err := danglingImage(); err != nil {
+				return err
+			}
+			if err := nextImage(); err != nil {
+				return err
+			}
+		}
+		if more && image.Id == name {
+			return nextImage()
+		}
+		if obj.LastModified != nil && obj.LastModified.After(cutoff) {
+			return nil
+		}
+		// Never delete the object of an image, even if the storage
+		// lists the objects in a different order than the images.
+		if exists, err := d.db.Exists(ctx, name); err != nil {
+			return errors.Wrapf(err, "failed to check image of object %s", obj.Path)
+		} else if exists {
+			return nil
+		}
+		report.OrphanedObjects = append(report.OrphanedObjects, ReconcileObject{
+			Path:         obj.Path,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+		})
+		if opts.Delete {
+			err := d.objectStorage.DeleteObject(ctx, obj.Path)
+			if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+				return errors.Wrapf(err, "failed to delete object %s", obj.Path)
+			}
+			report.DeletedObjects++
+		}
+		return nil
+	})
+	for err == nil && more {
+		if err = danglingImage(); err == nil {
+			err = nextImage()
+		}
+	}
+	if err != nil {
+		return report, err
+	}
+	return report, nil
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
@@ -26,6 +27,7 @@ import (
 	mstorage "github.com/mendersoftware/deployments/storage/mocks"
 	"github.com/mendersoftware/deployments/store"
 	mstore "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/go-lib-micro/identity"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -262,3 +264,165 @@ func TestCleanupExpiredUploads(t *testing.T) {
 		assert.ErrorIs(t, err, errInternal)
 	})
 }
+
+// walkingObjectStorage lists the objects for storage.ObjectWalker.
+type walkingObjectStorage struct {
+	*mstorage.ObjectStorage
+	objects []storage.ObjectInfo
+}
+
+func (s walkingObjectStorage) WalkObjects(
+	ctx context.Context,
+	prefix string,
+	maxKeys int,
+	fn func(*storage.ObjectInfo) error,
+) error {
+	for i := range s.objects {
+		if !strings.HasPrefix(s.objects[i].Path, prefix) {
+			continue
+		}
+		if err := fn(&s.objects[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestReconcile(t *testing.T) {
+	t.Parallel()
+
+	const tenantID = "123456789012345678901234"
+	var (
+		old    = time.Now().Add(-time.Hour * 48)
+		recent = time.Now().Add(-time.Minute)
+	)
+	object := func(name string, modified time.Time) storage.ObjectInfo {
+		size := int64(1024)
+		return storage.ObjectInfo{
+			Path:         path.Join(tenantID, name),
+			Size:         &size,
+			LastModified: &modified,
+		}
+	}
+	objects := []storage.ObjectInfo{
+		object("a", old),
+		object("b", old),
+		object("c.tmp", old),
+		object("d", recent),
+		object("e", old),
+		object("other/x", old),
+	}
+	images := func() store.Iterator[model.Image] {
+		return NewArrayIterator([]model.Image{
+			{Id: "a", Modified: &old},
+			{Id: "c", Modified: &old},
+			{Id: "f", Modified: &recent},
+			{Id: "g", Modified: &old},
+		})
+	}
+
+	testCases := []struct {
+		Name string
+
+		Options ReconcileOptions
+		Walker  bool
+
+		Report *ReconcileReport
+		Error  error
+	}{{
+		Name: "ok/dry run",
+
+		Options: ReconcileOptions{MinAge: time.Hour},
+		Walker:  true,
+
+		Report: &ReconcileReport{
+			TenantID:       tenantID,
+			DryRun:         true,
+			ObjectsScanned: 4,
+			ImagesScanned:  4,
+			OrphanedObjects: []ReconcileObject{{
+				Path:         objects[1].Path,
+				Size:         objects[1].Size,
+				LastModified: objects[1].LastModified,
+			}},
+			DanglingImages: []string{"c"},
+		},
+	}, {
+		Name: "ok/delete",
+
+		Options: ReconcileOptions{Delete: true, MinAge: time.Hour},
+		Walker:  true,
+
+		Report: &ReconcileReport{
+			TenantID:       tenantID,
+			ObjectsScanned: 4,
+			ImagesScanned:  4,
+			OrphanedObjects: []ReconcileObject{{
+				Path:         objects[1].Path,
+				Size:         objects[1].Size,
+				LastModified: objects[1].LastModified,
+			}},
+			DeletedObjects: 1,
+			DanglingImages: []string{"c"},
+		},
+	}, {
+		Name: "error/listing not supported",
+
+		Error: storage.ErrListingNotSupported,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ctx := identity.WithContext(context.Background(), &identity.Identity{
+				Tenant: tenantID,
+			})
+			database := new(mstore.DataStore)
+			objectStore := new(mstorage.ObjectStorage)
+			defer database.AssertExpectations(t)
+			defer objectStore.AssertExpectations(t)
+
+			database.On("GetStorageSettings", mock.Anything).
+				Return(nil, nil).
+				Once()
+			var objStorage storage.ObjectStorage = objectStore
+			if tc.Walker {
+				objStorage = walkingObjectStorage{
+					ObjectStorage: objectStore,
+					objects:       objects,
+				}
+				database.On("FindImageIDs", mock.Anything).
+					Return(images(), nil).
+					Once()
+				// "e" was created after the images were scanned.
+				database.On("Exists", mock.Anything, "b").
+					Return(false, nil).
+					Once()
+				database.On("Exists", mock.Anything, "e").
+					Return(true, nil).
+					Once()
+				// The object of "g" was uploaded after the objects
+				// were listed.
+				objectStore.On("StatObject", mock.Anything, path.Join(tenantID, "c")).
+					Return(nil, storage.ErrObjectNotFound).
+					Once()
+				objectStore.On("StatObject", mock.Anything, path.Join(tenantID, "g")).
+					Return(&storage.ObjectInfo{}, nil).
+					Once()
+			}
+			if tc.Options.Delete {
+				objectStore.On("DeleteObject", mock.Anything, objects[1].Path).
+					Return(nil).
+					Once()
+			}
+
+			app := NewDeployments(database, objStorage)
+			report, err := app.Reconcile(ctx, tc.Options)
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tc.Report, report)
+			}
+		})
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -564,6 +565,521 @@ func TestUploadLink(t *testing.T) {
 	})
 }
 
+func TestNewArtifactID(t *testing.T) {
+	t.Parallel()
+
+	deploy := NewDeployments(nil, nil)
+	id, err := uuid.Parse(deploy.newArtifactID())
+	if assert.NoError(t, err) {
+		assert.Equal(t, uuid.Version(4), id.Version())
+	}
+
+	deploy = deploy.WithTimeOrderedIDs()
+	before := time.Now()
+	id, err = uuid.Parse(deploy.newArtifactID())
+	if assert.NoError(t, err) {
+		assert.Equal(t, uuid.Version(7), id.Version())
+		sec, nsec := id.Time().UnixTime()
+		assert.WithinDuration(t, before, time.Unix(sec, nsec), time.Second)
+	}
+}
+
+func TestDownloadLink(t *testing.T) {
+	t.Parallel()
+
+	const imageID = "a2a6bd58-6a79-4ae3-98e3-a8f77e2c0c30"
+	image := &model.Image{
+		Id: imageID,
+		ImageMeta: &model.ImageMeta{
+			Description: "imagine artifacts",
+		},
+		ArtifactMeta: &model.ArtifactMeta{
+			Name: "release-1",
+		},
+	}
+	link := &model.Link{
+		Uri:    "http://localhost:8080",
+		Method: "GET",
+		Expire: time.Now().Add(time.Hour),
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		ctx := context.Background()
+		objStore := new(fs_mocks.ObjectStorage)
+		ds := new(mocks.DataStore)
+		deploy := NewDeployments(ds, objStore)
+		ds.On("FindImageByID", ctx, imageID).
+			Return(image, nil).
+			Once().
+			On("GetStorageSettings", ctx).
+			Return(nil, nil).
+			Once()
+		objStore.On("StatObject", h.ContextMatcher(), imageID).
+			Return(&storage.ObjectInfo{Path: imageID}, nil).
+			Once().
+			On("GetRequest",
+				h.ContextMatcher(),
+				imageID,
+				"release-1"+model.ArtifactFileSuffix,
+				time.Minute,
+			).
+			Return(link, nil).
+			Once()
+
+		res, err := deploy.DownloadLink(ctx, imageID, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, link, res)
+		objStore.AssertExpectations(t)
+		ds.AssertExpectations(t)
+	})
+
+	t.Run("ok/image file not found", func(t *testing.T) {
+		ctx := context.Background()
+		objStore := new(fs_mocks.ObjectStorage)
+		ds := new(mocks.DataStore)
+		deploy := NewDeployments(ds, objStore)
+		ds.On("FindImageByID", ctx, imageID).
+			Return(image, nil).
+			Once().
+			On("GetStorageSettings", ctx).
+			Return(nil, nil).
+			Once()
+		objStore.On("StatObject", h.ContextMatcher(), imageID).
+			Return(nil, errors.Wrap(storage.ErrObjectNotFound, "s3")).
+			Once()
+
+		res, err := deploy.DownloadLink(ctx, imageID, time.Minute)
+		assert.NoError(t, err)
+		assert.Nil(t, res)
+		objStore.AssertExpectations(t)
+		ds.AssertExpectations(t)
+	})
+
+	t.Run("error/stat image file", func(t *testing.T) {
+		ctx := context.Background()
+		objStore := new(fs_mocks.ObjectStorage)
+		ds := new(mocks.DataStore)
+		deploy := NewDeployments(ds, objStore)
+		errInternal := errors.New("internal error")
+		ds.On("FindImageByID", ctx, imageID).
+			Return(image, nil).
+			Once().
+			On("GetStorageSettings", ctx).
+			Return(nil, nil).
+			Once()
+		objStore.On("StatObject", h.ContextMatcher(), imageID).
+			Return(nil, errInternal).
+			Once()
+
+		res, err := deploy.DownloadLink(ctx, imageID, time.Minute)
+		assert.ErrorIs(t, err, errInternal)
+		assert.Nil(t, res)
+		objStore.AssertExpectations(t)
+		ds.AssertExpectations(t)
+	})
+}
+
+// resumableObjectStorage signs resumable links for
+// storage.ResumablePresigner.
+type resumableObjectStorage struct {
+	*fs_mocks.ObjectStorage
+}
+
+func (s resumableObjectStorage) PresignResumable(
+	ctx context.Context,
+	path string,
+	opts storage.PresignOptions,
+) (*storage.ResumableLink, error) {
+	ret := s.Called(ctx, path, opts)
+	link, _ := ret.Get(0).(*storage.ResumableLink)
+	return link, ret.Error(1)
+}
+
+func TestDeploymentInstructionsDownloadLink(t *testing.T) {
+	t.Parallel()
+
+	const imageID = "a2a6bd58-6a79-4ae3-98e3-a8f77e2c0c30"
+	deployment := &model.Deployment{
+		Id:                    validUUIDv4,
+		DeploymentConstructor: &model.DeploymentConstructor{},
+	}
+	newDeviceDeployment := func() *model.DeviceDeployment {
+		dd := model.NewDeviceDeployment("device", validUUIDv4)
+		dd.Status = model.DeviceDeploymentStatusDownloading
+		dd.Image = &model.Image{
+			Id: imageID,
+			ArtifactMeta: &model.ArtifactMeta{
+				Name:                  "release-2",
+				DeviceTypesCompatible: []string{"rpi"},
+			},
+		}
+		return dd
+	}
+	request := &model.DeploymentNextRequest{
+		DeviceProvides: &model.InstalledDeviceDeployment{
+			ArtifactName: "release-1",
+			DeviceType:   "rpi",
+		},
+	}
+	link := model.Link{
+		Uri:    "http://localhost:8080",
+		Method: "GET",
+		Expire: time.Now().Add(time.Hour),
+	}
+	resumableLink := &storage.ResumableLink{
+		Link: model.Link{
+			Uri:    link.Uri,
+			Method: link.Method,
+			Expire: link.Expire,
+			Header: map[string]string{"If-Match": `"abc"`},
+		},
+		ETag: `"abc"`,
+		Size: 1024,
+	}
+	presignOptions := storage.PresignOptions{
+		Expire:   DefaultUpdateDownloadLinkExpire,
+		Filename: "release-2" + model.ArtifactFileSuffix,
+	}
+	errInternal := errors.New("internal error")
+
+	testCases := []struct {
+		Name string
+
+		Resumable       bool
+		ResumeRequested bool
+		Setup           func(objStore *fs_mocks.ObjectStorage)
+
+		Artifact model.ArtifactDeploymentInstructions
+		Error    error
+	}{{
+		Name: "ok/resumable",
+
+		Resumable:       true,
+		ResumeRequested: true,
+		Setup: func(objStore *fs_mocks.ObjectStorage) {
+			objStore.On("PresignResumable",
+				h.ContextMatcher(), imageID, presignOptions).
+				Return(resumableLink, nil).
+				Once()
+		},
+
+		Artifact: model.ArtifactDeploymentInstructions{
+			ID:                    imageID,
+			ArtifactName:          "release-2",
+			Source:                resumableLink.Link,
+			DeviceTypesCompatible: []string{"rpi"},
+			ETag:                  `"abc"`,
+			Size:                  1024,
+		},
+	}, {
+		Name: "ok/resume not supported",
+
+		Resumable:       true,
+		ResumeRequested: true,
+		Setup: func(objStore *fs_mocks.ObjectStorage) {
+			objStore.On("PresignResumable",
+				h.ContextMatcher(), imageID, presignOptions).
+				Return(nil, storage.ErrResumeNotSupported).
+				Once().
+				On("GetRequest",
+					h.ContextMatcher(),
+					imageID,
+					"release-2"+model.ArtifactFileSuffix,
+					DefaultUpdateDownloadLinkExpire,
+				).
+				Return(&link, nil).
+				Once()
+		},
+
+		Artifact: model.ArtifactDeploymentInstructions{
+			ID:                    imageID,
+			ArtifactName:          "release-2",
+			Source:                link,
+			DeviceTypesCompatible: []string{"rpi"},
+		},
+	}, {
+		Name: "ok/resume not requested",
+
+		Resumable: true,
+		Setup: func(objStore *fs_mocks.ObjectStorage) {
+			objStore.On("GetRequest",
+				h.ContextMatcher(),
+				imageID,
+				"release-2"+model.ArtifactFileSuffix,
+				DefaultUpdateDownloadLinkExpire,
+			).
+				Return(&link, nil).
+				Once()
+		},
+
+		Artifact: model.ArtifactDeploymentInstructions{
+			ID:                    imageID,
+			ArtifactName:          "release-2",
+			Source:                link,
+			DeviceTypesCompatible: []string{"rpi"},
+		},
+	}, {
+		Name: "ok/not a resumable presigner",
+
+		ResumeRequested: true,
+		Setup: func(objStore *fs_mocks.ObjectStorage) {
+			objStore.On("GetRequest",
+				h.ContextMatcher(),
+				imageID,
+				"release-2"+model.ArtifactFileSuffix,
+				DefaultUpdateDownloadLinkExpire,
+			).
+				Return(&link, nil).
+				Once()
+		},
+
+		Artifact: model.ArtifactDeploymentInstructions{
+			ID:                    imageID,
+			ArtifactName:          "release-2",
+			Source:                link,
+			DeviceTypesCompatible: []string{"rpi"},
+		},
+	}, {
+		Name: "error/presign resumable",
+
+		Resumable:       true,
+		ResumeRequested: true,
+		Setup: func(objStore *fs_mocks.ObjectStorage) {
+			objStore.On("PresignResumable",
+				h.ContextMatcher(), imageID, presignOptions).
+				Return(nil, errInternal).
+				Once()
+		},
+
+		Error: errInternal,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			if tc.ResumeRequested {
+				ctx = ResumableDownloadWithContext(ctx)
+			}
+			objStore := new(fs_mocks.ObjectStorage)
+			defer objStore.AssertExpectations(t)
+			ds := new(mocks.DataStore)
+			defer ds.AssertExpectations(t)
+			ds.On("GetStorageSettings", ctx).
+				Return(nil, nil).
+				Once()
+			tc.Setup(objStore)
+
+			var objStorage storage.ObjectStorage = objStore
+			if tc.Resumable {
+				objStorage = resumableObjectStorage{ObjectStorage: objStore}
+			}
+			deploy := NewDeployments(ds, objStorage)
+
+			instructions, err := deploy.getDeploymentInstructions(
+				ctx, deployment, newDeviceDeployment(), request)
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+				assert.Nil(t, instructions)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, &model.DeploymentInstructions{
+					ID:       validUUIDv4,
+					Artifact: tc.Artifact,
+				}, instructions)
+			}
+		})
+	}
+}
+
+func TestDeploymentInstructionsDeadlinePassed(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	deadline := time.Now().Add(-time.Minute)
+	deployment := &model.Deployment{
+		Id: validUUIDv4,
+		DeploymentConstructor: &model.DeploymentConstructor{
+			Deadline: &deadline,
+		},
+	}
+	deviceDeployment := model.NewDeviceDeployment("device", validUUIDv4)
+	deviceDeployment.Status = model.DeviceDeploymentStatusPending
+	deviceDeployment.Image = &model.Image{
+		Id: "a2a6bd58-6a79-4ae3-98e3-a8f77e2c0c30",
+		ArtifactMeta: &model.ArtifactMeta{
+			Name:                  "release-2",
+			DeviceTypesCompatible: []string{"rpi"},
+		},
+	}
+	request := &model.DeploymentNextRequest{
+		DeviceProvides: &model.InstalledDeviceDeployment{
+			ArtifactName: "release-1",
+			DeviceType:   "rpi",
+		},
+	}
+
+	objStore := new(fs_mocks.ObjectStorage)
+	defer objStore.AssertExpectations(t)
+	ds := new(mocks.DataStore)
+	defer ds.AssertExpectations(t)
+	ds.On("GetStorageSettings", ctx).
+		Return(nil, nil).
+		Once().
+		On("GetDeviceDeployment", h.ContextMatcher(), validUUIDv4, "device", false).
+		Return(deviceDeployment, nil).
+		Once().
+		On("UpdateDeviceDeploymentStatus", h.ContextMatcher(), "device", validUUIDv4,
+			mock.MatchedBy(func(state model.DeviceDeploymentState) bool {
+				return state.Status == model.DeviceDeploymentStatusAborted &&
+					state.FinishTime != nil
+			})).
+		Return(model.DeviceDeploymentStatusPending, nil).
+		Once().
+		On("UpdateStatsInc", h.ContextMatcher(), validUUIDv4,
+			model.DeviceDeploymentStatusPending,
+			model.DeviceDeploymentStatusAborted).
+		Return(nil).
+		Once().
+		On("FindDeploymentByID", h.ContextMatcher(), validUUIDv4).
+		Return(deployment, nil).
+		Once().
+		On("SetDeploymentStatus", h.ContextMatcher(), validUUIDv4,
+			mock.AnythingOfType("model.DeploymentStatus"),
+			mock.AnythingOfType("time.Time")).
+		Return(nil).
+		Once().
+		On("SaveLastDeviceDeploymentStatus", h.ContextMatcher(),
+			mock.AnythingOfType("model.DeviceDeployment")).
+		Return(nil).
+		Once()
+	deploy := NewDeployments(ds, objStore)
+
+	instructions, err := deploy.getDeploymentInstructions(
+		ctx, deployment, deviceDeployment, request)
+	assert.ErrorIs(t, err, model.ErrDeploymentDeadlinePassed)
+	assert.Nil(t, instructions)
+}
+
+func TestCheckArtifactResume(t *testing.T) {
+	t.Parallel()
+
+	const (
+		imageID  = "a2a6bd58-6a79-4ae3-98e3-a8f77e2c0c30"
+		deviceID = "device"
+	)
+	newDeviceDeployment := func(status model.DeviceDeploymentStatus) *model.DeviceDeployment {
+		dd := model.NewDeviceDeployment(deviceID, validUUIDv4)
+		dd.Status = status
+		dd.Image = &model.Image{Id: imageID}
+		return dd
+	}
+	etag, size := `"abc"`, int64(1024)
+	info := &storage.ObjectInfo{
+		Path: imageID,
+		ETag: &etag,
+		Size: &size,
+	}
+	req := storage.ResumeRequest{ETag: `"abc"`, Size: 1024, Offset: 512}
+	errInternal := errors.New("internal error")
+
+	testCases := []struct {
+		Name string
+
+		Request          storage.ResumeRequest
+		DeviceDeployment *model.DeviceDeployment
+		DataStoreErr     error
+		ObjectInfo       *storage.ObjectInfo
+		StatErr          error
+
+		Error error
+	}{{
+		Name: "ok",
+
+		Request:          req,
+		DeviceDeployment: newDeviceDeployment(model.DeviceDeploymentStatusDownloading),
+		ObjectInfo:       info,
+	}, {
+		Name: "error/artifact changed",
+
+		Request: storage.ResumeRequest{ETag: `"def"`, Size: 1024, Offset: 512},
+		DeviceDeployment: newDeviceDeployment(
+			model.DeviceDeploymentStatusDownloading),
+		ObjectInfo: info,
+
+		Error: storage.ErrObjectChanged,
+	}, {
+		Name: "error/artifact deleted",
+
+		Request:          req,
+		DeviceDeployment: newDeviceDeployment(model.DeviceDeploymentStatusDownloading),
+		StatErr:          errors.Wrap(storage.ErrObjectNotFound, "s3"),
+
+		Error: storage.ErrObjectChanged,
+	}, {
+		Name: "error/offset out of range",
+
+		Request: storage.ResumeRequest{ETag: `"abc"`, Size: 1024, Offset: 1024},
+		DeviceDeployment: newDeviceDeployment(
+			model.DeviceDeploymentStatusDownloading),
+		ObjectInfo: info,
+
+		Error: storage.ErrInvalidRange,
+	}, {
+		Name: "error/deployment aborted",
+
+		Request:          req,
+		DeviceDeployment: newDeviceDeployment(model.DeviceDeploymentStatusAborted),
+
+		Error: ErrDeploymentAborted,
+	}, {
+		Name: "error/no artifact assigned",
+
+		Request:          req,
+		DeviceDeployment: model.NewDeviceDeployment(deviceID, validUUIDv4),
+
+		Error: ErrStorageNotFound,
+	}, {
+		Name: "error/datastore",
+
+		Request:      req,
+		DataStoreErr: errInternal,
+
+		Error: errInternal,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			objStore := new(fs_mocks.ObjectStorage)
+			defer objStore.AssertExpectations(t)
+			ds := new(mocks.DataStore)
+			defer ds.AssertExpectations(t)
+			ds.On("GetDeviceDeployment", ctx, validUUIDv4, deviceID, false).
+				Return(tc.DeviceDeployment, tc.DataStoreErr).
+				Once()
+			if tc.ObjectInfo != nil || tc.StatErr != nil {
+				ds.On("GetStorageSettings", ctx).
+					Return(nil, nil).
+					Once()
+				objStore.On("StatObject", h.ContextMatcher(), imageID).
+					Return(tc.ObjectInfo, tc.StatErr).
+					Once()
+			}
+			deploy := NewDeployments(ds, objStore)
+
+			err := deploy.CheckArtifactResume(ctx, validUUIDv4, deviceID, tc.Request)
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
 type eofReadCloser struct {
 	ch   chan struct{}
 	once *sync.Once
@@ -24,6 +24,8 @@ import (
 
 	model "github.com/mendersoftware/deployments/model"
 
+	storage "github.com/mendersoftware/deployments/storage"
+
 	store "github.com/mendersoftware/deployments/store"
 
 	time "time"
@@ -62,6 +64,20 @@ func (_m *App) AbortDeviceDeployments(ctx context.Context, deviceID string) erro
 	return r0
 }
 
+// CheckArtifactResume provides a mock function with given fields: ctx, deploymentID, deviceID, req
+func (_m *App) CheckArtifactResume(ctx context.Context, deploymentID string, deviceID string, req storage.ResumeRequest) error {
+	ret := _m.Called(ctx, deploymentID, deviceID, req)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, storage.ResumeRequest) error); ok {
+		r0 = rf(ctx, deploymentID, deviceID, req)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // CompleteUpload provides a mock function with given fields: ctx, intentID, skipVerify
 func (_m *App) CompleteUpload(ctx context.Context, intentID string, skipVerify bool) error {
 	ret := _m.Called(ctx, intentID, skipVerify)
@@ -564,6 +580,29 @@ func (_m *App) GetStorageSettings(ctx context.Context) (*model.StorageSettings,
 	return r0, r1
 }
 
+// GetStorageEndpoints provides a mock function with given fields: ctx
+func (_m *App) GetStorageEndpoints(ctx context.Context) (*model.StorageEndpoints, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *model.StorageEndpoints
+	if rf, ok := ret.Get(0).(func(context.Context) *model.StorageEndpoints); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.StorageEndpoints)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // HasDeploymentForDevice provides a mock function with given fields: ctx, deploymentID, deviceID
 func (_m *App) HasDeploymentForDevice(ctx context.Context, deploymentID string, deviceID string) (bool, error) {
 	ret := _m.Called(ctx, deploymentID, deviceID)
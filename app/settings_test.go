@@ -153,3 +153,81 @@ func TestSetStorageSettings(t *testing.T) {
 		})
 	}
 }
+
+type endpointsObjectStorage struct {
+	*storageMocks.ObjectStorage
+}
+
+func (endpointsObjectStorage) ResolvedEndpoints(
+	ctx context.Context,
+) (string, string, error) {
+	settings, _ := storage.SettingsFromContext(ctx)
+	if settings == nil {
+		return "https://default.example.com", "https://default.example.com", nil
+	}
+	return settings.Uri, settings.ExternalUri, nil
+}
+
+func TestGetStorageEndpoints(t *testing.T) {
+	settings := &model.StorageSettings{
+		Region:      "region",
+		Key:         "secretkey",
+		Secret:      "secret",
+		Bucket:      "bucket",
+		Uri:         "https://example.com",
+		ExternalUri: "https://external.example.com",
+	}
+	testCases := map[string]struct {
+		settings      *model.StorageSettings
+		dbErr         error
+		objectStorage storage.ObjectStorage
+
+		endpoints *model.StorageEndpoints
+		err       error
+	}{
+		"ok": {
+			objectStorage: endpointsObjectStorage{},
+			endpoints: &model.StorageEndpoints{
+				Client:  "https://default.example.com",
+				Presign: "https://default.example.com",
+			},
+		},
+		"ok/storage settings": {
+			settings:      settings,
+			objectStorage: endpointsObjectStorage{},
+			endpoints: &model.StorageEndpoints{
+				Client:  "https://example.com",
+				Presign: "https://external.example.com",
+			},
+		},
+		"error/not supported": {
+			objectStorage: new(storageMocks.ObjectStorage),
+			err:           storage.ErrEndpointsNotSupported,
+		},
+		"error/storage settings": {
+			dbErr:         errors.New("generic error"),
+			objectStorage: endpointsObjectStorage{},
+			err:           errors.New("generic error"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db := mocks.DataStore{}
+			db.On("GetStorageSettings",
+				mock.MatchedBy(func(ctx context.Context) bool { return true }),
+			).Return(tc.settings, tc.dbErr)
+			ds := &Deployments{
+				db:            &db,
+				objectStorage: tc.objectStorage,
+			}
+
+			endpoints, err := ds.GetStorageEndpoints(context.Background())
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tc.endpoints, endpoints)
+			}
+		})
+	}
+}
@@ -60,14 +60,74 @@ const (
 	SettingsAws                       = "aws"
 	SettingAwsS3Region                = SettingsAws + ".region"
 	SettingAwsS3RegionDefault         = "us-east-1"
+	SettingAwsS3SigningRegion         = SettingsAws + ".signing_region"
+	SettingAwsSignatureVersion        = SettingsAws + ".signature_version"
+	SettingAwsS3KeyPrefix             = SettingsAws + ".key_prefix"
+	SettingAwsKeyStrategy             = SettingsAws + ".key_strategy"
 	SettingAwsS3ForcePathStyle        = SettingsAws + ".force_path_style"
 	SettingAwsS3ForcePathStyleDefault = true
 	SettingAwsS3UseAccelerate         = SettingsAws + ".use_accelerate"
 	SettingAwsS3UseAccelerateDefault  = false
+	SettingAwsAccelerateFallback      = SettingsAws + ".accelerate_fallback"
+	SettingAwsS3UseDualStack          = SettingsAws + ".use_dual_stack"
+	SettingAwsS3UseDualStackDefault   = false
 	SettingAwsURI                     = SettingsAws + ".uri"
+	SettingAwsProvider                = SettingsAws + ".provider"
+	SettingAwsDiscoveryURL            = SettingsAws + ".discovery_url"
+	SettingAwsDiscoveryInterval       = SettingsAws + ".discovery_interval"
 	SettingAwsExternalURI             = SettingsAws + ".external_uri"
 	SettingAwsUnsignedHeaders         = SettingsAws + ".unsigned_headers"
+	SettingAwsFallbackRegions         = SettingsAws + ".fallback_regions"
 	SettingAwsUnsignedHeadersDefault  = "Accept-Encoding"
+	SettingAwsSSEAlgorithm            = SettingsAws + ".sse_algorithm"
+	SettingAwsSSEKMSKeyID             = SettingsAws + ".sse_kms_key_id"
+	SettingAwsSSECustomerKey          = SettingsAws + ".sse_customer_key"
+	SettingAwsStorageClass            = SettingsAws + ".storage_class"
+	SettingAwsACL                     = SettingsAws + ".acl"
+	SettingAwsContentDisposition      = SettingsAws + ".content_disposition"
+	SettingAwsCacheControl            = SettingsAws + ".cache_control"
+	SettingAwsContentEncoding         = SettingsAws + ".content_encoding"
+	SettingAwsCompressOnUpload        = SettingsAws + ".compress_on_upload"
+	SettingAwsChecksumAlgorithm       = SettingsAws + ".checksum_algorithm"
+	SettingAwsObjectLockMode          = SettingsAws + ".object_lock_mode"
+	SettingAwsObjectLockRetention     = SettingsAws + ".object_lock_retention"
+	SettingAwsPartSize                = SettingsAws + ".part_size"
+	SettingAwsBufferPoolSize          = SettingsAws + ".buffer_pool_size"
+	SettingAwsUploadConcurrency       = SettingsAws + ".upload_concurrency"
+	SettingAwsSpillToDisk             = SettingsAws + ".spill_to_disk"
+	SettingAwsTempDir                 = SettingsAws + ".temp_dir"
+	SettingAwsDeduplicateByHash       = SettingsAws + ".deduplicate_by_hash"
+	SettingAwsStoreSHA256             = SettingsAws + ".store_sha256"
+	SettingAwsResumableUploads        = SettingsAws + ".resumable_uploads"
+	SettingAwsOperationTimeout        = SettingsAws + ".operation_timeout"
+	SettingAwsMaxRetries              = SettingsAws + ".max_retries"
+	SettingAwsRetryMaxBackoff         = SettingsAws + ".retry_max_backoff"
+	SettingAwsMaxConcurrentRequests   = SettingsAws + ".max_concurrent_requests"
+	SettingAwsCircuitBreakerThreshold = SettingsAws + ".circuit_breaker_threshold"
+	SettingAwsCircuitBreakerWindow    = SettingsAws + ".circuit_breaker_window"
+	SettingAwsCircuitBreakerProbe     = SettingsAws + ".circuit_breaker_probe_interval"
+	SettingAwsUploadRateLimit         = SettingsAws + ".upload_rate_limit"
+	SettingAwsTags                    = SettingsAws + ".tags"
+	SettingAwsExpiresAfter            = SettingsAws + ".expires_after"
+	SettingAwsCacheSize               = SettingsAws + ".cache_size"
+	SettingAwsCacheTTL                = SettingsAws + ".cache_ttl"
+	SettingAwsPresignQuery            = SettingsAws + ".presign_query"
+	SettingAwsRequestLogging          = SettingsAws + ".request_logging"
+	SettingAwsUserAgentSuffix         = SettingsAws + ".user_agent_suffix"
+	SettingAwsEnableMetrics           = SettingsAws + ".enable_metrics"
+	SettingAwsEnableTracing           = SettingsAws + ".enable_tracing"
+	SettingAwsPingWrite               = SettingsAws + ".ping_write"
+	SettingAwsVerifyIntegrity         = SettingsAws + ".verify_integrity"
+	SettingAwsRequestPayer            = SettingsAws + ".request_payer"
+	SettingAwsProxyURL                = SettingsAws + ".proxy_url"
+	SettingAwsCABundleFile            = SettingsAws + ".ca_bundle_file"
+	SettingAwsInsecureSkipVerify      = SettingsAws + ".insecure_skip_verify"
+	SettingAwsAllowInsecureTransport  = SettingsAws + ".allow_insecure_transport"
+	SettingAwsMaxIdleConns            = SettingsAws + ".max_idle_conns"
+	SettingAwsMaxIdleConnsPerHost     = SettingsAws + ".max_idle_conns_per_host"
+	SettingAwsIdleConnTimeout         = SettingsAws + ".idle_conn_timeout"
+	SettingAwsExpectContinueTimeout   = SettingsAws + ".expect_continue_timeout"
+	SettingAwsClockSkewCorrection     = SettingsAws + ".clock_skew_correction"
 
 	SettingsAwsTagArtifact        = SettingsAws + ".tag_artifact"
 	SettingsAwsTagArtifactDefault = false
@@ -77,6 +137,19 @@ const (
 	SettingAwsAuthSecret = SettingsAwsAuth + ".secret"
 	SettingAwsAuthToken  = SettingsAwsAuth + ".token"
 
+	SettingsAwsAssumeRole           = SettingsAws + ".assume_role"
+	SettingAwsAssumeRoleARN         = SettingsAwsAssumeRole + ".role_arn"
+	SettingAwsAssumeRoleExternalID  = SettingsAwsAssumeRole + ".external_id"
+	SettingAwsAssumeRoleSessionName = SettingsAwsAssumeRole + ".session_name"
+
+	SettingsAwsWebIdentity         = SettingsAws + ".web_identity"
+	SettingAwsWebIdentityTokenFile = SettingsAwsWebIdentity + ".token_file"
+	SettingAwsWebIdentityRoleARN   = SettingsAwsWebIdentity + ".role_arn"
+
+	SettingAwsCredentialSource  = SettingsAws + ".credential_source"
+	SettingAwsProfile           = SettingsAws + ".profile"
+	SettingAwsMinPresignCredTTL = SettingsAws + ".min_presign_credentials_ttl"
+
 	SettingAzure                    = "azure"
 	SettingAzureAuth                = SettingAzure + ".auth"
 	SettingAzureConnectionString    = SettingAzureAuth + ".connection_string"
@@ -85,6 +158,24 @@ const (
 	SettingAzureSharedKeyAccountKey = SettingAzureSharedKey + ".account_key"
 	SettingAzureSharedKeyURI        = SettingAzureSharedKey + ".uri"
 
+	SettingAzureManagedIdentity         = SettingAzureAuth + ".managed_identity"
+	SettingAzureManagedIdentityAccount  = SettingAzureManagedIdentity + ".account_name"
+	SettingAzureManagedIdentityClientID = SettingAzureManagedIdentity + ".client_id"
+	SettingAzureManagedIdentityURI      = SettingAzureManagedIdentity + ".uri"
+
+	SettingGCS                    = "gcs"
+	SettingGCSAuth                = SettingGCS + ".auth"
+	SettingGCSAuthCredentialsJSON = SettingGCSAuth + ".credentials_json"
+	SettingGCSAuthCredentialsFile = SettingGCSAuth + ".credentials_file"
+	SettingGCSAuthServiceAccount  = SettingGCSAuth + ".service_account"
+	SettingGCSURI                 = SettingGCS + ".uri"
+	SettingGCSChunkSize           = SettingGCS + ".chunk_size"
+
+	SettingLocal           = "local"
+	SettingLocalRoot       = SettingLocal + ".root"
+	SettingLocalURI        = SettingLocal + ".uri"
+	SettingLocalURIDefault = "http://localhost:8080/storage"
+
 	SettingMongo        = "mongo-url"
 	SettingMongoDefault = "mongodb://mongo-deployments:27017"
 
@@ -145,6 +236,8 @@ const (
 const (
 	StorageTypeAWS   = "aws"
 	StorageTypeAzure = "azure"
+	StorageTypeGCS   = "gcs"
+	StorageTypeLocal = "local"
 )
 
 const (
@@ -199,9 +292,10 @@ func ValidateHttps(c config.Reader) error {
 
 func ValidateStorage(c config.Reader) error {
 	svc := c.GetString(SettingDefaultStorage)
-	if svc != StorageTypeAWS && svc != StorageTypeAzure {
+	if svc != StorageTypeAWS && svc != StorageTypeAzure &&
+		svc != StorageTypeGCS && svc != StorageTypeLocal {
 		return fmt.Errorf(
-			`setting "%s" (%s) must be one of "aws" or "azure"`,
+			`setting "%s" (%s) must be one of "aws", "azure", "gcs" or "local"`,
 			SettingDefaultStorage, svc,
 		)
 	}
@@ -282,8 +376,10 @@ var (
 		{Key: SettingStorageEnableDirectUpload, Value: SettingStorageEnableDirectUploadDefault},
 		{Key: SettingAwsS3ForcePathStyle, Value: SettingAwsS3ForcePathStyleDefault},
 		{Key: SettingAwsS3UseAccelerate, Value: SettingAwsS3UseAccelerateDefault},
+		{Key: SettingAwsS3UseDualStack, Value: SettingAwsS3UseDualStackDefault},
 		{Key: SettingAwsUnsignedHeaders, Value: SettingAwsUnsignedHeadersDefault},
 		{Key: SettingStorageMaxImageSize, Value: SettingStorageMaxImageSizeDefault},
+		{Key: SettingLocalURI, Value: SettingLocalURIDefault},
 		{Key: SettingsStorageDownloadExpireSeconds,
 			Value: SettingsStorageDownloadExpireSecondsDefault},
 		{Key: SettingsStorageUploadExpireSeconds, Value: SettingsStorageUploadExpireSecondsDefault},
@@ -16,6 +16,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"time"
@@ -30,6 +31,7 @@ import (
 	"github.com/mendersoftware/deployments/app"
 	"github.com/mendersoftware/deployments/client/workflows"
 	dconfig "github.com/mendersoftware/deployments/config"
+	"github.com/mendersoftware/deployments/storage/s3"
 	"github.com/mendersoftware/deployments/store"
 	"github.com/mendersoftware/deployments/store/mongo"
 )
@@ -128,6 +130,43 @@ func doMain(args []string) {
 			},
 			Action: cmdStorageDaemon,
 		},
+		{
+			Name: "cleanup-multipart-uploads",
+			Usage: "Abort abandoned multipart uploads in the S3 bucket " +
+				"and discard the uploaded parts",
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name: "older-than",
+					Usage: "Abort multipart uploads initiated more than " +
+						"`DURATION` ago.",
+					Value: time.Hour * 24,
+				},
+			},
+			Action: cmdCleanupMultipartUploads,
+		},
+		{
+			Name: "reconcile-artifacts",
+			Usage: "Report artifact objects without an artifact in the " +
+				"database and artifacts without an object, as JSON",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "tenant",
+					Usage: "Tenant ID (optional) - reconcile just a single tenant.",
+				},
+				cli.BoolFlag{
+					Name: "delete",
+					Usage: "Delete the objects without an artifact; " +
+						"by default the objects are only reported (dry run).",
+				},
+				cli.DurationFlag{
+					Name: "min-age",
+					Usage: "Ignore objects and artifacts modified less than " +
+						"`DURATION` ago, e.g. uploads in progress.",
+					Value: time.Hour * 24,
+				},
+			},
+			Action: cmdReconcileArtifacts,
+		},
 	}
 
 	app.Action = cmdServer
@@ -209,15 +248,15 @@ func migrate(tenant string, automigrate bool) error {
 
 func cmdStorageDaemon(args *cli.Context) error {
 	ctx := context.Background()
-	objectStorage, err := SetupObjectStorage(ctx)
+	mgo, err := mongo.NewMongoClient(ctx, config.Config)
 	if err != nil {
 		return err
 	}
-	mgo, err := mongo.NewMongoClient(ctx, config.Config)
+	database := mongo.NewDataStoreMongoWithClient(mgo)
+	objectStorage, err := SetupObjectStorage(ctx, database)
 	if err != nil {
 		return err
 	}
-	database := mongo.NewDataStoreMongoWithClient(mgo)
 	app := app.NewDeployments(database, objectStorage)
 	return app.CleanupExpiredUploads(
 		ctx,
@@ -226,6 +265,109 @@ func cmdStorageDaemon(args *cli.Context) error {
 	)
 }
 
+func cmdCleanupMultipartUploads(args *cli.Context) error {
+	if defType := config.Config.GetString(dconfig.SettingDefaultStorage); defType !=
+		dconfig.StorageTypeAWS {
+		return cli.NewExitError(fmt.Sprintf(
+			"multipart uploads are not supported by storage type %q", defType,
+		), 1)
+	}
+	ctx := context.Background()
+	options := s3.NewOptions()
+	if config.Config.GetBool(dconfig.SettingAwsResumableUploads) {
+		// Remove the records of the aborted uploads.
+		mgo, err := mongo.NewMongoClient(ctx, config.Config)
+		if err != nil {
+			return err
+		}
+		options.SetUploadStore(mongo.NewDataStoreMongoWithClient(mgo))
+	}
+	objectStorage, err := SetupS3(ctx, options)
+	if err != nil {
+		return err
+	}
+	n, err := objectStorage.(*s3.SimpleStorageService).
+		CleanupAbandonedUploads(ctx, args.Duration("older-than"))
+	log.NewEmpty().Infof("aborted %d multipart uploads", n)
+	return err
+}
+
+func cmdReconcileArtifacts(args *cli.Context) error {
+	ctx := context.Background()
+	mgo, err := mongo.NewMongoClient(ctx, config.Config)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = mgo.Disconnect(ctx)
+	}()
+	database := mongo.NewDataStoreMongoWithClient(mgo)
+	objectStorage, err := SetupObjectStorage(ctx, database)
+	if err != nil {
+		return err
+	}
+	err = reconcileArtifacts(
+		ctx,
+		database,
+		app.NewDeployments(database, objectStorage),
+		args.String("tenant"),
+		app.ReconcileOptions{
+			Delete: args.Bool("delete"),
+			MinAge: args.Duration("min-age"),
+		},
+		json.NewEncoder(os.Stdout),
+	)
+	if err != nil {
+		return cli.NewExitError(err, 7)
+	}
+	return nil
+}
+
+// reconcileArtifacts reconciles the artifacts of the tenant, or of all
+// tenants, writing the report of each tenant to enc.
+func reconcileArtifacts(
+	ctx context.Context,
+	db store.DataStore,
+	deployments *app.Deployments,
+	tenant string,
+	opts app.ReconcileOptions,
+	enc *json.Encoder,
+) error {
+	l := log.NewEmpty()
+	dbs := []string{mstore.DbNameForTenant(tenant, mongo.DbName)}
+	if tenant == "" {
+		tdbs, err := db.GetTenantDbs()
+		if err != nil {
+			return errors.Wrap(err, "failed to retrieve tenant DBs")
+		}
+		if len(tdbs) > 0 {
+			dbs = tdbs
+		}
+	}
+	for _, dbname := range dbs {
+		tenantCtx := ctx
+		if tenant := mstore.TenantFromDbName(dbname, mongo.DbName); tenant != "" {
+			tenantCtx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tenant,
+			})
+		}
+		report, err := deployments.Reconcile(tenantCtx, opts)
+		if report != nil {
+			if errEnc := enc.Encode(report); errEnc != nil && err == nil {
+				err = errEnc
+			}
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to reconcile DB %s", dbname)
+		}
+		l.Infof("reconciled DB %s: %d orphaned objects (%d deleted), "+
+			"%d artifacts without an object", dbname,
+			len(report.OrphanedObjects), report.DeletedObjects,
+			len(report.DanglingImages))
+	}
+	return nil
+}
+
 func cmdPropagateReporting(args *cli.Context) error {
 	if config.Config.GetString(dconfig.SettingReportingAddr) == "" {
 		return cli.NewExitError(errors.New("reporting address not configured"), 1)
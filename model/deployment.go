@@ -40,6 +40,10 @@ var (
 		"The deployment for group constructor should have neither list of devices" +
 			" nor all_devices flag set",
 	)
+	ErrInvalidDeploymentDeadline = errors.New(
+		"Invalid deployments definition: deadline must be in the future",
+	)
+	ErrDeploymentDeadlinePassed = errors.New("The deployment deadline has passed")
 )
 
 type DeploymentStatus string
@@ -86,6 +90,12 @@ type DeploymentConstructor struct {
 	// `already-installed` check
 	ForceInstallation bool `json:"force_installation,omitempty" bson:"force_installation"`
 
+	// Deadline after which no download links are handed out to the
+	// devices, optional; the links expire at the deadline at the latest,
+	// and devices asking for the deployment after the deadline are
+	// aborted
+	Deadline *time.Time `json:"deadline,omitempty" bson:"deadline,omitempty"`
+
 	// When set the deployment will be created for all accepted devices from a given group
 	Group string `json:"-" bson:"-"`
 }
@@ -104,6 +114,9 @@ func (c DeploymentConstructor) ValidateNew() error {
 	if err := c.Validate(); err != nil {
 		return err
 	}
+	if c.Deadline != nil && !c.Deadline.After(time.Now()) {
+		return ErrInvalidDeploymentDeadline
+	}
 
 	if len(c.Group) == 0 {
 		if len(c.Devices) == 0 && !c.AllDevices {
@@ -256,6 +269,23 @@ func (d *Deployment) MarshalJSON() ([]byte, error) {
 	return json.Marshal(&slim)
 }
 
+// LinkExpire returns the expiry of the download links handed out for the
+// deployment at the time now: maxExpire, or the time left until the
+// deadline if sooner. ErrDeploymentDeadlinePassed is returned if the
+// deadline has passed.
+func (d *Deployment) LinkExpire(maxExpire time.Duration, now time.Time) (time.Duration, error) {
+	if d.DeploymentConstructor == nil || d.Deadline == nil {
+		return maxExpire, nil
+	}
+	left := d.Deadline.Sub(now)
+	if left <= 0 {
+		return 0, ErrDeploymentDeadlinePassed
+	} else if left < maxExpire {
+		return left, nil
+	}
+	return maxExpire, nil
+}
+
 func (d *Deployment) IsNotPending() bool {
 	if d.Stats[DeviceDeploymentStatusDownloadingStr] > 0 ||
 		d.Stats[DeviceDeploymentStatusInstallingStr] > 0 ||
@@ -34,6 +34,7 @@ func TestDeploymentConstructorValidate(t *testing.T) {
 		InputDevices      []string
 		InputAllDevices   bool
 		InputGroup        string
+		InputDeadline     *time.Time
 		IsValid           bool
 	}{
 		{
@@ -119,6 +120,20 @@ func TestDeploymentConstructorValidate(t *testing.T) {
 			InputAllDevices:   true,
 			IsValid:           false,
 		},
+		{
+			InputName:         "f826484e-1157-4109-af21-304e6d711560",
+			InputArtifactName: "f826484e-1157-4109-af21-304e6d711560",
+			InputDevices:      []string{"lala"},
+			InputDeadline:     timePtr(time.Now().Add(time.Hour)),
+			IsValid:           true,
+		},
+		{
+			InputName:         "f826484e-1157-4109-af21-304e6d711560",
+			InputArtifactName: "f826484e-1157-4109-af21-304e6d711560",
+			InputDevices:      []string{"lala"},
+			InputDeadline:     timePtr(time.Now().Add(-time.Hour)),
+			IsValid:           false,
+		},
 	}
 
 	for _, test := range testCases {
@@ -129,6 +144,7 @@ func TestDeploymentConstructorValidate(t *testing.T) {
 		dep.Devices = test.InputDevices
 		dep.Group = test.InputGroup
 		dep.AllDevices = test.InputAllDevices
+		dep.Deadline = test.InputDeadline
 
 		err := dep.ValidateNew()
 
@@ -141,6 +157,49 @@ func TestDeploymentConstructorValidate(t *testing.T) {
 
 }
 
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestDeploymentLinkExpire(t *testing.T) {
+
+	t.Parallel()
+
+	now := time.Now()
+	testCases := map[string]struct {
+		Deadline *time.Time
+		Expire   time.Duration
+		Error    error
+	}{
+		"no deadline": {
+			Expire: time.Hour,
+		},
+		"deadline after max expire": {
+			Deadline: timePtr(now.Add(2 * time.Hour)),
+			Expire:   time.Hour,
+		},
+		"deadline before max expire": {
+			Deadline: timePtr(now.Add(10 * time.Minute)),
+			Expire:   10 * time.Minute,
+		},
+		"deadline passed": {
+			Deadline: timePtr(now),
+			Error:    ErrDeploymentDeadlinePassed,
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			dep := &Deployment{DeploymentConstructor: &DeploymentConstructor{
+				Deadline: tc.Deadline,
+			}}
+			expire, err := dep.LinkExpire(time.Hour, now)
+			assert.Equal(t, tc.Error, err)
+			assert.Equal(t, tc.Expire, expire)
+		})
+	}
+}
+
 func TestNewDeploymentFromConstructor(t *testing.T) {
 
 	t.Parallel()
@@ -19,6 +19,12 @@ type ArtifactDeploymentInstructions struct {
 	ArtifactName          string   `json:"artifact_name"`
 	Source                Link     `json:"source"`
 	DeviceTypesCompatible []string `json:"device_types_compatible"`
+	// ETag and Size of the artifact Source downloads; set only if the
+	// device asked for a resumable download and the storage supports it.
+	// Source must then be requested with its Header, and fails once the
+	// artifact is replaced.
+	ETag string `json:"etag,omitempty"`
+	Size int64  `json:"size,omitempty"`
 }
 
 type DeploymentInstructions struct {
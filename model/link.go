@@ -28,6 +28,15 @@ type Link struct {
 	TenantID string            `json:"-" bson:"tenant_id"`
 }
 
+// PostLink is a presigned HTML form upload; the Fields must be submitted
+// as multipart/form-data together with the file.
+type PostLink struct {
+	Uri    string            `json:"uri"`
+	Expire time.Time         `json:"expire,omitempty"`
+	Method string            `json:"method,omitempty"`
+	Fields map[string]string `json:"fields"`
+}
+
 type UploadLink struct {
 	ArtifactID string `json:"id" bson:"_id"`
 	Link       `bson:"inline"`
@@ -0,0 +1,42 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"time"
+)
+
+// MultipartUpload is the state of a multipart upload to the object
+// storage, persisted so that the upload can be resumed after a restart.
+type MultipartUpload struct {
+	// UploadID is the ID assigned to the upload by the object storage.
+	UploadID string `bson:"_id"`
+	Bucket   string `bson:"bucket"`
+	Key      string `bson:"key"`
+	// Parts are the parts in the order they were uploaded; a part that
+	// was uploaded again is listed again.
+	Parts []MultipartUploadPart `bson:"parts"`
+
+	CreatedTS time.Time `bson:"created_ts"`
+	UpdatedTS time.Time `bson:"updated_ts"`
+}
+
+type MultipartUploadPart struct {
+	PartNumber int32  `bson:"number"`
+	Size       int64  `bson:"size"`
+	ETag       string `bson:"etag"`
+	// MD5 is the hex encoded MD5 sum of the part data.
+	MD5 string `bson:"md5"`
+}
@@ -149,3 +149,12 @@ func (s StorageSettings) Validate() error {
 		validation.Field(&s.Token, ruleLen5_100),
 	)
 }
+
+// StorageEndpoints are the endpoints resolved by the storage from the
+// storage settings or the default configuration.
+type StorageEndpoints struct {
+	// Client is the endpoint the requests of the service are sent to.
+	Client string `json:"client"`
+	// Presign is the endpoint the presigned links point to.
+	Presign string `json:"presign"`
+}
@@ -18,11 +18,17 @@ import (
 	"context"
 	"encoding/base64"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
 	"github.com/mendersoftware/go-lib-micro/config"
 
@@ -32,26 +38,53 @@ import (
 	dconfig "github.com/mendersoftware/deployments/config"
 	"github.com/mendersoftware/deployments/storage"
 	"github.com/mendersoftware/deployments/storage/azblob"
+	"github.com/mendersoftware/deployments/storage/gcs"
+	"github.com/mendersoftware/deployments/storage/local"
 	"github.com/mendersoftware/deployments/storage/manager"
 	"github.com/mendersoftware/deployments/storage/s3"
 	mstore "github.com/mendersoftware/deployments/store/mongo"
 )
 
 func SetupS3(ctx context.Context, defaultOptions *s3.Options) (storage.ObjectStorage, error) {
+	options, err := s3OptionsFromConfig(defaultOptions)
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(ctx, config.Config.GetString(dconfig.SettingStorageBucket), options)
+}
+
+// s3OptionsFromConfig merges the aws settings into the defaultOptions.
+func s3OptionsFromConfig(defaultOptions *s3.Options) (*s3.Options, error) {
 	c := config.Config
 
 	// Copy / merge defaultOptions
 	options := s3.NewOptions(defaultOptions).
 		SetForcePathStyle(c.GetBool(dconfig.SettingAwsS3ForcePathStyle)).
-		SetUseAccelerate(c.GetBool(dconfig.SettingAwsS3UseAccelerate))
-
-	// Compute the buffer size
-	bucket := c.GetString(dconfig.SettingStorageBucket)
+		SetUseAccelerate(c.GetBool(dconfig.SettingAwsS3UseAccelerate)).
+		SetUseDualStack(c.GetBool(dconfig.SettingAwsS3UseDualStack))
 
 	// The following parameters falls back on AWS_* environment if not set
 	if c.IsSet(dconfig.SettingAwsS3Region) {
 		options.SetRegion(c.GetString(dconfig.SettingAwsS3Region))
 	}
+	if c.IsSet(dconfig.SettingAwsS3SigningRegion) {
+		options.SetSigningRegion(c.GetString(dconfig.SettingAwsS3SigningRegion))
+	}
+	if c.IsSet(dconfig.SettingAwsSignatureVersion) {
+		options.SetSignatureVersion(c.GetString(dconfig.SettingAwsSignatureVersion))
+	}
+	if c.IsSet(dconfig.SettingAwsS3KeyPrefix) {
+		options.SetKeyPrefix(c.GetString(dconfig.SettingAwsS3KeyPrefix))
+	}
+	if c.IsSet(dconfig.SettingAwsKeyStrategy) {
+		strategy, err := s3.ParseKeyStrategy(c.GetString(dconfig.SettingAwsKeyStrategy))
+		if err != nil {
+			return nil, errors.WithMessagef(err,
+				"invalid setting '%s'", dconfig.SettingAwsKeyStrategy,
+			)
+		}
+		options.SetKeyStrategy(strategy)
+	}
 	if c.IsSet(dconfig.SettingsAwsAuth) ||
 		(c.IsSet(dconfig.SettingAwsAuthKeyId) &&
 			c.IsSet(dconfig.SettingAwsAuthSecret)) {
@@ -61,24 +94,252 @@ func SetupS3(ctx context.Context, defaultOptions *s3.Options) (storage.ObjectSto
 			c.GetString(dconfig.SettingAwsAuthToken),
 		)
 	}
+	if c.IsSet(dconfig.SettingAwsWebIdentityTokenFile) {
+		options.SetWebIdentity(
+			c.GetString(dconfig.SettingAwsWebIdentityTokenFile),
+			c.GetString(dconfig.SettingAwsWebIdentityRoleARN),
+		)
+	}
+	if c.IsSet(dconfig.SettingAwsCredentialSource) {
+		options.SetCredentialSource(c.GetString(dconfig.SettingAwsCredentialSource))
+	}
+	if c.IsSet(dconfig.SettingAwsProfile) {
+		options.SetProfile(c.GetString(dconfig.SettingAwsProfile))
+	}
+	if c.IsSet(dconfig.SettingAwsMinPresignCredTTL) {
+		options.SetMinPresignCredTTL(c.GetDuration(dconfig.SettingAwsMinPresignCredTTL))
+	}
+	if c.IsSet(dconfig.SettingAwsAssumeRoleARN) {
+		options.SetAssumeRoleARN(c.GetString(dconfig.SettingAwsAssumeRoleARN))
+		if c.IsSet(dconfig.SettingAwsAssumeRoleExternalID) {
+			options.SetExternalID(c.GetString(dconfig.SettingAwsAssumeRoleExternalID))
+		}
+		if c.IsSet(dconfig.SettingAwsAssumeRoleSessionName) {
+			options.SetRoleSessionName(c.GetString(dconfig.SettingAwsAssumeRoleSessionName))
+		}
+	}
 	if c.IsSet(dconfig.SettingAwsURI) {
 		options.SetURI(c.GetString(dconfig.SettingAwsURI))
 	}
+	if c.IsSet(dconfig.SettingAwsDiscoveryURL) {
+		options.SetDiscoveryURL(c.GetString(dconfig.SettingAwsDiscoveryURL))
+	}
+	if c.IsSet(dconfig.SettingAwsDiscoveryInterval) {
+		options.SetDiscoveryInterval(c.GetDuration(dconfig.SettingAwsDiscoveryInterval))
+	}
+	if c.IsSet(dconfig.SettingAwsProvider) {
+		options.SetProvider(c.GetString(dconfig.SettingAwsProvider))
+	}
 	if c.IsSet(dconfig.SettingAwsExternalURI) {
 		options.SetExternalURI(c.GetString(dconfig.SettingAwsExternalURI))
 	}
+	if c.IsSet(dconfig.SettingAwsFallbackRegions) {
+		options.SetFallbackRegions(c.GetStringSlice(dconfig.SettingAwsFallbackRegions))
+	}
 	if c.IsSet(dconfig.SettingAwsUnsignedHeaders) {
 		options.SetUnsignedHeaders(c.GetStringSlice(dconfig.SettingAwsUnsignedHeaders))
 	}
-
-	storage, err := s3.New(ctx, bucket, options)
-	return storage, err
+	if c.IsSet(dconfig.SettingAwsSSEAlgorithm) {
+		options.SetSSEAlgorithm(c.GetString(dconfig.SettingAwsSSEAlgorithm))
+	}
+	if c.IsSet(dconfig.SettingAwsSSEKMSKeyID) {
+		options.SetSSEKMSKeyID(c.GetString(dconfig.SettingAwsSSEKMSKeyID))
+	}
+	if c.IsSet(dconfig.SettingAwsSSECustomerKey) {
+		key, err := base64.StdEncoding.DecodeString(
+			c.GetString(dconfig.SettingAwsSSECustomerKey),
+		)
+		if err != nil {
+			return nil, errors.WithMessagef(err,
+				"invalid setting '%s'", dconfig.SettingAwsSSECustomerKey,
+			)
+		}
+		options.SetSSECustomerKey(key)
+	}
+	if c.IsSet(dconfig.SettingAwsStorageClass) {
+		options.SetStorageClass(c.GetString(dconfig.SettingAwsStorageClass))
+	}
+	if c.IsSet(dconfig.SettingAwsACL) {
+		options.SetACL(c.GetString(dconfig.SettingAwsACL))
+	}
+	if c.IsSet(dconfig.SettingAwsContentDisposition) {
+		options.SetContentDisposition(c.GetString(dconfig.SettingAwsContentDisposition))
+	}
+	if c.IsSet(dconfig.SettingAwsCacheControl) {
+		options.SetCacheControl(c.GetString(dconfig.SettingAwsCacheControl))
+	}
+	if c.IsSet(dconfig.SettingAwsContentEncoding) {
+		options.SetContentEncoding(c.GetString(dconfig.SettingAwsContentEncoding))
+	}
+	if c.IsSet(dconfig.SettingAwsCompressOnUpload) {
+		options.SetCompressOnUpload(c.GetBool(dconfig.SettingAwsCompressOnUpload))
+	}
+	if c.IsSet(dconfig.SettingAwsPartSize) {
+		partSize := c.GetInt(dconfig.SettingAwsPartSize)
+		maxImageSize := c.GetInt64(dconfig.SettingStorageMaxImageSize)
+		if int64(partSize)*s3.MultipartMaxParts < maxImageSize {
+			return nil, errors.Errorf(
+				"invalid setting '%s': must be at least %d bytes to "+
+					"cover '%s'", dconfig.SettingAwsPartSize,
+				(maxImageSize-1)/s3.MultipartMaxParts+1,
+				dconfig.SettingStorageMaxImageSize,
+			)
+		}
+		options.SetPartSize(partSize)
+	}
+	if c.IsSet(dconfig.SettingAwsBufferPoolSize) {
+		options.SetBufferPoolSize(c.GetInt(dconfig.SettingAwsBufferPoolSize))
+	}
+	if c.IsSet(dconfig.SettingAwsUploadConcurrency) {
+		options.SetUploadConcurrency(c.GetInt(dconfig.SettingAwsUploadConcurrency))
+	}
+	if c.IsSet(dconfig.SettingAwsSpillToDisk) {
+		options.SetSpillToDisk(c.GetBool(dconfig.SettingAwsSpillToDisk))
+	}
+	if c.IsSet(dconfig.SettingAwsTempDir) {
+		options.SetTempDir(c.GetString(dconfig.SettingAwsTempDir))
+	}
+	if c.IsSet(dconfig.SettingAwsDeduplicateByHash) {
+		options.SetDeduplicateByHash(c.GetBool(dconfig.SettingAwsDeduplicateByHash))
+	}
+	if c.IsSet(dconfig.SettingAwsStoreSHA256) {
+		options.SetStoreSHA256(c.GetBool(dconfig.SettingAwsStoreSHA256))
+	}
+	if c.IsSet(dconfig.SettingAwsResumableUploads) {
+		options.SetResumableUploads(c.GetBool(dconfig.SettingAwsResumableUploads))
+	}
+	if c.IsSet(dconfig.SettingAwsChecksumAlgorithm) {
+		options.SetChecksumAlgorithm(c.GetString(dconfig.SettingAwsChecksumAlgorithm))
+	}
+	if c.IsSet(dconfig.SettingAwsObjectLockMode) {
+		options.SetObjectLock(
+			c.GetString(dconfig.SettingAwsObjectLockMode),
+			c.GetDuration(dconfig.SettingAwsObjectLockRetention),
+		)
+	}
+	if c.IsSet(dconfig.SettingAwsTags) {
+		options.SetTags(c.GetStringMapString(dconfig.SettingAwsTags))
+	}
+	if c.IsSet(dconfig.SettingAwsExpiresAfter) {
+		options.SetExpiresAfter(c.GetDuration(dconfig.SettingAwsExpiresAfter))
+	}
+	if c.IsSet(dconfig.SettingAwsCacheSize) {
+		ttl := s3.DefaultCacheTTL
+		if c.IsSet(dconfig.SettingAwsCacheTTL) {
+			ttl = c.GetDuration(dconfig.SettingAwsCacheTTL)
+		}
+		options.SetCache(c.GetInt64(dconfig.SettingAwsCacheSize), ttl)
+	}
+	if c.IsSet(dconfig.SettingAwsPresignQuery) {
+		options.SetPresignQuery(c.GetStringMapString(dconfig.SettingAwsPresignQuery))
+	}
+	if c.IsSet(dconfig.SettingAwsOperationTimeout) {
+		options.SetOperationTimeout(c.GetDuration(dconfig.SettingAwsOperationTimeout))
+	}
+	if c.IsSet(dconfig.SettingAwsMaxRetries) {
+		options.SetMaxRetries(c.GetInt(dconfig.SettingAwsMaxRetries))
+	}
+	if c.IsSet(dconfig.SettingAwsRetryMaxBackoff) {
+		options.SetRetryMaxBackoff(c.GetDuration(dconfig.SettingAwsRetryMaxBackoff))
+	}
+	if c.IsSet(dconfig.SettingAwsMaxConcurrentRequests) {
+		options.SetMaxConcurrentRequests(c.GetInt(dconfig.SettingAwsMaxConcurrentRequests))
+	}
+	if c.IsSet(dconfig.SettingAwsCircuitBreakerThreshold) {
+		window := s3.DefaultCircuitBreakerWindow
+		if c.IsSet(dconfig.SettingAwsCircuitBreakerWindow) {
+			window = c.GetDuration(dconfig.SettingAwsCircuitBreakerWindow)
+		}
+		options.SetCircuitBreaker(
+			c.GetInt(dconfig.SettingAwsCircuitBreakerThreshold), window,
+		)
+	}
+	if c.IsSet(dconfig.SettingAwsCircuitBreakerProbe) {
+		options.SetCircuitBreakerProbeInterval(
+			c.GetDuration(dconfig.SettingAwsCircuitBreakerProbe),
+		)
+	}
+	if c.IsSet(dconfig.SettingAwsUploadRateLimit) {
+		options.SetUploadRateLimit(c.GetInt(dconfig.SettingAwsUploadRateLimit))
+	}
+	if c.IsSet(dconfig.SettingAwsRequestLogging) {
+		options.SetRequestLogging(c.GetBool(dconfig.SettingAwsRequestLogging))
+	}
+	if c.IsSet(dconfig.SettingAwsUserAgentSuffix) {
+		options.SetUserAgentSuffix(c.GetString(dconfig.SettingAwsUserAgentSuffix))
+	}
+	if c.IsSet(dconfig.SettingAwsEnableMetrics) {
+		options.SetEnableMetrics(c.GetBool(dconfig.SettingAwsEnableMetrics))
+	}
+	if c.IsSet(dconfig.SettingAwsEnableTracing) {
+		options.SetEnableTracing(c.GetBool(dconfig.SettingAwsEnableTracing))
+	}
+	if c.IsSet(dconfig.SettingAwsPingWrite) {
+		options.SetPingWrite(c.GetBool(dconfig.SettingAwsPingWrite))
+	}
+	if c.IsSet(dconfig.SettingAwsVerifyIntegrity) {
+		options.SetVerifyIntegrity(c.GetBool(dconfig.SettingAwsVerifyIntegrity))
+	}
+	if c.IsSet(dconfig.SettingAwsAccelerateFallback) {
+		options.SetAccelerateFallback(c.GetBool(dconfig.SettingAwsAccelerateFallback))
+	}
+	if c.IsSet(dconfig.SettingAwsRequestPayer) {
+		options.SetRequestPayer(c.GetBool(dconfig.SettingAwsRequestPayer))
+	}
+	if c.IsSet(dconfig.SettingAwsClockSkewCorrection) {
+		options.SetEnableClockSkewCorrection(
+			c.GetBool(dconfig.SettingAwsClockSkewCorrection),
+		)
+	}
+	if c.IsSet(dconfig.SettingAwsProxyURL) {
+		options.SetProxyURL(c.GetString(dconfig.SettingAwsProxyURL))
+	}
+	if c.IsSet(dconfig.SettingAwsCABundleFile) {
+		pemCerts, err := os.ReadFile(c.GetString(dconfig.SettingAwsCABundleFile))
+		if err != nil {
+			return nil, errors.WithMessagef(err,
+				"invalid setting '%s'", dconfig.SettingAwsCABundleFile,
+			)
+		}
+		options.SetCABundle(pemCerts)
+	}
+	if c.IsSet(dconfig.SettingAwsInsecureSkipVerify) {
+		options.SetInsecureSkipVerify(c.GetBool(dconfig.SettingAwsInsecureSkipVerify))
+	}
+	if c.IsSet(dconfig.SettingAwsAllowInsecureTransport) {
+		options.SetAllowInsecureTransport(
+			c.GetBool(dconfig.SettingAwsAllowInsecureTransport),
+		)
+	}
+	if c.IsSet(dconfig.SettingAwsMaxIdleConns) {
+		options.SetMaxIdleConns(c.GetInt(dconfig.SettingAwsMaxIdleConns))
+	}
+	if c.IsSet(dconfig.SettingAwsMaxIdleConnsPerHost) {
+		options.SetMaxIdleConnsPerHost(c.GetInt(dconfig.SettingAwsMaxIdleConnsPerHost))
+	}
+	if c.IsSet(dconfig.SettingAwsIdleConnTimeout) {
+		options.SetIdleConnTimeout(c.GetDuration(dconfig.SettingAwsIdleConnTimeout))
+	}
+	if c.IsSet(dconfig.SettingAwsExpectContinueTimeout) {
+		options.SetExpectContinueTimeout(
+			c.GetDuration(dconfig.SettingAwsExpectContinueTimeout),
+		)
+	}
+	return options, nil
 }
 
 func SetupBlobStorage(
 	ctx context.Context,
 	defaultOptions *azblob.Options,
 ) (storage.ObjectStorage, error) {
+	return azblob.New(ctx,
+		config.Config.GetString(dconfig.SettingStorageBucket),
+		azblobOptionsFromConfig(defaultOptions),
+	)
+}
+
+// azblobOptionsFromConfig merges the azure settings into the defaultOptions.
+func azblobOptionsFromConfig(defaultOptions *azblob.Options) *azblob.Options {
 	c := config.Config
 
 	// Copy / merge options
@@ -97,11 +358,78 @@ func SetupBlobStorage(
 			creds.URI = &uri
 		}
 		options.SetSharedKey(creds)
+	} else if c.IsSet(dconfig.SettingAzureManagedIdentityAccount) {
+		creds := azblob.ManagedIdentityCredentials{
+			AccountName: c.GetString(dconfig.SettingAzureManagedIdentityAccount),
+		}
+		if c.IsSet(dconfig.SettingAzureManagedIdentityClientID) {
+			clientID := c.GetString(dconfig.SettingAzureManagedIdentityClientID)
+			creds.ClientID = &clientID
+		}
+		if c.IsSet(dconfig.SettingAzureManagedIdentityURI) {
+			uri := c.GetString(dconfig.SettingAzureManagedIdentityURI)
+			creds.URI = &uri
+		}
+		options.SetManagedIdentity(creds)
 	}
-	return azblob.New(ctx, c.GetString(dconfig.SettingStorageBucket), options)
+	return options
 }
 
-func SetupObjectStorage(ctx context.Context) (objManager storage.ObjectStorage, err error) {
+// gcsOptionsFromConfig merges the gcs settings into the defaultOptions.
+func gcsOptionsFromConfig(defaultOptions *gcs.Options) *gcs.Options {
+	c := config.Config
+
+	options := gcs.NewOptions(defaultOptions)
+
+	if c.IsSet(dconfig.SettingGCSAuthCredentialsJSON) {
+		options.SetCredentialsJSON(c.GetString(dconfig.SettingGCSAuthCredentialsJSON))
+	} else if c.IsSet(dconfig.SettingGCSAuthCredentialsFile) {
+		options.SetCredentialsFile(c.GetString(dconfig.SettingGCSAuthCredentialsFile))
+	}
+	if c.IsSet(dconfig.SettingGCSAuthServiceAccount) {
+		options.SetServiceAccount(c.GetString(dconfig.SettingGCSAuthServiceAccount))
+	}
+	if c.IsSet(dconfig.SettingGCSURI) {
+		options.SetURI(c.GetString(dconfig.SettingGCSURI))
+	}
+	if c.IsSet(dconfig.SettingGCSChunkSize) {
+		options.SetChunkSize(c.GetInt(dconfig.SettingGCSChunkSize))
+	}
+	return options
+}
+
+// SetupLocalStorage sets up the storage on the local filesystem (or in
+// memory if no root directory is configured) for development and testing.
+// The presigned requests are served at the path of the configured URI.
+func SetupLocalStorage(ctx context.Context) (*local.Storage, error) {
+	return local.New(ctx, localOptionsFromConfig())
+}
+
+func localOptionsFromConfig() *local.Options {
+	c := config.Config
+	options := local.NewOptions().
+		SetContentType(app.ArtifactContentType).
+		SetURI(c.GetString(dconfig.SettingLocalURI))
+	if c.IsSet(dconfig.SettingLocalRoot) {
+		options.SetRoot(c.GetString(dconfig.SettingLocalRoot))
+	}
+	return options
+}
+
+// SetupObjectStorage sets up the configured object storage; uploads records
+// the s3 multipart uploads if aws.resumable_uploads is enabled.
+func SetupObjectStorage(
+	ctx context.Context,
+	uploads s3.UploadStore,
+) (objManager storage.ObjectStorage, err error) {
+	objManager, _, err = setupObjectStorage(ctx, uploads)
+	return objManager, err
+}
+
+func setupObjectStorage(ctx context.Context, uploads s3.UploadStore) (
+	objManager, defaultStorage storage.ObjectStorage,
+	err error,
+) {
 	c := config.Config
 
 	// Calculate s3 multipart buffer size: the minimum buffer size that
@@ -113,30 +441,78 @@ func SetupObjectStorage(ctx context.Context) (objManager storage.ObjectStorage,
 	var (
 		s3Options = s3.NewOptions().
 				SetContentType(app.ArtifactContentType).
-				SetBufferSize(int(bufferSize))
+				SetBufferSize(int(bufferSize)).
+				SetMaxObjectSize(maxImageSize).
+				SetUploadStore(uploads)
 		azOptions = azblob.NewOptions().
 				SetContentType(app.ArtifactContentType)
 	)
-	var defaultStorage storage.ObjectStorage
-	switch defType := c.GetString(dconfig.SettingDefaultStorage); defType {
+	// The storage type is the kind of the backend in storage.New.
+	var options interface{}
+	defType := c.GetString(dconfig.SettingDefaultStorage)
+	switch defType {
 	case dconfig.StorageTypeAWS:
-		defaultStorage, err = SetupS3(ctx, s3Options)
+		options, err = s3OptionsFromConfig(s3Options)
 	case dconfig.StorageTypeAzure:
-		defaultStorage, err = SetupBlobStorage(ctx, azOptions)
-	default:
+		options = azblobOptionsFromConfig(azOptions)
+	case dconfig.StorageTypeGCS:
+		options = gcsOptionsFromConfig(gcs.NewOptions().
+			SetContentType(app.ArtifactContentType))
+	case dconfig.StorageTypeLocal:
+		options = localOptionsFromConfig()
+	}
+	if err == nil {
+		defaultStorage, err = storage.New(ctx, defType,
+			c.GetString(dconfig.SettingStorageBucket), options)
+	}
+	if errors.Is(err, storage.ErrUnknownKind) {
 		err = errors.Errorf(
-			`storage type must be one of %q or %q, received value %q`,
-			dconfig.StorageTypeAWS, dconfig.StorageTypeAzure, defType,
+			`storage type must be one of %q, received value %q`,
+			storage.Kinds(), defType,
 		)
 	}
+	if err != nil {
+		return nil, nil, err
+	}
+	objManager, err = manager.New(ctx, defaultStorage, s3Options, azOptions)
+	return objManager, defaultStorage, err
+}
+
+// setupTracing installs the global OpenTelemetry tracer provider, exporting
+// the spans with OTLP over HTTP, and returns its shutdown function. The
+// exporter is configured with the OTEL_EXPORTER_OTLP_* environment variables.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return manager.New(ctx, defaultStorage, s3Options, azOptions)
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// propagateTrace continues the trace of the incoming requests, such that
+// the spans of the storage operations are children of the caller's span.
+func propagateTrace(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().
+			Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
 }
 
 func RunServer(ctx context.Context) error {
 	c := config.Config
+	if c.GetBool(dconfig.SettingAwsEnableTracing) {
+		shutdown, err := setupTracing(ctx)
+		if err != nil {
+			return errors.WithMessage(err, "main: failed to setup tracing")
+		}
+		defer func() {
+			_ = shutdown(context.Background())
+		}()
+	}
 	dbClient, err := mstore.NewMongoClient(ctx, c)
 	if err != nil {
 		return err
@@ -148,7 +524,7 @@ func RunServer(ctx context.Context) error {
 	ds := mstore.NewDataStoreMongoWithClient(dbClient)
 
 	// Storage Layer
-	objStore, err := SetupObjectStorage(ctx)
+	objStore, defaultStorage, err := setupObjectStorage(ctx, ds)
 	if err != nil {
 		return errors.WithMessage(err, "main: failed to setup storage client")
 	}
@@ -158,6 +534,9 @@ func RunServer(ctx context.Context) error {
 		c := reporting.NewClient(addr)
 		app = app.WithReporting(c)
 	}
+	if strings.EqualFold(c.GetString(dconfig.SettingAwsKeyStrategy), s3.KeyStrategyDate) {
+		app = app.WithTimeOrderedIDs()
+	}
 
 	// Setup API Router configuration
 	base64Repl := strings.NewReplacer("-", "+", "_", "/", "=", "")
@@ -181,9 +560,27 @@ func RunServer(ctx context.Context) error {
 		return err
 	}
 
-	api := rest.NewApi()
-	SetupMiddleware(c, api)
-	api.SetApp(router)
+	restAPI := rest.NewApi()
+	SetupMiddleware(c, restAPI)
+	restAPI.SetApp(router)
+
+	handler := restAPI.MakeHandler()
+	if localStorage, ok := defaultStorage.(*local.Storage); ok {
+		// Serve the presigned requests to the local storage.
+		mux := http.NewServeMux()
+		mux.Handle("/", handler)
+		mux.Handle(localStorage.Path()+"/", localStorage)
+		handler = mux
+	}
+	if c.GetBool(dconfig.SettingAwsEnableMetrics) {
+		mux := http.NewServeMux()
+		mux.Handle("/", handler)
+		mux.Handle(api.ApiUrlInternalMetrics, promhttp.Handler())
+		handler = mux
+	}
+	if c.GetBool(dconfig.SettingAwsEnableTracing) {
+		handler = propagateTrace(handler)
+	}
 
 	listen := c.GetString(dconfig.SettingListen)
 
@@ -192,8 +589,8 @@ func RunServer(ctx context.Context) error {
 		cert := c.GetString(dconfig.SettingHttpsCertificate)
 		key := c.GetString(dconfig.SettingHttpsKey)
 
-		return http.ListenAndServeTLS(listen, cert, key, api.MakeHandler())
+		return http.ListenAndServeTLS(listen, cert, key, handler)
 	}
 
-	return http.ListenAndServe(listen, api.MakeHandler())
+	return http.ListenAndServe(listen, handler)
 }
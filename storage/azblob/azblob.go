@@ -27,6 +27,7 @@ import (
 	"github.com/mendersoftware/deployments/storage"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
@@ -34,6 +35,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
 )
 
 const (
@@ -45,15 +47,43 @@ const (
 type client struct {
 	DefaultClient *container.Client
 	credentials   *azblob.SharedKeyCredential
+	// delegation signs the presigned requests if the client is
+	// authenticated with a managed identity.
+	delegation    *delegationKeys
 	contentType   *string
 	bufferSize    int64
+	defaultExpire time.Duration
+}
+
+var _ storage.ObjectStorage = &client{}
+
+// Kind is the kind of the Azure Blob storage in storage.New.
+const Kind = "azure"
+
+func init() {
+	storage.Register(Kind, func(
+		ctx context.Context,
+		bucket string,
+		options interface{},
+	) (storage.ObjectStorage, error) {
+		opt, ok := options.(*Options)
+		if !ok && options != nil {
+			return nil, fmt.Errorf("%w: expected *azblob.Options, got %T",
+				storage.ErrInvalidOptions, options)
+		}
+		return New(ctx, bucket, opt)
+	})
 }
 
 func NewEmpty(ctx context.Context, opts ...*Options) (storage.ObjectStorage, error) {
 	opt := NewOptions(opts...)
 	objStore := &client{
-		bufferSize:  opt.BufferSize,
-		contentType: opt.ContentType,
+		bufferSize:    opt.BufferSize,
+		contentType:   opt.ContentType,
+		defaultExpire: DefaultExpire,
+	}
+	if opt.DefaultExpire != nil {
+		objStore.defaultExpire = *opt.DefaultExpire
 	}
 	return objStore, nil
 }
@@ -97,6 +127,16 @@ func New(ctx context.Context, bucket string, opts ...*Options) (storage.ObjectSt
 				clientOptions,
 			)
 		}
+	} else if mi := opt.ManagedIdentity; mi != nil {
+		containerURL, tokenCred := mi.azParams(bucket)
+		cc, err = container.NewClient(containerURL, tokenCred, clientOptions)
+		if err == nil {
+			objectStorage.(*client).delegation, err = newDelegationKeys(
+				containerURL, tokenCred, &service.ClientOptions{
+					ClientOptions: clientOptions.ClientOptions,
+				},
+			)
+		}
 	}
 	if err != nil {
 		return nil, err
@@ -181,38 +221,117 @@ func (r objectReader) Length() int64 {
 	return r.length
 }
 
+type rangeReader struct {
+	objectReader
+	contentRange string
+}
+
+func (r rangeReader) ContentRange() string {
+	return r.contentRange
+}
+
 func (c *client) GetObject(
 	ctx context.Context,
 	objectPath string,
 ) (io.ReadCloser, error) {
+	out, err := c.download(ctx, OpGetObject, objectPath, blob.HTTPRange{})
+	if err != nil {
+		return nil, err
+	}
+	if out.ContentLength != nil {
+		return objectReader{
+			ReadCloser: out.Body,
+			length:     *out.ContentLength,
+		}, nil
+	}
+	return out.Body, nil
+}
+
+func (c *client) GetObjectRange(
+	ctx context.Context,
+	objectPath string,
+	offset, length int64,
+) (storage.RangeReader, error) {
+	if _, err := storage.ValidateRange(offset, length); err != nil {
+		return nil, OpError{
+			Op:     OpGetObjectRange,
+			Reason: err,
+		}
+	}
+	httpRange := blob.HTTPRange{Offset: offset}
+	if length > 0 {
+		httpRange.Count = length
+	}
+	out, err := c.download(ctx, OpGetObjectRange, objectPath, httpRange)
+	if err != nil {
+		return nil, err
+	}
+	r := rangeReader{
+		objectReader: objectReader{
+			ReadCloser: out.Body,
+		},
+	}
+	if out.ContentLength != nil {
+		r.length = *out.ContentLength
+	}
+	if out.ContentRange != nil {
+		r.contentRange = *out.ContentRange
+	} else {
+		// The whole blob was requested: no range in the response
+		r.contentRange = fmt.Sprintf("bytes 0-%d/%d", r.length-1, r.length)
+	}
+	return r, nil
+}
+
+func (c *client) download(
+	ctx context.Context,
+	op string,
+	objectPath string,
+	httpRange blob.HTTPRange,
+) (*blob.DownloadStreamResponse, error) {
 	azClient, err := c.clientFromContext(ctx)
 	if err != nil {
 		return nil, OpError{
-			Op:     OpGetObject,
+			Op:     op,
 			Reason: err,
 		}
 	}
 	bc := azClient.NewBlockBlobClient(objectPath)
-	out, err := bc.DownloadStream(ctx, &blob.DownloadStreamOptions{})
+	opts := &blob.DownloadStreamOptions{
+		Range: httpRange,
+	}
+	var rsp *http.Response
+	if etag, ok := storage.IfNoneMatchFromContext(ctx); ok {
+		opts.AccessConditions = &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{
+				IfNoneMatch: to.Ptr(azcore.ETag(etag)),
+			},
+		}
+		// 304 Not Modified is not an error for the SDK
+		ctx = runtime.WithCaptureResponse(ctx, &rsp)
+	}
+	out, err := bc.DownloadStream(ctx, opts)
 	if bloberror.HasCode(err,
 		bloberror.BlobNotFound,
 		bloberror.ContainerNotFound,
 		bloberror.ResourceNotFound) {
 		err = storage.ErrObjectNotFound
+	} else if bloberror.HasCode(err, bloberror.InvalidRange) {
+		err = storage.ErrInvalidRange
+	} else if err == nil && rsp != nil &&
+		rsp.StatusCode == http.StatusNotModified {
+		if out.Body != nil {
+			out.Body.Close()
+		}
+		err = storage.ErrNotModified
 	}
 	if err != nil {
 		return nil, OpError{
-			Op:     OpGetObject,
+			Op:     op,
 			Reason: err,
 		}
 	}
-	if out.ContentLength != nil {
-		return objectReader{
-			ReadCloser: out.Body,
-			length:     *out.ContentLength,
-		}, nil
-	}
-	return out.Body, nil
+	return &out, nil
 }
 
 func (c *client) PutObject(
@@ -228,13 +347,32 @@ func (c *client) PutObject(
 		}
 	}
 	bc := azClient.NewBlockBlobClient(objectPath)
+	tags, _ := storage.ObjectTagsFromContext(ctx)
 	var blobOpts = &blockblob.UploadStreamOptions{
 		HTTPHeaders: &blob.HTTPHeaders{
 			BlobContentType: c.contentType,
 		},
+		Tags: tags,
 	}
 	blobOpts.BlockSize = c.bufferSize
+	if cond, ok := storage.PutConditionFromContext(ctx); ok {
+		conditions := &blob.ModifiedAccessConditions{}
+		if cond.IfMatch != "" {
+			conditions.IfMatch = to.Ptr(azcore.ETag(cond.IfMatch))
+		}
+		if cond.IfNotExists {
+			conditions.IfNoneMatch = to.Ptr(azcore.ETagAny)
+		}
+		blobOpts.AccessConditions = &blob.AccessConditions{
+			ModifiedAccessConditions: conditions,
+		}
+	}
 	_, err = bc.UploadStream(ctx, src, blobOpts)
+	if bloberror.HasCode(err,
+		bloberror.ConditionNotMet,
+		bloberror.BlobAlreadyExists) {
+		err = storage.ErrPreconditionFailed
+	}
 	if err != nil {
 		return OpError{
 			Op:      OpPutObject,
@@ -310,11 +448,17 @@ func (c *client) StatObject(
 			Reason:  err,
 		}
 	}
-	return &storage.ObjectInfo{
+	info := &storage.ObjectInfo{
 		Path:         path,
 		LastModified: rsp.LastModified,
 		Size:         rsp.ContentLength,
-	}, nil
+		ContentType:  rsp.ContentType,
+	}
+	if rsp.ETag != nil {
+		etag := string(*rsp.ETag)
+		info.ETag = &etag
+	}
+	return info, nil
 }
 
 func buildSignedURL(
@@ -345,6 +489,13 @@ func (c *client) GetRequest(
 	filename string,
 	duration time.Duration,
 ) (*model.Link, error) {
+	duration, err := c.presignExpire(duration)
+	if err != nil {
+		return nil, OpError{
+			Op:     OpGetRequest,
+			Reason: err,
+		}
+	}
 	azClient, err := c.clientFromContext(ctx)
 	if err != nil {
 		return nil, OpError{
@@ -376,46 +527,28 @@ func (c *client) GetRequest(
 			Reason:  err,
 		}
 	}
-	now := time.Now().UTC()
-	exp := now.Add(duration)
-	// HACK: We cannot use BlockBlobClient.GetSASToken because the API does
-	// not expose the required parameters.
-	urlParts, _ := blob.ParseURL(bc.URL())
-	sk, err := c.credentialsFromContext(ctx)
-	if err != nil {
-		return nil, OpError{
-			Op:      OpGetRequest,
-			Message: "failed to retrieve credentials",
-			Reason:  err,
-		}
-	}
 	var contentDisposition string
 	if filename != "" {
-		contentDisposition = fmt.Sprintf(
-			`attachment; filename="%s"`, filename,
-		)
+		contentDisposition = storage.AttachmentDisposition(filename)
 	}
-	permissions := &sas.BlobPermissions{
-		Read: true,
+	hdr, _ := storage.ResponseHeadersFromContext(ctx)
+	if hdr.ContentDisposition != "" {
+		contentDisposition = hdr.ContentDisposition
 	}
-	qParams, err := sas.BlobSignatureValues{
-		ContainerName: urlParts.ContainerName,
-		BlobName:      urlParts.BlobName,
-
-		Permissions:        permissions.String(),
+	if hdr.ContentType == "" && c.contentType != nil {
+		// Like s3, respond with the configured content type.
+		hdr.ContentType = *c.contentType
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	exp := now.Add(duration)
+	uri, err := c.signURL(ctx, bc.URL(), sas.BlobSignatureValues{
+		Permissions:        (&sas.BlobPermissions{Read: true}).String(),
 		ContentDisposition: contentDisposition,
+		ContentType:        hdr.ContentType,
 
-		StartTime:  now.UTC(),
-		ExpiryTime: exp.UTC(),
-	}.SignWithSharedKey(sk)
-	if err != nil {
-		return nil, OpError{
-			Op:      OpGetRequest,
-			Message: "failed to build signed URL",
-			Reason:  err,
-		}
-	}
-	uri, err := buildSignedURL(bc.URL(), qParams)
+		StartTime:  now,
+		ExpiryTime: exp,
+	})
 	if err != nil {
 		return nil, OpError{
 			Op:      OpGetRequest,
@@ -435,10 +568,23 @@ func (c *client) DeleteRequest(
 	path string,
 	duration time.Duration,
 ) (*model.Link, error) {
+	if _, ok := storage.ResponseHeadersFromContext(ctx); ok {
+		return nil, OpError{
+			Op:     OpDeleteRequest,
+			Reason: storage.ErrResponseHeadersNotGET,
+		}
+	}
+	duration, err := c.presignExpire(duration)
+	if err != nil {
+		return nil, OpError{
+			Op:     OpDeleteRequest,
+			Reason: err,
+		}
+	}
 	azClient, err := c.clientFromContext(ctx)
 	if err != nil {
 		return nil, OpError{
-			Op:     OpGetRequest,
+			Op:     OpDeleteRequest,
 			Reason: err,
 		}
 	}
@@ -450,9 +596,13 @@ func (c *client) DeleteRequest(
 			Reason:  err,
 		}
 	}
-	now := time.Now().UTC()
+	now := time.Now().UTC().Truncate(time.Second)
 	exp := now.Add(duration)
-	uri, err := bc.GetSASURL(sas.BlobPermissions{Delete: true}, now, exp)
+	uri, err := c.signURL(ctx, bc.URL(), sas.BlobSignatureValues{
+		Permissions: (&sas.BlobPermissions{Delete: true}).String(),
+		StartTime:   now,
+		ExpiryTime:  exp,
+	})
 	if err != nil {
 		return nil, OpError{
 			Op:      OpDeleteRequest,
@@ -473,10 +623,23 @@ func (c *client) PutRequest(
 	objectPath string,
 	duration time.Duration,
 ) (*model.Link, error) {
+	if _, ok := storage.ResponseHeadersFromContext(ctx); ok {
+		return nil, OpError{
+			Op:     OpPutRequest,
+			Reason: storage.ErrResponseHeadersNotGET,
+		}
+	}
+	duration, err := c.presignExpire(duration)
+	if err != nil {
+		return nil, OpError{
+			Op:     OpPutRequest,
+			Reason: err,
+		}
+	}
 	azClient, err := c.clientFromContext(ctx)
 	if err != nil {
 		return nil, OpError{
-			Op:     OpGetRequest,
+			Op:     OpPutRequest,
 			Reason: err,
 		}
 	}
@@ -488,12 +651,13 @@ func (c *client) PutRequest(
 			Reason:  err,
 		}
 	}
-	now := time.Now().UTC()
+	now := time.Now().UTC().Truncate(time.Second)
 	exp := now.Add(duration)
-	uri, err := bc.GetSASURL(sas.BlobPermissions{
-		Create: true,
-		Write:  true,
-	}, now, exp)
+	uri, err := c.signURL(ctx, bc.URL(), sas.BlobSignatureValues{
+		Permissions: (&sas.BlobPermissions{Create: true, Write: true}).String(),
+		StartTime:   now,
+		ExpiryTime:  exp,
+	})
 	if err != nil {
 		return nil, OpError{
 			Op:      OpPutRequest,
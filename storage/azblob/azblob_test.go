@@ -197,6 +197,7 @@ func TestObjectStorage(t *testing.T) {
 			if assert.NoError(t, err) {
 				assert.WithinDuration(t, time.Now(), *stat.LastModified, time.Second*10,
 					"StatObject; last modified timestamp is not close to present time")
+				assert.NotNil(t, stat.ETag)
 			}
 
 			client := new(http.Client)
@@ -267,6 +268,12 @@ func TestObjectStorage(t *testing.T) {
 
 }
 
+func TestStorageNew(t *testing.T) {
+	assert.Contains(t, storage.Kinds(), Kind)
+	_, err := storage.New(context.Background(), Kind, "container", "options")
+	assert.ErrorIs(t, err, storage.ErrInvalidOptions)
+}
+
 func TestKeyFromConnectionString(t *testing.T) {
 	const (
 		ConnStr = "AccountName=foobar;AccountNotKey=notfoobar;Spam=spam;AccountKey=Zm9vYmFy"
@@ -419,6 +426,23 @@ func TestGetObject(t *testing.T) {
 		Error: func(t assert.TestingT, err error, _ ...interface{}) bool {
 			return assert.Error(t, err)
 		},
+	}, {
+		Name: "error/not modified",
+
+		CTX: storage.IfNoneMatchWithContext(
+			context.Background(), `"0x8DB4E3E4B5C2D1A"`,
+		),
+		ObjectPath: "foo/bar",
+		Handler: func(t *testing.T) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, `"0x8DB4E3E4B5C2D1A"`, r.Header.Get("If-None-Match"))
+
+				w.WriteHeader(http.StatusNotModified)
+			}
+		},
+		Error: func(t assert.TestingT, err error, _ ...interface{}) bool {
+			return assert.ErrorIs(t, err, storage.ErrNotModified)
+		},
 	}, {
 		Name: "error/invalid settings from context",
 
@@ -462,3 +486,89 @@ func TestGetObject(t *testing.T) {
 		})
 	}
 }
+
+func TestGetObjectRange(t *testing.T) {
+	t.Parallel()
+
+	const object = "imagine artifacts"
+	type testCase struct {
+		Name string
+
+		Offset int64
+		Length int64
+
+		Range        string
+		Body         string
+		ContentRange string
+		Error        error
+	}
+	testCases := []testCase{{
+		Name: "ok",
+
+		Offset: 8,
+		Length: 4,
+
+		Range:        "bytes=8-11",
+		Body:         "arti",
+		ContentRange: "bytes 8-11/17",
+	}, {
+		Name: "ok/whole object",
+
+		Offset: 0,
+		Length: -1,
+
+		Body:         object,
+		ContentRange: "bytes 0-16/17",
+	}, {
+		Name: "error/offset beyond end",
+
+		Offset: 17,
+		Length: -1,
+
+		Range: "bytes=17-",
+		Error: storage.ErrInvalidRange,
+	}, {
+		Name: "error/invalid offset",
+
+		Offset: -1,
+		Length: 10,
+
+		Error: storage.ErrInvalidRange,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			azClient, srv := newTestStorageAndServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					assert.Equal(t, tc.Range, r.Header.Get("x-ms-range"))
+					if tc.Error != nil {
+						w.Header().Set("x-ms-error-code", "InvalidRange")
+						w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+						return
+					}
+					r.Header.Set("Range", r.Header.Get("x-ms-range"))
+					http.ServeContent(w, r, "", time.Time{},
+						strings.NewReader(object))
+				},
+			))
+			defer srv.Close()
+
+			obj, err := azClient.GetObjectRange(context.Background(),
+				"foo/bar", tc.Offset, tc.Length)
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer obj.Close()
+			b, _ := io.ReadAll(obj)
+			assert.Equal(t, tc.Body, string(b))
+			assert.Equal(t, int64(len(tc.Body)), obj.Length())
+			assert.Equal(t, tc.ContentRange, obj.ContentRange())
+		})
+	}
+}
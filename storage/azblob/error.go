@@ -41,14 +41,15 @@ func (err OpError) Unwrap() error {
 }
 
 const (
-	OpHealthCheck   = "HealthCheck"
-	OpGetObject     = "GetObject"
-	OpPutObject     = "PutObject"
-	OpDeleteObject  = "DeleteObject"
-	OpStatObject    = "StatObject"
-	OpGetRequest    = "GetRequest"
-	OpDeleteRequest = "DeleteRequest"
-	OpPutRequest    = "PutRequest"
+	OpHealthCheck    = "HealthCheck"
+	OpGetObject      = "GetObject"
+	OpGetObjectRange = "GetObjectRange"
+	OpPutObject      = "PutObject"
+	OpDeleteObject   = "DeleteObject"
+	OpStatObject     = "StatObject"
+	OpGetRequest     = "GetRequest"
+	OpDeleteRequest  = "DeleteRequest"
+	OpPutRequest     = "PutRequest"
 )
 
 var (
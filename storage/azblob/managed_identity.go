@@ -0,0 +1,137 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package azblob
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+const (
+	// imdsTokenURL is the token endpoint of the Azure Instance Metadata
+	// Service, the source of managed identity tokens on Azure VMs, AKS
+	// nodes and container instances.
+	imdsTokenURL   = "http://169.254.169.254/metadata/identity/oauth2/token"
+	imdsAPIVersion = "2018-02-01"
+	imdsTimeout    = 30 * time.Second
+)
+
+var (
+	ErrManagedIdentity       = errors.New("managed identity token request failed")
+	ErrManagedIdentityScopes = errors.New("managed identity tokens require exactly one scope")
+)
+
+// ManagedIdentityCredentials authenticate with the managed identity
+// assigned to the host. The presigned links are signed with a user
+// delegation key, so the identity must have a role allowed to delegate
+// access, such as "Storage Blob Data Contributor".
+type ManagedIdentityCredentials struct {
+	AccountName string
+	// ClientID selects a user-assigned identity; the system-assigned
+	// identity is used if not set.
+	ClientID *string
+
+	URI *string // Optional
+}
+
+func (creds ManagedIdentityCredentials) azParams(
+	containerName string,
+) (containerURL string, azCreds azcore.TokenCredential) {
+	if creds.URI != nil {
+		containerURL = *creds.URI
+	} else {
+		containerURL = fmt.Sprintf(
+			"https://%s.blob.core.windows.net/%s",
+			creds.AccountName,
+			containerName,
+		)
+	}
+	return containerURL, &managedIdentityCredential{
+		endpoint: imdsTokenURL,
+		clientID: creds.ClientID,
+		client: &http.Client{
+			// The metadata service is link-local: never use a proxy.
+			Transport: &http.Transport{},
+			Timeout:   imdsTimeout,
+		},
+	}
+}
+
+// managedIdentityCredential implements azcore.TokenCredential using the
+// instance metadata service. Tokens are cached and refreshed by the SDK.
+type managedIdentityCredential struct {
+	endpoint string
+	clientID *string
+	client   *http.Client
+}
+
+func (cred *managedIdentityCredential) GetToken(
+	ctx context.Context,
+	opts policy.TokenRequestOptions,
+) (azcore.AccessToken, error) {
+	if len(opts.Scopes) != 1 {
+		return azcore.AccessToken{}, ErrManagedIdentityScopes
+	}
+	q := url.Values{}
+	q.Set("api-version", imdsAPIVersion)
+	q.Set("resource", strings.TrimSuffix(opts.Scopes[0], "/.default"))
+	if cred.clientID != nil {
+		q.Set("client_id", *cred.clientID)
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodGet, cred.endpoint+"?"+q.Encode(), nil,
+	)
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+	req.Header.Set("Metadata", "true")
+	rsp, err := cred.client.Do(req)
+	if err != nil {
+		return azcore.AccessToken{}, fmt.Errorf("%w: %s", ErrManagedIdentity, err)
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(rsp.Body, 1024))
+		return azcore.AccessToken{}, fmt.Errorf("%w: %s: %s",
+			ErrManagedIdentity, rsp.Status, strings.TrimSpace(string(b)))
+	}
+	var token struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresOn   json.Number `json:"expires_on"`
+	}
+	if err = json.NewDecoder(rsp.Body).Decode(&token); err != nil {
+		return azcore.AccessToken{}, fmt.Errorf("%w: invalid response: %s",
+			ErrManagedIdentity, err)
+	}
+	expiresOn, err := token.ExpiresOn.Int64()
+	if err != nil || token.AccessToken == "" {
+		return azcore.AccessToken{}, fmt.Errorf("%w: invalid response",
+			ErrManagedIdentity)
+	}
+	return azcore.AccessToken{
+		Token:     token.AccessToken,
+		ExpiresOn: time.Unix(expiresOn, 0),
+	}, nil
+}
@@ -0,0 +1,234 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package azblob
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/storage"
+)
+
+const testTokenScope = "https://storage.azure.com/.default"
+
+func newTestIMDS(t *testing.T, clientID string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			if r.Header.Get("Metadata") != "true" ||
+				q.Get("resource") != "https://storage.azure.com" ||
+				q.Get("client_id") != clientID {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"invalid_request"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"access_token":"token","expires_on":"%d"}`,
+				time.Now().Add(time.Hour).Unix())
+		},
+	))
+}
+
+func TestManagedIdentityCredential(t *testing.T) {
+	t.Parallel()
+	clientID := "client"
+	type testCase struct {
+		Name string
+
+		ClientID       *string
+		ServerClientID string
+		Scopes         []string
+
+		Error error
+	}
+	testCases := []testCase{{
+		Name: "ok/system-assigned",
+
+		Scopes: []string{testTokenScope},
+	}, {
+		Name: "ok/user-assigned",
+
+		ClientID:       &clientID,
+		ServerClientID: clientID,
+		Scopes:         []string{testTokenScope},
+	}, {
+		Name: "error/unknown identity",
+
+		ClientID: &clientID,
+		Scopes:   []string{testTokenScope},
+		Error:    ErrManagedIdentity,
+	}, {
+		Name: "error/scopes",
+
+		Scopes: []string{testTokenScope, "https://management.azure.com/.default"},
+		Error:  ErrManagedIdentityScopes,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			srv := newTestIMDS(t, tc.ServerClientID)
+			defer srv.Close()
+			cred := &managedIdentityCredential{
+				endpoint: srv.URL,
+				clientID: tc.ClientID,
+				client:   srv.Client(),
+			}
+			token, err := cred.GetToken(context.Background(),
+				policy.TokenRequestOptions{Scopes: tc.Scopes})
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, "token", token.Token)
+				assert.WithinDuration(t, time.Now().Add(time.Hour),
+					token.ExpiresOn, time.Minute)
+			}
+		})
+	}
+}
+
+func TestPresignManagedIdentity(t *testing.T) {
+	t.Parallel()
+	imds := newTestIMDS(t, "")
+	defer imds.Close()
+	var keyRequests int32
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			q := r.URL.Query()
+			switch {
+			case r.Method == http.MethodPost && q.Get("comp") == "userdelegationkey":
+				assert.Equal(t, "/", r.URL.Path)
+				atomic.AddInt32(&keyRequests, 1)
+				now := time.Now().UTC()
+				fmt.Fprintf(w, `<UserDelegationKey>`+
+					`<SignedOid>oid</SignedOid><SignedTid>tid</SignedTid>`+
+					`<SignedStart>%s</SignedStart><SignedExpiry>%s</SignedExpiry>`+
+					`<SignedService>b</SignedService>`+
+					`<SignedVersion>2020-10-02</SignedVersion>`+
+					`<Value>c2VjcmV0</Value></UserDelegationKey>`,
+					now.Format(time.RFC3339), now.Add(ExpireMaxLimit).Format(time.RFC3339))
+			case r.Method == http.MethodHead:
+				w.WriteHeader(http.StatusOK)
+			default:
+				t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		},
+	))
+	defer srv.Close()
+
+	// Token credentials require https: tunnel the TLS connections to the
+	// plain test server.
+	var d net.Dialer
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return d.DialContext(ctx,
+			srv.Listener.Addr().Network(), srv.Listener.Addr().String())
+	}
+	clientOptions := azcore.ClientOptions{
+		Transport: &http.Client{Transport: &http.Transport{
+			DialContext:    dial,
+			DialTLSContext: dial,
+		}},
+	}
+	containerURL, cred := ManagedIdentityCredentials{
+		AccountName: "test",
+	}.azParams("container")
+	cred.(*managedIdentityCredential).endpoint = imds.URL
+	cc, err := container.NewClient(containerURL, cred,
+		&container.ClientOptions{ClientOptions: clientOptions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delegation, err := newDelegationKeys(containerURL, cred,
+		&service.ClientOptions{ClientOptions: clientOptions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	contentType := "application/vnd.mender-artifact"
+	azClient := &client{
+		DefaultClient: cc,
+		delegation:    delegation,
+		contentType:   &contentType,
+		defaultExpire: DefaultExpire,
+	}
+
+	ctx := context.Background()
+	link, err := azClient.GetRequest(ctx, "foo/bar", "bar.mender", 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.MethodGet, link.Method)
+	assert.WithinDuration(t, time.Now().Add(DefaultExpire), link.Expire, 2*time.Second)
+	uri, err := url.Parse(link.Uri)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/container/foo/bar", uri.Path)
+		q := uri.Query()
+		assert.Equal(t, "oid", q.Get("skoid"), "expected a user delegation SAS")
+		assert.Equal(t, "r", q.Get("sp"))
+		assert.Equal(t, contentType, q.Get("rsct"))
+		assert.Equal(t, `attachment; filename="bar.mender"`, q.Get("rscd"))
+		assert.Equal(t, link.Expire.UTC().Format(time.RFC3339), q.Get("se"))
+		assert.NotEmpty(t, q.Get("sig"))
+	}
+
+	link, err = azClient.PutRequest(ctx, "foo/bar", time.Hour)
+	if assert.NoError(t, err) {
+		uri, _ := url.Parse(link.Uri)
+		assert.Equal(t, "cw", uri.Query().Get("sp"))
+		assert.Equal(t, "oid", uri.Query().Get("skoid"))
+	}
+	link, err = azClient.DeleteRequest(ctx, "foo/bar", ExpireMaxLimit+time.Hour)
+	if assert.NoError(t, err) {
+		assert.WithinDuration(t, time.Now().Add(ExpireMaxLimit),
+			link.Expire, 2*time.Second)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&keyRequests),
+		"expected the delegation key to be cached")
+
+	_, err = azClient.DeleteRequest(ctx, "foo/bar", -time.Minute)
+	assert.ErrorIs(t, err, ErrPresignExpireNegative)
+
+	// Shared keys from the storage settings take precedence.
+	keyCtx := storage.SettingsWithContext(ctx, &model.StorageSettings{
+		Type:   model.StorageTypeAzure,
+		Bucket: "container",
+		Key:    "test",
+		Secret: "c2VjcmV0",
+	})
+	_, err = azClient.signURL(keyCtx, containerURL+"/foo/bar", sas.BlobSignatureValues{
+		Permissions: "r",
+		ExpiryTime:  time.Now().Add(time.Hour),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&keyRequests))
+}
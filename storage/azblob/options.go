@@ -16,6 +16,7 @@ package azblob
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 )
@@ -23,6 +24,12 @@ import (
 const (
 	BufferSizeMin     = 4 * 1024          // 4KiB
 	BufferSizeDefault = 8 * BufferSizeMin // 32KiB - same default as used in io.Copy
+
+	// DefaultExpire is the expiry of presigned requests if the requested
+	// duration is zero.
+	DefaultExpire  = 15 * time.Minute
+	ExpireMaxLimit = 7 * 24 * time.Hour
+	ExpireMinLimit = 1 * time.Minute
 )
 
 type SharedKeyCredentials struct {
@@ -53,10 +60,17 @@ func (creds SharedKeyCredentials) azParams(
 type Options struct {
 	ConnectionString *string
 	SharedKey        *SharedKeyCredentials
+	// ManagedIdentity authenticates with the managed identity of the
+	// host if neither ConnectionString nor SharedKey is set.
+	ManagedIdentity *ManagedIdentityCredentials
 
 	BufferSize int64
 
 	ContentType *string
+
+	// DefaultExpire is the expiry of presigned requests if the requested
+	// duration is zero (defaults to: 15 minutes).
+	DefaultExpire *time.Duration
 }
 
 func NewOptions(opts ...*Options) *Options {
@@ -73,6 +87,12 @@ func NewOptions(opts ...*Options) *Options {
 		if o.SharedKey != nil {
 			opt.SharedKey = o.SharedKey
 		}
+		if o.ManagedIdentity != nil {
+			opt.ManagedIdentity = o.ManagedIdentity
+		}
+		if o.DefaultExpire != nil {
+			opt.DefaultExpire = o.DefaultExpire
+		}
 		if o.ContentType != nil {
 			opt.ContentType = o.ContentType
 		}
@@ -93,6 +113,16 @@ func (opts *Options) SetSharedKey(sk SharedKeyCredentials) *Options {
 	return opts
 }
 
+func (opts *Options) SetManagedIdentity(mi ManagedIdentityCredentials) *Options {
+	opts.ManagedIdentity = &mi
+	return opts
+}
+
+func (opts *Options) SetDefaultExpire(expire time.Duration) *Options {
+	opts.DefaultExpire = &expire
+	return opts
+}
+
 func (opts *Options) SetContentType(typ string) *Options {
 	opts.ContentType = &typ
 	return opts
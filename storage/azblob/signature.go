@@ -17,9 +17,17 @@ package azblob
 import (
 	"context"
 	"errors"
+	"net/url"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
 
 	"github.com/mendersoftware/deployments/storage"
 )
@@ -27,8 +35,125 @@ import (
 var (
 	ErrConnStrNoName = errors.New("connection string does not contain an account name")
 	ErrConnStrNoKey  = errors.New("connection string does not contain an account key")
+	ErrNoSigningKey  = errors.New("no credentials for signing requests")
+
+	ErrPresignExpireNegative = errors.New("presign expiry must not be negative")
 )
 
+// presignExpire returns the expiry of a presigned request: the
+// DefaultExpire if expire is zero, limited to ExpireMinLimit and
+// ExpireMaxLimit (7 days). Negative expiry is rejected.
+func (c *client) presignExpire(expire time.Duration) (time.Duration, error) {
+	if expire < 0 {
+		return 0, ErrPresignExpireNegative
+	} else if expire == 0 {
+		expire = c.defaultExpire
+	}
+	if expire < ExpireMinLimit {
+		expire = ExpireMinLimit
+	} else if expire > ExpireMaxLimit {
+		expire = ExpireMaxLimit
+	}
+	return expire.Truncate(time.Second), nil
+}
+
+// delegationKeys caches the user delegation key signing the presigned
+// requests of clients authenticated with a token credential (managed
+// identity). A key is valid for up to 7 days; a new key is requested when
+// the cached key expires before the requested link.
+type delegationKeys struct {
+	service *service.Client
+
+	mu     sync.Mutex
+	key    *service.UserDelegationCredential
+	expiry time.Time
+}
+
+// serviceURL returns the URL of the storage account of the container URL.
+func serviceURL(containerURL string) (string, error) {
+	u, err := url.Parse(containerURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path, u.RawPath, u.RawQuery = "/", "", ""
+	return u.String(), nil
+}
+
+func newDelegationKeys(
+	containerURL string,
+	cred azcore.TokenCredential,
+	opts *service.ClientOptions,
+) (*delegationKeys, error) {
+	svcURL, err := serviceURL(containerURL)
+	if err != nil {
+		return nil, err
+	}
+	svc, err := service.NewClient(svcURL, cred, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &delegationKeys{service: svc}, nil
+}
+
+func (k *delegationKeys) get(
+	ctx context.Context,
+	expiry time.Time,
+) (*service.UserDelegationCredential, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.key != nil && !k.expiry.Before(expiry) {
+		return k.key, nil
+	}
+	// Start a bit earlier to tolerate clock skew with the service.
+	now := time.Now().UTC().Truncate(time.Second)
+	start, keyExpiry := now.Add(-time.Minute), now.Add(ExpireMaxLimit)
+	key, err := k.service.GetUserDelegationCredential(ctx, service.KeyInfo{
+		Start:  to.Ptr(start.Format(sas.TimeFormat)),
+		Expiry: to.Ptr(keyExpiry.Format(sas.TimeFormat)),
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	k.key, k.expiry = key, keyExpiry
+	return key, nil
+}
+
+// signURL returns the blob URL with a SAS token for the signature values.
+// The token is signed with the shared key from the context or of the
+// client, or else with a user delegation key.
+func (c *client) signURL(
+	ctx context.Context,
+	blobURL string,
+	values sas.BlobSignatureValues,
+) (string, error) {
+	urlParts, err := blob.ParseURL(blobURL)
+	if err != nil {
+		return "", err
+	}
+	values.ContainerName = urlParts.ContainerName
+	values.BlobName = urlParts.BlobName
+	sk, err := c.credentialsFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	var qParams sas.QueryParameters
+	if sk != nil {
+		qParams, err = values.SignWithSharedKey(sk)
+	} else if c.delegation != nil {
+		var key *service.UserDelegationCredential
+		key, err = c.delegation.get(ctx, values.ExpiryTime)
+		if err == nil {
+			qParams, err = values.SignWithUserDelegation(key)
+		}
+	} else {
+		err = ErrNoSigningKey
+	}
+	if err != nil {
+		return "", err
+	}
+	return buildSignedURL(blobURL, qParams)
+}
+
 func (c *client) credentialsFromContext(
 	ctx context.Context,
 ) (creds *azblob.SharedKeyCredential, err error) {
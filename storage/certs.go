@@ -16,22 +16,97 @@ package storage
 
 import (
 	"crypto/x509"
+	"encoding/pem"
 	"os"
+	"sync"
 )
 
-const storageBackendCertEnvName = "STORAGE_BACKEND_CERT"
+const (
+	storageBackendCertEnvName     = "STORAGE_BACKEND_CERT"
+	storageBackendCertFileEnvName = "STORAGE_BACKEND_CERT_FILE"
+)
 
 var getEnv = func(key string) string {
 	return os.Getenv(key)
 }
 
-func GetRootCAs() *x509.CertPool {
-	rootCAs, _ := x509.SystemCertPool()
-	if rootCAs == nil {
-		rootCAs = x509.NewCertPool()
+// rootCAs caches the certificates trusted in addition to the system pool.
+var rootCAs struct {
+	sync.RWMutex
+	loaded bool
+	certs  []*x509.Certificate
+}
+
+// parseCerts returns the certificates in the PEM encoded data; blocks that
+// are not certificates or fail to parse are skipped.
+func parseCerts(pemCerts []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for len(pemCerts) > 0 {
+		var block *pem.Block
+		block, pemCerts = pem.Decode(pemCerts)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" || len(block.Headers) != 0 {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		certs = append(certs, cert)
 	}
+	return certs
+}
+
+func loadCerts() []*x509.Certificate {
+	var certs []*x509.Certificate
 	if storageBackendCert := getEnv(storageBackendCertEnvName); storageBackendCert != "" {
-		rootCAs.AppendCertsFromPEM([]byte(storageBackendCert))
+		certs = append(certs, parseCerts([]byte(storageBackendCert))...)
+	}
+	if certFile := getEnv(storageBackendCertFileEnvName); certFile != "" {
+		if pemCerts, err := os.ReadFile(certFile); err == nil {
+			certs = append(certs, parseCerts(pemCerts)...)
+		}
+	}
+	return certs
+}
+
+// ReloadRootCAs re-reads the certificates from STORAGE_BACKEND_CERT and
+// the file at STORAGE_BACKEND_CERT_FILE. Only pools returned by GetRootCAs
+// afterwards include the new certificates: clients created before the
+// reload keep trusting the previous set.
+func ReloadRootCAs() {
+	certs := loadCerts()
+	rootCAs.Lock()
+	rootCAs.certs = certs
+	rootCAs.loaded = true
+	rootCAs.Unlock()
+}
+
+// GetRootCAs returns the system root pool extended with the certificates
+// from STORAGE_BACKEND_CERT and STORAGE_BACKEND_CERT_FILE. The certificates
+// are loaded on the first call and cached until ReloadRootCAs is called.
+// Every call returns a new pool, which the caller may extend.
+func GetRootCAs() *x509.CertPool {
+	rootCAs.RLock()
+	loaded, certs := rootCAs.loaded, rootCAs.certs
+	rootCAs.RUnlock()
+	if !loaded {
+		rootCAs.Lock()
+		if !rootCAs.loaded {
+			rootCAs.certs = loadCerts()
+			rootCAs.loaded = true
+		}
+		certs = rootCAs.certs
+		rootCAs.Unlock()
+	}
+	pool, _ := x509.SystemCertPool()
+	if pool == nil {
+		pool = x509.NewCertPool()
+	}
+	for _, cert := range certs {
+		pool.AddCert(cert)
 	}
-	return rootCAs
+	return pool
 }
@@ -17,6 +17,7 @@ package storage
 import (
 	"crypto/x509"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -65,10 +66,15 @@ func TestGetRootCAs(t *testing.T) {
 			oldGetEnv := getEnv
 			defer func() {
 				getEnv = oldGetEnv
+				ReloadRootCAs()
 			}()
 			getEnv = func(key string) string {
-				return tc.certPEM
+				if key == storageBackendCertEnvName {
+					return tc.certPEM
+				}
+				return ""
 			}
+			ReloadRootCAs()
 			deploymentsRootCAs := GetRootCAs()
 			assert.NotNil(t, deploymentsRootCAs)
 
@@ -80,3 +86,37 @@ func TestGetRootCAs(t *testing.T) {
 		})
 	}
 }
+
+func TestReloadRootCAs(t *testing.T) {
+	rootCAs, _ := x509.SystemCertPool()
+	systemCerts := len(rootCAs.Subjects())
+
+	certFile := filepath.Join(t.TempDir(), "ca.crt")
+	oldGetEnv := getEnv
+	defer func() {
+		getEnv = oldGetEnv
+		ReloadRootCAs()
+	}()
+	getEnv = func(key string) string {
+		if key == storageBackendCertFileEnvName {
+			return certFile
+		}
+		return ""
+	}
+	ReloadRootCAs()
+
+	before := GetRootCAs()
+	assert.Equal(t, systemCerts, len(before.Subjects()))
+
+	// The certificates are cached until reloaded.
+	if err := os.WriteFile(certFile, []byte(cert), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, systemCerts, len(GetRootCAs().Subjects()))
+
+	ReloadRootCAs()
+	after := GetRootCAs()
+	assert.Equal(t, systemCerts+1, len(after.Subjects()))
+	assert.Equal(t, systemCerts, len(before.Subjects()),
+		"pools returned before the reload must not change")
+}
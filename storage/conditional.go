@@ -0,0 +1,64 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package storage
+
+import "context"
+
+type ifNoneMatchContextKey struct{}
+
+// IfNoneMatchWithContext makes downloads with the returned context
+// conditional: if the object ETag matches etag, GetObject returns
+// ErrNotModified, and presigned GET requests respond with 304 Not Modified.
+// Backends that do not support conditional requests return the object.
+func IfNoneMatchWithContext(ctx context.Context, etag string) context.Context {
+	return context.WithValue(ctx, ifNoneMatchContextKey{}, etag)
+}
+
+func IfNoneMatchFromContext(ctx context.Context) (string, bool) {
+	etag, ok := ctx.Value(ifNoneMatchContextKey{}).(string)
+	return etag, ok && etag != ""
+}
+
+// PutCondition makes an upload conditional on the object currently stored
+// at the path, preventing lost updates when uploads race for the same path.
+type PutCondition struct {
+	// IfMatch is the ETag the stored object must have.
+	IfMatch string
+	// IfNotExists requires that no object is stored at the path.
+	IfNotExists bool
+}
+
+type putConditionContextKey struct{}
+
+// PutConditionWithContext makes uploads with the returned context
+// conditional: PutObject returns ErrPreconditionFailed if the condition is
+// not met, leaving the stored object as is. The condition is checked when
+// the upload completes, so a large object might be transferred before it
+// is rejected.
+//
+// The s3 backend sends the If-Match and If-None-Match headers; S3
+// compatible services without conditional writes ignore them and overwrite
+// the object unconditionally. The azblob backend commits the blob with the
+// corresponding access conditions. The local backend checks the condition
+// before storing the object, which is not atomic with concurrent uploads.
+// Presigned upload requests are not conditional.
+func PutConditionWithContext(ctx context.Context, cond PutCondition) context.Context {
+	return context.WithValue(ctx, putConditionContextKey{}, cond)
+}
+
+func PutConditionFromContext(ctx context.Context) (PutCondition, bool) {
+	cond, ok := ctx.Value(putConditionContextKey{}).(PutCondition)
+	return cond, ok && (cond.IfMatch != "" || cond.IfNotExists)
+}
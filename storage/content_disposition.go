@@ -0,0 +1,79 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AttachmentDisposition returns the content-disposition for downloading an
+// object as filename, e.g. the name of the artifact rather than its key.
+func AttachmentDisposition(filename string) string {
+	return "attachment; " + FilenameParams(filename)
+}
+
+// FilenameParams returns the content-disposition filename parameters as
+// specified by RFC 6266. Quotes and backslashes are escaped; names that are
+// not plain ASCII get an ASCII fallback in addition to the UTF-8 encoded
+// filename* parameter.
+func FilenameParams(filename string) string {
+	var (
+		fallback strings.Builder
+		isASCII  = true
+	)
+	for _, c := range filename {
+		switch {
+		case c < ' ' || c >= 0x7F:
+			isASCII = false
+			fallback.WriteByte('_')
+		case c == '"' || c == '\\':
+			fallback.WriteByte('\\')
+			fallback.WriteRune(c)
+		default:
+			fallback.WriteRune(c)
+		}
+	}
+	params := fmt.Sprintf(`filename="%s"`, fallback.String())
+	if !isASCII {
+		params += "; filename*=UTF-8''" + encodeExtValue(filename)
+	}
+	return params
+}
+
+// encodeExtValue percent-encodes s as an RFC 5987 ext-value.
+func encodeExtValue(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0x0F])
+		}
+	}
+	return b.String()
+}
+
+func isAttrChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
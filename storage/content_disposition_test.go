@@ -0,0 +1,72 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttachmentDisposition(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		Filename string
+
+		ContentDisposition string
+	}{
+		"ascii": {
+			Filename: "release-1.0.mender",
+
+			ContentDisposition: `attachment; filename="release-1.0.mender"`,
+		},
+		"spaces": {
+			Filename: "release 1.0.mender",
+
+			ContentDisposition: `attachment; filename="release 1.0.mender"`,
+		},
+		"quotes and backslashes": {
+			Filename: `release "1.0"\beta.mender`,
+
+			ContentDisposition: `attachment; filename="release \"1.0\"\\beta.mender"`,
+		},
+		"unicode": {
+			Filename: "rélease 1.0 🚀.mender",
+
+			ContentDisposition: `attachment; filename="r_lease 1.0 _.mender"; ` +
+				`filename*=UTF-8''r%C3%A9lease%201.0%20%F0%9F%9A%80.mender`,
+		},
+		"unicode and quotes": {
+			Filename: `bär "1".mender`,
+
+			ContentDisposition: `attachment; filename="b_r \"1\".mender"; ` +
+				`filename*=UTF-8''b%C3%A4r%20%221%22.mender`,
+		},
+		"control characters": {
+			Filename: "release\r\nX-Injected: 1.mender",
+
+			ContentDisposition: `attachment; filename="release__X-Injected: 1.mender"; ` +
+				`filename*=UTF-8''release%0D%0AX-Injected%3A%201.mender`,
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.ContentDisposition, AttachmentDisposition(tc.Filename))
+		})
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrEndpointsNotSupported = errors.New("storage does not resolve endpoints")
+
+// EndpointResolver is implemented by the object storages that can report
+// the endpoints resolved from their configuration, for diagnostics.
+type EndpointResolver interface {
+	// ResolvedEndpoints returns the endpoint the storage sends requests
+	// to and the endpoint the presigned links point to.
+	ResolvedEndpoints(ctx context.Context) (client, presign string, err error)
+}
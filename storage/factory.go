@@ -0,0 +1,83 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrUnknownKind    = errors.New("storage: unknown storage kind")
+	ErrInvalidOptions = errors.New("storage: invalid options for storage kind")
+)
+
+// Factory creates an ObjectStorage of a kind registered with Register.
+// The options are the options type of the backend package (e.g.
+// *s3.Options); nil selects the default options. Backends without buckets
+// ignore the bucket argument.
+type Factory func(ctx context.Context, bucket string, options interface{}) (ObjectStorage, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a backend available to New under the given kind. The
+// backend packages register themselves when imported; Register panics if
+// the kind is registered twice.
+func Register(kind string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if factory == nil {
+		panic("storage: Register factory is nil")
+	}
+	if _, dup := factories[kind]; dup {
+		panic("storage: Register called twice for kind " + kind)
+	}
+	factories[kind] = factory
+}
+
+// Kinds returns the sorted list of the registered storage kinds.
+func Kinds() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	kinds := make([]string, 0, len(factories))
+	for kind := range factories {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// New creates an ObjectStorage of the given kind. It returns
+// ErrUnknownKind if no backend is registered for kind, and
+// ErrInvalidOptions if the options are not of the backend's type.
+func New(
+	ctx context.Context,
+	kind, bucket string,
+	options interface{},
+) (ObjectStorage, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[kind]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKind, kind)
+	}
+	return factory(ctx, bucket, options)
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStorage struct {
+	ObjectStorage
+	bucket  string
+	options interface{}
+}
+
+func TestFactory(t *testing.T) {
+	errFactory := errors.New("factory error")
+	Register("test/ok", func(
+		ctx context.Context,
+		bucket string,
+		options interface{},
+	) (ObjectStorage, error) {
+		return &fakeStorage{bucket: bucket, options: options}, nil
+	})
+	Register("test/error", func(
+		ctx context.Context,
+		bucket string,
+		options interface{},
+	) (ObjectStorage, error) {
+		return nil, errFactory
+	})
+	assert.Subset(t, Kinds(), []string{"test/error", "test/ok"})
+
+	objStore, err := New(context.Background(), "test/ok", "bucket", "options")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &fakeStorage{bucket: "bucket", options: "options"}, objStore)
+	}
+	_, err = New(context.Background(), "test/error", "bucket", nil)
+	assert.ErrorIs(t, err, errFactory)
+	_, err = New(context.Background(), "test/unknown", "bucket", nil)
+	assert.ErrorIs(t, err, ErrUnknownKind)
+
+	assert.Panics(t, func() {
+		Register("test/ok", func(
+			context.Context, string, interface{},
+		) (ObjectStorage, error) {
+			return nil, nil
+		})
+	}, "registering a kind twice must panic")
+	assert.Panics(t, func() {
+		Register("test/nil", nil)
+	})
+}
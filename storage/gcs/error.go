@@ -0,0 +1,95 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package gcs
+
+import (
+	"errors"
+	"net/http"
+
+	gstorage "cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+
+	"github.com/mendersoftware/deployments/storage"
+)
+
+type OpError struct {
+	Op      string
+	Message string
+	Reason  error
+}
+
+func (err OpError) Error() string {
+	errStr := "gcs"
+	if err.Op != "" {
+		errStr += " " + err.Op
+	}
+	if err.Message != "" {
+		errStr += ": " + err.Message
+	}
+	if err.Reason != nil {
+		errStr += ": " + err.Reason.Error()
+	}
+	return errStr
+}
+
+func (err OpError) Unwrap() error {
+	return err.Reason
+}
+
+const (
+	OpHealthCheck    = "HealthCheck"
+	OpGetObject      = "GetObject"
+	OpGetObjectRange = "GetObjectRange"
+	OpPutObject      = "PutObject"
+	OpDeleteObject   = "DeleteObject"
+	OpStatObject     = "StatObject"
+	OpGetRequest     = "GetRequest"
+	OpDeleteRequest  = "DeleteRequest"
+	OpPutRequest     = "PutRequest"
+)
+
+var (
+	ErrPresignExpireNegative = errors.New("presign expiry must not be negative")
+)
+
+// translateError maps the errors of the storage API to the errors of the
+// storage package.
+func translateError(err error) error {
+	var apiErr *googleapi.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gstorage.ErrObjectNotExist):
+		return storage.ErrObjectNotFound
+	case errors.Is(err, gstorage.ErrBucketNotExist):
+		return storage.ErrBucketNotFound
+	case errors.As(err, &apiErr):
+		switch apiErr.Code {
+		case http.StatusNotFound:
+			return storage.ErrObjectNotFound
+		case http.StatusNotModified:
+			return storage.ErrNotModified
+		case http.StatusForbidden:
+			return storage.ErrAccessDenied
+		case http.StatusPreconditionFailed:
+			return storage.ErrPreconditionFailed
+		case http.StatusRequestedRangeNotSatisfiable:
+			return storage.ErrInvalidRange
+		case http.StatusTooManyRequests:
+			return storage.ErrThrottled
+		}
+	}
+	return err
+}
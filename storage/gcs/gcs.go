@@ -0,0 +1,464 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package gcs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	gstorage "cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/storage"
+)
+
+// Kind is the kind of the Google Cloud Storage in storage.New.
+const Kind = "gcs"
+
+type client struct {
+	bucket         *gstorage.BucketHandle
+	serviceAccount string
+	contentType    *string
+	chunkSize      int
+	defaultExpire  time.Duration
+}
+
+var (
+	_ storage.ObjectStorage = &client{}
+	_ storage.Presigner     = &client{}
+)
+
+func init() {
+	storage.Register(Kind, func(
+		ctx context.Context,
+		bucket string,
+		options interface{},
+	) (storage.ObjectStorage, error) {
+		opt, ok := options.(*Options)
+		if !ok && options != nil {
+			return nil, fmt.Errorf("%w: expected *gcs.Options, got %T",
+				storage.ErrInvalidOptions, options)
+		}
+		return New(ctx, bucket, opt)
+	})
+}
+
+// New initializes a client of the bucket with the native Google Cloud
+// Storage API: objects are uploaded with the SDK (resumable uploads in
+// chunks of ChunkSize) and requests are presigned as V4 signed URLs.
+func New(ctx context.Context, bucket string, opts ...*Options) (storage.ObjectStorage, error) {
+	opt := NewOptions(opts...)
+	var clientOpts []option.ClientOption
+	if opt.CredentialsJSON != nil {
+		clientOpts = append(clientOpts,
+			option.WithCredentialsJSON([]byte(*opt.CredentialsJSON)))
+	} else if opt.CredentialsFile != nil {
+		clientOpts = append(clientOpts,
+			option.WithCredentialsFile(*opt.CredentialsFile))
+	}
+	if opt.URI != nil {
+		clientOpts = append(clientOpts, option.WithEndpoint(
+			strings.TrimSuffix(*opt.URI, "/")+"/storage/v1/",
+		))
+	}
+	gc, err := gstorage.NewClient(ctx, clientOpts...)
+	if err != nil {
+		return nil, OpError{
+			Message: "failed to initialize client",
+			Reason:  err,
+		}
+	}
+	objStore := &client{
+		bucket:        gc.Bucket(bucket),
+		contentType:   opt.ContentType,
+		chunkSize:     ChunkSizeDefault,
+		defaultExpire: DefaultExpire,
+	}
+	if opt.ServiceAccount != nil {
+		objStore.serviceAccount = *opt.ServiceAccount
+	}
+	if opt.ChunkSize != nil {
+		objStore.chunkSize = *opt.ChunkSize
+	}
+	if opt.DefaultExpire != nil {
+		objStore.defaultExpire = *opt.DefaultExpire
+	}
+	if err := objStore.HealthCheck(ctx); err != nil {
+		return nil, err
+	}
+	return objStore, nil
+}
+
+func (c *client) HealthCheck(ctx context.Context) error {
+	_, err := c.bucket.Attrs(ctx)
+	if err != nil {
+		return OpError{
+			Op:     OpHealthCheck,
+			Reason: translateError(err),
+		}
+	}
+	return nil
+}
+
+type objectReader struct {
+	io.ReadCloser
+	length int64
+}
+
+func (r objectReader) Length() int64 {
+	return r.length
+}
+
+type rangeReader struct {
+	objectReader
+	contentRange string
+}
+
+func (r rangeReader) ContentRange() string {
+	return r.contentRange
+}
+
+func (c *client) GetObject(
+	ctx context.Context,
+	objectPath string,
+) (io.ReadCloser, error) {
+	r, err := c.newRangeReader(ctx, OpGetObject, objectPath, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	return objectReader{
+		ReadCloser: r,
+		length:     r.Remain(),
+	}, nil
+}
+
+func (c *client) GetObjectRange(
+	ctx context.Context,
+	objectPath string,
+	offset, length int64,
+) (storage.RangeReader, error) {
+	if _, err := storage.ValidateRange(offset, length); err != nil {
+		return nil, OpError{
+			Op:     OpGetObjectRange,
+			Reason: err,
+		}
+	}
+	r, err := c.newRangeReader(ctx, OpGetObjectRange, objectPath, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	start := r.Attrs.StartOffset
+	return rangeReader{
+		objectReader: objectReader{
+			ReadCloser: r,
+			length:     r.Remain(),
+		},
+		contentRange: fmt.Sprintf("bytes %d-%d/%d",
+			start, start+r.Remain()-1, r.Attrs.Size),
+	}, nil
+}
+
+// newRangeReader reads the object as stored, i.e. without decompressing
+// gzip encoded objects. The SDK does not support ETag conditions, so
+// conditional reads (storage.IfNoneMatchWithContext) look up the object
+// first and read the generation that was compared.
+func (c *client) newRangeReader(
+	ctx context.Context,
+	op string,
+	objectPath string,
+	offset, length int64,
+) (*gstorage.Reader, error) {
+	obj := c.bucket.Object(objectPath).ReadCompressed(true)
+	if etag, ok := storage.IfNoneMatchFromContext(ctx); ok {
+		attrs, err := obj.Attrs(ctx)
+		if err == nil && attrs.Etag == etag {
+			err = storage.ErrNotModified
+		}
+		if err != nil {
+			return nil, OpError{
+				Op:     op,
+				Reason: translateError(err),
+			}
+		}
+		obj = obj.Generation(attrs.Generation)
+	}
+	r, err := obj.NewRangeReader(ctx, offset, length)
+	if err != nil {
+		return nil, OpError{
+			Op:     op,
+			Reason: translateError(err),
+		}
+	}
+	return r, nil
+}
+
+func (c *client) PutObject(
+	ctx context.Context,
+	objectPath string,
+	src io.Reader,
+) error {
+	obj := c.bucket.Object(objectPath)
+	if cond, ok := storage.PutConditionFromContext(ctx); ok {
+		var err error
+		obj, err = c.putCondition(ctx, obj, cond)
+		if err != nil {
+			return OpError{
+				Op:     OpPutObject,
+				Reason: err,
+			}
+		}
+	}
+	// Canceling the context aborts the upload.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := obj.NewWriter(ctx)
+	w.ChunkSize = c.chunkSize
+	if c.contentType != nil {
+		w.ContentType = *c.contentType
+	}
+	if tags, ok := storage.ObjectTagsFromContext(ctx); ok {
+		// Objects have no tags: the tags are stored as metadata.
+		w.Metadata = tags
+	}
+	_, err := io.Copy(w, src)
+	if err != nil {
+		cancel()
+		_ = w.Close()
+	} else {
+		err = w.Close()
+	}
+	if err != nil {
+		return OpError{
+			Op:      OpPutObject,
+			Message: "failed to upload object",
+			Reason:  translateError(err),
+		}
+	}
+	return nil
+}
+
+// putCondition returns the object handle with the preconditions of cond.
+// The preconditions of the API are on the generation of the object, so
+// the ETag of IfMatch is compared with the current object first.
+func (c *client) putCondition(
+	ctx context.Context,
+	obj *gstorage.ObjectHandle,
+	cond storage.PutCondition,
+) (*gstorage.ObjectHandle, error) {
+	if cond.IfMatch == "" {
+		return obj.If(gstorage.Conditions{DoesNotExist: true}), nil
+	} else if cond.IfNotExists {
+		// The object must exist to match.
+		return nil, storage.ErrPreconditionFailed
+	}
+	attrs, err := obj.Attrs(ctx)
+	if errors.Is(err, gstorage.ErrObjectNotExist) ||
+		(err == nil && attrs.Etag != cond.IfMatch) {
+		err = storage.ErrPreconditionFailed
+	}
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return obj.If(gstorage.Conditions{GenerationMatch: attrs.Generation}), nil
+}
+
+func (c *client) DeleteObject(
+	ctx context.Context,
+	path string,
+) error {
+	err := c.bucket.Object(path).Delete(ctx)
+	if err != nil {
+		return OpError{
+			Op:      OpDeleteObject,
+			Message: "failed to delete object",
+			Reason:  translateError(err),
+		}
+	}
+	return nil
+}
+
+func (c *client) StatObject(
+	ctx context.Context,
+	path string,
+) (*storage.ObjectInfo, error) {
+	attrs, err := c.bucket.Object(path).Attrs(ctx)
+	if err != nil {
+		return nil, OpError{
+			Op:      OpStatObject,
+			Message: "failed to retrieve object attributes",
+			Reason:  translateError(err),
+		}
+	}
+	return objectInfo(path, attrs), nil
+}
+
+func objectInfo(path string, attrs *gstorage.ObjectAttrs) *storage.ObjectInfo {
+	info := &storage.ObjectInfo{
+		Path:         path,
+		Size:         &attrs.Size,
+		LastModified: &attrs.Updated,
+	}
+	if attrs.Etag != "" {
+		info.ETag = &attrs.Etag
+	}
+	if attrs.ContentType != "" {
+		info.ContentType = &attrs.ContentType
+	}
+	if attrs.ContentEncoding != "" {
+		info.ContentEncoding = &attrs.ContentEncoding
+	}
+	return info
+}
+
+// GetRequest duration is limited to 7 days (V4 signature limitation); the
+// DefaultExpire is used if the duration is zero. Like s3, the link
+// downloads the object as filename with the configured content type.
+func (c *client) GetRequest(
+	ctx context.Context,
+	objectPath string,
+	filename string,
+	duration time.Duration,
+) (*model.Link, error) {
+	return c.PresignGet(ctx, objectPath, storage.PresignOptions{
+		Expire:   duration,
+		Filename: filename,
+	})
+}
+
+// PresignGet implements storage.Presigner; like GetRequest, the expiry is
+// limited to 7 days. The response headers of the options take precedence
+// over the ones from the context.
+func (c *client) PresignGet(
+	ctx context.Context,
+	objectPath string,
+	presignOpts storage.PresignOptions,
+) (*model.Link, error) {
+	duration, err := c.presignExpire(presignOpts.Expire)
+	if err != nil {
+		return nil, OpError{
+			Op:     OpGetRequest,
+			Reason: err,
+		}
+	}
+	// Check if object exists
+	attrs, err := c.bucket.Object(objectPath).Attrs(ctx)
+	if err == nil {
+		err = storage.CheckMaxBytes(objectInfo(objectPath, attrs), presignOpts.MaxBytes)
+	}
+	if err != nil {
+		return nil, OpError{
+			Op:      OpGetRequest,
+			Message: "failed to check preconditions",
+			Reason:  translateError(err),
+		}
+	}
+	var contentDisposition string
+	if presignOpts.Filename != "" {
+		contentDisposition = storage.AttachmentDisposition(presignOpts.Filename)
+	}
+	hdr, _ := storage.ResponseHeadersFromContext(ctx)
+	if presignOpts.ResponseHeaders.ContentType != "" {
+		hdr.ContentType = presignOpts.ResponseHeaders.ContentType
+	}
+	if presignOpts.ResponseHeaders.ContentDisposition != "" {
+		hdr.ContentDisposition = presignOpts.ResponseHeaders.ContentDisposition
+	}
+	if hdr.ContentDisposition != "" {
+		contentDisposition = hdr.ContentDisposition
+	}
+	if hdr.ContentType == "" && c.contentType != nil {
+		hdr.ContentType = *c.contentType
+	}
+	query := make(map[string][]string, 2)
+	if contentDisposition != "" {
+		query[paramResponseContentDisposition] = []string{contentDisposition}
+	}
+	if hdr.ContentType != "" {
+		query[paramResponseContentType] = []string{hdr.ContentType}
+	}
+	link, err := c.signURL(objectPath, http.MethodGet, duration, query)
+	if err != nil {
+		return nil, OpError{
+			Op:      OpGetRequest,
+			Message: "failed to create pre-signed URL",
+			Reason:  err,
+		}
+	}
+	return link, nil
+}
+
+func (c *client) DeleteRequest(
+	ctx context.Context,
+	path string,
+	duration time.Duration,
+) (*model.Link, error) {
+	if _, ok := storage.ResponseHeadersFromContext(ctx); ok {
+		return nil, OpError{
+			Op:     OpDeleteRequest,
+			Reason: storage.ErrResponseHeadersNotGET,
+		}
+	}
+	duration, err := c.presignExpire(duration)
+	if err != nil {
+		return nil, OpError{
+			Op:     OpDeleteRequest,
+			Reason: err,
+		}
+	}
+	link, err := c.signURL(path, http.MethodDelete, duration, nil)
+	if err != nil {
+		return nil, OpError{
+			Op:      OpDeleteRequest,
+			Message: "failed to generate signed URL",
+			Reason:  err,
+		}
+	}
+	return link, nil
+}
+
+func (c *client) PutRequest(
+	ctx context.Context,
+	objectPath string,
+	duration time.Duration,
+) (*model.Link, error) {
+	if _, ok := storage.ResponseHeadersFromContext(ctx); ok {
+		return nil, OpError{
+			Op:     OpPutRequest,
+			Reason: storage.ErrResponseHeadersNotGET,
+		}
+	}
+	duration, err := c.presignExpire(duration)
+	if err != nil {
+		return nil, OpError{
+			Op:     OpPutRequest,
+			Reason: err,
+		}
+	}
+	link, err := c.signURL(objectPath, http.MethodPut, duration, nil)
+	if err != nil {
+		return nil, OpError{
+			Op:      OpPutRequest,
+			Message: "failed to generate signed URL",
+			Reason:  err,
+		}
+	}
+	return link, nil
+}
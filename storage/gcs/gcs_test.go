@@ -0,0 +1,530 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/storage"
+	"github.com/mendersoftware/deployments/storage/storagetest"
+)
+
+const (
+	testBucket         = "bucket"
+	testServiceAccount = "deployments@project.iam.gserviceaccount.com"
+)
+
+type fakeObject struct {
+	data        []byte
+	generation  int64
+	contentType string
+	metadata    map[string]string
+	updated     time.Time
+}
+
+func (o *fakeObject) etag() string {
+	return "CA" + strconv.FormatInt(o.generation, 10) + "E="
+}
+
+// fakeGCS is an in-memory server of the subset of the JSON and XML APIs
+// of Google Cloud Storage used by the client, including the OAuth token
+// endpoint of the service account.
+type fakeGCS struct {
+	t *testing.T
+
+	mu         sync.Mutex
+	objects    map[string]*fakeObject
+	sessions   map[string]*bytes.Buffer
+	generation int64
+	chunks     int
+}
+
+func newFakeGCS(t *testing.T) *fakeGCS {
+	return &fakeGCS{
+		t:        t,
+		objects:  make(map[string]*fakeObject),
+		sessions: make(map[string]*bytes.Buffer),
+	}
+}
+
+func (f *fakeGCS) objectResource(name string, obj *fakeObject) map[string]interface{} {
+	return map[string]interface{}{
+		"bucket":      testBucket,
+		"name":        name,
+		"size":        strconv.Itoa(len(obj.data)),
+		"generation":  strconv.FormatInt(obj.generation, 10),
+		"etag":        obj.etag(),
+		"contentType": obj.contentType,
+		"metadata":    obj.metadata,
+		"updated":     obj.updated.Format(time.RFC3339Nano),
+	}
+}
+
+func (f *fakeGCS) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeGCS) writeError(w http.ResponseWriter, status int) {
+	f.writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    status,
+			"message": http.StatusText(status),
+		},
+	})
+}
+
+// checkGeneration checks the ifGenerationMatch precondition.
+func (f *fakeGCS) checkGeneration(q url.Values, name string) bool {
+	match := q.Get("ifGenerationMatch")
+	if match == "" {
+		return true
+	}
+	var generation int64
+	if obj, ok := f.objects[name]; ok {
+		generation = obj.generation
+	}
+	return match == strconv.FormatInt(generation, 10)
+}
+
+func (f *fakeGCS) store(
+	w http.ResponseWriter,
+	q url.Values,
+	metadata map[string]interface{},
+	data []byte,
+) {
+	name, _ := metadata["name"].(string)
+	if !f.checkGeneration(q, name) {
+		f.writeError(w, http.StatusPreconditionFailed)
+		return
+	}
+	f.generation++
+	obj := &fakeObject{
+		data:       data,
+		generation: f.generation,
+		updated:    time.Now().UTC(),
+		metadata:   make(map[string]string),
+	}
+	obj.contentType, _ = metadata["contentType"].(string)
+	if md, ok := metadata["metadata"].(map[string]interface{}); ok {
+		for key, value := range md {
+			obj.metadata[key], _ = value.(string)
+		}
+	}
+	f.objects[name] = obj
+	f.writeJSON(w, http.StatusOK, f.objectResource(name, obj))
+}
+
+func (f *fakeGCS) upload(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	switch q.Get("uploadType") {
+	case "multipart":
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if !assert.NoError(f.t, err) {
+			f.writeError(w, http.StatusBadRequest)
+			return
+		}
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		var metadata map[string]interface{}
+		part, _ := mr.NextPart()
+		_ = json.NewDecoder(part).Decode(&metadata)
+		part, _ = mr.NextPart()
+		data, _ := io.ReadAll(part)
+		f.store(w, q, metadata, data)
+
+	case "resumable":
+		var metadata map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&metadata)
+		id := strconv.Itoa(len(f.sessions))
+		f.sessions[id] = new(bytes.Buffer)
+		session := &url.URL{
+			Scheme:   "http",
+			Host:     r.Host,
+			Path:     "/upload/session/" + id,
+			RawQuery: q.Encode(),
+		}
+		meta, _ := json.Marshal(metadata)
+		f.sessions[id+"/meta"] = bytes.NewBuffer(meta)
+		w.Header().Set("Location", session.String())
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		f.writeError(w, http.StatusBadRequest)
+	}
+}
+
+func (f *fakeGCS) uploadChunk(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/upload/session/")
+	buf, ok := f.sessions[id]
+	if !ok {
+		f.writeError(w, http.StatusNotFound)
+		return
+	}
+	chunk, _ := io.ReadAll(r.Body)
+	buf.Write(chunk)
+	f.chunks++
+	contentRange := r.Header.Get("Content-Range")
+	if strings.HasSuffix(contentRange, "/*") {
+		// The client asks for "308 Resume Incomplete" as header with
+		// X-GUploader-No-308.
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", buf.Len()-1))
+		w.Header().Set("X-Http-Status-Code-Override", "308")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	var metadata map[string]interface{}
+	_ = json.Unmarshal(f.sessions[id+"/meta"].Bytes(), &metadata)
+	f.store(w, r.URL.Query(), metadata, buf.Bytes())
+}
+
+// read serves the XML API downloads, including presigned requests.
+func (f *fakeGCS) read(w http.ResponseWriter, r *http.Request, name string) {
+	q := r.URL.Query()
+	if q.Get("X-Goog-Signature") != "" {
+		assert.Equal(f.t, "GOOG4-RSA-SHA256", q.Get("X-Goog-Algorithm"))
+		assert.True(f.t,
+			strings.HasPrefix(q.Get("X-Goog-Credential"), testServiceAccount+"/"),
+			"credential %q", q.Get("X-Goog-Credential"))
+	} else {
+		assert.Equal(f.t, "Bearer test-token", r.Header.Get("Authorization"))
+	}
+	obj, ok := f.objects[name]
+	if !ok || (q.Get("generation") != "" &&
+		q.Get("generation") != strconv.FormatInt(obj.generation, 10)) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	contentType := obj.contentType
+	if value := q.Get("response-content-type"); value != "" {
+		contentType = value
+	}
+	w.Header().Set("Content-Type", contentType)
+	if value := q.Get("response-content-disposition"); value != "" {
+		w.Header().Set("Content-Disposition", value)
+	}
+	w.Header().Set("X-Goog-Generation", strconv.FormatInt(obj.generation, 10))
+	w.Header().Set("X-Goog-Metageneration", "1")
+	http.ServeContent(w, r, "", obj.updated, bytes.NewReader(obj.data))
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	const (
+		bucketPath = "/storage/v1/b/" + testBucket
+		objectPath = bucketPath + "/o/"
+	)
+	switch {
+	case r.URL.Path == "/token":
+		f.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": "test-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+
+	case r.URL.Path == "/upload/storage/v1/b/"+testBucket+"/o":
+		f.upload(w, r)
+
+	case strings.HasPrefix(r.URL.Path, "/upload/session/"):
+		f.uploadChunk(w, r)
+
+	case r.URL.Path == bucketPath:
+		f.writeJSON(w, http.StatusOK, map[string]interface{}{"name": testBucket})
+
+	case strings.HasPrefix(r.URL.Path, objectPath):
+		name := strings.TrimPrefix(r.URL.Path, objectPath)
+		obj, ok := f.objects[name]
+		if !ok {
+			f.writeError(w, http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			f.writeJSON(w, http.StatusOK, f.objectResource(name, obj))
+		case http.MethodDelete:
+			delete(f.objects, name)
+			w.WriteHeader(http.StatusNoContent)
+		}
+
+	case strings.HasPrefix(r.URL.Path, "/"+testBucket+"/"):
+		f.read(w, r, strings.TrimPrefix(r.URL.Path, "/"+testBucket+"/"))
+
+	default:
+		f.writeError(w, http.StatusNotFound)
+	}
+}
+
+// testCredentials returns the JSON key of a service account requesting
+// tokens from the test server.
+func testCredentials(t *testing.T, srvURL string) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	creds, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "project",
+		"private_key_id": "key",
+		"private_key":    string(keyPEM),
+		"client_email":   testServiceAccount,
+		"client_id":      "1",
+		"token_uri":      srvURL + "/token",
+	})
+	return string(creds)
+}
+
+// redirectTransport sends the requests to storage.googleapis.com to the
+// test server.
+type redirectTransport struct {
+	host string
+}
+
+func (rt redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = "http"
+	req.URL.Host = rt.host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newTestStorageAndServer(
+	t *testing.T,
+	opts ...*Options,
+) (storage.ObjectStorage, *fakeGCS, *httptest.Server) {
+	fake := newFakeGCS(t)
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	opt := NewOptions(append([]*Options{NewOptions().
+		SetCredentialsJSON(testCredentials(t, srv.URL)).
+		SetURI(srv.URL).
+		SetContentType("vnd/testing"),
+	}, opts...)...)
+	objStore, err := New(context.Background(), testBucket, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return objStore, fake, srv
+}
+
+func TestStorageNew(t *testing.T) {
+	assert.Contains(t, storage.Kinds(), Kind)
+	_, err := storage.New(context.Background(), Kind, "bucket", "options")
+	assert.ErrorIs(t, err, storage.ErrInvalidOptions)
+}
+
+func TestObjectStorage(t *testing.T) {
+	t.Parallel()
+
+	objStore, _, _ := newTestStorageAndServer(t)
+	ctx := context.Background()
+	const content = "imagine artifacts"
+
+	ctxTags := storage.ObjectTagsWithContext(ctx, map[string]string{"tenant": "foo"})
+	err := objStore.PutObject(ctxTags, "foo/bar", strings.NewReader(content))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	info, err := objStore.StatObject(ctx, "foo/bar")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "foo/bar", info.Path)
+		assert.Equal(t, int64(len(content)), *info.Size)
+		assert.Equal(t, "vnd/testing", *info.ContentType)
+		assert.NotNil(t, info.ETag)
+		assert.WithinDuration(t, time.Now(), *info.LastModified, time.Minute)
+	}
+
+	obj, err := objStore.GetObject(ctx, "foo/bar")
+	if assert.NoError(t, err) {
+		b, _ := io.ReadAll(obj)
+		obj.Close()
+		assert.Equal(t, content, string(b))
+		assert.Equal(t, int64(len(content)), obj.(storage.ObjectReader).Length())
+	}
+
+	rng, err := objStore.GetObjectRange(ctx, "foo/bar", 8, 4)
+	if assert.NoError(t, err) {
+		b, _ := io.ReadAll(rng)
+		rng.Close()
+		assert.Equal(t, "arti", string(b))
+		assert.Equal(t, int64(4), rng.Length())
+		assert.Equal(t, "bytes 8-11/17", rng.ContentRange())
+	}
+	_, err = objStore.GetObjectRange(ctx, "foo/bar", 17, -1)
+	assert.ErrorIs(t, err, storage.ErrInvalidRange)
+
+	_, err = objStore.GetObject(
+		storage.IfNoneMatchWithContext(ctx, *info.ETag), "foo/bar",
+	)
+	assert.ErrorIs(t, err, storage.ErrNotModified)
+
+	err = objStore.PutObject(
+		storage.PutConditionWithContext(ctx, storage.PutCondition{IfNotExists: true}),
+		"foo/bar", strings.NewReader("overwritten"),
+	)
+	assert.ErrorIs(t, err, storage.ErrPreconditionFailed)
+	err = objStore.PutObject(
+		storage.PutConditionWithContext(ctx, storage.PutCondition{IfMatch: "CA0E="}),
+		"foo/bar", strings.NewReader("overwritten"),
+	)
+	assert.ErrorIs(t, err, storage.ErrPreconditionFailed)
+	err = objStore.PutObject(
+		storage.PutConditionWithContext(ctx, storage.PutCondition{IfMatch: *info.ETag}),
+		"foo/bar", strings.NewReader("replaced"),
+	)
+	assert.NoError(t, err)
+
+	err = objStore.DeleteObject(ctx, "foo/bar")
+	assert.NoError(t, err)
+	_, err = objStore.GetObject(ctx, "foo/bar")
+	assert.ErrorIs(t, err, storage.ErrObjectNotFound)
+	_, err = objStore.StatObject(ctx, "foo/bar")
+	assert.ErrorIs(t, err, storage.ErrObjectNotFound)
+	err = objStore.DeleteObject(ctx, "foo/bar")
+	assert.ErrorIs(t, err, storage.ErrObjectNotFound)
+}
+
+func TestResumableUpload(t *testing.T) {
+	t.Parallel()
+
+	const chunkSize = 256 * 1024
+	objStore, fake, _ := newTestStorageAndServer(t,
+		NewOptions().SetChunkSize(chunkSize))
+	content := bytes.Repeat([]byte("imagine artifacts"), chunkSize/8)
+
+	err := objStore.PutObject(context.Background(), "foo/bar", bytes.NewReader(content))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 3, fake.chunks)
+	assert.Equal(t, content, fake.objects["foo/bar"].data)
+	assert.Equal(t, "vnd/testing", fake.objects["foo/bar"].contentType)
+}
+
+func TestPresigner(t *testing.T) {
+	t.Parallel()
+
+	objStore, _, srv := newTestStorageAndServer(t)
+	content := []byte("imagine artifacts")
+	err := objStore.PutObject(context.Background(), "foo/bar", bytes.NewReader(content))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	srvURL, _ := url.Parse(srv.URL)
+	client := &http.Client{Transport: redirectTransport{host: srvURL.Host}}
+	storagetest.TestPresigner(t, objStore.(storage.Presigner), client, "foo/bar", content)
+}
+
+func TestPresignRequests(t *testing.T) {
+	t.Parallel()
+
+	objStore, _, _ := newTestStorageAndServer(t, NewOptions().
+		SetServiceAccount(testServiceAccount).
+		SetDefaultExpire(time.Hour))
+	ctx := context.Background()
+	err := objStore.PutObject(ctx, "foo/bar", strings.NewReader("imagine artifacts"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	checkLink := func(t *testing.T, method, uri string, expire time.Duration) {
+		u, err := url.Parse(uri)
+		if !assert.NoError(t, err) {
+			return
+		}
+		q := u.Query()
+		assert.Equal(t, "storage.googleapis.com", u.Host)
+		assert.Equal(t, "/"+testBucket+"/foo/bar", u.Path)
+		assert.Equal(t, "GOOG4-RSA-SHA256", q.Get("X-Goog-Algorithm"))
+		assert.Equal(t, strconv.Itoa(int(expire.Seconds())), q.Get("X-Goog-Expires"))
+		assert.NotEmpty(t, q.Get("X-Goog-Signature"))
+	}
+
+	t.Run("get", func(t *testing.T) {
+		link, err := objStore.GetRequest(ctx, "foo/bar", "bar.mender", 0)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.MethodGet, link.Method)
+		checkLink(t, link.Method, link.Uri, time.Hour)
+		u, _ := url.Parse(link.Uri)
+		assert.Equal(t, `attachment; filename="bar.mender"`,
+			u.Query().Get(paramResponseContentDisposition))
+		assert.Equal(t, "vnd/testing", u.Query().Get(paramResponseContentType))
+	})
+
+	t.Run("get/not found", func(t *testing.T) {
+		_, err := objStore.GetRequest(ctx, "foo/baz", "baz.mender", 0)
+		assert.ErrorIs(t, err, storage.ErrObjectNotFound)
+	})
+
+	t.Run("put", func(t *testing.T) {
+		link, err := objStore.PutRequest(ctx, "foo/bar", 8*24*time.Hour)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.MethodPut, link.Method)
+		checkLink(t, link.Method, link.Uri, ExpireMaxLimit)
+		assert.WithinDuration(t, time.Now().Add(ExpireMaxLimit), link.Expire, time.Minute)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		link, err := objStore.DeleteRequest(ctx, "foo/bar", time.Second)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.MethodDelete, link.Method)
+		checkLink(t, link.Method, link.Uri, ExpireMinLimit)
+	})
+
+	t.Run("error/negative expire", func(t *testing.T) {
+		_, err := objStore.PutRequest(ctx, "foo/bar", -time.Second)
+		assert.ErrorIs(t, err, ErrPresignExpireNegative)
+	})
+
+	t.Run("error/response headers", func(t *testing.T) {
+		ctx := storage.ResponseHeadersWithContext(ctx, storage.ResponseHeaders{
+			ContentType: "text/plain",
+		})
+		_, err := objStore.PutRequest(ctx, "foo/bar", time.Minute)
+		assert.ErrorIs(t, err, storage.ErrResponseHeadersNotGET)
+		_, err = objStore.DeleteRequest(ctx, "foo/bar", time.Minute)
+		assert.ErrorIs(t, err, storage.ErrResponseHeadersNotGET)
+	})
+}
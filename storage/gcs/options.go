@@ -0,0 +1,127 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package gcs
+
+import (
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// ChunkSizeDefault is the size of the chunks of resumable uploads.
+	ChunkSizeDefault = googleapi.DefaultUploadChunkSize // 16MiB
+
+	// DefaultExpire is the expiry of presigned requests if the requested
+	// duration is zero.
+	DefaultExpire = 15 * time.Minute
+	// ExpireMaxLimit is the maximum expiry of V4 signed URLs.
+	ExpireMaxLimit = 7 * 24 * time.Hour
+	ExpireMinLimit = 1 * time.Minute
+)
+
+type Options struct {
+	// CredentialsJSON is the JSON key of the service account, and
+	// CredentialsFile the path of the key file. If neither is set, the
+	// client authenticates with the Application Default Credentials,
+	// e.g. with workload identity on GKE.
+	CredentialsJSON *string
+	CredentialsFile *string
+	// ServiceAccount is the email of the service account signing the
+	// presigned requests. Defaults to the client_email of the key, or
+	// the service account of the metadata server (workload identity),
+	// which signs with the IAM signBlob API.
+	ServiceAccount *string
+	// URI is the base URL of the storage API, e.g. of an emulator
+	// (defaults to: https://storage.googleapis.com). Presigned requests
+	// are always signed for storage.googleapis.com.
+	URI *string
+
+	// ChunkSize is the size of the chunks of resumable uploads; zero
+	// uploads objects in a single request (defaults to: 16MiB).
+	ChunkSize *int
+
+	ContentType *string
+
+	// DefaultExpire is the expiry of presigned requests if the requested
+	// duration is zero (defaults to: 15 minutes).
+	DefaultExpire *time.Duration
+}
+
+func NewOptions(opts ...*Options) *Options {
+	opt := &Options{}
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.CredentialsJSON != nil {
+			opt.CredentialsJSON = o.CredentialsJSON
+		}
+		if o.CredentialsFile != nil {
+			opt.CredentialsFile = o.CredentialsFile
+		}
+		if o.ServiceAccount != nil {
+			opt.ServiceAccount = o.ServiceAccount
+		}
+		if o.URI != nil {
+			opt.URI = o.URI
+		}
+		if o.ChunkSize != nil {
+			opt.ChunkSize = o.ChunkSize
+		}
+		if o.ContentType != nil {
+			opt.ContentType = o.ContentType
+		}
+		if o.DefaultExpire != nil {
+			opt.DefaultExpire = o.DefaultExpire
+		}
+	}
+	return opt
+}
+
+func (opts *Options) SetCredentialsJSON(json string) *Options {
+	opts.CredentialsJSON = &json
+	return opts
+}
+
+func (opts *Options) SetCredentialsFile(path string) *Options {
+	opts.CredentialsFile = &path
+	return opts
+}
+
+func (opts *Options) SetServiceAccount(email string) *Options {
+	opts.ServiceAccount = &email
+	return opts
+}
+
+func (opts *Options) SetURI(uri string) *Options {
+	opts.URI = &uri
+	return opts
+}
+
+func (opts *Options) SetChunkSize(size int) *Options {
+	opts.ChunkSize = &size
+	return opts
+}
+
+func (opts *Options) SetContentType(typ string) *Options {
+	opts.ContentType = &typ
+	return opts
+}
+
+func (opts *Options) SetDefaultExpire(expire time.Duration) *Options {
+	opts.DefaultExpire = &expire
+	return opts
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package gcs
+
+import (
+	"time"
+
+	gstorage "cloud.google.com/go/storage"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+const (
+	paramResponseContentDisposition = "response-content-disposition"
+	paramResponseContentType        = "response-content-type"
+)
+
+// presignExpire returns the expiry of a presigned request: the
+// DefaultExpire if expire is zero, limited to ExpireMinLimit and
+// ExpireMaxLimit (7 days). Negative expiry is rejected.
+func (c *client) presignExpire(expire time.Duration) (time.Duration, error) {
+	if expire < 0 {
+		return 0, ErrPresignExpireNegative
+	} else if expire == 0 {
+		expire = c.defaultExpire
+	}
+	if expire < ExpireMinLimit {
+		expire = ExpireMinLimit
+	} else if expire > ExpireMaxLimit {
+		expire = ExpireMaxLimit
+	}
+	return expire.Truncate(time.Second), nil
+}
+
+// signURL presigns the request as V4 signed URL. The signing account and key
+// are detected from the credentials of the client unless ServiceAccount is
+// set; without a private key (e.g. workload identity) the URL is signed with
+// the IAM signBlob API.
+func (c *client) signURL(
+	objectPath, method string,
+	duration time.Duration,
+	query map[string][]string,
+) (*model.Link, error) {
+	now := time.Now().UTC()
+	// X-Goog-Expires is computed from the clock of the SDK and rounded down
+	// to seconds: give it half a second of slack for the requested duration.
+	uri, err := c.bucket.SignedURL(objectPath, &gstorage.SignedURLOptions{
+		GoogleAccessID:  c.serviceAccount,
+		Method:          method,
+		Expires:         now.Add(duration + time.Second/2),
+		QueryParameters: query,
+		Scheme:          gstorage.SigningSchemeV4,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &model.Link{
+		Uri:    uri,
+		Expire: now.Add(duration),
+		Method: method,
+	}, nil
+}
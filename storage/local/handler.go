@@ -0,0 +1,196 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package local
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/storage"
+)
+
+const (
+	paramExpires            = "x-local-expires"
+	paramSignature          = "x-local-signature"
+	paramContentType        = "response-content-type"
+	paramContentDisposition = "response-content-disposition"
+)
+
+var (
+	ErrSignatureInvalid = errors.New("local: invalid signature")
+	ErrSignatureExpired = errors.New("local: signature expired")
+)
+
+func (s *Storage) sign(
+	method, key string,
+	expires int64,
+	hdr storage.ResponseHeaders,
+) string {
+	mac := hmac.New(sha256.New, s.secret)
+	_, _ = mac.Write([]byte(strings.Join([]string{
+		method,
+		key,
+		strconv.FormatInt(expires, 10),
+		hdr.ContentType,
+		hdr.ContentDisposition,
+	}, "\n")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// presign returns a link to the Handler for the method on the object key,
+// valid for duration; the DefaultExpire is used if duration is not positive.
+func (s *Storage) presign(
+	method, key string,
+	duration time.Duration,
+	hdr storage.ResponseHeaders,
+) *model.Link {
+	if duration <= 0 {
+		duration = DefaultExpire
+	}
+	expire := time.Now().Add(duration).Truncate(time.Second)
+	q := url.Values{}
+	q.Set(paramExpires, strconv.FormatInt(expire.Unix(), 10))
+	if hdr.ContentType != "" {
+		q.Set(paramContentType, hdr.ContentType)
+	}
+	if hdr.ContentDisposition != "" {
+		q.Set(paramContentDisposition, hdr.ContentDisposition)
+	}
+	q.Set(paramSignature, s.sign(method, key, expire.Unix(), hdr))
+	u := *s.uri
+	u.Path = s.uri.Path + "/" + key
+	u.RawQuery = q.Encode()
+	return &model.Link{
+		Uri:    u.String(),
+		Expire: expire,
+		Method: method,
+	}
+}
+
+// verify checks the signature and expiry of the presigned request.
+func (s *Storage) verify(
+	method, key string,
+	q url.Values,
+) (storage.ResponseHeaders, error) {
+	hdr := storage.ResponseHeaders{
+		ContentType:        q.Get(paramContentType),
+		ContentDisposition: q.Get(paramContentDisposition),
+	}
+	expires, err := strconv.ParseInt(q.Get(paramExpires), 10, 64)
+	if err != nil {
+		return hdr, ErrSignatureInvalid
+	}
+	signature := s.sign(method, key, expires, hdr)
+	if !hmac.Equal([]byte(signature), []byte(q.Get(paramSignature))) {
+		return hdr, ErrSignatureInvalid
+	}
+	if time.Now().After(time.Unix(expires, 0)) {
+		return hdr, ErrSignatureExpired
+	}
+	return hdr, nil
+}
+
+// ServeHTTP serves the presigned requests; the Storage must be mounted at
+// the path of the configured URI.
+func (s *Storage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	objectPath := strings.TrimPrefix(r.URL.Path, s.uri.Path+"/")
+	if objectPath == r.URL.Path {
+		http.NotFound(w, r)
+		return
+	}
+	key, err := objectKey(objectPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	switch method {
+	case http.MethodGet, http.MethodPut, http.MethodDelete:
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	hdr, err := s.verify(method, key, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	switch method {
+	case http.MethodGet:
+		s.serveObject(w, r, key, hdr)
+	case http.MethodPut:
+		if err := s.PutObject(r.Context(), key, r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if info, err := s.store.stat(key); err == nil {
+			w.Header().Set("ETag", info.etag)
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		err := s.DeleteObject(r.Context(), key)
+		if err != nil && err != storage.ErrObjectNotFound {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Storage) serveObject(
+	w http.ResponseWriter,
+	r *http.Request,
+	key string,
+	hdr storage.ResponseHeaders,
+) {
+	rd, info, err := s.store.open(key)
+	if err == storage.ErrObjectNotFound {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rd.Close()
+	contentType := hdr.ContentType
+	if contentType == "" && s.contentType != nil {
+		contentType = *s.contentType
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	if hdr.ContentDisposition != "" {
+		w.Header().Set("Content-Disposition", hdr.ContentDisposition)
+	}
+	if info.etag != "" {
+		w.Header().Set("ETag", info.etag)
+	}
+	// ServeContent handles conditional and range requests.
+	http.ServeContent(w, r, "", info.modTime, rd)
+}
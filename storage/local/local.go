@@ -0,0 +1,426 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package local implements an object storage backed by the local filesystem
+// or memory, for development and testing without an S3 compatible service.
+// Presigned requests are served by the Storage itself as an http.Handler.
+package local
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/storage"
+)
+
+var ErrInvalidPath = errors.New("local: invalid object path")
+
+// Storage is an object storage keeping the objects in a local directory or
+// in memory.
+type Storage struct {
+	store       objectStore
+	uri         *url.URL
+	secret      []byte
+	partSize    int
+	contentType *string
+}
+
+var (
+	_ storage.ObjectStorage      = &Storage{}
+	_ storage.ResumablePresigner = &Storage{}
+)
+
+// Kind is the kind of the local storage in storage.New; the bucket is
+// ignored.
+const Kind = "local"
+
+func init() {
+	storage.Register(Kind, func(
+		ctx context.Context,
+		bucket string,
+		options interface{},
+	) (storage.ObjectStorage, error) {
+		opt, ok := options.(*Options)
+		if !ok && options != nil {
+			return nil, fmt.Errorf("%w: expected *local.Options, got %T",
+				storage.ErrInvalidOptions, options)
+		}
+		s, err := New(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	})
+}
+
+func New(ctx context.Context, opts ...*Options) (*Storage, error) {
+	opt := NewOptions(opts...)
+	if err := opt.Validate(); err != nil {
+		return nil, errors.WithMessage(err, "local: invalid configuration")
+	}
+	uri, _ := url.Parse(*opt.URI)
+	uri.Path = strings.TrimSuffix(uri.Path, "/")
+	s := &Storage{
+		uri:         uri,
+		secret:      opt.Secret,
+		partSize:    *opt.PartSize,
+		contentType: opt.ContentType,
+	}
+	if s.secret == nil {
+		s.secret = make([]byte, 32)
+		if _, err := rand.Read(s.secret); err != nil {
+			return nil, errors.WithMessage(err, "local: failed to generate secret")
+		}
+	}
+	if opt.Root != nil {
+		store, err := newDirStore(*opt.Root)
+		if err != nil {
+			return nil, errors.WithMessage(err, "local: failed to initialize storage")
+		}
+		s.store = store
+	} else {
+		s.store = newMemStore()
+	}
+	return s, nil
+}
+
+// Path returns the URL path the presign Handler must be mounted at.
+func (s *Storage) Path() string {
+	return s.uri.Path
+}
+
+// objectKey normalizes the path to the key of the object; the key never
+// refers outside of the storage.
+func objectKey(objectPath string) (string, error) {
+	key := strings.TrimPrefix(path.Clean("/"+objectPath), "/")
+	if key == "" {
+		return "", ErrInvalidPath
+	}
+	return key, nil
+}
+
+func (s *Storage) HealthCheck(ctx context.Context) error {
+	if err := s.store.healthCheck(); err != nil {
+		return errors.WithMessage(err, "local: storage not available")
+	}
+	return nil
+}
+
+type objectReader struct {
+	io.ReadCloser
+	length int64
+}
+
+func (r objectReader) Length() int64 {
+	return r.length
+}
+
+type rangeReader struct {
+	objectReader
+	contentRange string
+}
+
+func (r rangeReader) ContentRange() string {
+	return r.contentRange
+}
+
+func (s *Storage) open(
+	ctx context.Context,
+	objectPath string,
+) (io.ReadSeekCloser, objectInfo, error) {
+	key, err := objectKey(objectPath)
+	if err != nil {
+		return nil, objectInfo{}, err
+	}
+	rd, info, err := s.store.open(key)
+	if err != nil {
+		return nil, info, err
+	}
+	if etag, ok := storage.IfNoneMatchFromContext(ctx); ok && etag == info.etag {
+		rd.Close()
+		return nil, info, storage.ErrNotModified
+	}
+	return rd, info, nil
+}
+
+func (s *Storage) GetObject(ctx context.Context, objectPath string) (io.ReadCloser, error) {
+	rd, info, err := s.open(ctx, objectPath)
+	if err != nil {
+		return nil, err
+	}
+	return objectReader{
+		ReadCloser: rd,
+		length:     info.size,
+	}, nil
+}
+
+func (s *Storage) GetObjectRange(
+	ctx context.Context,
+	objectPath string,
+	offset, length int64,
+) (storage.RangeReader, error) {
+	if _, err := storage.ValidateRange(offset, length); err != nil {
+		return nil, err
+	}
+	rd, info, err := s.open(ctx, objectPath)
+	if err != nil {
+		return nil, err
+	}
+	if offset >= info.size {
+		rd.Close()
+		return nil, storage.ErrInvalidRange
+	}
+	if length == -1 || offset+length > info.size {
+		length = info.size - offset
+	}
+	if _, err := rd.Seek(offset, io.SeekStart); err != nil {
+		rd.Close()
+		return nil, err
+	}
+	return rangeReader{
+		objectReader: objectReader{
+			ReadCloser: struct {
+				io.Reader
+				io.Closer
+			}{io.LimitReader(rd, length), rd},
+			length: length,
+		},
+		contentRange: fmt.Sprintf("bytes %d-%d/%d",
+			offset, offset+length-1, info.size),
+	}, nil
+}
+
+// PutObject stores the object from src. Like S3 multipart uploads, the
+// object is written in parts of PartSize bytes and only becomes visible
+// once all parts are written; a failed upload leaves no trace. The ETag is
+// computed the same way as S3 does: the MD5 sum of the object for a single
+// part, or the MD5 sum of the part sums for multiple parts.
+func (s *Storage) PutObject(ctx context.Context, objectPath string, src io.Reader) error {
+	key, err := objectKey(objectPath)
+	if err != nil {
+		return err
+	}
+	uploadID := uuid.NewString()
+	buf := make([]byte, s.partSize)
+	var (
+		sums  []byte
+		parts int
+	)
+	for {
+		n, eRead := io.ReadFull(src, buf)
+		if eRead == io.ErrUnexpectedEOF {
+			eRead = io.EOF
+		}
+		if n > 0 || parts == 0 {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			parts++
+			if err = s.store.writePart(uploadID, parts, buf[:n]); err != nil {
+				break
+			}
+			sum := md5.Sum(buf[:n]) //nolint:gosec
+			sums = append(sums, sum[:]...)
+		}
+		if eRead != nil {
+			if eRead != io.EOF {
+				err = eRead
+			}
+			break
+		}
+	}
+	if err == nil {
+		err = s.checkPutCondition(ctx, key)
+	}
+	if err == nil {
+		err = s.store.completeUpload(uploadID, key, parts, multipartETag(sums, parts))
+	}
+	if err != nil {
+		_ = s.store.abortUpload(uploadID)
+		return errors.WithMessage(err, "local: failed to put object")
+	}
+	return nil
+}
+
+// checkPutCondition returns ErrPreconditionFailed if the object at key does
+// not satisfy the storage.PutCondition in the context.
+func (s *Storage) checkPutCondition(ctx context.Context, key string) error {
+	cond, ok := storage.PutConditionFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, err := s.store.stat(key)
+	switch {
+	case err == storage.ErrObjectNotFound:
+		if cond.IfMatch != "" {
+			return storage.ErrPreconditionFailed
+		}
+		return nil
+	case err != nil:
+		return err
+	case cond.IfNotExists,
+		cond.IfMatch != "" && strings.Trim(cond.IfMatch, `"`) != strings.Trim(info.etag, `"`):
+		return storage.ErrPreconditionFailed
+	}
+	return nil
+}
+
+func multipartETag(sums []byte, parts int) string {
+	if parts == 1 {
+		return `"` + hex.EncodeToString(sums) + `"`
+	}
+	sum := md5.Sum(sums) //nolint:gosec
+	return fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), parts)
+}
+
+func (s *Storage) DeleteObject(ctx context.Context, objectPath string) error {
+	key, err := objectKey(objectPath)
+	if err != nil {
+		return err
+	}
+	return s.store.remove(key)
+}
+
+func (s *Storage) StatObject(ctx context.Context, objectPath string) (*storage.ObjectInfo, error) {
+	key, err := objectKey(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.store.stat(key)
+	if err != nil {
+		return nil, err
+	}
+	return &storage.ObjectInfo{
+		Path:         objectPath,
+		Size:         &info.size,
+		LastModified: &info.modTime,
+		ETag:         &info.etag,
+		ContentType:  s.contentType,
+	}, nil
+}
+
+func (s *Storage) GetRequest(
+	ctx context.Context,
+	objectPath string,
+	filename string,
+	duration time.Duration,
+) (*model.Link, error) {
+	key, err := objectKey(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.store.stat(key); err != nil {
+		return nil, err
+	}
+	var hdr storage.ResponseHeaders
+	if filename != "" {
+		hdr.ContentDisposition = storage.AttachmentDisposition(filename)
+	}
+	if override, ok := storage.ResponseHeadersFromContext(ctx); ok {
+		if override.ContentType != "" {
+			hdr.ContentType = override.ContentType
+		}
+		if override.ContentDisposition != "" {
+			hdr.ContentDisposition = override.ContentDisposition
+		}
+	}
+	return s.presign(http.MethodGet, key, duration, hdr), nil
+}
+
+// PresignResumable implements storage.ResumablePresigner; the Handler
+// answers requests with the If-Match header of the link with 412
+// Precondition Failed once the object is replaced.
+func (s *Storage) PresignResumable(
+	ctx context.Context,
+	objectPath string,
+	opts storage.PresignOptions,
+) (*storage.ResumableLink, error) {
+	key, err := objectKey(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.store.stat(key)
+	if err != nil {
+		return nil, err
+	}
+	err = storage.CheckMaxBytes(&storage.ObjectInfo{
+		Path: objectPath,
+		Size: &info.size,
+	}, opts.MaxBytes)
+	if err != nil {
+		return nil, err
+	} else if info.etag == "" {
+		return nil, storage.ErrResumeNotSupported
+	}
+	var hdr storage.ResponseHeaders
+	if opts.Filename != "" {
+		hdr.ContentDisposition = storage.AttachmentDisposition(opts.Filename)
+	}
+	if opts.ResponseHeaders.ContentType != "" {
+		hdr.ContentType = opts.ResponseHeaders.ContentType
+	}
+	if opts.ResponseHeaders.ContentDisposition != "" {
+		hdr.ContentDisposition = opts.ResponseHeaders.ContentDisposition
+	}
+	link := s.presign(http.MethodGet, key, opts.Expire, hdr)
+	link.Header = map[string]string{"If-Match": info.etag}
+	return &storage.ResumableLink{
+		Link: *link,
+		ETag: info.etag,
+		Size: info.size,
+	}, nil
+}
+
+func (s *Storage) DeleteRequest(
+	ctx context.Context,
+	objectPath string,
+	duration time.Duration,
+) (*model.Link, error) {
+	if _, ok := storage.ResponseHeadersFromContext(ctx); ok {
+		return nil, storage.ErrResponseHeadersNotGET
+	}
+	key, err := objectKey(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	return s.presign(http.MethodDelete, key, duration, storage.ResponseHeaders{}), nil
+}
+
+func (s *Storage) PutRequest(
+	ctx context.Context,
+	objectPath string,
+	duration time.Duration,
+) (*model.Link, error) {
+	if _, ok := storage.ResponseHeadersFromContext(ctx); ok {
+		return nil, storage.ErrResponseHeadersNotGET
+	}
+	key, err := objectKey(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	return s.presign(http.MethodPut, key, duration, storage.ResponseHeaders{}), nil
+}
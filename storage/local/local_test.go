@@ -0,0 +1,454 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/storage"
+	"github.com/mendersoftware/deployments/storage/storagetest"
+)
+
+const testURI = "http://localhost:8080/storage"
+
+func newTestStorages(t *testing.T, opts ...*Options) map[string]*Storage {
+	root := t.TempDir()
+	ret := make(map[string]*Storage, 2)
+	for name, opt := range map[string]*Options{
+		"memory":     NewOptions(),
+		"filesystem": NewOptions().SetRoot(root),
+	} {
+		opt.SetURI(testURI).SetPartSize(4)
+		s, err := New(context.Background(), append([]*Options{opt}, opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret[name] = s
+	}
+	return ret
+}
+
+func TestOptionsValidate(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]struct {
+		Options *Options
+		Error   bool
+	}{
+		"ok": {
+			Options: NewOptions().SetURI(testURI),
+		},
+		"error/no uri": {
+			Options: NewOptions(),
+			Error:   true,
+		},
+		"error/uri without path": {
+			Options: NewOptions().SetURI("http://localhost:8080/"),
+			Error:   true,
+		},
+		"error/relative uri": {
+			Options: NewOptions().SetURI("/storage"),
+			Error:   true,
+		},
+		"error/short secret": {
+			Options: NewOptions().SetURI(testURI).SetSecret([]byte("secret")),
+			Error:   true,
+		},
+		"error/part size": {
+			Options: NewOptions().SetURI(testURI).SetPartSize(0),
+			Error:   true,
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.Options.Validate()
+			if tc.Error {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestStorageNew(t *testing.T) {
+	t.Parallel()
+	objStore, err := storage.New(context.Background(), Kind, "",
+		NewOptions().SetURI(testURI))
+	if assert.NoError(t, err) {
+		assert.IsType(t, &Storage{}, objStore)
+	}
+	objStore, err = storage.New(context.Background(), Kind, "", NewOptions())
+	assert.Error(t, err)
+	assert.Nil(t, objStore)
+	_, err = storage.New(context.Background(), Kind, "", "options")
+	assert.ErrorIs(t, err, storage.ErrInvalidOptions)
+}
+
+func TestObjects(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	contentType := "application/vnd.mender-artifact"
+	storages := newTestStorages(t, &Options{ContentType: &contentType})
+	for name, s := range storages {
+		s := s
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.NoError(t, s.HealthCheck(ctx))
+
+			_, err := s.StatObject(ctx, "foo/bar")
+			assert.ErrorIs(t, err, storage.ErrObjectNotFound)
+
+			// 10 bytes are uploaded in three parts of 4 bytes.
+			payload := []byte("0123456789")
+			err = s.PutObject(ctx, "foo/bar", bytes.NewReader(payload))
+			if !assert.NoError(t, err) {
+				return
+			}
+			info, err := s.StatObject(ctx, "/foo//bar")
+			if assert.NoError(t, err) {
+				assert.Equal(t, int64(len(payload)), *info.Size)
+				assert.True(t, strings.HasSuffix(*info.ETag, `-3"`),
+					"expected multipart ETag, got %s", *info.ETag)
+				assert.Equal(t, contentType, *info.ContentType)
+			}
+
+			rd, err := s.GetObject(ctx, "foo/bar")
+			if assert.NoError(t, err) {
+				b, _ := io.ReadAll(rd)
+				rd.Close()
+				assert.Equal(t, payload, b)
+			}
+			_, err = s.GetObject(storage.IfNoneMatchWithContext(ctx, *info.ETag), "foo/bar")
+			assert.ErrorIs(t, err, storage.ErrNotModified)
+
+			rng, err := s.GetObjectRange(ctx, "foo/bar", 2, 5)
+			if assert.NoError(t, err) {
+				b, _ := io.ReadAll(rng)
+				rng.Close()
+				assert.Equal(t, payload[2:7], b)
+				assert.Equal(t, "bytes 2-6/10", rng.ContentRange())
+			}
+			_, err = s.GetObjectRange(ctx, "foo/bar", 10, -1)
+			assert.ErrorIs(t, err, storage.ErrInvalidRange)
+
+			// Single part objects have a plain MD5 ETag.
+			err = s.PutObject(ctx, "../baz", bytes.NewReader([]byte("1")))
+			assert.NoError(t, err)
+			info, err = s.StatObject(ctx, "baz")
+			if assert.NoError(t, err) {
+				assert.Equal(t, `"c4ca4238a0b923820dcc509a6f75849b"`, *info.ETag)
+			}
+
+			assert.NoError(t, s.DeleteObject(ctx, "foo/bar"))
+			assert.ErrorIs(t, s.DeleteObject(ctx, "foo/bar"), storage.ErrObjectNotFound)
+			_, err = s.GetObject(ctx, "foo/bar")
+			assert.ErrorIs(t, err, storage.ErrObjectNotFound)
+		})
+	}
+}
+
+type errReader struct {
+	io.Reader
+	err error
+}
+
+func (r *errReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	if err == io.EOF {
+		err = r.err
+	}
+	return n, err
+}
+
+func TestPutObjectAbort(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	errBroken := errors.New("broken pipe")
+	root := t.TempDir()
+	s, err := New(ctx, NewOptions().
+		SetURI(testURI).
+		SetRoot(root).
+		SetPartSize(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.PutObject(ctx, "foo/bar", &errReader{
+		Reader: bytes.NewReader([]byte("0123456789")),
+		err:    errBroken,
+	})
+	assert.ErrorIs(t, err, errBroken)
+	_, err = s.StatObject(ctx, "foo/bar")
+	assert.ErrorIs(t, err, storage.ErrObjectNotFound)
+	uploads, err := os.ReadDir(filepath.Join(root, dirUploads))
+	if assert.NoError(t, err) {
+		assert.Empty(t, uploads, "expected parts of aborted upload to be removed")
+	}
+
+	mem := newMemStore()
+	s.store = mem
+	err = s.PutObject(ctx, "foo/bar", &errReader{
+		Reader: bytes.NewReader([]byte("0123456789")),
+		err:    errBroken,
+	})
+	assert.ErrorIs(t, err, errBroken)
+	assert.Empty(t, mem.uploads)
+	assert.Empty(t, mem.objects)
+}
+
+func TestPresign(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	for name, s := range newTestStorages(t) {
+		s := s
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			mux := http.NewServeMux()
+			mux.Handle(s.Path()+"/", s)
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+			do := func(method, uri string, body io.Reader) *http.Response {
+				uri = strings.Replace(uri, "http://localhost:8080", srv.URL, 1)
+				req, _ := http.NewRequest(method, uri, body)
+				rsp, err := srv.Client().Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return rsp
+			}
+
+			link, err := s.PutRequest(ctx, "foo/bar", time.Minute)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, http.MethodPut, link.Method)
+			assert.True(t, strings.HasPrefix(link.Uri, testURI+"/foo/bar?"))
+			rsp := do(http.MethodPut, link.Uri, strings.NewReader("0123456789"))
+			rsp.Body.Close()
+			assert.Equal(t, http.StatusOK, rsp.StatusCode)
+
+			// The signature is bound to the method and the object.
+			rsp = do(http.MethodDelete, link.Uri, nil)
+			rsp.Body.Close()
+			assert.Equal(t, http.StatusForbidden, rsp.StatusCode)
+			rsp = do(http.MethodPut,
+				strings.Replace(link.Uri, "foo/bar", "foo/baz", 1), nil)
+			rsp.Body.Close()
+			assert.Equal(t, http.StatusForbidden, rsp.StatusCode)
+
+			link, err = s.GetRequest(ctx, "foo/bar", "bar.mender", time.Minute)
+			if !assert.NoError(t, err) {
+				return
+			}
+			rsp = do(http.MethodGet, link.Uri, nil)
+			b, _ := io.ReadAll(rsp.Body)
+			rsp.Body.Close()
+			assert.Equal(t, http.StatusOK, rsp.StatusCode)
+			assert.Equal(t, "0123456789", string(b))
+			assert.Equal(t, `attachment; filename="bar.mender"`,
+				rsp.Header.Get("Content-Disposition"))
+			assert.NotEmpty(t, rsp.Header.Get("ETag"))
+
+			// Response headers are signed.
+			rsp = do(http.MethodGet,
+				strings.Replace(link.Uri, "bar.mender", "baz.mender", 1), nil)
+			rsp.Body.Close()
+			assert.Equal(t, http.StatusForbidden, rsp.StatusCode)
+
+			link, err = s.GetRequest(ctx, "foo/bar", `my "ärtifact".mender`, time.Minute)
+			if assert.NoError(t, err) {
+				rsp = do(http.MethodGet, link.Uri, nil)
+				rsp.Body.Close()
+				assert.Equal(t, `attachment; filename="my \"_rtifact\".mender"; `+
+					`filename*=UTF-8''my%20%22%C3%A4rtifact%22.mender`,
+					rsp.Header.Get("Content-Disposition"))
+			}
+
+			_, err = s.GetRequest(ctx, "foo/baz", "", time.Minute)
+			assert.ErrorIs(t, err, storage.ErrObjectNotFound)
+			_, err = s.PutRequest(
+				storage.ResponseHeadersWithContext(ctx, storage.ResponseHeaders{
+					ContentType: "text/plain",
+				}), "foo/bar", time.Minute)
+			assert.ErrorIs(t, err, storage.ErrResponseHeadersNotGET)
+
+			expired := s.presign(http.MethodGet, "foo/bar", -time.Minute, storage.ResponseHeaders{})
+			assert.True(t, expired.Expire.After(time.Now()),
+				"expected default expiry for non-positive durations")
+			expires := time.Now().Add(-time.Second).Unix()
+			q := url.Values{}
+			q.Set(paramExpires, strconv.FormatInt(expires, 10))
+			q.Set(paramSignature, s.sign(http.MethodGet, "foo/bar", expires,
+				storage.ResponseHeaders{}))
+			rsp = do(http.MethodGet, testURI+"/foo/bar?"+q.Encode(), nil)
+			b, _ = io.ReadAll(rsp.Body)
+			rsp.Body.Close()
+			assert.Equal(t, http.StatusForbidden, rsp.StatusCode)
+			assert.Contains(t, string(b), ErrSignatureExpired.Error())
+
+			link, err = s.DeleteRequest(ctx, "foo/bar", time.Minute)
+			if !assert.NoError(t, err) {
+				return
+			}
+			rsp = do(http.MethodDelete, link.Uri, nil)
+			rsp.Body.Close()
+			assert.Equal(t, http.StatusNoContent, rsp.StatusCode)
+			_, err = s.StatObject(ctx, "foo/bar")
+			assert.ErrorIs(t, err, storage.ErrObjectNotFound)
+		})
+	}
+}
+
+func TestPutCondition(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	for name, s := range newTestStorages(t) {
+		s := s
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			put := func(cond storage.PutCondition) error {
+				return s.PutObject(storage.PutConditionWithContext(ctx, cond),
+					"foo/bar", strings.NewReader("0123456789"))
+			}
+			assert.ErrorIs(t, put(storage.PutCondition{IfMatch: `"etag"`}),
+				storage.ErrPreconditionFailed)
+			assert.NoError(t, put(storage.PutCondition{IfNotExists: true}))
+			assert.ErrorIs(t, put(storage.PutCondition{IfNotExists: true}),
+				storage.ErrPreconditionFailed)
+
+			info, err := s.StatObject(ctx, "foo/bar")
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.NoError(t, put(storage.PutCondition{IfMatch: *info.ETag}))
+			assert.ErrorIs(t, put(storage.PutCondition{IfMatch: `"etag"`}),
+				storage.ErrPreconditionFailed)
+		})
+	}
+}
+
+func TestPresignerConformance(t *testing.T) {
+	t.Parallel()
+	content := []byte("imagine artifacts")
+	for name, s := range newTestStorages(t) {
+		s := s
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			mux := http.NewServeMux()
+			mux.Handle(s.Path()+"/", s)
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+			client := &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "tcp", srv.Listener.Addr().String())
+				},
+			}}
+
+			err := s.PutObject(context.Background(), "foo/bar", bytes.NewReader(content))
+			if !assert.NoError(t, err) {
+				return
+			}
+			storagetest.TestPresigner(t, storage.AsPresigner(s), client, "foo/bar", content)
+		})
+	}
+}
+
+func TestPresignResumable(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	for name, s := range newTestStorages(t) {
+		s := s
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			mux := http.NewServeMux()
+			mux.Handle(s.Path()+"/", s)
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+			download := func(link *storage.ResumableLink, offset int64) (*http.Response, string) {
+				uri := strings.Replace(link.Uri, "http://localhost:8080", srv.URL, 1)
+				req, _ := http.NewRequest(link.Method, uri, nil)
+				for key, value := range link.Header {
+					req.Header.Set(key, value)
+				}
+				req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+				rsp, err := srv.Client().Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer rsp.Body.Close()
+				b, _ := io.ReadAll(rsp.Body)
+				return rsp, string(b)
+			}
+
+			_, err := s.PresignResumable(ctx, "foo/bar", storage.PresignOptions{})
+			assert.ErrorIs(t, err, storage.ErrObjectNotFound)
+
+			err = s.PutObject(ctx, "foo/bar", strings.NewReader("0123456789"))
+			if !assert.NoError(t, err) {
+				return
+			}
+			_, err = s.PresignResumable(ctx, "foo/bar", storage.PresignOptions{
+				MaxBytes: 5,
+			})
+			assert.ErrorIs(t, err, storage.ErrMaxBytesExceeded)
+
+			link, err := s.PresignResumable(ctx, "foo/bar", storage.PresignOptions{
+				Expire: time.Minute,
+			})
+			if !assert.NoError(t, err) {
+				return
+			}
+			info, _ := s.StatObject(ctx, "foo/bar")
+			assert.Equal(t, *info.ETag, link.ETag)
+			assert.Equal(t, int64(10), link.Size)
+			assert.Equal(t, map[string]string{"If-Match": link.ETag}, link.Header)
+
+			rsp, body := download(link, 4)
+			assert.Equal(t, http.StatusPartialContent, rsp.StatusCode)
+			assert.Equal(t, "456789", body)
+			resume := storage.ResumeRequest{ETag: link.ETag, Size: link.Size, Offset: 4}
+			assert.NoError(t, storage.CheckResume(ctx, s, "foo/bar", resume))
+
+			// A replaced object is not served from the offset of the
+			// previous one.
+			err = s.PutObject(ctx, "foo/bar", strings.NewReader("abcdefghij"))
+			if !assert.NoError(t, err) {
+				return
+			}
+			rsp, _ = download(link, 6)
+			assert.Equal(t, http.StatusPreconditionFailed, rsp.StatusCode)
+			resume.Offset = 6
+			assert.ErrorIs(t, storage.CheckResume(ctx, s, "foo/bar", resume),
+				storage.ErrObjectChanged)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package local
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const (
+	// DefaultPartSize matches the minimum part size of S3 multipart
+	// uploads.
+	DefaultPartSize = 5 * 1024 * 1024
+	// DefaultExpire is the expiry of presigned requests if the requested
+	// duration is not positive.
+	DefaultExpire = 15 * time.Minute
+)
+
+var (
+	errInvalidURI   = errors.New("must be an absolute http(s) URL")
+	errURIRootPath  = errors.New("must have a path other than '/'")
+	validPartSize   = validation.Min(1).Error("must be a positive size")
+	validSecretSize = validation.Length(16, 0).Error("must be at least 16 bytes")
+)
+
+type Options struct {
+	// Root is the directory where the objects are stored. If not set,
+	// the objects are kept in memory and lost when the process exits.
+	Root *string
+	// URI is the base URL of the Handler serving presigned requests, as
+	// reachable by the clients of the presigned links. The URL must have
+	// a path, which the Handler is mounted at.
+	URI *string
+	// Secret is the key signing presigned requests. If not set, a random
+	// key is generated; links signed before a restart are then rejected.
+	Secret []byte
+	// PartSize is the size of the parts uploads are split into, emulating
+	// S3 multipart uploads.
+	PartSize *int
+	// ContentType of the stored objects.
+	ContentType *string
+}
+
+func NewOptions(opts ...*Options) *Options {
+	partSize := DefaultPartSize
+	ret := &Options{
+		PartSize: &partSize,
+	}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.Root != nil {
+			ret.Root = opt.Root
+		}
+		if opt.URI != nil {
+			ret.URI = opt.URI
+		}
+		if opt.Secret != nil {
+			ret.Secret = opt.Secret
+		}
+		if opt.PartSize != nil {
+			ret.PartSize = opt.PartSize
+		}
+		if opt.ContentType != nil {
+			ret.ContentType = opt.ContentType
+		}
+	}
+	return ret
+}
+
+func validateURI(value interface{}) error {
+	uri, _ := value.(*string)
+	if uri == nil {
+		return nil
+	}
+	u, err := url.Parse(*uri)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errInvalidURI
+	}
+	if u.Path == "" || u.Path == "/" {
+		return errURIRootPath
+	}
+	return nil
+}
+
+func (opts Options) Validate() error {
+	return validation.ValidateStruct(&opts,
+		validation.Field(&opts.Root, validation.NilOrNotEmpty),
+		validation.Field(&opts.URI, validation.Required, validation.By(validateURI)),
+		validation.Field(&opts.Secret, validation.When(opts.Secret != nil, validSecretSize)),
+		validation.Field(&opts.PartSize, validation.Required, validPartSize),
+	)
+}
+
+func (opts *Options) SetRoot(root string) *Options {
+	opts.Root = &root
+	return opts
+}
+
+func (opts *Options) SetURI(uri string) *Options {
+	opts.URI = &uri
+	return opts
+}
+
+func (opts *Options) SetSecret(secret []byte) *Options {
+	opts.Secret = secret
+	return opts
+}
+
+func (opts *Options) SetPartSize(size int) *Options {
+	opts.PartSize = &size
+	return opts
+}
+
+func (opts *Options) SetContentType(contentType string) *Options {
+	opts.ContentType = &contentType
+	return opts
+}
@@ -0,0 +1,289 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package local
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/deployments/storage"
+)
+
+const (
+	dirObjects  = "objects"
+	dirMetadata = "metadata"
+	dirUploads  = "uploads"
+)
+
+type objectInfo struct {
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+// objectStore keeps the objects of the Storage. Uploads are written part by
+// part and the object only becomes visible once the upload is completed,
+// like S3 multipart uploads.
+type objectStore interface {
+	healthCheck() error
+	writePart(uploadID string, partNum int, data []byte) error
+	completeUpload(uploadID, key string, parts int, etag string) error
+	abortUpload(uploadID string) error
+	open(key string) (io.ReadSeekCloser, objectInfo, error)
+	stat(key string) (objectInfo, error)
+	remove(key string) error
+}
+
+// memStore keeps the objects in memory.
+type memStore struct {
+	mu      sync.RWMutex
+	objects map[string]memObject
+	uploads map[string][][]byte
+}
+
+type memObject struct {
+	data []byte
+	info objectInfo
+}
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		objects: make(map[string]memObject),
+		uploads: make(map[string][][]byte),
+	}
+}
+
+func (m *memStore) healthCheck() error {
+	return nil
+}
+
+func (m *memStore) writePart(uploadID string, partNum int, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	parts := m.uploads[uploadID]
+	if len(parts) != partNum-1 {
+		return fmt.Errorf("local: unexpected part number %d", partNum)
+	}
+	m.uploads[uploadID] = append(parts, append([]byte(nil), data...))
+	return nil
+}
+
+func (m *memStore) completeUpload(uploadID, key string, parts int, etag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	uploaded := m.uploads[uploadID]
+	if len(uploaded) != parts {
+		return fmt.Errorf("local: upload has %d parts, expected %d",
+			len(uploaded), parts)
+	}
+	delete(m.uploads, uploadID)
+	data := bytes.Join(uploaded, nil)
+	m.objects[key] = memObject{
+		data: data,
+		info: objectInfo{
+			size:    int64(len(data)),
+			modTime: time.Now(),
+			etag:    etag,
+		},
+	}
+	return nil
+}
+
+func (m *memStore) abortUpload(uploadID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.uploads, uploadID)
+	return nil
+}
+
+func (m *memStore) open(key string) (io.ReadSeekCloser, objectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, ok := m.objects[key]
+	if !ok {
+		return nil, objectInfo{}, storage.ErrObjectNotFound
+	}
+	return nopSeekCloser{bytes.NewReader(obj.data)}, obj.info, nil
+}
+
+func (m *memStore) stat(key string) (objectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, ok := m.objects[key]
+	if !ok {
+		return objectInfo{}, storage.ErrObjectNotFound
+	}
+	return obj.info, nil
+}
+
+func (m *memStore) remove(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.objects[key]; !ok {
+		return storage.ErrObjectNotFound
+	}
+	delete(m.objects, key)
+	return nil
+}
+
+// dirStore keeps the objects in a directory tree; the object data is stored
+// under objects/, the ETags under metadata/ and the pending uploads under
+// uploads/.
+type dirStore struct {
+	root string
+}
+
+func newDirStore(root string) (*dirStore, error) {
+	for _, dir := range []string{dirObjects, dirMetadata, dirUploads} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o700); err != nil {
+			return nil, err
+		}
+	}
+	return &dirStore{root: root}, nil
+}
+
+func (d *dirStore) path(dir, key string) string {
+	return filepath.Join(d.root, dir, filepath.FromSlash(key))
+}
+
+func (d *dirStore) healthCheck() error {
+	info, err := os.Stat(filepath.Join(d.root, dirObjects))
+	if err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("local: %s is not a directory", d.root)
+	}
+	return nil
+}
+
+func (d *dirStore) writePart(uploadID string, partNum int, data []byte) error {
+	dir := d.path(dirUploads, uploadID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, strconv.Itoa(partNum)), data, 0o600)
+}
+
+func (d *dirStore) completeUpload(uploadID, key string, parts int, etag string) error {
+	dir := d.path(dirUploads, uploadID)
+	object := filepath.Join(dir, "object")
+	f, err := os.OpenFile(object, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	for partNum := 1; partNum <= parts && err == nil; partNum++ {
+		var part *os.File
+		part, err = os.Open(filepath.Join(dir, strconv.Itoa(partNum)))
+		if err == nil {
+			_, err = io.Copy(f, part)
+			part.Close()
+		}
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return err
+	}
+	metadata := filepath.Join(dir, "metadata")
+	if err = os.WriteFile(metadata, []byte(etag), 0o600); err != nil {
+		return err
+	}
+	for _, target := range []string{d.path(dirObjects, key), d.path(dirMetadata, key)} {
+		if err = os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+			return err
+		}
+	}
+	if err = os.Rename(object, d.path(dirObjects, key)); err != nil {
+		return err
+	}
+	if err = os.Rename(metadata, d.path(dirMetadata, key)); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (d *dirStore) abortUpload(uploadID string) error {
+	return os.RemoveAll(d.path(dirUploads, uploadID))
+}
+
+func (d *dirStore) info(key string, fileInfo fs.FileInfo) objectInfo {
+	etag, _ := os.ReadFile(d.path(dirMetadata, key))
+	return objectInfo{
+		size:    fileInfo.Size(),
+		modTime: fileInfo.ModTime(),
+		etag:    string(etag),
+	}
+}
+
+func notFound(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return storage.ErrObjectNotFound
+	}
+	return err
+}
+
+func (d *dirStore) open(key string) (io.ReadSeekCloser, objectInfo, error) {
+	f, err := os.Open(d.path(dirObjects, key))
+	if err != nil {
+		return nil, objectInfo{}, notFound(err)
+	}
+	fileInfo, err := f.Stat()
+	if err == nil && fileInfo.IsDir() {
+		err = storage.ErrObjectNotFound
+	}
+	if err != nil {
+		f.Close()
+		return nil, objectInfo{}, err
+	}
+	return f, d.info(key, fileInfo), nil
+}
+
+func (d *dirStore) stat(key string) (objectInfo, error) {
+	fileInfo, err := os.Stat(d.path(dirObjects, key))
+	if err != nil {
+		return objectInfo{}, notFound(err)
+	} else if fileInfo.IsDir() {
+		return objectInfo{}, storage.ErrObjectNotFound
+	}
+	return d.info(key, fileInfo), nil
+}
+
+func (d *dirStore) remove(key string) error {
+	if _, err := d.stat(key); err != nil {
+		return err
+	}
+	if err := os.Remove(d.path(dirObjects, key)); err != nil {
+		return notFound(err)
+	}
+	_ = os.Remove(d.path(dirMetadata, key))
+	return nil
+}
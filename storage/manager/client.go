@@ -35,6 +35,8 @@ type client struct {
 	providerMap    map[model.StorageType]storage.ObjectStorage
 }
 
+var _ storage.ObjectStorage = &client{}
+
 func New(
 	ctx context.Context,
 	defaultStore storage.ObjectStorage,
@@ -89,6 +91,18 @@ func (c *client) GetObject(ctx context.Context, path string) (io.ReadCloser, err
 	return objStore.GetObject(ctx, path)
 }
 
+func (c *client) GetObjectRange(
+	ctx context.Context,
+	path string,
+	offset, length int64,
+) (storage.RangeReader, error) {
+	objStore, err := c.clientFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return objStore.GetObjectRange(ctx, path, offset, length)
+}
+
 func (c *client) PutObject(ctx context.Context, path string, src io.Reader) error {
 	objStore, err := c.clientFromContext(ctx)
 	if err != nil {
@@ -150,3 +164,56 @@ func (c *client) PutRequest(
 	}
 	return objStore.PutRequest(ctx, path, duration)
 }
+
+// WalkObjects implements storage.ObjectWalker for the storage selected by
+// the context.
+func (c *client) WalkObjects(
+	ctx context.Context,
+	prefix string,
+	maxKeys int,
+	fn func(*storage.ObjectInfo) error,
+) error {
+	objStore, err := c.clientFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	walker, ok := objStore.(storage.ObjectWalker)
+	if !ok {
+		return storage.ErrListingNotSupported
+	}
+	return walker.WalkObjects(ctx, prefix, maxKeys, fn)
+}
+
+// PresignResumable implements storage.ResumablePresigner for the storage
+// selected by the context.
+func (c *client) PresignResumable(
+	ctx context.Context,
+	path string,
+	opts storage.PresignOptions,
+) (*storage.ResumableLink, error) {
+	objStore, err := c.clientFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	presigner, ok := objStore.(storage.ResumablePresigner)
+	if !ok {
+		return nil, storage.ErrResumeNotSupported
+	}
+	return presigner.PresignResumable(ctx, path, opts)
+}
+
+// ResolvedEndpoints implements storage.EndpointResolver for the storage
+// selected by the context.
+func (c *client) ResolvedEndpoints(
+	ctx context.Context,
+) (client, presign string, err error) {
+	objStore, err := c.clientFromContext(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	resolver, ok := objStore.(storage.EndpointResolver)
+	if !ok {
+		return "", "", storage.ErrEndpointsNotSupported
+	}
+	return resolver.ResolvedEndpoints(ctx)
+}
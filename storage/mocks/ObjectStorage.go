@@ -94,6 +94,29 @@ func (_m *ObjectStorage) GetObject(ctx context.Context, path string) (io.ReadClo
 	return r0, r1
 }
 
+// GetObjectRange provides a mock function with given fields: ctx, path, offset, length
+func (_m *ObjectStorage) GetObjectRange(ctx context.Context, path string, offset int64, length int64) (storage.RangeReader, error) {
+	ret := _m.Called(ctx, path, offset, length)
+
+	var r0 storage.RangeReader
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int64) storage.RangeReader); ok {
+		r0 = rf(ctx, path, offset, length)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(storage.RangeReader)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64, int64) error); ok {
+		r1 = rf(ctx, path, offset, length)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetRequest provides a mock function with given fields: ctx, path, filename, duration
 func (_m *ObjectStorage) GetRequest(ctx context.Context, path string, filename string, duration time.Duration) (*model.Link, error) {
 	ret := _m.Called(ctx, path, filename, duration)
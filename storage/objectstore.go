@@ -17,6 +17,7 @@ package storage
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"time"
 
@@ -25,14 +26,31 @@ import (
 
 var (
 	ErrObjectNotFound = errors.New("object not found")
+	ErrNotModified    = errors.New("object not modified")
+	ErrInvalidRange   = errors.New("invalid object range")
+	ErrBucketNotFound = errors.New("bucket not found")
+	ErrAccessDenied   = errors.New("access denied")
+	ErrThrottled      = errors.New("request throttled")
+	// ErrStorageUnavailable is returned without contacting the storage
+	// while it is considered down after repeated failures.
+	ErrStorageUnavailable = errors.New("storage unavailable")
+	// ErrPreconditionFailed is returned by conditional uploads (see
+	// PutConditionWithContext) if the condition is not met.
+	ErrPreconditionFailed = errors.New("object precondition failed")
 )
 
-// ObjectStorage allows to store and manage large files
+// ObjectStorage allows to store and manage large files. The backends
+// (s3, azblob, gcs, local) register themselves with Register and are created
+// by kind with New.
 //
 //go:generate ../utils/mockgen.sh
 type ObjectStorage interface {
 	HealthCheck(ctx context.Context) error
 	GetObject(ctx context.Context, path string) (io.ReadCloser, error)
+	// GetObjectRange returns a reader for length bytes of the object
+	// starting at offset; a length of -1 reads to the end of the object.
+	GetObjectRange(ctx context.Context, path string,
+		offset, length int64) (RangeReader, error)
 	PutObject(ctx context.Context, path string, src io.Reader) error
 	DeleteObject(ctx context.Context, path string) error
 	StatObject(ctx context.Context, path string) (*ObjectInfo, error)
@@ -52,6 +70,15 @@ type ObjectInfo struct {
 	Size *int64
 
 	LastModified *time.Time
+
+	ETag *string
+
+	ContentType *string
+
+	// ContentEncoding is the encoding the object is stored with, e.g.
+	// "gzip" for objects compressed on upload. The object is read as
+	// stored: sizes and ranges refer to the encoded data.
+	ContentEncoding *string
 }
 
 type ObjectReader interface {
@@ -59,3 +86,26 @@ type ObjectReader interface {
 
 	Length() int64
 }
+
+// RangeReader reads a byte range of an object.
+type RangeReader interface {
+	io.ReadCloser
+
+	// Length returns the length of the range.
+	Length() int64
+	// ContentRange returns the range as in the Content-Range header,
+	// e.g. "bytes 0-1023/4096".
+	ContentRange() string
+}
+
+// ValidateRange validates the offset and length arguments to
+// GetObjectRange, and returns the value of the Range header.
+func ValidateRange(offset, length int64) (string, error) {
+	if offset < 0 || length == 0 || length < -1 {
+		return "", ErrInvalidRange
+	}
+	if length == -1 {
+		return fmt.Sprintf("bytes=%d-", offset), nil
+	}
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1), nil
+}
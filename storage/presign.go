@@ -0,0 +1,95 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+var ErrMaxBytesExceeded = errors.New("object exceeds the maximum size of the request")
+
+// PresignOptions are the options of a presigned request, common to all
+// storage backends.
+type PresignOptions struct {
+	// Expire is the validity of the link from the time of signing; zero
+	// uses the default of the backend. Backends cap the validity at their
+	// limit (7 days for s3 SigV4). Like the expiry of an Azure SAS, the
+	// Expire of the returned link is the absolute time the link expires,
+	// whatever the backend encodes in the URL.
+	Expire time.Duration
+	// Filename names the download, e.g. after the artifact; ignored if
+	// ResponseHeaders sets the content-disposition.
+	Filename string
+	// ResponseHeaders override the headers of the response.
+	ResponseHeaders ResponseHeaders
+	// MaxBytes fails presigning objects larger than MaxBytes with
+	// ErrMaxBytesExceeded; zero means no limit.
+	MaxBytes int64
+}
+
+// Presigner presigns requests to the objects of the storage, hiding how
+// the backend encodes the signature and the expiry in the URL.
+type Presigner interface {
+	// PresignGet returns a link for downloading the object at path.
+	PresignGet(ctx context.Context, path string, opts PresignOptions) (*model.Link, error)
+}
+
+// AsPresigner returns objStore as Presigner. Storages that do not
+// implement Presigner themselves presign with GetRequest.
+func AsPresigner(objStore ObjectStorage) Presigner {
+	if p, ok := objStore.(Presigner); ok {
+		return p
+	}
+	return presigner{objStore}
+}
+
+type presigner struct {
+	ObjectStorage
+}
+
+func (p presigner) PresignGet(
+	ctx context.Context,
+	path string,
+	opts PresignOptions,
+) (*model.Link, error) {
+	if opts.MaxBytes > 0 {
+		info, err := p.StatObject(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		if err = CheckMaxBytes(info, opts.MaxBytes); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ResponseHeaders != (ResponseHeaders{}) {
+		ctx = ResponseHeadersWithContext(ctx, opts.ResponseHeaders)
+	}
+	return p.GetRequest(ctx, path, opts.Filename, opts.Expire)
+}
+
+// CheckMaxBytes returns ErrMaxBytesExceeded if the object is larger than
+// maxBytes; a maxBytes of zero means no limit.
+func CheckMaxBytes(info *ObjectInfo, maxBytes int64) error {
+	if maxBytes > 0 && info.Size != nil && *info.Size > maxBytes {
+		return fmt.Errorf("%w: %s has %d bytes, the limit is %d",
+			ErrMaxBytesExceeded, info.Path, *info.Size, maxBytes)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrResponseHeadersNotGET = errors.New(
+	"response header overrides are only supported for GET requests",
+)
+
+// ResponseHeaders overrides the headers of the response to a presigned GET
+// request. Empty fields keep the defaults of the storage backend.
+type ResponseHeaders struct {
+	ContentType        string
+	ContentDisposition string
+}
+
+type responseHeadersContextKey struct{}
+
+// ResponseHeadersWithContext overrides the response headers of the GET
+// requests presigned with the returned context. Presigning other requests
+// with the returned context fails with ErrResponseHeadersNotGET.
+func ResponseHeadersWithContext(ctx context.Context, hdr ResponseHeaders) context.Context {
+	return context.WithValue(ctx, responseHeadersContextKey{}, hdr)
+}
+
+func ResponseHeadersFromContext(ctx context.Context) (ResponseHeaders, bool) {
+	hdr, ok := ctx.Value(responseHeadersContextKey{}).(ResponseHeaders)
+	return hdr, ok && hdr != ResponseHeaders{}
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+var (
+	ErrResumeNotSupported = errors.New("storage does not support resumable downloads")
+	// ErrObjectChanged is returned when resuming a download of an object
+	// that was replaced since the download started; the download must
+	// start over, the bytes received so far belong to another object.
+	ErrObjectChanged = errors.New("object changed since the download started")
+)
+
+// ResumableLink is a presigned download link bound to the version of the
+// object it was signed for. The device resumes an interrupted download by
+// requesting the remaining bytes with a Range header, sending the Header of
+// the link along; the storage responds with 412 Precondition Failed once
+// the object is replaced, instead of serving the bytes of another object.
+type ResumableLink struct {
+	model.Link
+	// ETag of the object version the link downloads.
+	ETag string `json:"etag"`
+	// Size of the object version in bytes. Objects stored with a
+	// content-encoding (see ObjectInfo.ContentEncoding) are downloaded as
+	// stored: the size and the ranges refer to the encoded data.
+	Size int64 `json:"size"`
+}
+
+// ResumablePresigner is implemented by the object storages that can make
+// presigned downloads conditional on the object version.
+type ResumablePresigner interface {
+	// PresignResumable returns a link for downloading the object at path
+	// in one or more Range requests; the link fails with 412
+	// Precondition Failed if the object no longer has the ETag of the
+	// link.
+	PresignResumable(ctx context.Context, path string,
+		opts PresignOptions) (*ResumableLink, error)
+}
+
+// ResumeRequest is the bookkeeping of a partial download the device wants
+// to resume: the ETag and Size of the ResumableLink it started with and
+// the number of bytes it already received.
+type ResumeRequest struct {
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+	Offset int64  `json:"offset"`
+}
+
+// ValidateResume checks req against the current info of the object. It
+// returns ErrObjectChanged if the ETag or the size of the object differ
+// from the ones the download started with, and ErrInvalidRange if the
+// offset is not within the object.
+func ValidateResume(info *ObjectInfo, req ResumeRequest) error {
+	if info.ETag == nil || !etagEqual(*info.ETag, req.ETag) {
+		return fmt.Errorf("%w: %s has a different ETag", ErrObjectChanged, info.Path)
+	}
+	if info.Size == nil || *info.Size != req.Size {
+		return fmt.Errorf("%w: %s has a different size", ErrObjectChanged, info.Path)
+	}
+	if req.Offset < 0 || req.Offset >= req.Size {
+		return ErrInvalidRange
+	}
+	return nil
+}
+
+// CheckResume stats the object at path and validates req against it with
+// ValidateResume.
+func CheckResume(
+	ctx context.Context,
+	objStore ObjectStorage,
+	path string,
+	req ResumeRequest,
+) error {
+	info, err := objStore.StatObject(ctx, path)
+	if err != nil {
+		return err
+	}
+	return ValidateResume(info, req)
+}
+
+// etagEqual compares ETags regardless of the quotes; an empty ETag never
+// matches.
+func etagEqual(a, b string) bool {
+	a, b = strings.Trim(a, `"`), strings.Trim(b, `"`)
+	return a != "" && a == b
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckResume(t *testing.T) {
+	t.Parallel()
+	objStore := &memObjectStorage{
+		data: []byte("0123456789"),
+		etag: `"etag"`,
+	}
+
+	testCases := []struct {
+		Name    string
+		Path    string
+		Request ResumeRequest
+
+		Error error
+	}{{
+		Name:    "ok",
+		Request: ResumeRequest{ETag: `"etag"`, Size: 10, Offset: 4},
+	}, {
+		Name:    "ok/unquoted etag",
+		Request: ResumeRequest{ETag: "etag", Size: 10, Offset: 0},
+	}, {
+		Name:    "error/replaced object",
+		Request: ResumeRequest{ETag: `"other"`, Size: 10, Offset: 4},
+
+		Error: ErrObjectChanged,
+	}, {
+		Name:    "error/empty etag",
+		Request: ResumeRequest{Size: 10, Offset: 4},
+
+		Error: ErrObjectChanged,
+	}, {
+		Name:    "error/size changed",
+		Request: ResumeRequest{ETag: `"etag"`, Size: 12, Offset: 4},
+
+		Error: ErrObjectChanged,
+	}, {
+		Name:    "error/offset at the end",
+		Request: ResumeRequest{ETag: `"etag"`, Size: 10, Offset: 10},
+
+		Error: ErrInvalidRange,
+	}, {
+		Name:    "error/negative offset",
+		Request: ResumeRequest{ETag: `"etag"`, Size: 10, Offset: -1},
+
+		Error: ErrInvalidRange,
+	}, {
+		Name:    "error/object deleted",
+		Path:    "deleted",
+		Request: ResumeRequest{ETag: `"etag"`, Size: 10, Offset: 4},
+
+		Error: ErrObjectNotFound,
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			path := tc.Path
+			if path == "" {
+				path = "artifact"
+			}
+			err := CheckResume(context.Background(), objStore, path, tc.Request)
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	awsHttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+var ErrAccelerateNotEnabled = errors.New(
+	"s3: transfer acceleration is not enabled for the bucket",
+)
+
+// accelerateCache caches the transfer acceleration status of the buckets.
+type accelerateCache struct {
+	buckets sync.Map // map[string]bool
+}
+
+func disableAccelerate(o *s3.Options) {
+	o.UseAccelerate = false
+}
+
+// accelerateEnabled checks whether transfer acceleration is enabled for the
+// bucket. The request is sent to the standard endpoint, since the
+// accelerate endpoint cannot be used for buckets without acceleration. A
+// bucket that does not exist yet is created without acceleration.
+func (s *SimpleStorageService) accelerateEnabled(
+	ctx context.Context,
+	bucket string,
+	opts func(*s3.Options),
+) (bool, error) {
+	if enabled, ok := s.accelerate.buckets.Load(bucket); ok {
+		return enabled.(bool), nil
+	}
+	out, err := s.client.GetBucketAccelerateConfiguration(ctx,
+		&s3.GetBucketAccelerateConfigurationInput{
+			Bucket: &bucket,
+		}, opts, disableAccelerate)
+	var rspErr *awsHttp.ResponseError
+	if errors.As(err, &rspErr) {
+		switch rspErr.HTTPStatusCode() {
+		case http.StatusNotFound:
+			err = nil
+			out = &s3.GetBucketAccelerateConfigurationOutput{}
+		case http.StatusForbidden:
+			log.FromContext(ctx).Warnf(
+				"s3: not authorized to check transfer acceleration "+
+					"of bucket '%s', assuming it is enabled", bucket,
+			)
+			s.accelerate.buckets.Store(bucket, true)
+			return true, nil
+		}
+	}
+	if err != nil {
+		return false, fmt.Errorf(
+			"s3: failed to check transfer acceleration of bucket '%s': %w",
+			bucket, err,
+		)
+	}
+	enabled := out.Status == types.BucketAccelerateStatusEnabled
+	s.accelerate.buckets.Store(bucket, enabled)
+	return enabled, nil
+}
+
+// accelerateOptions returns the client options for the bucket with
+// transfer acceleration disabled if it is not enabled for the bucket and
+// AccelerateFallback is set, otherwise ErrAccelerateNotEnabled is returned.
+func (s *SimpleStorageService) accelerateOptions(
+	ctx context.Context,
+	bucket string,
+	opts func(*s3.Options),
+) (func(*s3.Options), error) {
+	enabled, err := s.accelerateEnabled(ctx, bucket, opts)
+	if err != nil || enabled {
+		return opts, err
+	} else if !s.accelerateFallback {
+		return nil, fmt.Errorf("%w: '%s'", ErrAccelerateNotEnabled, bucket)
+	}
+	return func(o *s3.Options) {
+		opts(o)
+		disableAccelerate(o)
+	}, nil
+}
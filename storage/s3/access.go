@@ -0,0 +1,119 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+
+	"github.com/mendersoftware/deployments/storage"
+)
+
+var errAccessContentMismatch = errors.New("object content does not match the upload")
+
+// AccessReport lists the capabilities available with the configured
+// bucket and credentials, as probed by ValidateAccess.
+type AccessReport struct {
+	// Bucket is true if the bucket exists and is accessible (HeadBucket).
+	Bucket bool
+	// Write is true if objects can be uploaded (PutObject).
+	Write bool
+	// Read is true if objects can be downloaded (GetObject).
+	Read bool
+	// Delete is true if objects can be deleted (DeleteObject).
+	Delete bool
+	// Errors holds the error (a *PingError) of every failed probe, keyed
+	// by the operation.
+	Errors map[string]error
+}
+
+func (report *AccessReport) probe(op string, err error) bool {
+	if err != nil {
+		report.Errors[op] = newPingError(op, err)
+		return false
+	}
+	return true
+}
+
+// ValidateAccess probes the bucket for read, write and delete permission
+// using the same endpoint, region and credentials as all other operations.
+// A small sentinel object is uploaded under ".ping/", read back and deleted;
+// if the upload fails, reading and deleting are probed on the non-existent
+// sentinel key, which S3 answers with 404 and 204 respectively if the
+// permission is granted. The error is only set if the probes could not be
+// run at all.
+func (s *SimpleStorageService) ValidateAccess(ctx context.Context) (*AccessReport, error) {
+	bucket, opts, err := s.optionsFromContext(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	report := &AccessReport{Errors: make(map[string]error)}
+
+	_, err = s.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(bucket),
+	}, opts)
+	report.Bucket = report.probe("HeadBucket", err)
+
+	key := s.objectKey(path.Join(pingObjectPrefix, uuid.NewString()))
+	content := []byte("access")
+	putParams := &s3.PutObjectInput{
+		Bucket:        aws.String(bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(content),
+		ContentLength: int64(len(content)),
+
+		ServerSideEncryption: s.sseAlgorithm,
+		SSEKMSKeyId:          s.sseKMSKeyID,
+	}
+	putParams.SSECustomerAlgorithm,
+		putParams.SSECustomerKey,
+		putParams.SSECustomerKeyMD5 = s.sseCustomerKey.params()
+	_, err = s.client.PutObject(ctx, putParams, opts)
+	report.Write = report.probe("PutObject", err)
+
+	getParams := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	getParams.SSECustomerAlgorithm,
+		getParams.SSECustomerKey,
+		getParams.SSECustomerKeyMD5 = s.sseCustomerKey.params()
+	out, err := s.client.GetObject(ctx, getParams, opts)
+	if err == nil {
+		var body []byte
+		body, err = io.ReadAll(out.Body)
+		out.Body.Close()
+		if err == nil && report.Write && !bytes.Equal(body, content) {
+			err = errAccessContentMismatch
+		}
+	} else if !report.Write && errors.Is(mapError(err), storage.ErrObjectNotFound) {
+		err = nil
+	}
+	report.Read = report.probe("GetObject", err)
+
+	_, err = s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, opts)
+	report.Delete = report.probe("DeleteObject", err)
+	return report, nil
+}
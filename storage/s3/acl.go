@@ -0,0 +1,81 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+var ErrACLNotSupported = errors.New(
+	"s3: an ACL is configured, but the bucket does not allow ACLs " +
+		"(object ownership is bucket owner enforced)",
+)
+
+func cannedACLs() []interface{} {
+	values := types.ObjectCannedACL("").Values()
+	ret := make([]interface{}, len(values))
+	for i, value := range values {
+		ret[i] = string(value)
+	}
+	return ret
+}
+
+// isPublicACL returns true if the canned ACL grants everyone access to the
+// objects.
+func isPublicACL(acl string) bool {
+	switch types.ObjectCannedACL(acl) {
+	case types.ObjectCannedACLPublicRead, types.ObjectCannedACLPublicReadWrite:
+		return true
+	}
+	return false
+}
+
+// aclMiddleware applies the canned ACL to the objects created by uploads
+// and copies. Presigned uploads are left as is, since the clients of the
+// links do not send the signed ACL header.
+func aclMiddleware(acl types.ObjectCannedACL) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		if _, presign := stack.Finalize.Get(presignMiddlewareID); presign {
+			return nil
+		}
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc(
+			"ACL", func(
+				ctx context.Context,
+				in middleware.InitializeInput,
+				next middleware.InitializeHandler,
+			) (middleware.InitializeOutput, middleware.Metadata, error) {
+				switch params := in.Parameters.(type) {
+				case *s3.PutObjectInput:
+					withACL := *params
+					withACL.ACL = acl
+					in.Parameters = &withACL
+				case *s3.CreateMultipartUploadInput:
+					withACL := *params
+					withACL.ACL = acl
+					in.Parameters = &withACL
+				case *s3.CopyObjectInput:
+					withACL := *params
+					withACL.ACL = acl
+					in.Parameters = &withACL
+				}
+				return next.HandleInitialize(ctx, in)
+			}), middleware.Before)
+	}
+}
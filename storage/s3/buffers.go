@@ -0,0 +1,73 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"sync"
+)
+
+// bufferPool hands out the buffers for uploads. If the pool is bounded, at
+// most limit buffers are allocated and uploads wait for a free buffer until
+// their context is done; otherwise buffers are allocated on demand and
+// reused if available.
+type bufferPool struct {
+	size  int
+	free  chan []byte
+	slots chan struct{}
+	pool  sync.Pool
+}
+
+func newBufferPool(size int, limit *int) *bufferPool {
+	p := &bufferPool{size: size}
+	if limit != nil {
+		p.free = make(chan []byte, *limit)
+		p.slots = make(chan struct{}, *limit)
+	} else {
+		p.pool.New = func() interface{} {
+			buf := make([]byte, size)
+			return &buf
+		}
+	}
+	return p
+}
+
+func (p *bufferPool) get(ctx context.Context) ([]byte, error) {
+	if p.free == nil {
+		return *p.pool.Get().(*[]byte), nil
+	}
+	select {
+	case buf := <-p.free:
+		return buf, nil
+	default:
+	}
+	select {
+	case buf := <-p.free:
+		return buf, nil
+	case p.slots <- struct{}{}:
+		return make([]byte, p.size), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *bufferPool) put(buf []byte) {
+	buf = buf[:p.size]
+	if p.free == nil {
+		p.pool.Put(&buf)
+		return
+	}
+	p.free <- buf
+}
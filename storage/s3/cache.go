@@ -0,0 +1,400 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	"github.com/mendersoftware/deployments/storage"
+)
+
+const (
+	// DefaultCacheTTL is the time objects are cached with the CacheSize
+	// option if CacheTTL is not set.
+	DefaultCacheTTL = time.Minute
+	// DefaultCacheMaxItemSize is the size of the largest object body or
+	// range cached with the CacheSize option if CacheMaxItemSize is not
+	// set.
+	DefaultCacheMaxItemSize = 64 * kib
+
+	// cacheInfoSize is the size accounted for cached object infos.
+	cacheInfoSize = 256
+)
+
+// CacheMetricsRecorder is implemented by MetricsRecorders that also record
+// the hits and misses of the object cache (see the CacheSize option). The
+// operation is "GetObject" or "StatObject".
+type CacheMetricsRecorder interface {
+	ObserveCache(operation string, hit bool)
+}
+
+type cacheEntry struct {
+	key     string
+	object  string
+	etag    string
+	expires time.Time
+	size    int64
+
+	data         []byte
+	contentRange string
+	info         *storage.ObjectInfo
+}
+
+// objectCache is a size bounded LRU cache of small object reads and object
+// infos. Entries expire after the TTL, and entries of an object are dropped
+// when a response with a different ETag of the object is seen or the object
+// is modified through the storage. Hits are revalidated with a conditional
+// request (If-None-Match with the cached ETag), so changes by other writers
+// are seen right away; the cache saves the transfer of unchanged bodies.
+type objectCache struct {
+	mu       sync.Mutex
+	maxSize  int64
+	maxItem  int64
+	ttl      time.Duration
+	size     int64
+	lru      *list.List
+	entries  map[string]*list.Element
+	objects  map[string]map[string]struct{}
+	recorder CacheMetricsRecorder
+}
+
+func newObjectCache(opts *Options) *objectCache {
+	if opts.CacheSize == nil {
+		return nil
+	}
+	cache := &objectCache{
+		maxSize: *opts.CacheSize,
+		maxItem: DefaultCacheMaxItemSize,
+		ttl:     DefaultCacheTTL,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		objects: make(map[string]map[string]struct{}),
+	}
+	if opts.CacheMaxItemSize != nil {
+		cache.maxItem = *opts.CacheMaxItemSize
+	}
+	if cache.maxItem > cache.maxSize {
+		cache.maxItem = cache.maxSize
+	}
+	if opts.CacheTTL != nil {
+		cache.ttl = *opts.CacheTTL
+	}
+	cache.recorder, _ = opts.metricsRecorder().(CacheMetricsRecorder)
+	return cache
+}
+
+func (c *objectCache) observe(operation string, hit bool) {
+	if c.recorder != nil {
+		c.recorder.ObserveCache(operation, hit)
+	}
+}
+
+// get returns the entry for key to revalidate, or nil if there is no
+// entry; entries without an ETag cannot be revalidated and are ignored.
+func (c *objectCache) get(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*cacheEntry)
+	if entry.etag == "" || time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return entry
+}
+
+func (c *objectCache) add(entry *cacheEntry) {
+	if entry.size > c.maxSize {
+		return
+	}
+	entry.expires = time.Now().Add(c.ttl)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dropStale(entry.object, entry.etag)
+	if elem, ok := c.entries[entry.key]; ok {
+		c.remove(elem)
+	}
+	for c.size+entry.size > c.maxSize && c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	keys, ok := c.objects[entry.object]
+	if !ok {
+		keys = make(map[string]struct{})
+		c.objects[entry.object] = keys
+	}
+	keys[entry.key] = struct{}{}
+	c.size += entry.size
+}
+
+// dropStale removes the entries of the object with an ETag other than etag.
+func (c *objectCache) dropStale(object, etag string) {
+	for key := range c.objects[object] {
+		if elem := c.entries[key]; elem.Value.(*cacheEntry).etag != etag {
+			c.remove(elem)
+		}
+	}
+}
+
+// invalidate removes all entries of the object.
+func (c *objectCache) invalidate(object string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.objects[object] {
+		c.remove(c.entries[key])
+	}
+}
+
+func (c *objectCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+	if keys := c.objects[entry.object]; keys != nil {
+		delete(keys, entry.key)
+		if len(keys) == 0 {
+			delete(c.objects, entry.object)
+		}
+	}
+	c.size -= entry.size
+}
+
+type revalidateContextKey struct{}
+
+// revalidateWithContext makes the reads of the cache with the returned
+// context conditional on the cached ETag; the reads fail with
+// storage.ErrNotModified if the object is unchanged.
+func revalidateWithContext(ctx context.Context, etag string) context.Context {
+	return context.WithValue(ctx, revalidateContextKey{}, etag)
+}
+
+// revalidateFromContext returns the ETag for revalidating a cache entry,
+// quoted like ifNoneMatchFromContext.
+func revalidateFromContext(ctx context.Context) *string {
+	etag, ok := ctx.Value(revalidateContextKey{}).(string)
+	if !ok {
+		return nil
+	}
+	return ifNoneMatchFromContext(storage.IfNoneMatchWithContext(ctx, etag))
+}
+
+// revalidate calls read with the context conditional on the ETag of the
+// entry. It returns true if the entry is still valid; otherwise the error
+// of read is returned and, if the object is gone, its entries are dropped.
+func (s *SimpleStorageService) revalidate(
+	ctx context.Context,
+	operation string,
+	entry *cacheEntry,
+	read func(ctx context.Context) error,
+) (bool, error) {
+	err := read(revalidateWithContext(ctx, entry.etag))
+	if errors.Is(err, storage.ErrNotModified) {
+		s.cache.observe(operation, true)
+		return true, nil
+	}
+	s.cache.observe(operation, false)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		s.cache.invalidate(entry.object)
+	}
+	return false, err
+}
+
+// cacheObject returns the cache identity of the object at path: the bucket
+// and the key.
+func (s *SimpleStorageService) cacheObject(ctx context.Context, path string) string {
+	bucket := s.bucket
+	if settings := settingsFromContext(ctx); settings != nil {
+		bucket = settings.Bucket
+	}
+	return bucket + "/" + s.objectKey(path)
+}
+
+// cacheable returns true if reads with the context may use the cache;
+// conditional reads are never cached.
+func (s *SimpleStorageService) cacheable(ctx context.Context) bool {
+	if s.cache == nil {
+		return false
+	}
+	_, conditional := storage.IfNoneMatchFromContext(ctx)
+	return !conditional
+}
+
+// invalidateCache removes the cached reads of the objects at paths after
+// they were modified.
+func (s *SimpleStorageService) invalidateCache(ctx context.Context, paths ...string) {
+	if s.cache == nil {
+		return
+	}
+	for _, path := range paths {
+		s.cache.invalidate(s.cacheObject(ctx, path))
+	}
+}
+
+// invalidateCacheKey removes the cached reads of the object with the key in
+// the bucket.
+func (s *SimpleStorageService) invalidateCacheKey(bucket, key string) {
+	if s.cache != nil {
+		s.cache.invalidate(bucket + "/" + key)
+	}
+}
+
+// getObjectCached returns the body of the object at path, or of the range,
+// from the cache or by calling get. Bodies larger than the maximum item size
+// are not cached and are returned as streamed by get.
+func (s *SimpleStorageService) getObjectCached(
+	ctx context.Context,
+	path string,
+	byteRange string,
+	get func(ctx context.Context) (body io.ReadCloser, length int64,
+		etag, contentRange string, err error),
+) (objectReader, string, error) {
+	if !s.cacheable(ctx) {
+		body, length, _, contentRange, err := get(ctx)
+		return objectReader{ReadCloser: body, length: length}, contentRange, err
+	}
+	object := s.cacheObject(ctx, path)
+	key := "get\x00" + object + "\x00" + byteRange
+	var (
+		body         io.ReadCloser
+		length       int64
+		etag         string
+		contentRange string
+		err          error
+	)
+	if entry := s.cache.get(key); entry != nil {
+		var valid bool
+		valid, err = s.revalidate(ctx, "GetObject", entry, func(ctx context.Context) error {
+			var errGet error
+			body, length, etag, contentRange, errGet = get(ctx)
+			return errGet
+		})
+		if valid {
+			return objectReader{
+				ReadCloser: io.NopCloser(bytes.NewReader(entry.data)),
+				length:     int64(len(entry.data)),
+			}, entry.contentRange, nil
+		} else if err != nil {
+			return objectReader{}, "", err
+		}
+	} else {
+		s.cache.observe("GetObject", false)
+		body, length, etag, contentRange, err = get(ctx)
+	}
+	if err != nil || length < 0 || length > s.cache.maxItem {
+		return objectReader{ReadCloser: body, length: length}, contentRange, err
+	}
+	data, err := io.ReadAll(io.LimitReader(body, length+1))
+	body.Close()
+	if err != nil {
+		return objectReader{}, "", err
+	}
+	if int64(len(data)) == length {
+		s.cache.add(&cacheEntry{
+			key:          key,
+			object:       object,
+			etag:         etag,
+			size:         int64(len(key) + len(data)),
+			data:         data,
+			contentRange: contentRange,
+		})
+	}
+	return objectReader{
+		ReadCloser: io.NopCloser(bytes.NewReader(data)),
+		length:     int64(len(data)),
+	}, contentRange, nil
+}
+
+// statObjectCached returns the info of the object at path from the cache or
+// by calling stat.
+func (s *SimpleStorageService) statObjectCached(
+	ctx context.Context,
+	path string,
+	stat func(ctx context.Context) (*storage.ObjectInfo, error),
+) (*storage.ObjectInfo, error) {
+	if !s.cacheable(ctx) {
+		return stat(ctx)
+	}
+	object := s.cacheObject(ctx, path)
+	key := "stat\x00" + object
+	var (
+		info *storage.ObjectInfo
+		err  error
+	)
+	if entry := s.cache.get(key); entry != nil {
+		var valid bool
+		valid, err = s.revalidate(ctx, "StatObject", entry, func(ctx context.Context) error {
+			var errStat error
+			info, errStat = stat(ctx)
+			return errStat
+		})
+		if valid {
+			return copyObjectInfo(entry.info), nil
+		} else if err != nil {
+			return nil, err
+		}
+	} else {
+		s.cache.observe("StatObject", false)
+		if info, err = stat(ctx); err != nil {
+			return nil, err
+		}
+	}
+	cached := copyObjectInfo(info)
+	var etag string
+	if info.ETag != nil {
+		etag = *info.ETag
+	}
+	s.cache.add(&cacheEntry{
+		key:    key,
+		object: object,
+		etag:   etag,
+		size:   int64(len(key) + cacheInfoSize),
+		info:   cached,
+	})
+	return info, nil
+}
+
+// copyObjectInfo returns a deep copy of info, such that callers cannot
+// modify the cached info through the pointer fields.
+func copyObjectInfo(info *storage.ObjectInfo) *storage.ObjectInfo {
+	ret := &storage.ObjectInfo{Path: info.Path}
+	if info.Size != nil {
+		size := *info.Size
+		ret.Size = &size
+	}
+	if info.LastModified != nil {
+		lastModified := *info.LastModified
+		ret.LastModified = &lastModified
+	}
+	if info.ETag != nil {
+		ret.ETag = aws.String(*info.ETag)
+	}
+	if info.ContentType != nil {
+		ret.ContentType = aws.String(*info.ContentType)
+	}
+	if info.ContentEncoding != nil {
+		ret.ContentEncoding = aws.String(*info.ContentEncoding)
+	}
+	return ret
+}
@@ -0,0 +1,193 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	awsHttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/deployments/storage"
+)
+
+const (
+	// DefaultCircuitBreakerWindow is the default window in which the
+	// consecutive failures must occur to open the circuit breaker.
+	DefaultCircuitBreakerWindow = time.Minute
+	// DefaultCircuitBreakerProbeInterval is the default time the circuit
+	// breaker stays open before probing the storage again.
+	DefaultCircuitBreakerProbeInterval = 30 * time.Second
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker fails the operations fast with
+// storage.ErrStorageUnavailable once threshold consecutive operations
+// failed within the window, instead of letting every operation wait for
+// the timeout of an unreachable storage.
+//
+// While open, the first operation after the probe interval is let through
+// as the probe (half-open); concurrent operations keep failing fast. A
+// successful probe closes the breaker, a failed one opens it for another
+// probe interval. A probe canceled by its caller is inconclusive and the
+// next operation probes again.
+type circuitBreaker struct {
+	threshold     int
+	window        time.Duration
+	probeInterval time.Duration
+	now           func() time.Time
+
+	mu           sync.Mutex
+	state        circuitState
+	failures     int
+	firstFailure time.Time
+	opened       time.Time
+}
+
+func newCircuitBreaker(opts *Options) *circuitBreaker {
+	b := &circuitBreaker{
+		threshold:     *opts.CircuitBreakerThreshold,
+		window:        DefaultCircuitBreakerWindow,
+		probeInterval: DefaultCircuitBreakerProbeInterval,
+		now:           time.Now,
+	}
+	if opts.CircuitBreakerWindow != nil {
+		b.window = *opts.CircuitBreakerWindow
+	}
+	if opts.CircuitBreakerProbeInterval != nil {
+		b.probeInterval = *opts.CircuitBreakerProbeInterval
+	}
+	return b
+}
+
+// allow returns whether the operation may be sent and whether it is the
+// probe of a half-open breaker.
+func (b *circuitBreaker) allow() (allowed, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if b.now().Sub(b.opened) < b.probeInterval {
+			return false, false
+		}
+		b.state = circuitHalfOpen
+		return true, true
+	case circuitHalfOpen:
+		return false, false
+	}
+	return true, false
+}
+
+// record updates the breaker with the outcome of an operation and returns
+// whether the breaker opened or closed.
+func (b *circuitBreaker) record(probe, failed, inconclusive bool) (circuitState, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	switch {
+	case probe && inconclusive:
+		b.state = circuitOpen
+		return b.state, false
+	case probe && failed:
+		b.state = circuitOpen
+		b.opened = now
+		return b.state, false
+	case probe:
+		b.state = circuitClosed
+		b.failures = 0
+		return b.state, true
+	case b.state != circuitClosed || inconclusive:
+		// Outcomes of operations sent before the breaker opened.
+		return b.state, false
+	case !failed:
+		b.failures = 0
+		return b.state, false
+	}
+	if b.failures == 0 || now.Sub(b.firstFailure) > b.window {
+		b.failures = 0
+		b.firstFailure = now
+	}
+	b.failures++
+	if b.failures < b.threshold {
+		return b.state, false
+	}
+	b.state = circuitOpen
+	b.opened = now
+	b.failures = 0
+	return b.state, true
+}
+
+// isStorageFailure returns whether err indicates that the storage is not
+// available: the request could not be sent or the service responded with
+// a server error other than throttling. Errors of the request itself, e.g.
+// missing objects, do not count.
+func isStorageFailure(err error) bool {
+	var sendErr *smithyhttp.RequestSendError
+	if errors.As(err, &sendErr) {
+		return true
+	}
+	var rspErr *awsHttp.ResponseError
+	return errors.As(err, &rspErr) &&
+		rspErr.HTTPStatusCode() >= http.StatusInternalServerError &&
+		errorKind(err) != storage.ErrThrottled
+}
+
+// circuitBreakerMiddleware fails the operations fast while the breaker is
+// open. Presign operations do not send any request and are not affected.
+func circuitBreakerMiddleware(b *circuitBreaker) apiOptions {
+	return func(stack *middleware.Stack) error {
+		if _, presign := stack.Finalize.Get(presignMiddlewareID); presign {
+			return nil
+		}
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc(
+			"CircuitBreaker", func(
+				ctx context.Context,
+				in middleware.InitializeInput,
+				next middleware.InitializeHandler,
+			) (out middleware.InitializeOutput, md middleware.Metadata, err error) {
+				allowed, probe := b.allow()
+				if !allowed {
+					return out, md, fmt.Errorf("s3: %w", storage.ErrStorageUnavailable)
+				}
+				out, md, err = next.HandleInitialize(ctx, in)
+				state, changed := b.record(probe,
+					isStorageFailure(err), err != nil && ctx.Err() != nil)
+				switch {
+				case changed && state == circuitOpen:
+					log.FromContext(ctx).Errorf(
+						"s3: storage unavailable after %d consecutive failures, "+
+							"failing requests for %s: %s",
+						b.threshold, b.probeInterval, err.Error())
+				case changed:
+					log.FromContext(ctx).Info("s3: storage available again")
+				}
+				return out, md, err
+			}), middleware.Before)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+const (
+	// clockSkewInterval is the age of the clock skew measurement of a host
+	// after which the skew is measured again before signing a request.
+	clockSkewInterval = 10 * time.Minute
+	// clockSkewTimeout limits the measurement request.
+	clockSkewTimeout = 5 * time.Second
+
+	errCodeRequestTimeTooSkewed = "RequestTimeTooSkewed"
+)
+
+// clockSkew keeps the offset of the storage clock to the local clock per
+// endpoint host, as measured from the Date header of the responses, and
+// corrects the signing time of the requests by the offset.
+//
+// Every response updates the offset of its host. If no response was
+// received from a host for the interval, the offset is measured with an
+// unsigned HEAD request to the host before the next request is signed, so
+// that presigned links are corrected also when the client itself is idle.
+type clockSkew struct {
+	client   s3.HTTPClient
+	interval time.Duration
+	hosts    sync.Map // map[string]*hostClockSkew
+}
+
+type hostClockSkew struct {
+	// offset is the time.Duration to add to the local time.
+	offset int64
+	// measured is the local time of the last measurement in unix
+	// nanoseconds.
+	measured int64
+}
+
+func newClockSkew() *clockSkew {
+	return &clockSkew{
+		client:   http.DefaultClient,
+		interval: clockSkewInterval,
+	}
+}
+
+func (c *clockSkew) host(host string) *hostClockSkew {
+	if h, ok := c.hosts.Load(host); ok {
+		return h.(*hostClockSkew)
+	}
+	h, _ := c.hosts.LoadOrStore(host, &hostClockSkew{})
+	return h.(*hostClockSkew)
+}
+
+// update sets the offset of the host from the Date header of a response to
+// a request sent at sent and received at received.
+func (c *clockSkew) update(host, date string, sent, received time.Time) {
+	serverTime, err := http.ParseTime(date)
+	if err != nil {
+		return
+	}
+	// The Date header has a precision of a second, so smaller offsets
+	// are not corrected.
+	offset := serverTime.Sub(sent.Add(received.Sub(sent) / 2))
+	if offset > -time.Second && offset < time.Second {
+		offset = 0
+	}
+	h := c.host(host)
+	atomic.StoreInt64(&h.offset, int64(offset))
+	atomic.StoreInt64(&h.measured, received.UnixNano())
+}
+
+// measure updates the offset of the host of u from the response to an
+// unsigned HEAD request; any response carries the Date header.
+func (c *clockSkew) measure(ctx context.Context, u *url.URL) {
+	ctx, cancel := context.WithTimeout(ctx, clockSkewTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead,
+		(&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}).String(), nil)
+	if err != nil {
+		return
+	}
+	sent := time.Now()
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		// The previous offset is kept.
+		return
+	}
+	rsp.Body.Close()
+	c.update(u.Host, rsp.Header.Get("Date"), sent, time.Now())
+}
+
+// signingTime returns signingTime corrected by the offset of the host of u,
+// measuring the offset first if the last measurement is older than the
+// interval. Concurrent requests (and the measuring request) use the
+// previous offset while the offset is measured.
+func (c *clockSkew) signingTime(
+	ctx context.Context,
+	u *url.URL,
+	signingTime time.Time,
+) time.Time {
+	h := c.host(u.Host)
+	last := atomic.LoadInt64(&h.measured)
+	if time.Since(time.Unix(0, last)) >= c.interval &&
+		atomic.CompareAndSwapInt64(&h.measured, last, time.Now().UnixNano()) {
+		c.measure(ctx, u)
+	}
+	return signingTime.Add(time.Duration(atomic.LoadInt64(&h.offset)))
+}
+
+// clockSkewSigner signs the requests with the corrected time.
+type clockSkewSigner struct {
+	s3.HTTPSignerV4
+	skew *clockSkew
+}
+
+func (s clockSkewSigner) SignHTTP(
+	ctx context.Context,
+	credentials aws.Credentials,
+	r *http.Request,
+	payloadHash, service, region string,
+	signingTime time.Time,
+	optFns ...func(*v4.SignerOptions),
+) error {
+	return s.HTTPSignerV4.SignHTTP(ctx, credentials, r,
+		payloadHash, service, region,
+		s.skew.signingTime(ctx, r.URL, signingTime), optFns...)
+}
+
+// clockSkewPresigner presigns the requests with the corrected time.
+type clockSkewPresigner struct {
+	s3.HTTPPresignerV4
+	skew *clockSkew
+}
+
+func (s clockSkewPresigner) PresignHTTP(
+	ctx context.Context,
+	credentials aws.Credentials,
+	r *http.Request,
+	payloadHash, service, region string,
+	signingTime time.Time,
+	optFns ...func(*v4.SignerOptions),
+) (string, http.Header, error) {
+	return s.HTTPPresignerV4.PresignHTTP(ctx, credentials, r,
+		payloadHash, service, region,
+		s.skew.signingTime(ctx, r.URL, signingTime), optFns...)
+}
+
+func isRequestTimeTooSkewedError(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) &&
+		apiErr.ErrorCode() == errCodeRequestTimeTooSkewed
+}
+
+// clockSkewMiddleware updates the clock skew from the Date header of the
+// responses, and retries a request rejected as RequestTimeTooSkewed once
+// with the updated skew.
+func clockSkewMiddleware(skew *clockSkew) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		if _, ok := stack.Finalize.Get("Signing"); !ok {
+			// Presigned requests are not sent by the client.
+			return nil
+		}
+		err := stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc(
+			"ClockSkew",
+			func(
+				ctx context.Context,
+				in middleware.DeserializeInput,
+				next middleware.DeserializeHandler,
+			) (middleware.DeserializeOutput, middleware.Metadata, error) {
+				sent := time.Now()
+				out, md, err := next.HandleDeserialize(ctx, in)
+				req, ok := in.Request.(*smithyhttp.Request)
+				rsp, _ := out.RawResponse.(*smithyhttp.Response)
+				if ok && rsp != nil {
+					skew.update(req.URL.Host, rsp.Header.Get("Date"), sent, time.Now())
+				}
+				return out, md, err
+			}), middleware.After)
+		if err != nil {
+			return err
+		}
+		return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc(
+			"RetryRequestTimeTooSkewed",
+			func(
+				ctx context.Context,
+				in middleware.FinalizeInput,
+				next middleware.FinalizeHandler,
+			) (middleware.FinalizeOutput, middleware.Metadata, error) {
+				out, md, err := next.HandleFinalize(ctx, in)
+				if !isRequestTimeTooSkewedError(err) {
+					return out, md, err
+				}
+				req, ok := in.Request.(*smithyhttp.Request)
+				if !ok || req.RewindStream() != nil {
+					return out, md, err
+				}
+				return next.HandleFinalize(ctx, in)
+			}),
+			middleware.Before,
+		)
+	}
+}
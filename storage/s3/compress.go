@@ -0,0 +1,106 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"mime"
+	"strings"
+)
+
+// contentEncodingGzip is the content-encoding of objects compressed with
+// the CompressOnUpload option.
+const contentEncodingGzip = "gzip"
+
+// compressedContentTypes are the media types of data that is compressed
+// already; compressing it again costs CPU without saving storage.
+var compressedContentTypes = map[string]struct{}{
+	"application/gzip":             {},
+	"application/x-gzip":           {},
+	"application/zip":              {},
+	"application/x-xz":             {},
+	"application/zstd":             {},
+	"application/x-zstd":           {},
+	"application/x-bzip2":          {},
+	"application/x-lz4":            {},
+	"application/x-7z-compressed":  {},
+	"application/x-rar-compressed": {},
+	"application/vnd.rar":          {},
+	"application/x-compress":       {},
+	"application/x-brotli":         {},
+}
+
+// isCompressedContentType returns true if the content type is the type
+// of compressed data: an archive or compression format, or an image, audio
+// or video type other than XML (e.g. SVG).
+func isCompressedContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	if _, ok := compressedContentTypes[mediaType]; ok {
+		return true
+	}
+	if strings.HasSuffix(mediaType, "+xml") {
+		return false
+	}
+	for _, prefix := range []string{"image/", "audio/", "video/"} {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type contentEncodingKey struct{}
+
+// contentEncodingFromContext returns the content-encoding of an upload: the
+// encoding attached to the context by a compressed upload, or the
+// ContentEncoding option.
+func (s *SimpleStorageService) contentEncodingFromContext(ctx context.Context) *string {
+	if encoding, ok := ctx.Value(contentEncodingKey{}).(string); ok {
+		return &encoding
+	}
+	return s.contentEncoding
+}
+
+// gzipReader returns a stream of the gzip compressed src. The data is
+// compressed in a goroutine while the stream is read; the goroutine stops
+// reading src once the stream is closed or the context is canceled.
+func gzipReader(ctx context.Context, src io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		zw := gzip.NewWriter(pw)
+		_, err := io.Copy(zw, contextReader{ctx: ctx, r: src})
+		if err == nil {
+			err = zw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// compressUpload returns the upload context and source of a compressed
+// upload of src with the CompressOnUpload option. The compressed size is
+// not known in advance: the result is uploaded as a stream.
+func (s *SimpleStorageService) compressUpload(
+	ctx context.Context,
+	src io.Reader,
+) (context.Context, io.ReadCloser) {
+	return context.WithValue(ctx, contentEncodingKey{}, contentEncodingGzip),
+		gzipReader(ctx, src)
+}
@@ -0,0 +1,46 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+
+	"github.com/aws/smithy-go/middleware"
+)
+
+// concurrencyLimitMiddleware limits the number of operations in flight to
+// the capacity of slots. Operations wait for a free slot until the context
+// is done. Presign operations do not send any request and are not limited.
+func concurrencyLimitMiddleware(slots chan struct{}) apiOptions {
+	return func(stack *middleware.Stack) error {
+		if _, presign := stack.Finalize.Get(presignMiddlewareID); presign {
+			return nil
+		}
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc(
+			"ConcurrencyLimit", func(
+				ctx context.Context,
+				in middleware.InitializeInput,
+				next middleware.InitializeHandler,
+			) (out middleware.InitializeOutput, md middleware.Metadata, err error) {
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					return out, md, ctx.Err()
+				}
+				defer func() { <-slots }()
+				return next.HandleInitialize(ctx, in)
+			}), middleware.Before)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"strings"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/mendersoftware/deployments/storage"
+)
+
+// quoteETag returns the ETag as quoted string, as expected by If-Match.
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+// putConditionMiddleware sends the storage.PutCondition of the operation
+// context with the requests completing uploads: PutObject and
+// CompleteMultipartUpload. S3 responds with 412 Precondition Failed if the
+// condition is not met. Presigned uploads are left as is.
+func putConditionMiddleware(stack *middleware.Stack) error {
+	if _, presign := stack.Finalize.Get(presignMiddlewareID); presign {
+		return nil
+	}
+	return stack.Build.Add(middleware.BuildMiddlewareFunc(
+		"PutCondition", func(
+			ctx context.Context,
+			in middleware.BuildInput,
+			next middleware.BuildHandler,
+		) (middleware.BuildOutput, middleware.Metadata, error) {
+			cond, ok := storage.PutConditionFromContext(ctx)
+			if !ok {
+				return next.HandleBuild(ctx, in)
+			}
+			switch awsmiddleware.GetOperationName(ctx) {
+			case "PutObject", "CompleteMultipartUpload":
+			default:
+				return next.HandleBuild(ctx, in)
+			}
+			if req, ok := in.Request.(*smithyhttp.Request); ok {
+				if cond.IfMatch != "" {
+					req.Header.Set("If-Match", quoteETag(cond.IfMatch))
+				}
+				if cond.IfNotExists {
+					req.Header.Set("If-None-Match", "*")
+				}
+			}
+			return next.HandleBuild(ctx, in)
+		}), middleware.After)
+}
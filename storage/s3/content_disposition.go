@@ -0,0 +1,45 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"strings"
+
+	"github.com/mendersoftware/deployments/storage"
+)
+
+// contentDispositionName is the placeholder in the ContentDisposition
+// option substituted with the filename parameters.
+const contentDispositionName = "{name}"
+
+// contentDisposition returns the content-disposition for downloading an
+// object as filename, or an empty string if the download should use the
+// object's own content-disposition.
+func (s *SimpleStorageService) contentDisposition(filename string) string {
+	if s.contentDispositionTemplate == nil {
+		if filename == "" {
+			return ""
+		}
+		return storage.AttachmentDisposition(filename)
+	}
+	template := *s.contentDispositionTemplate
+	if !strings.Contains(template, contentDispositionName) {
+		return template
+	} else if filename == "" {
+		return ""
+	}
+	return strings.ReplaceAll(template, contentDispositionName,
+		storage.FilenameParams(filename))
+}
@@ -0,0 +1,293 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	// copyMaxSize is the largest object S3 copies in a single request;
+	// larger objects are copied in parts.
+	copyMaxSize = MultipartMaxSize
+	// copyPartSize is the size of the parts of multipart copies, unless
+	// the object needs larger parts to fit in MultipartMaxParts.
+	copyPartSize = 512 * mib
+)
+
+// CopyOptions configures CopyObject through CopyOptionsWithContext.
+type CopyOptions struct {
+	// Bucket is the destination bucket; defaults to the bucket of the
+	// source object.
+	Bucket string
+	// ReplaceMetadata replaces the content type and user-defined metadata
+	// of the source object with ContentType and Metadata. Otherwise, the
+	// copy keeps those of the source.
+	ReplaceMetadata bool
+	// ContentType of the copy; defaults to the ContentType option.
+	ContentType *string
+	// Metadata of the copy, merged with the Metadata option.
+	Metadata map[string]string
+}
+
+type copyOptionsKey struct{}
+
+// CopyOptionsWithContext configures the CopyObject calls with the returned
+// context.
+func CopyOptionsWithContext(ctx context.Context, opts CopyOptions) context.Context {
+	return context.WithValue(ctx, copyOptionsKey{}, opts)
+}
+
+func copyOptionsFromContext(ctx context.Context) CopyOptions {
+	opts, _ := ctx.Value(copyOptionsKey{}).(CopyOptions)
+	return opts
+}
+
+// copySource returns the URL-encoded source of copy requests.
+func copySource(bucket, key string) *string {
+	segments := strings.Split(key, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	return aws.String(bucket + "/" + strings.Join(segments, "/"))
+}
+
+// copyMetadata are the properties the copy of an object is stored with.
+type copyMetadata struct {
+	contentType        *string
+	contentEncoding    *string
+	contentDisposition *string
+	cacheControl       *string
+	metadata           map[string]string
+}
+
+// replacedMetadata returns the properties of a copy replacing the metadata
+// of the source: the configured properties, overridden by copyOpts.
+func (s *SimpleStorageService) replacedMetadata(copyOpts CopyOptions) (copyMetadata, error) {
+	meta := copyMetadata{
+		contentType:     s.contentType,
+		contentEncoding: s.contentEncoding,
+		cacheControl:    s.cacheControl,
+		metadata:        s.metadata,
+	}
+	if copyOpts.ContentType != nil {
+		if err := validateHeaderValue(copyOpts.ContentType); err != nil {
+			return meta, errors.WithMessage(err, "s3: invalid content type")
+		}
+		meta.contentType = copyOpts.ContentType
+	}
+	if len(copyOpts.Metadata) > 0 {
+		meta.metadata = make(map[string]string, len(s.metadata)+len(copyOpts.Metadata))
+		for key, value := range s.metadata {
+			meta.metadata[key] = value
+		}
+		for key, value := range normalizeMetadata(copyOpts.Metadata) {
+			meta.metadata[key] = value
+		}
+		if err := validateMetadata(meta.metadata); err != nil {
+			return meta, errors.WithMessage(err, "s3: invalid metadata")
+		}
+	}
+	return meta, nil
+}
+
+// CopyObject copies the object at srcPath to dstPath without transferring
+// the data through the service. The destination bucket and the metadata
+// of the copy are configured with CopyOptionsWithContext.
+//
+// Objects up to 5 GiB are copied in a single request, which also copies the
+// tags of the source. Larger objects are copied in parts with a multipart
+// upload; the content type and metadata of the source are carried over,
+// but the copy is tagged with the configured tags only.
+func (s *SimpleStorageService) CopyObject(
+	ctx context.Context,
+	srcPath, dstPath string,
+) error {
+	bucket, opts, err := s.optionsFromContext(ctx, true)
+	if err != nil {
+		return err
+	}
+	copyOpts := copyOptionsFromContext(ctx)
+	dstBucket := bucket
+	if copyOpts.Bucket != "" {
+		dstBucket = copyOpts.Bucket
+	}
+	srcKey, head, err := s.headObject(ctx, srcPath)
+	if err != nil {
+		return err
+	}
+	size := head.ContentLength
+	if ref := s.objectKey(srcPath); ref != srcKey &&
+		dstBucket == bucket && !copyOpts.ReplaceMetadata {
+		// Copy the reference to the deduplicated content instead of
+		// the content.
+		srcKey, size = ref, 0
+	}
+	meta := copyMetadata{
+		contentType:        head.ContentType,
+		contentEncoding:    head.ContentEncoding,
+		contentDisposition: head.ContentDisposition,
+		cacheControl:       head.CacheControl,
+		metadata:           head.Metadata,
+	}
+	if copyOpts.ReplaceMetadata {
+		if meta, err = s.replacedMetadata(copyOpts); err != nil {
+			return err
+		}
+	}
+	dstKey := s.objectKey(dstPath)
+	defer s.invalidateCacheKey(dstBucket, dstKey)
+	if size <= copyMaxSize {
+		err = s.copyObject(ctx, bucket, srcKey, dstBucket, dstKey,
+			copyOpts.ReplaceMetadata, meta, opts)
+	} else {
+		err = s.copyMultipart(ctx, bucket, srcKey, dstBucket, dstKey,
+			size, meta, opts)
+	}
+	if err != nil {
+		return errors.WithMessage(mapError(err), "s3: failed to copy object")
+	}
+	return nil
+}
+
+func (s *SimpleStorageService) copyObject(
+	ctx context.Context,
+	srcBucket, srcKey, dstBucket, dstKey string,
+	replace bool,
+	meta copyMetadata,
+	opts func(*s3.Options),
+) error {
+	params := &s3.CopyObjectInput{
+		Bucket:     &dstBucket,
+		Key:        &dstKey,
+		CopySource: copySource(srcBucket, srcKey),
+
+		ServerSideEncryption: s.sseAlgorithm,
+		SSEKMSKeyId:          s.sseKMSKeyID,
+		StorageClass:         s.storageClass,
+		ChecksumAlgorithm:    s.checksum,
+
+		ObjectLockMode:            s.objectLockMode,
+		ObjectLockRetainUntilDate: s.objectLockRetainUntil(),
+	}
+	if replace {
+		params.MetadataDirective = types.MetadataDirectiveReplace
+		params.ContentType = meta.contentType
+		params.ContentEncoding = meta.contentEncoding
+		params.CacheControl = meta.cacheControl
+		params.Metadata = meta.metadata
+	}
+	params.SSECustomerAlgorithm,
+		params.SSECustomerKey,
+		params.SSECustomerKeyMD5 = s.sseCustomerKey.params()
+	params.CopySourceSSECustomerAlgorithm,
+		params.CopySourceSSECustomerKey,
+		params.CopySourceSSECustomerKeyMD5 = s.sseCustomerKey.params()
+	_, err := s.client.CopyObject(ctx, params, opts)
+	return s.objectLockError(err)
+}
+
+// copyMultipart copies size bytes of the source in parts of at least
+// copyPartSize bytes.
+func (s *SimpleStorageService) copyMultipart(
+	ctx context.Context,
+	srcBucket, srcKey, dstBucket, dstKey string,
+	size int64,
+	meta copyMetadata,
+	opts func(*s3.Options),
+) error {
+	partSize := int64(copyPartSize)
+	if minSize := (size + MultipartMaxParts - 1) / MultipartMaxParts; minSize > partSize {
+		partSize = minSize
+	}
+	tagging, err := s.taggingFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	createParams := s.createMultipartInput(ctx, dstBucket, dstKey, tagging)
+	createParams.ContentType = meta.contentType
+	createParams.ContentEncoding = meta.contentEncoding
+	createParams.ContentDisposition = meta.contentDisposition
+	createParams.CacheControl = meta.cacheControl
+	createParams.Metadata = meta.metadata
+	rspCreate, err := s.client.CreateMultipartUpload(ctx, createParams, opts)
+	if err != nil {
+		return s.objectLockError(err)
+	}
+
+	partParams := &s3.UploadPartCopyInput{
+		Bucket:     &dstBucket,
+		Key:        &dstKey,
+		UploadId:   rspCreate.UploadId,
+		CopySource: copySource(srcBucket, srcKey),
+	}
+	partParams.SSECustomerAlgorithm,
+		partParams.SSECustomerKey,
+		partParams.SSECustomerKeyMD5 = s.sseCustomerKey.params()
+	partParams.CopySourceSSECustomerAlgorithm,
+		partParams.CopySourceSSECustomerKey,
+		partParams.CopySourceSSECustomerKeyMD5 = s.sseCustomerKey.params()
+	parts := make([]types.CompletedPart, 0, (size+partSize-1)/partSize)
+	for offset, partNum := int64(0), int32(1); offset < size; partNum++ {
+		end := offset + partSize
+		if end > size {
+			end = size
+		}
+		partParams.PartNumber = partNum
+		partParams.CopySourceRange = aws.String(
+			fmt.Sprintf("bytes=%d-%d", offset, end-1),
+		)
+		var rsp *s3.UploadPartCopyOutput
+		rsp, err = s.client.UploadPartCopy(ctx, partParams, opts)
+		if err != nil {
+			break
+		}
+		part := types.CompletedPart{PartNumber: partNum}
+		if result := rsp.CopyPartResult; result != nil {
+			part.ETag = result.ETag
+			part.ChecksumCRC32 = result.ChecksumCRC32
+			part.ChecksumCRC32C = result.ChecksumCRC32C
+			part.ChecksumSHA1 = result.ChecksumSHA1
+			part.ChecksumSHA256 = result.ChecksumSHA256
+		}
+		parts = append(parts, part)
+		offset = end
+	}
+	if err == nil {
+		_, err = s.client.CompleteMultipartUpload(ctx,
+			&s3.CompleteMultipartUploadInput{
+				Bucket:   &dstBucket,
+				Key:      &dstKey,
+				UploadId: rspCreate.UploadId,
+				MultipartUpload: &types.CompletedMultipartUpload{
+					Parts: parts,
+				},
+			},
+			opts,
+		)
+	}
+	if err != nil {
+		s.abortMultipart(ctx, dstBucket, dstKey, rspCreate.UploadId, opts)
+	}
+	return err
+}
@@ -0,0 +1,344 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/endpointcreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// credentialsExpiryWindow is the duration before the expiry of temporary
+// credentials where the credentials are refreshed.
+const credentialsExpiryWindow = 5 * time.Minute
+
+// Credential sources for Options.CredentialSource. Unless a source is
+// forced, the credentials are resolved in the following order:
+//
+//  1. StaticCredentials, if set
+//  2. web identity (WebIdentityTokenFile), if set
+//  3. environment (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY)
+//  4. shared config and credentials files (takes precedence over the
+//     environment if AWS_PROFILE is set)
+//  5. container (ECS) or EC2 instance profile
+//
+// Steps 3-5 are the default credential chain of the AWS SDK. If
+// AssumeRoleARN is set, the resolved credentials are the source
+// credentials for assuming the role.
+const (
+	CredentialSourceStatic       = "static"
+	CredentialSourceWebIdentity  = "web_identity"
+	CredentialSourceEnvironment  = "environment"
+	CredentialSourceSharedConfig = "shared_config"
+	CredentialSourceInstance     = "instance"
+
+	// containerCredentialsHost is the host of the ECS container
+	// credentials endpoint for AWS_CONTAINER_CREDENTIALS_RELATIVE_URI.
+	containerCredentialsHost = "http://169.254.170.2"
+)
+
+// ErrPresignCredentialsExpiring is returned by presign operations if the
+// credentials cannot be refreshed to remain valid for MinPresignCredTTL.
+var ErrPresignCredentialsExpiring = errors.New(
+	"s3: credentials expire too soon for signing the request",
+)
+
+// ErrProfileNotFound is returned when creating the storage if the Profile
+// does not exist in the shared config files.
+var ErrProfileNotFound = errors.New("s3: shared config profile not found")
+
+var (
+	errInvalidRoleARN     = errors.New("must be a valid IAM role ARN")
+	errNoCredentialsInEnv = errors.New("s3: no credentials in the environment")
+	validCredentialSource = validation.In(
+		CredentialSourceStatic,
+		CredentialSourceWebIdentity,
+		CredentialSourceEnvironment,
+		CredentialSourceSharedConfig,
+		CredentialSourceInstance,
+	)
+)
+
+// credentialsProvider returns the provider of the credentials source,
+// following the order documented with the CredentialSource constants;
+// s3Opts.Credentials are the credentials of the AWS SDK default chain.
+func (opts *Options) credentialsProvider(s3Opts *s3.Options) aws.CredentialsProvider {
+	source := aws.ToString(opts.CredentialSource)
+	switch {
+	case source == CredentialSourceStatic,
+		source == "" && opts.StaticCredentials != nil:
+		return *opts.StaticCredentials
+	case source == CredentialSourceWebIdentity,
+		source == "" && opts.WebIdentityTokenFile != nil:
+		return opts.webIdentityProvider(s3Opts)
+	case source == CredentialSourceEnvironment:
+		return environmentCredentials()
+	case source == CredentialSourceSharedConfig:
+		return sharedConfigCredentials(aws.ToString(opts.Profile))
+	case source == CredentialSourceInstance:
+		return instanceCredentials(s3Opts)
+	}
+	return s3Opts.Credentials
+}
+
+// environmentCredentials returns the credentials from the environment
+// variables; the variables are read when the credentials are retrieved.
+func environmentCredentials() aws.CredentialsProvider {
+	return aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+		env, err := awsConfig.NewEnvConfig()
+		if err != nil {
+			return aws.Credentials{}, err
+		} else if !env.Credentials.HasKeys() {
+			return aws.Credentials{}, errNoCredentialsInEnv
+		}
+		return env.Credentials, nil
+	})
+}
+
+// sharedConfigCredentials returns the credentials of the shared config
+// profile (the profile, AWS_PROFILE or "default"), ignoring credentials
+// from the environment.
+func sharedConfigCredentials(profile string) aws.CredentialsProvider {
+	return aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		env, err := awsConfig.NewEnvConfig()
+		if err != nil {
+			return aws.Credentials{}, err
+		}
+		if profile == "" {
+			profile = env.SharedConfigProfile
+		}
+		if profile == "" {
+			profile = awsConfig.DefaultSharedConfigProfile
+		}
+		cfg, err := awsConfig.LoadDefaultConfig(ctx,
+			awsConfig.WithSharedConfigProfile(profile),
+		)
+		if err != nil {
+			return aws.Credentials{}, err
+		}
+		return cfg.Credentials.Retrieve(ctx)
+	})
+}
+
+// checkProfile returns ErrProfileNotFound if the profile does not exist in
+// the shared config files; the AWS SDK silently ignores missing profiles.
+func checkProfile(ctx context.Context, profile string) error {
+	env, err := awsConfig.NewEnvConfig()
+	if err != nil {
+		return err
+	}
+	_, err = awsConfig.LoadSharedConfigProfile(ctx, profile,
+		func(opts *awsConfig.LoadSharedConfigOptions) {
+			if env.SharedConfigFile != "" {
+				opts.ConfigFiles = []string{env.SharedConfigFile}
+			}
+			if env.SharedCredentialsFile != "" {
+				opts.CredentialsFiles = []string{env.SharedCredentialsFile}
+			}
+		})
+	var errProfile awsConfig.SharedConfigProfileNotExistError
+	if errors.As(err, &errProfile) {
+		return fmt.Errorf("%w: %q", ErrProfileNotFound, profile)
+	}
+	return err
+}
+
+// instanceCredentials returns the credentials of the ECS container if
+// the container credentials endpoint is configured in the environment,
+// and the credentials of the EC2 instance profile otherwise.
+func instanceCredentials(s3Opts *s3.Options) aws.CredentialsProvider {
+	env, _ := awsConfig.NewEnvConfig()
+	endpoint := env.ContainerCredentialsEndpoint
+	if env.ContainerCredentialsRelativePath != "" {
+		endpoint = containerCredentialsHost + env.ContainerCredentialsRelativePath
+	}
+	if endpoint != "" {
+		return endpointcreds.New(endpoint, func(o *endpointcreds.Options) {
+			o.HTTPClient = s3Opts.HTTPClient
+			o.AuthorizationToken = env.ContainerAuthorizationToken
+		})
+	}
+	return ec2rolecreds.New()
+}
+
+func validateRoleARN(value interface{}) error {
+	roleARN, _ := value.(*string)
+	if roleARN == nil {
+		return nil
+	}
+	a, err := arn.Parse(*roleARN)
+	if err != nil || a.Service != "iam" || !strings.HasPrefix(a.Resource, "role/") {
+		return errInvalidRoleARN
+	}
+	return nil
+}
+
+func stsClientFromOptions(s3Opts *s3.Options) *sts.Client {
+	return sts.New(sts.Options{
+		Region:      s3Opts.Region,
+		Credentials: s3Opts.Credentials,
+		HTTPClient:  s3Opts.HTTPClient,
+	})
+}
+
+func newCredentialsCache(provider aws.CredentialsProvider) *aws.CredentialsCache {
+	return aws.NewCredentialsCache(provider,
+		func(cco *aws.CredentialsCacheOptions) {
+			cco.ExpiryWindow = credentialsExpiryWindow
+		},
+	)
+}
+
+// cachedCredentials makes sure the credentials provider is wrapped in a
+// credentials cache, so temporary credentials are refreshed ahead of their
+// expiry instead of being reused until requests are rejected. Static and
+// anonymous credentials never expire and are returned as is.
+func cachedCredentials(provider aws.CredentialsProvider) aws.CredentialsProvider {
+	switch provider.(type) {
+	case nil, *aws.CredentialsCache, StaticCredentials, aws.AnonymousCredentials:
+		return provider
+	}
+	return newCredentialsCache(provider)
+}
+
+// expiredTokenErrorCodes are the error codes returned by the storage for
+// requests signed with expired temporary credentials.
+var expiredTokenErrorCodes = map[string]struct{}{
+	"ExpiredToken":          {},
+	"ExpiredTokenException": {},
+	"TokenRefreshRequired":  {},
+}
+
+func isExpiredTokenError(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	_, ok := expiredTokenErrorCodes[apiErr.ErrorCode()]
+	return ok
+}
+
+// refreshCredentialsMiddleware retries a request once with refreshed
+// credentials when the storage rejects the cached credentials as expired.
+// This covers credentials revoked or expiring earlier than announced (e.g.
+// due to clock skew) during long running multipart uploads, where the parts
+// uploaded late in the session would otherwise fail.
+func refreshCredentialsMiddleware(cache *aws.CredentialsCache) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		if _, ok := stack.Finalize.Get("Signing"); !ok {
+			// Presigned requests are not sent by the client.
+			return nil
+		}
+		return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc(
+			"RefreshExpiredCredentials",
+			func(
+				ctx context.Context,
+				in middleware.FinalizeInput,
+				next middleware.FinalizeHandler,
+			) (middleware.FinalizeOutput, middleware.Metadata, error) {
+				out, md, err := next.HandleFinalize(ctx, in)
+				if !isExpiredTokenError(err) {
+					return out, md, err
+				}
+				req, ok := in.Request.(*smithyhttp.Request)
+				if !ok || req.RewindStream() != nil {
+					return out, md, err
+				}
+				cache.Invalidate()
+				return next.HandleFinalize(ctx, in)
+			}),
+			middleware.Before,
+		)
+	}
+}
+
+// minTTLCredentials makes sure the credentials used for presigning remain
+// valid for at least minTTL, so that the links are not signed with
+// credentials about to expire. Credentials expiring sooner are refreshed
+// once by invalidating the client's credentials cache, if any.
+type minTTLCredentials struct {
+	aws.CredentialsProvider
+	minTTL time.Duration
+	cache  func() *aws.CredentialsCache
+}
+
+func (p minTTLCredentials) valid(creds aws.Credentials) bool {
+	return !creds.CanExpire || time.Until(creds.Expires) >= p.minTTL
+}
+
+func (p minTTLCredentials) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	creds, err := p.CredentialsProvider.Retrieve(ctx)
+	if err != nil || p.valid(creds) {
+		return creds, err
+	}
+	if cache := p.cache(); cache != nil {
+		cache.Invalidate()
+		creds, err = p.CredentialsProvider.Retrieve(ctx)
+		if err != nil || p.valid(creds) {
+			return creds, err
+		}
+	}
+	return aws.Credentials{}, ErrPresignCredentialsExpiring
+}
+
+// webIdentityProvider returns a provider exchanging the web identity token
+// read from WebIdentityTokenFile for temporary role credentials. The token
+// file is read every time the credentials are refreshed, picking up rotated
+// tokens.
+func (opts *Options) webIdentityProvider(s3Opts *s3.Options) aws.CredentialsProvider {
+	provider := stscreds.NewWebIdentityRoleProvider(
+		stsClientFromOptions(s3Opts),
+		*opts.WebIdentityRoleARN,
+		stscreds.IdentityTokenFile(*opts.WebIdentityTokenFile),
+		func(wro *stscreds.WebIdentityRoleOptions) {
+			if opts.RoleSessionName != nil {
+				wro.RoleSessionName = *opts.RoleSessionName
+			}
+		},
+	)
+	return newCredentialsCache(provider)
+}
+
+// assumeRoleProvider wraps the client credentials with an STS AssumeRole
+// provider. The credentials from the s3 options (static or default chain)
+// are used as the source credentials for assuming the role.
+func (opts *Options) assumeRoleProvider(s3Opts *s3.Options) aws.CredentialsProvider {
+	provider := stscreds.NewAssumeRoleProvider(
+		stsClientFromOptions(s3Opts),
+		*opts.AssumeRoleARN,
+		func(aro *stscreds.AssumeRoleOptions) {
+			aro.ExternalID = opts.ExternalID
+			if opts.RoleSessionName != nil {
+				aro.RoleSessionName = *opts.RoleSessionName
+			}
+		},
+	)
+	return newCredentialsCache(provider)
+}
@@ -0,0 +1,191 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deployments/storage"
+)
+
+const (
+	// contentPrefix is the storage path prefix of deduplicated content;
+	// the objects are named by the hex encoded SHA256 sum.
+	contentPrefix = ".content/sha256/"
+	// metaContentSHA256 holds the SHA256 sum of deduplicated content, and
+	// of other objects with the StoreSHA256 option.
+	metaContentSHA256 = "content-sha256"
+	// metaContentRef marks an (empty) object as a reference to the
+	// deduplicated content with the SHA256 sum of the value.
+	metaContentRef = "content-ref"
+)
+
+type uploadMetadataKey struct{}
+
+func withUploadMetadata(ctx context.Context, key, value string) context.Context {
+	return context.WithValue(ctx, uploadMetadataKey{}, [2]string{key, value})
+}
+
+// metadataFromContext returns the user-defined metadata of an upload: the
+// Metadata option, the entry attached to the context, if any, and the
+// expiry time with the ExpiresAfter option.
+func (s *SimpleStorageService) metadataFromContext(ctx context.Context) map[string]string {
+	entry, ok := ctx.Value(uploadMetadataKey{}).([2]string)
+	if !ok && s.expiresAfter <= 0 {
+		return s.metadata
+	}
+	metadata := make(map[string]string, len(s.metadata)+2)
+	for key, value := range s.metadata {
+		metadata[key] = value
+	}
+	if ok {
+		metadata[entry[0]] = entry[1]
+	}
+	if s.expiresAfter > 0 {
+		metadata[metaExpiresAt] = s.expiresAt()
+	}
+	return metadata
+}
+
+func (s *SimpleStorageService) contentKey(sum string) string {
+	return s.objectKey(contentPrefix + sum)
+}
+
+// sectionSHA256 returns the hex encoded SHA256 sum of size bytes of rs
+// starting at start.
+func sectionSHA256(rs io.ReadSeeker, start, size int64) (string, error) {
+	digest := sha256.New()
+	if _, err := io.Copy(digest, newSection(rs, start, size)); err != nil {
+		return "", errors.WithMessage(err, "s3: failed to hash object")
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// putDeduplicated stores size bytes of rs starting at start as content
+// object named by its SHA256 sum and references the content from key. The
+// transfer is skipped if the content object exists with the same size and
+// sum; content objects that do not match, for instance written by other
+// means under the same key, are uploaded again.
+func (s *SimpleStorageService) putDeduplicated(
+	ctx context.Context,
+	key string,
+	rs io.ReadSeeker,
+	start, size int64,
+) error {
+	sum, err := sectionSHA256(rs, start, size)
+	if err != nil {
+		return err
+	}
+
+	bucket, opts, err := s.optionsFromContext(ctx, true)
+	if err != nil {
+		return err
+	}
+	contentKey := s.contentKey(sum)
+	params := &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(contentKey),
+	}
+	params.SSECustomerAlgorithm,
+		params.SSECustomerKey,
+		params.SSECustomerKeyMD5 = s.sseCustomerKey.params()
+	rsp, err := s.client.HeadObject(ctx, params, opts)
+	switch {
+	case err == nil &&
+		rsp.ContentLength == size &&
+		rsp.Metadata[metaContentSHA256] == sum:
+		// Identical content is already stored.
+	case err == nil, errors.Is(mapError(err), storage.ErrObjectNotFound):
+		// The condition applies to the object at the path, not to the
+		// shared content.
+		err = s.putSeekable(
+			withUploadMetadata(
+				storage.PutConditionWithContext(ctx, storage.PutCondition{}),
+				metaContentSHA256, sum,
+			),
+			contentKey, rs, start, size,
+		)
+	}
+	if err != nil {
+		return err
+	}
+	return s.putObject(
+		withUploadMetadata(ctx, metaContentRef, sum),
+		key, bytes.NewReader(nil), 0,
+	)
+}
+
+// statObject returns the properties of the object at path and the key of
+// its data; references to deduplicated content are resolved to the
+// content object.
+func (s *SimpleStorageService) statObject(
+	ctx context.Context,
+	path string,
+) (string, *storage.ObjectInfo, error) {
+	key, rsp, err := s.headObject(ctx, path)
+	if err != nil {
+		return "", nil, err
+	}
+	return key, &storage.ObjectInfo{
+		Path:         path,
+		LastModified: rsp.LastModified,
+		Size:         &rsp.ContentLength,
+		ETag:         rsp.ETag,
+		ContentType:  rsp.ContentType,
+
+		ContentEncoding: rsp.ContentEncoding,
+	}, nil
+}
+
+// headObject returns the HEAD response for the data of the object at path
+// and its key, resolving references like statObject.
+func (s *SimpleStorageService) headObject(
+	ctx context.Context,
+	path string,
+) (string, *s3.HeadObjectOutput, error) {
+	bucket, opts, err := s.optionsFromContext(ctx, false)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key := s.objectKey(path)
+	params := &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		// Only set when revalidating a cached info.
+		IfNoneMatch: revalidateFromContext(ctx),
+	}
+	params.SSECustomerAlgorithm,
+		params.SSECustomerKey,
+		params.SSECustomerKeyMD5 = s.sseCustomerKey.params()
+	rsp, err := s.client.HeadObject(ctx, params, opts)
+	if err == nil && rsp.Metadata[metaContentRef] != "" {
+		key = s.contentKey(rsp.Metadata[metaContentRef])
+		params.Key = aws.String(key)
+		rsp, err = s.client.HeadObject(ctx, params, opts)
+	}
+	if err != nil {
+		return "", nil, errors.WithMessage(mapError(err), "s3: error getting object info")
+	}
+	return key, rsp, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsHttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/pkg/errors"
+)
+
+// DeleteObjectsMaxKeys is the maximum number of keys deleted in a single
+// DeleteObjects request.
+const DeleteObjectsMaxKeys = 1000
+
+// DeleteObjectError describes an object that could not be deleted.
+type DeleteObjectError struct {
+	Path    string
+	Code    string
+	Message string
+}
+
+// DeleteObjectsResult lists the outcome of DeleteObjects per object.
+type DeleteObjectsResult struct {
+	Deleted []string
+	Errors  []DeleteObjectError
+}
+
+// DeleteObjects deletes the objects at paths using the batch DeleteObjects
+// API, in requests of up to DeleteObjectsMaxKeys keys. The objects that could
+// not be deleted are listed in the result's Errors, so callers can retry
+// them. If the backend does not implement batch deletes, the objects are
+// deleted one by one. The returned error is only set if a request failed as
+// a whole; the result then contains the objects processed until the failure.
+func (s *SimpleStorageService) DeleteObjects(
+	ctx context.Context,
+	paths []string,
+) (*DeleteObjectsResult, error) {
+	bucket, opts, err := s.optionsFromContext(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer s.invalidateCache(ctx, paths...)
+	result := &DeleteObjectsResult{
+		Deleted: make([]string, 0, len(paths)),
+	}
+	for start := 0; start < len(paths); start += DeleteObjectsMaxKeys {
+		end := start + DeleteObjectsMaxKeys
+		if end > len(paths) {
+			end = len(paths)
+		}
+		objects := make([]types.ObjectIdentifier, end-start)
+		for i, path := range paths[start:end] {
+			objects[i].Key = aws.String(s.objectKey(path))
+		}
+		rsp, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &types.Delete{Objects: objects},
+		}, opts)
+		var rspErr *awsHttp.ResponseError
+		if errors.As(err, &rspErr) &&
+			rspErr.Response.StatusCode == http.StatusNotImplemented {
+			for _, path := range paths[start:] {
+				s.deleteObjectSequential(ctx, path, result)
+			}
+			break
+		} else if err != nil {
+			return result, errors.WithMessage(mapError(err), "s3: error deleting objects")
+		}
+		for _, deleted := range rsp.Deleted {
+			result.Deleted = append(result.Deleted, s.objectPath(aws.ToString(deleted.Key)))
+		}
+		for _, e := range rsp.Errors {
+			result.Errors = append(result.Errors, DeleteObjectError{
+				Path:    s.objectPath(aws.ToString(e.Key)),
+				Code:    aws.ToString(e.Code),
+				Message: aws.ToString(e.Message),
+			})
+		}
+	}
+	return result, nil
+}
+
+func (s *SimpleStorageService) deleteObjectSequential(
+	ctx context.Context,
+	path string,
+	result *DeleteObjectsResult,
+) {
+	err := s.DeleteObject(ctx, path)
+	if err == nil {
+		result.Deleted = append(result.Deleted, path)
+		return
+	}
+	deleteErr := DeleteObjectError{
+		Path:    path,
+		Message: err.Error(),
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		deleteErr.Code = apiErr.ErrorCode()
+		deleteErr.Message = apiErr.ErrorMessage()
+	}
+	result.Errors = append(result.Errors, deleteErr)
+}
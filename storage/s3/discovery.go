@@ -0,0 +1,193 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+const (
+	// DefaultDiscoveryInterval is the age of the discovery document after
+	// which it is fetched again.
+	DefaultDiscoveryInterval = 5 * time.Minute
+	// discoveryTimeout limits the request for the discovery document.
+	discoveryTimeout = 10 * time.Second
+	// discoveryMaxSize limits the size of the discovery document.
+	discoveryMaxSize = 64 * 1024
+)
+
+// discoveryDocument is the document served at the DiscoveryURL, announcing
+// the endpoint and region of the s3 API:
+//
+//	{"endpoint": "https://s3.example.com", "region": "eu-central-1"}
+//
+// The region is optional; unknown fields are ignored.
+type discoveryDocument struct {
+	Endpoint string `json:"endpoint"`
+	Region   string `json:"region,omitempty"`
+}
+
+func (doc discoveryDocument) validate(allowInsecure bool) error {
+	return validation.ValidateStruct(&doc,
+		validation.Field(&doc.Endpoint,
+			validation.Required,
+			validation.By(func(value interface{}) error {
+				endpoint := value.(string)
+				if err := validateAbsoluteURL(&endpoint); err != nil {
+					return err
+				}
+				return validatePlainHTTP(allowInsecure)(&endpoint)
+			}),
+		),
+		validation.Field(&doc.Region, validation.By(func(value interface{}) error {
+			region := value.(string)
+			if region == "" {
+				return nil
+			}
+			return validateHeaderValue(&region)
+		})),
+	)
+}
+
+// endpointDiscovery resolves the endpoint announced by the discovery
+// document. The document is fetched before the first request and again
+// once it is older than the interval; until a document was fetched, or if
+// the document could not be fetched, the fallback resolver of the static
+// URI (or the AWS endpoints) is used.
+type endpointDiscovery struct {
+	url           string
+	client        s3.HTTPClient
+	interval      time.Duration
+	allowInsecure bool
+
+	forcePathStyle bool
+	signingRegion  string
+	fallback       s3.EndpointResolver
+
+	// resolver is the s3.EndpointResolver of the last valid document.
+	resolver atomic.Value
+	// fetched is the local time of the last fetch in unix nanoseconds.
+	fetched int64
+}
+
+func newEndpointDiscovery(opts *Options) *endpointDiscovery {
+	d := &endpointDiscovery{
+		url:            *opts.DiscoveryURL,
+		client:         http.DefaultClient,
+		interval:       DefaultDiscoveryInterval,
+		allowInsecure:  aws.ToBool(opts.AllowInsecureTransport),
+		forcePathStyle: aws.ToBool(opts.ForcePathStyle),
+		signingRegion:  aws.ToString(opts.SigningRegion),
+		fallback:       s3.NewDefaultEndpointResolver(),
+	}
+	if opts.DiscoveryInterval != nil {
+		d.interval = *opts.DiscoveryInterval
+	}
+	if opts.URI != nil {
+		d.fallback = endpointResolver(*opts.URI, d.forcePathStyle, d.signingRegion)
+	}
+	return d
+}
+
+// fetch returns the validated discovery document.
+func (d *endpointDiscovery) fetch(ctx context.Context) (*discoveryDocument, error) {
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	rsp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", rsp.Status)
+	}
+	var doc discoveryDocument
+	err = json.NewDecoder(io.LimitReader(rsp.Body, discoveryMaxSize)).Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	if err = doc.validate(d.allowInsecure); err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+	return &doc, nil
+}
+
+// refresh fetches the discovery document if the last fetch is older than
+// the interval. Concurrent requests use the previous endpoint while the
+// document is fetched; if the fetch fails, the previous endpoint is kept.
+func (d *endpointDiscovery) refresh(ctx context.Context) {
+	last := atomic.LoadInt64(&d.fetched)
+	if last != 0 && time.Since(time.Unix(0, last)) < d.interval ||
+		!atomic.CompareAndSwapInt64(&d.fetched, last, time.Now().UnixNano()) {
+		return
+	}
+	doc, err := d.fetch(ctx)
+	if err != nil {
+		log.FromContext(ctx).Warnf(
+			"s3: endpoint discovery from %s failed, using the previous endpoint: %s",
+			d.url, err.Error(),
+		)
+		return
+	}
+	signingRegion := d.signingRegion
+	if signingRegion == "" {
+		signingRegion = doc.Region
+	}
+	d.resolver.Store(endpointResolver(doc.Endpoint, d.forcePathStyle, signingRegion))
+}
+
+func (d *endpointDiscovery) ResolveEndpoint(
+	region string,
+	options s3.EndpointResolverOptions,
+) (aws.Endpoint, error) {
+	if resolver, ok := d.resolver.Load().(s3.EndpointResolver); ok {
+		return resolver.ResolveEndpoint(region, options)
+	}
+	return d.fallback.ResolveEndpoint(region, options)
+}
+
+// discoveryMiddleware refreshes the discovery document before the endpoint
+// of the operation is resolved.
+func discoveryMiddleware(d *endpointDiscovery) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc(
+			"EndpointDiscovery",
+			func(
+				ctx context.Context,
+				in middleware.InitializeInput,
+				next middleware.InitializeHandler,
+			) (middleware.InitializeOutput, middleware.Metadata, error) {
+				d.refresh(ctx)
+				return next.HandleInitialize(ctx, in)
+			}), middleware.Before)
+	}
+}
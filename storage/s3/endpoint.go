@@ -0,0 +1,119 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// errEndpointResolved stops the requests built by resolveEndpoint.
+var errEndpointResolved = errors.New("s3: endpoint resolved")
+
+// endpointResolver resolves the s3 API endpoint to the custom uri for the
+// client, presign and per-tenant settings alike.
+//
+// With hostnameImmutable (ForcePathStyle) the host of the uri is used as is
+// and the bucket is encoded in the path, which S3 compatible stores like GCS
+// and MinIO require; otherwise the bucket is prepended to the host. If
+// signingRegion is empty, requests are signed for the client region.
+//
+// NOTE: The resolution is kept in one place so that it can be switched to
+// BaseEndpoint and EndpointResolverV2 once the SDK is upgraded to a version
+// supporting them.
+func endpointResolver(
+	uri string,
+	hostnameImmutable bool,
+	signingRegion string,
+) s3.EndpointResolver {
+	return s3.EndpointResolverFromURL(uri, func(ep *aws.Endpoint) {
+		ep.HostnameImmutable = hostnameImmutable
+		if signingRegion != "" {
+			ep.SigningRegion = signingRegion
+		}
+	})
+}
+
+// resolveEndpoint returns the bucket URL of a request built by the presign
+// client with the client options. The request is stopped once built, so it
+// is neither signed nor sent and no credentials are needed.
+func resolveEndpoint(
+	ctx context.Context,
+	client *s3.PresignClient,
+	bucket string,
+	opts func(*s3.Options),
+) (endpoint string, err error) {
+	_, err = client.PresignHeadBucket(ctx,
+		&s3.HeadBucketInput{Bucket: aws.String(bucket)},
+		s3.WithPresignClientFromClientOptions(opts, func(o *s3.Options) {
+			o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+				return stack.Build.Add(middleware.BuildMiddlewareFunc(
+					"ResolveEndpoint", func(
+						ctx context.Context,
+						in middleware.BuildInput,
+						next middleware.BuildHandler,
+					) (middleware.BuildOutput, middleware.Metadata, error) {
+						if req, ok := in.Request.(*smithyhttp.Request); ok {
+							u := *req.URL
+							u.RawQuery = ""
+							u.Path = strings.TrimSuffix(u.Path, "/")
+							u.RawPath = strings.TrimSuffix(u.RawPath, "/")
+							endpoint = u.String()
+						}
+						return middleware.BuildOutput{}, middleware.Metadata{},
+							errEndpointResolved
+					}), middleware.After)
+			})
+		}),
+	)
+	if errors.Is(err, errEndpointResolved) {
+		return endpoint, nil
+	} else if err == nil {
+		err = errors.New("s3: endpoint not resolved")
+	}
+	return "", err
+}
+
+// ResolvedEndpoints returns the bucket URLs the storage sends its requests
+// to (client) and presigns the links for (presign), as resolved from the
+// URI, ExternalURI, Region, ForcePathStyle and UseAccelerate options or the
+// storage settings in the context. No request is sent.
+func (s *SimpleStorageService) ResolvedEndpoints(
+	ctx context.Context,
+) (client, presign string, err error) {
+	bucket, clientOpts, err := s.optionsFromContext(ctx, false)
+	if err != nil {
+		return "", "", err
+	}
+	_, presignOpts, err := s.optionsFromContext(ctx, true)
+	if err != nil {
+		return "", "", err
+	}
+	client, err = resolveEndpoint(ctx, s3.NewPresignClient(s.client), bucket, clientOpts)
+	if err != nil {
+		return "", "", err
+	}
+	presign, err = resolveEndpoint(ctx, s.presignClient, bucket, presignOpts)
+	if err != nil {
+		return "", "", err
+	}
+	return client, presign, nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"errors"
+	"net/http"
+
+	awsHttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+
+	"github.com/mendersoftware/deployments/storage"
+)
+
+// throttlingErrorCodes are the error codes S3 compatible services respond
+// with when requests are rate limited.
+var throttlingErrorCodes = map[string]struct{}{
+	"SlowDown":                  {},
+	"Throttling":                {},
+	"ThrottlingException":       {},
+	"RequestThrottled":          {},
+	"RequestLimitExceeded":      {},
+	"TooManyRequestsException":  {},
+	"RequestThrottledException": {},
+}
+
+// storageError is an S3 error classified as one of the typed storage
+// errors. errors.Is matches both the typed error and the S3 error, and
+// errors.As still yields the SDK error types.
+type storageError struct {
+	kind error
+	err  error
+}
+
+func (e *storageError) Error() string {
+	return e.kind.Error() + ": " + e.err.Error()
+}
+
+func (e *storageError) Unwrap() error {
+	return e.err
+}
+
+func (e *storageError) Is(target error) bool {
+	return target == e.kind
+}
+
+// mapError wraps errors returned by the S3 API in the matching typed
+// storage error; other errors are returned as is.
+func mapError(err error) error {
+	var sErr *storageError
+	if err == nil || errors.As(err, &sErr) {
+		return err
+	}
+	if kind := errorKind(err); kind != nil {
+		return &storageError{kind: kind, err: err}
+	}
+	return err
+}
+
+func errorKind(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.ErrorCode()
+		switch code {
+		case "NoSuchKey", "NotFound":
+			return storage.ErrObjectNotFound
+		case "NoSuchBucket":
+			return storage.ErrBucketNotFound
+		case "AccessDenied", "AllAccessDisabled":
+			return storage.ErrAccessDenied
+		case "BadDigest":
+			return ErrIntegrityMismatch
+		case "AccessControlListNotSupported":
+			return ErrACLNotSupported
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			// A conflict is a concurrent conditional upload to the key.
+			return storage.ErrPreconditionFailed
+		}
+		if _, ok := throttlingErrorCodes[code]; ok {
+			return storage.ErrThrottled
+		}
+	}
+	// HEAD requests and some S3 compatible services respond without an
+	// error code; fall back to the status code.
+	var rspErr *awsHttp.ResponseError
+	if errors.As(err, &rspErr) {
+		switch rspErr.HTTPStatusCode() {
+		case http.StatusNotFound:
+			return storage.ErrObjectNotFound
+		case http.StatusNotModified:
+			return storage.ErrNotModified
+		case http.StatusPreconditionFailed:
+			return storage.ErrPreconditionFailed
+		case http.StatusRequestedRangeNotSatisfiable:
+			return storage.ErrInvalidRange
+		case http.StatusForbidden:
+			return storage.ErrAccessDenied
+		case http.StatusTooManyRequests:
+			return storage.ErrThrottled
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+const (
+	headerExpect        = "Expect"
+	expectContinue      = "100-continue"
+	expectContinueBytes = 2 * mib
+)
+
+// expectContinueMiddleware sends "Expect: 100-continue" with uploads of at
+// least expectContinueBytes or of unknown length, so that the transport
+// holds back the body until the server accepted the request headers.
+func expectContinueMiddleware(stack *middleware.Stack) error {
+	if _, presign := stack.Finalize.Get(presignMiddlewareID); presign {
+		return nil
+	}
+	return stack.Build.Add(middleware.BuildMiddlewareFunc(
+		"ExpectContinue", func(
+			ctx context.Context,
+			in middleware.BuildInput,
+			next middleware.BuildHandler,
+		) (middleware.BuildOutput, middleware.Metadata, error) {
+			switch awsmiddleware.GetOperationName(ctx) {
+			case "PutObject", "UploadPart":
+				req, ok := in.Request.(*smithyhttp.Request)
+				if ok && (req.ContentLength < 0 || req.ContentLength >= expectContinueBytes) {
+					req.Header.Set(headerExpect, expectContinue)
+				}
+			}
+			return next.HandleBuild(ctx, in)
+		}), middleware.After)
+}
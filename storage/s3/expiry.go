@@ -0,0 +1,53 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	// ExpiryTag is the tag key of objects uploaded with the ExpiresAfter
+	// option; the value is the number of days after which the object
+	// expires. A bucket lifecycle rule filtering on the tag, e.g.
+	// expires-after-days=7 with an expiration of 7 days, deletes the
+	// objects.
+	ExpiryTag = "expires-after-days"
+	// metaExpiresAt holds the intended deletion time (RFC 3339) of objects
+	// uploaded with the ExpiresAfter option.
+	metaExpiresAt = "expires-at"
+)
+
+// expiryDays returns the lifecycle expiration in days for the duration;
+// lifecycle rules count whole days, so the duration is rounded up.
+func expiryDays(d time.Duration) int64 {
+	const day = 24 * time.Hour
+	return int64((d + day - 1) / day)
+}
+
+// expiryTag returns the value of the ExpiryTag for uploaded objects, or an
+// empty string if the ExpiresAfter option is not set.
+func (s *SimpleStorageService) expiryTag() string {
+	if s.expiresAfter <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(expiryDays(s.expiresAfter), 10)
+}
+
+// expiresAt returns the intended deletion time of an object uploaded now.
+func (s *SimpleStorageService) expiresAt() string {
+	return time.Now().Add(s.expiresAfter).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,146 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	awsHttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/deployments/storage"
+)
+
+var (
+	ErrUnknownRegion = errors.New("s3: region is neither the primary nor a fallback region")
+
+	errFallbackRegion = errors.New(`must be "region" or "region:bucket"`)
+)
+
+// replica is a copy of the bucket in a fallback region.
+type replica struct {
+	region string
+	bucket string
+}
+
+// parseReplica parses a FallbackRegions entry; the bucket is empty if the
+// replica has the same name as the primary bucket.
+func parseReplica(entry string) (replica, error) {
+	region, bucket, _ := strings.Cut(entry, ":")
+	if region == "" || (bucket == "" && strings.Contains(entry, ":")) {
+		return replica{}, errFallbackRegion
+	}
+	return replica{region: region, bucket: bucket}, nil
+}
+
+func validateFallbackRegions(value interface{}) error {
+	entries, _ := value.([]string)
+	for _, entry := range entries {
+		if _, err := parseReplica(entry); err != nil {
+			return fmt.Errorf("%q %w", entry, err)
+		}
+	}
+	return nil
+}
+
+type regionKey struct{}
+
+// RegionWithContext returns a context directing the operations of the
+// storage to the bucket in region: the primary Region or one of the
+// FallbackRegions. Presigned requests generated with the context send the
+// devices to the replica in the region, e.g. the one nearest to them.
+// Operations fail with ErrUnknownRegion for other regions. Storage
+// settings from the context take precedence.
+func RegionWithContext(ctx context.Context, region string) context.Context {
+	return context.WithValue(ctx, regionKey{}, region)
+}
+
+func regionFromContext(ctx context.Context) (string, bool) {
+	region, ok := ctx.Value(regionKey{}).(string)
+	return region, ok
+}
+
+// regionOptions returns the bucket in region and the client options
+// directing requests to the region.
+func (s *SimpleStorageService) regionOptions(region string) (string, func(*s3.Options), error) {
+	if region == s.region {
+		return s.bucket, noOpts, nil
+	}
+	for _, r := range s.replicas {
+		if r.region != region {
+			continue
+		}
+		bucket := r.bucket
+		if bucket == "" {
+			bucket = s.bucket
+		}
+		return bucket, func(opts *s3.Options) {
+			opts.Region = region
+		}, nil
+	}
+	return "", nil, fmt.Errorf("%w: %s", ErrUnknownRegion, region)
+}
+
+// isFailoverError returns true if a read from the primary region failed
+// because the endpoint is unreachable, the service is unavailable or the
+// object does not exist (yet) in the bucket.
+func isFailoverError(err error) bool {
+	var (
+		netErr net.Error
+		rspErr *awsHttp.ResponseError
+	)
+	switch {
+	case errors.Is(err, storage.ErrObjectNotFound):
+		return true
+	case errors.As(err, &netErr):
+		// Connection errors are wrapped in a ResponseError without status.
+		return true
+	case errors.As(err, &rspErr):
+		return rspErr.HTTPStatusCode() >= 500
+	}
+	return false
+}
+
+// readWithFailover runs read against the primary bucket, and against the
+// replicas in the FallbackRegions in order while the read fails with a
+// failover error. Reads directed to a region by the context, or to other
+// storage settings, do not fail over.
+func (s *SimpleStorageService) readWithFailover(
+	ctx context.Context,
+	read func(ctx context.Context) error,
+) error {
+	err := read(ctx)
+	if len(s.replicas) == 0 || settingsFromContext(ctx) != nil {
+		return err
+	} else if _, ok := regionFromContext(ctx); ok {
+		return err
+	}
+	for _, r := range s.replicas {
+		if err == nil || ctx.Err() != nil || !isFailoverError(err) {
+			break
+		}
+		log.FromContext(ctx).Warnf(
+			"s3: read failed, falling back to region %s: %s",
+			r.region, err.Error(),
+		)
+		err = read(RegionWithContext(ctx, r.region))
+	}
+	return err
+}
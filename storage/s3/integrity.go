@@ -0,0 +1,110 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+// ErrIntegrityMismatch is returned by PutObject with the VerifyIntegrity
+// option if the uploaded object does not match the data read from the
+// source, and by GetObjectVerified if the downloaded data does not match
+// the expected sum.
+var ErrIntegrityMismatch = errors.New("s3: uploaded object failed integrity verification")
+
+// contentMD5 returns the Content-MD5 header value and the MD5 sum of b.
+func contentMD5(b []byte) (header *string, sum []byte) {
+	digest := md5.Sum(b) //nolint:gosec
+	return aws.String(base64.StdEncoding.EncodeToString(digest[:])), digest[:]
+}
+
+// contentMD5Seeker returns the Content-MD5 header value and the MD5 sum of
+// the remaining bytes of rs; rs is rewound to its position.
+func contentMD5Seeker(rs io.ReadSeeker) (header *string, sum []byte, err error) {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, nil, err
+	}
+	digest := md5.New() //nolint:gosec
+	if _, err = io.Copy(digest, rs); err != nil {
+		return nil, nil, err
+	}
+	if _, err = rs.Seek(start, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	sum = digest.Sum(nil)
+	return aws.String(base64.StdEncoding.EncodeToString(sum)), sum, nil
+}
+
+// etagIsMD5 returns true if the ETag of uploaded objects is derived from
+// the MD5 sum of the data, which is not the case for objects encrypted
+// with SSE-KMS or SSE-C.
+func (s *SimpleStorageService) etagIsMD5() bool {
+	return s.sseAlgorithm != types.ServerSideEncryptionAwsKms &&
+		s.sseCustomerKey == nil
+}
+
+// multipartETag returns the ETag S3 computes for a multipart upload: the
+// MD5 sum of the concatenated part sums followed by the number of parts.
+func multipartETag(partSums []byte, parts int) string {
+	digest := md5.Sum(partSums) //nolint:gosec
+	return hex.EncodeToString(digest[:]) + "-" + strconv.Itoa(parts)
+}
+
+func verifyETag(etag *string, expected string) error {
+	actual := strings.Trim(aws.ToString(etag), `"`)
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("%w: expected ETag %q, got %q",
+			ErrIntegrityMismatch, expected, actual)
+	}
+	return nil
+}
+
+// removeCorrupted deletes an object that failed integrity verification
+// after the upload completed. Like aborting multipart uploads, the request
+// is detached from the context of the upload.
+func (s *SimpleStorageService) removeCorrupted(
+	ctx context.Context,
+	bucket, objectPath string,
+	opts func(*s3.Options),
+) {
+	l := log.FromContext(ctx)
+	ctx, cancel := context.WithTimeout(
+		log.WithContext(context.Background(), l),
+		abortMultipartTimeout,
+	)
+	defer cancel()
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &bucket,
+		Key:    &objectPath,
+	}, opts)
+	if err != nil {
+		l.Warnf("s3: failed to remove corrupted object %q: %s",
+			objectPath, err.Error())
+	}
+}
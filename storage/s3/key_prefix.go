@@ -0,0 +1,73 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	errKeyPrefixLeadingSlash = errors.New("must not start with '/'")
+	errKeyPrefixDotDot       = errors.New("must not contain '..'")
+)
+
+func validateKeyPrefix(value interface{}) error {
+	prefix, _ := value.(*string)
+	if prefix == nil {
+		return nil
+	}
+	if strings.HasPrefix(*prefix, "/") {
+		return errKeyPrefixLeadingSlash
+	}
+	if strings.Contains(*prefix, "..") {
+		return errKeyPrefixDotDot
+	}
+	return nil
+}
+
+// normalizeKeyPrefix collapses repeated slashes in the prefix and makes sure
+// a non-empty prefix ends with a single slash, such that "artifacts" and
+// "artifacts/" both yield the key "artifacts/abc" for the path "abc".
+func normalizeKeyPrefix(prefix string) string {
+	segments := strings.FieldsFunc(prefix, func(r rune) bool {
+		return r == '/'
+	})
+	if len(segments) == 0 {
+		return ""
+	}
+	return strings.Join(segments, "/") + "/"
+}
+
+// objectKey returns the object key for the storage path.
+func (s *SimpleStorageService) objectKey(path string) string {
+	if s.keyPrefix != "" {
+		path = strings.TrimLeft(path, "/")
+	}
+	if s.keyStrategy != nil {
+		path = s.keyStrategy.Key(path)
+	}
+	return s.keyPrefix + path
+}
+
+// objectPath returns the storage path for the object key; it is the inverse
+// of objectKey.
+func (s *SimpleStorageService) objectPath(key string) string {
+	path := strings.TrimPrefix(key, s.keyPrefix)
+	if s.keyStrategy != nil {
+		path = s.keyStrategy.Path(path)
+	}
+	return path
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	KeyStrategyFlat = "flat"
+	KeyStrategyDate = "date"
+)
+
+// KeyStrategy maps the storage paths to the object keys in the bucket, for
+// example to shape the bucket layout for lifecycle rules. Both mappings must
+// be deterministic: reads, deletes, presigned requests and listings all go
+// through the same strategy.
+type KeyStrategy interface {
+	// Key returns the object key for the storage path.
+	Key(path string) string
+	// Path returns the storage path for the object key; it is the inverse
+	// of Key.
+	Path(key string) string
+}
+
+// FlatKeys is the default KeyStrategy using the storage path as key.
+type FlatKeys struct{}
+
+func (FlatKeys) Key(path string) string {
+	return path
+}
+
+func (FlatKeys) Path(key string) string {
+	return key
+}
+
+// DateKeys partitions the objects named by a time-based (version 1 or 7)
+// UUID by the date of the UUID, such that the path "a/<id>" maps to the key
+// "a/yyyy/mm/dd/<id>" (UTC). The date is derived from the ID itself, so the
+// key of an object never depends on when it is accessed. The service names
+// new artifacts with version 7 UUIDs if the date strategy is configured.
+// Other paths, including random (version 4) UUIDs, are used as is.
+type DateKeys struct{}
+
+// idDate returns the date partition for the object name.
+func idDate(name string) (string, bool) {
+	id, err := uuid.Parse(name)
+	if err != nil || id.Variant() != uuid.RFC4122 {
+		return "", false
+	}
+	var t time.Time
+	switch id.Version() {
+	case 1:
+		t = time.Unix(id.Time().UnixTime())
+	case 7:
+		var ts [8]byte
+		copy(ts[2:], id[:6])
+		t = time.UnixMilli(int64(binary.BigEndian.Uint64(ts[:])))
+	default:
+		return "", false
+	}
+	return t.UTC().Format("2006/01/02"), true
+}
+
+func (DateKeys) Key(objectPath string) string {
+	dir, name := path.Split(objectPath)
+	date, ok := idDate(name)
+	if !ok {
+		return objectPath
+	}
+	return dir + date + "/" + name
+}
+
+func (DateKeys) Path(key string) string {
+	dir, name := path.Split(key)
+	date, ok := idDate(name)
+	if !ok {
+		return key
+	}
+	if prefix := strings.TrimSuffix(dir, date+"/"); prefix != dir &&
+		(prefix == "" || strings.HasSuffix(prefix, "/")) {
+		return prefix + name
+	}
+	return key
+}
+
+// ParseKeyStrategy returns the KeyStrategy by name; the names are
+// KeyStrategyFlat and KeyStrategyDate.
+func ParseKeyStrategy(name string) (KeyStrategy, error) {
+	switch strings.ToLower(name) {
+	case KeyStrategyFlat, "":
+		return FlatKeys{}, nil
+	case KeyStrategyDate:
+		return DateKeys{}, nil
+	}
+	return nil, fmt.Errorf("unknown key strategy %q: must be one of %s or %s",
+		name, KeyStrategyFlat, KeyStrategyDate)
+}
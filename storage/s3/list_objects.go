@@ -0,0 +1,98 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deployments/storage"
+)
+
+var _ storage.ObjectWalker = &SimpleStorageService{}
+
+// listObjectsPageSize is the maximum number of keys returned by a single
+// ListObjectsV2 request.
+const listObjectsPageSize = 1000
+
+// WalkObjects calls fn for each object with a key starting with prefix, in
+// lexicographical order, fetching the objects a page at a time. At most
+// maxKeys objects are visited; maxKeys <= 0 visits all objects. If fn
+// returns an error, the walk stops and the error is returned.
+func (s *SimpleStorageService) WalkObjects(
+	ctx context.Context,
+	prefix string,
+	maxKeys int,
+	fn func(*storage.ObjectInfo) error,
+) error {
+	bucket, opts, err := s.optionsFromContext(ctx, false)
+	if err != nil {
+		return err
+	}
+	params := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(s.objectKey(prefix)),
+	}
+	var visited int
+	for {
+		params.MaxKeys = listObjectsPageSize
+		if remaining := maxKeys - visited; maxKeys > 0 &&
+			remaining < listObjectsPageSize {
+			params.MaxKeys = int32(remaining)
+		}
+		rsp, err := s.client.ListObjectsV2(ctx, params, opts)
+		if err != nil {
+			return errors.WithMessage(mapError(err), "s3: error listing objects")
+		}
+		for i := range rsp.Contents {
+			obj := &rsp.Contents[i]
+			err = fn(&storage.ObjectInfo{
+				Path:         s.objectPath(aws.ToString(obj.Key)),
+				Size:         &obj.Size,
+				LastModified: obj.LastModified,
+			})
+			if err != nil {
+				return err
+			}
+			visited++
+			if maxKeys > 0 && visited >= maxKeys {
+				return nil
+			}
+		}
+		if !rsp.IsTruncated || rsp.NextContinuationToken == nil {
+			return nil
+		}
+		params.ContinuationToken = rsp.NextContinuationToken
+	}
+}
+
+// ListObjects returns the objects with a key starting with prefix. At most
+// maxKeys objects are returned; maxKeys <= 0 returns all objects. Use
+// WalkObjects for listing large numbers of objects.
+func (s *SimpleStorageService) ListObjects(
+	ctx context.Context,
+	prefix string,
+	maxKeys int,
+) ([]storage.ObjectInfo, error) {
+	var objects []storage.ObjectInfo
+	err := s.WalkObjects(ctx, prefix, maxKeys, func(obj *storage.ObjectInfo) error {
+		objects = append(objects, *obj)
+		return nil
+	})
+	return objects, err
+}
@@ -0,0 +1,151 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// LoadOptions reads Options from a YAML (or JSON) document. Field names
+// match the Options fields case-insensitively, the static credentials are
+// configured under "auth" with "key", "secret" and "token". Durations are
+// given as strings (e.g. "15m"), byte fields (SSECustomerKey, CABundle) as
+// plain strings. "${NAME}" in string values is replaced with the value of
+// the environment variable; the variable must be set. Middleware,
+// Transport and Metrics cannot be configured from a document.
+// The returned Options are merged with the defaults and validated.
+func LoadOptions(r io.Reader) (*Options, error) {
+	var doc interface{}
+	err := yaml.NewDecoder(r).Decode(&doc)
+	if err != nil && err != io.EOF {
+		return nil, errors.WithMessage(err, "s3: failed to parse options")
+	}
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+	fields, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("s3: failed to parse options: expected a mapping")
+	}
+	if err = expandEnvValues(fields); err != nil {
+		return nil, err
+	}
+	if err = normalizeOptionFields(fields); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, errors.WithMessage(err, "s3: failed to parse options")
+	}
+	var opts Options
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&opts); err != nil {
+		return nil, errors.WithMessage(err, "s3: failed to parse options")
+	}
+	ret := NewOptions(&opts)
+	if err = ret.Validate(); err != nil {
+		return nil, errors.WithMessage(err, "s3: invalid configuration")
+	}
+	return ret, nil
+}
+
+// expandEnvValues replaces "${NAME}" in the string values of the document
+// with the environment variables. The values are replaced after parsing,
+// so the values of the variables are never interpreted as YAML.
+func expandEnvValues(value interface{}) error {
+	var undefined []string
+	var expand func(interface{}) interface{}
+	expand = func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case string:
+			return envVarPattern.ReplaceAllStringFunc(v, func(match string) string {
+				name := envVarPattern.FindStringSubmatch(match)[1]
+				env, ok := os.LookupEnv(name)
+				if !ok {
+					undefined = append(undefined, name)
+				}
+				return env
+			})
+		case map[string]interface{}:
+			for key, elem := range v {
+				v[key] = expand(elem)
+			}
+		case []interface{}:
+			for i, elem := range v {
+				v[i] = expand(elem)
+			}
+		}
+		return value
+	}
+	expand(value)
+	if len(undefined) > 0 {
+		return errors.Errorf("s3: undefined environment variables: %s",
+			strings.Join(undefined, ", "))
+	}
+	return nil
+}
+
+var (
+	typeDuration = reflect.TypeOf(time.Duration(0))
+	typeBytes    = reflect.TypeOf([]byte(nil))
+)
+
+// normalizeOptionFields converts the values of the Options fields that
+// are not represented as strings in JSON: durations are parsed and byte
+// fields are base64 encoded.
+func normalizeOptionFields(fields map[string]interface{}) error {
+	optionsType := reflect.TypeOf(Options{})
+	for key, value := range fields {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		field, ok := optionsType.FieldByNameFunc(func(name string) bool {
+			return strings.EqualFold(name, key)
+		})
+		if !ok {
+			continue
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		switch fieldType {
+		case typeDuration:
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return errors.WithMessagef(err, "s3: invalid option %q", key)
+			}
+			fields[key] = int64(d)
+		case typeBytes:
+			fields[key] = base64.StdEncoding.EncodeToString([]byte(s))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+const redacted = "REDACTED"
+
+var (
+	redactedHeaders = map[string]struct{}{
+		"Authorization":        {},
+		"X-Amz-Security-Token": {},
+		headerSSECustomerKey:   {},
+	}
+	redactedQueryParams = map[string]struct{}{
+		"X-Amz-Credential":     {},
+		"X-Amz-Security-Token": {},
+		"X-Amz-Signature":      {},
+	}
+)
+
+func redactHeaders(hdr http.Header) map[string]string {
+	ret := make(map[string]string, len(hdr))
+	for key, values := range hdr {
+		key = textproto.CanonicalMIMEHeaderKey(key)
+		if _, ok := redactedHeaders[key]; ok {
+			ret[key] = redacted
+		} else {
+			ret[key] = strings.Join(values, ", ")
+		}
+	}
+	return ret
+}
+
+func redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	q := u.Query()
+	for key := range q {
+		if _, ok := redactedQueryParams[key]; ok {
+			q.Set(key, redacted)
+		}
+	}
+	ret := *u
+	ret.User = nil
+	ret.RawQuery = q.Encode()
+	return ret.String()
+}
+
+// requestLoggingMiddleware logs every request sent to the s3 API and the
+// corresponding response using the logger from the operation context.
+// Credentials and signatures are redacted from the logged request.
+func requestLoggingMiddleware(stack *middleware.Stack) error {
+	return stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc(
+		"RequestLogging", func(
+			ctx context.Context,
+			in middleware.DeserializeInput,
+			next middleware.DeserializeHandler,
+		) (middleware.DeserializeOutput, middleware.Metadata, error) {
+			req, ok := in.Request.(*smithyhttp.Request)
+			if !ok {
+				return next.HandleDeserialize(ctx, in)
+			}
+			l := log.FromContext(ctx).F(log.Ctx{
+				"s3_operation": awsmiddleware.GetOperationName(ctx),
+				"method":       req.Method,
+				"url":          redactURL(req.URL),
+				"headers":      redactHeaders(req.Header),
+			})
+			start := time.Now()
+			out, md, err := next.HandleDeserialize(ctx, in)
+			l = l.F(log.Ctx{"latency": time.Since(start).String()})
+			if rsp, ok := out.RawResponse.(*smithyhttp.Response); ok {
+				l = l.F(log.Ctx{"status": rsp.StatusCode})
+			}
+			if err != nil {
+				l.Errorf("s3: request failed: %s", err.Error())
+			} else {
+				l.Info("s3: request completed")
+			}
+			return out, md, err
+		}), middleware.Before)
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// metadataMaxSize is the maximum size of user-defined metadata (sum of the
+// keys and values in bytes) accepted by S3.
+const metadataMaxSize = 2 * kib
+
+var errMetadataEmptyKey = errors.New("metadata keys cannot be empty")
+
+func validateMetadata(value interface{}) error {
+	metadata, _ := value.(map[string]string)
+	var size int
+	for key, value := range metadata {
+		if key == "" {
+			return errMetadataEmptyKey
+		}
+		size += len(key) + len(value)
+	}
+	if size > metadataMaxSize {
+		return fmt.Errorf(
+			"total size of metadata (%d bytes) exceeds the limit of %d bytes",
+			size, metadataMaxSize,
+		)
+	}
+	return nil
+}
+
+// normalizeMetadata returns a copy of metadata with lower case keys as
+// stored by S3 (x-amz-meta-<key>).
+func normalizeMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	ret := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		ret[strings.ToLower(key)] = value
+	}
+	return ret
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+const (
+	// StatusClassError is the status class of operations that failed
+	// without a response from the s3 API.
+	StatusClassError = "error"
+	// StatusClassPresign is the status class of presign operations, which
+	// do not send any request.
+	StatusClassPresign = "presign"
+
+	presignMiddlewareID = "PresignHTTPRequest"
+)
+
+// MetricsRecorder records the duration and outcome of s3 operations, e.g.
+// as histograms and error counters labeled by operation and status class
+// (see PrometheusRecorder).
+type MetricsRecorder interface {
+	// ObserveOperation is called when an operation completes, including
+	// retries. The status class is the HTTP status class of the response
+	// ("2xx", "4xx", "5xx"), StatusClassError if no response was received,
+	// or StatusClassPresign for presign operations.
+	ObserveOperation(operation, statusClass string, duration time.Duration)
+}
+
+func statusClass(err error) string {
+	if err == nil {
+		return "2xx"
+	}
+	var rspErr *smithyhttp.ResponseError
+	if errors.As(err, &rspErr) && rspErr.HTTPStatusCode() > 0 {
+		return strconv.Itoa(rspErr.HTTPStatusCode()/100) + "xx"
+	}
+	return StatusClassError
+}
+
+// metricsMiddleware measures the duration of every operation and reports it
+// to the recorder. Presign operations are reported with the
+// StatusClassPresign status class and the "Presign" operation prefix.
+func metricsMiddleware(recorder MetricsRecorder) apiOptions {
+	return func(stack *middleware.Stack) error {
+		_, presign := stack.Finalize.Get(presignMiddlewareID)
+		mw := middleware.InitializeMiddlewareFunc(
+			"Metrics", func(
+				ctx context.Context,
+				in middleware.InitializeInput,
+				next middleware.InitializeHandler,
+			) (middleware.InitializeOutput, middleware.Metadata, error) {
+				start := time.Now()
+				out, md, err := next.HandleInitialize(ctx, in)
+				operation := awsmiddleware.GetOperationName(ctx)
+				class := statusClass(err)
+				if presign {
+					operation = "Presign" + operation
+					class = StatusClassPresign
+				}
+				recorder.ObserveOperation(operation, class, time.Since(start))
+				return out, md, err
+			})
+		// The operation name is available after the service metadata
+		// is registered.
+		metadataID := (&awsmiddleware.RegisterServiceMetadata{}).ID()
+		if _, ok := stack.Initialize.Get(metadataID); ok {
+			return stack.Initialize.Insert(mw, metadataID, middleware.After)
+		}
+		return stack.Initialize.Add(mw, middleware.Before)
+	}
+}
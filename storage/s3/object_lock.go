@@ -0,0 +1,61 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+var ErrObjectLockNotEnabled = errors.New(
+	"s3: object lock retention is configured, but the bucket does not " +
+		"have object lock enabled",
+)
+
+func objectLockModes() []interface{} {
+	values := types.ObjectLockMode("").Values()
+	ret := make([]interface{}, len(values))
+	for i, value := range values {
+		ret[i] = string(value)
+	}
+	return ret
+}
+
+// objectLockRetainUntil returns the retain until date for an object
+// uploaded now, or nil if object lock is not configured.
+func (s *SimpleStorageService) objectLockRetainUntil() *time.Time {
+	if s.objectLockMode == "" {
+		return nil
+	}
+	retainUntil := time.Now().Add(s.objectLockRetention).UTC()
+	return &retainUntil
+}
+
+// objectLockError replaces the error S3 returns when uploading an object
+// with retention settings to a bucket without object lock enabled.
+func (s *SimpleStorageService) objectLockError(err error) error {
+	var apiErr smithy.APIError
+	if s.objectLockMode != "" && errors.As(err, &apiErr) &&
+		apiErr.ErrorCode() == "InvalidRequest" &&
+		strings.Contains(apiErr.ErrorMessage(), "Object Lock") {
+		return fmt.Errorf("%w: %s", ErrObjectLockNotEnabled, apiErr.ErrorMessage())
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import "time"
+
+// Option is a functional option for NewOptionsFunc.
+type Option func(*Options)
+
+// NewOptionsFunc returns the options with the defaults of NewOptions and
+// the functional options applied in order. The result is the same as
+// merging Options configured with the corresponding setters, so both
+// construction styles can be mixed with WithOptions; the options are
+// validated by New.
+func NewOptionsFunc(opts ...Option) *Options {
+	ret := NewOptions()
+	for _, opt := range opts {
+		opt(ret)
+	}
+	return ret
+}
+
+// WithOptions merges the options like NewOptions.
+func WithOptions(options ...*Options) Option {
+	return func(opts *Options) {
+		*opts = *NewOptions(append([]*Options{opts}, options...)...)
+	}
+}
+
+func WithRegion(region string) Option {
+	return func(opts *Options) { opts.SetRegion(region) }
+}
+
+func WithStaticCredentials(key, secret, sessionToken string) Option {
+	return func(opts *Options) { opts.SetStaticCredentials(key, secret, sessionToken) }
+}
+
+func WithURI(uri string) Option {
+	return func(opts *Options) { opts.SetURI(uri) }
+}
+
+func WithExternalURI(externalURI string) Option {
+	return func(opts *Options) { opts.SetExternalURI(externalURI) }
+}
+
+func WithForcePathStyle(forcePathStyle bool) Option {
+	return func(opts *Options) { opts.SetForcePathStyle(forcePathStyle) }
+}
+
+func WithKeyPrefix(prefix string) Option {
+	return func(opts *Options) { opts.SetKeyPrefix(prefix) }
+}
+
+func WithContentType(contentType string) Option {
+	return func(opts *Options) { opts.SetContentType(contentType) }
+}
+
+func WithDefaultExpire(defaultExpire time.Duration) Option {
+	return func(opts *Options) { opts.SetDefaultExpire(defaultExpire) }
+}
+
+func WithBufferSize(bufferSize int) Option {
+	return func(opts *Options) { opts.SetBufferSize(bufferSize) }
+}
+
+func WithPartSize(partSize int) Option {
+	return func(opts *Options) { opts.SetPartSize(partSize) }
+}
+
+func WithMaxRetries(maxRetries int) Option {
+	return func(opts *Options) { opts.SetMaxRetries(maxRetries) }
+}
@@ -17,13 +17,22 @@ package s3
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/smithy-go/middleware"
 	smithyhttp "github.com/aws/smithy-go/transport/http"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
@@ -34,51 +43,517 @@ import (
 const (
 	kib = 1024
 	mib = kib * 1024
+	gib = mib * 1024
 
 	DefaultBufferSize = 10 * mib
 	DefaultExpire     = 15 * time.Minute
+
+	// Connection pooling of the default transport; all requests go to
+	// the same few hosts, so most idle connections are kept per host.
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 100
+	DefaultIdleConnTimeout     = 90 * time.Second
 )
 
 var (
 	validAtLeast5MiB = validation.Min(MultipartMinSize).
-		Error("must be at least 5MiB")
+				Error("must be at least 5MiB")
+	validAtMost5GiB = validation.Max(MultipartMaxSize).
+			Error("must be at most 5GiB")
+	validSSEAlgorithm = validation.In(
+		string(types.ServerSideEncryptionAes256),
+		string(types.ServerSideEncryptionAwsKms),
+	)
+	validSSECustomerKeyLength = validation.Length(32, 32).
+					Error("must be exactly 32 bytes")
+	validStorageClass = validation.In(storageClasses()...).
+				Error("must be a valid S3 storage class")
+	validChecksumAlgorithm = validation.In(checksumAlgorithms()...).
+				Error("must be one of CRC32, CRC32C, SHA1 or SHA256")
+	validObjectLockMode = validation.In(objectLockModes()...).
+				Error("must be one of GOVERNANCE or COMPLIANCE")
+	validACL = validation.In(cannedACLs()...).
+			Error("must be a canned S3 ACL")
+	validPositiveDuration = validation.Min(time.Duration(0)).Exclusive().
+				Error("must be a positive duration")
 )
 
+func storageClasses() []interface{} {
+	values := types.StorageClass("").Values()
+	ret := make([]interface{}, len(values))
+	for i, value := range values {
+		ret[i] = string(value)
+	}
+	return ret
+}
+
+func checksumAlgorithms() []interface{} {
+	values := types.ChecksumAlgorithm("").Values()
+	ret := make([]interface{}, len(values))
+	for i, value := range values {
+		ret[i] = string(value)
+	}
+	return ret
+}
+
 type Options struct {
 	// StaticCredentials that overrides AWS config.
 	StaticCredentials *StaticCredentials `json:"auth"`
 
+	// AssumeRoleARN sets the IAM role assumed using STS for accessing the
+	// bucket. The client credentials (static or from the AWS config) are
+	// used as source credentials for assuming the role.
+	AssumeRoleARN *string
+	// ExternalID is the (optional) external ID used when assuming the role.
+	ExternalID *string
+	// RoleSessionName is the (optional) session name used when assuming
+	// a role.
+	RoleSessionName *string
+
+	// WebIdentityTokenFile is the path to the web identity token (e.g. a
+	// projected Kubernetes service account token) exchanged for
+	// WebIdentityRoleARN credentials. If AssumeRoleARN is also set, the web
+	// identity credentials are used as source credentials.
+	WebIdentityTokenFile *string
+	// WebIdentityRoleARN is the role assumed using the web identity token.
+	WebIdentityRoleARN *string
+	// MinPresignCredTTL is the minimum remaining validity of temporary
+	// credentials (e.g. from AssumeRoleARN) used for presigning requests;
+	// credentials expiring sooner are refreshed before signing. If the
+	// refreshed credentials still expire too soon, presigning fails with
+	// ErrPresignCredentialsExpiring instead of returning a link that
+	// stops working shortly. Defaults to: no minimum.
+	MinPresignCredTTL *time.Duration
+	// CredentialSource forces the source of the credentials, one of the
+	// CredentialSource* constants, e.g. for testing. If not set, the
+	// credentials are resolved in the order documented with the
+	// constants: static, web identity, environment, shared config and
+	// container or instance profile.
+	CredentialSource *string
+	// Profile selects the profile of the shared config and credentials
+	// files (~/.aws/config and ~/.aws/credentials) the credentials and
+	// region are loaded from, taking precedence over the AWS_PROFILE
+	// environment variable and credentials in the environment. Region
+	// overrides the region of the profile. Creating the storage fails with
+	// ErrProfileNotFound if the profile does not exist.
+	Profile *string
+	// CredentialsResolver resolves the credentials for the tenant in the
+	// identity of the operation context, e.g. for tenants with their own
+	// bucket and credentials. The credentials are cached per tenant for
+	// CredentialsCacheTTL, or until shortly before they expire. Operations
+	// without a tenant, or for tenants the resolver returns
+	// ErrNoTenantCredentials for, use the credentials resolved from the
+	// other options (e.g. StaticCredentials).
+	CredentialsResolver CredentialsResolver `json:"-"`
+	// CredentialsCacheTTL is the duration the credentials returned by the
+	// CredentialsResolver are cached for (defaults to: 5m).
+	CredentialsCacheTTL *time.Duration
+
 	// Region where the bucket lives
 	Region *string
+	// FallbackRegions are the regions of replicas of the bucket, e.g. by
+	// S3 replication, in order of preference. Reads (GetObject,
+	// GetObjectRange and StatObject) failing in the primary region because
+	// the endpoint is unreachable, the service is unavailable or the object
+	// does not exist are retried against the replicas; writes only go to
+	// the primary bucket. An entry is the region if the replica has the
+	// same bucket name, or "region:bucket". RegionWithContext directs
+	// operations, like presigned requests, to a region.
+	FallbackRegions []string
+	// SigningRegion overrides the region used for signing requests to a
+	// custom URI, e.g. for regional gateways or proxies. Requires URI.
+	SigningRegion *string
+	// SignatureVersion is the version of the request signatures, v4 or
+	// the legacy v2 for S3 compatible stores that only support it
+	// (e.g. old Ceph RGW deployments). Version 2 does not support
+	// ChecksumAlgorithm and ObjectLockMode.
+	// Defaults to: v4
+	SignatureVersion *string
+	// KeyPrefix is prepended to the path of every object in the bucket,
+	// separated by a slash, for example "tenant-a/" or "artifacts".
+	// The prefix must not start with a slash or contain "..".
+	KeyPrefix *string
+	// KeyStrategy maps the storage paths to the object keys below the
+	// KeyPrefix; defaults to FlatKeys.
+	KeyStrategy KeyStrategy `json:"-"`
 	// ContentType of the uploaded objects
 	ContentType *string
-	// FilenameSuffix adds the suffix to the content-disposition for object downloads>
+	// FilenameSuffix adds the suffix to the content-disposition for object downloads.
+	//
+	// Deprecated: downloads are named by the filename passed to GetRequest,
+	// e.g. the artifact name; FilenameSuffix is ignored.
 	FilenameSuffix *string
+	// ContentDisposition sets the content-disposition for object downloads.
+	// The placeholder {name} is replaced with the RFC 6266 encoded filename
+	// parameters, for example "attachment; {name}". Without the
+	// placeholder, the value is used as is, for example "inline".
+	ContentDisposition *string
+	// CacheControl sets the cache-control of uploaded objects and
+	// presigned object downloads.
+	CacheControl *string
+	// ContentEncoding sets the content-encoding of uploaded objects, for
+	// example "gzip" for artifacts compressed before upload.
+	ContentEncoding *string
+	// CompressOnUpload compresses uploads with gzip while they are
+	// uploaded and sets their content-encoding to "gzip"; clients of
+	// presigned downloads decode the objects, GetObject returns the
+	// compressed data and StatObject reports the ContentEncoding, which
+	// storage.ServeObject forwards. Uploads are not compressed if the
+	// ContentType is the type of compressed data (e.g. application/gzip or
+	// image/png). Cannot be combined with ContentEncoding.
+	CompressOnUpload *bool
 	// ExternalURI is the URI used for signing requests.
 	ExternalURI *string
-	// URI is the URI for the s3 API.
+	// URI is the URI for the s3 API. A plain HTTP (http://) URI requires
+	// AllowInsecureTransport.
 	URI *string
+	// AllowInsecureTransport allows sending the requests to the s3 API
+	// unencrypted with an http:// URI, e.g. to gateways inside a service
+	// mesh encrypting the traffic itself. Never allowed for AWS endpoints.
+	AllowInsecureTransport *bool
+	// DiscoveryURL is the URL of a discovery document announcing the
+	// endpoint and region of the s3 API, e.g. of an object store that may
+	// move. The document is a JSON object:
+	//
+	//	{"endpoint": "https://s3.example.com", "region": "eu-central-1"}
+	//
+	// The region is optional. The document is fetched before the first
+	// request and again every DiscoveryInterval; the static URI and Region
+	// are used until a valid document was fetched.
+	DiscoveryURL *string
+	// DiscoveryInterval is the interval for fetching the discovery
+	// document again (defaults to: 5m).
+	DiscoveryInterval *time.Duration
+	// Provider applies the workarounds for an S3 compatible API (AWS, GCS
+	// or MinIO) to the options that are not set explicitly:
+	//   - GCS: URI (https://storage.googleapis.com), Region ("auto"),
+	//     ForcePathStyle and an unsigned Accept-Encoding header.
+	//   - MinIO: ForcePathStyle; requires URI.
+	//   - AWS: none (the default).
+	Provider *string
 
 	// ForcePathStyle encodes bucket in the API path.
-	ForcePathStyle bool
+	ForcePathStyle *bool
 	// UseAccelerate enables s3 Accelerate
-	UseAccelerate bool
+	UseAccelerate *bool
+	// AccelerateFallback uses the standard endpoint for buckets without
+	// transfer acceleration enabled if UseAccelerate is set, instead of
+	// failing. The acceleration status of the default bucket is checked
+	// on startup, and of the buckets in storage settings on first use.
+	AccelerateFallback *bool
+	// UseDualStack enables the dual-stack (IPv4 and IPv6) AWS endpoints.
+	// Ignored if URI is set.
+	UseDualStack *bool
+
+	// SSEAlgorithm sets the server-side encryption algorithm applied to
+	// uploaded objects (AES256 or aws:kms).
+	SSEAlgorithm *string
+	// SSEKMSKeyID sets the KMS key used for encrypting uploaded objects.
+	// Only valid when SSEAlgorithm is aws:kms.
+	SSEKMSKeyID *string
+	// SSECustomerKey sets a customer-provided AES-256 key (SSE-C) used
+	// for encrypting and decrypting objects. The key must be 32 bytes.
+	SSECustomerKey []byte
+
+	// StorageClass sets the storage class for uploaded objects
+	// (defaults to the bucket default).
+	StorageClass *string
+	// ACL sets the canned ACL (e.g. private or public-read) of uploaded
+	// and copied objects. With public-read, the objects are readable by
+	// anyone at their bucket URL without presigning; objects uploaded
+	// through presigned PUT requests keep the bucket default. Buckets
+	// with object ownership enforced by the bucket owner reject uploads
+	// with ACLs (ErrACLNotSupported).
+	// Defaults to: none (the bucket default).
+	ACL *string
+	// ChecksumAlgorithm sets the algorithm (CRC32, CRC32C, SHA1 or SHA256)
+	// used for computing checksums of uploaded objects and parts. S3
+	// rejects uploads where the checksum does not match the payload.
+	ChecksumAlgorithm *string
+	// ObjectLockMode sets the object lock retention mode (GOVERNANCE or
+	// COMPLIANCE) for uploaded objects. Requires ObjectLockRetention and
+	// a bucket with object lock enabled.
+	ObjectLockMode *string
+	// ObjectLockRetention sets for how long uploaded objects are locked,
+	// counting from the time of the upload. Requires ObjectLockMode.
+	ObjectLockRetention *time.Duration
+	// Tags sets the tags assigned to uploaded objects. Tags can also be
+	// assigned per upload using storage.ObjectTagsWithContext.
+	Tags map[string]string
+	// Metadata sets user-defined metadata (x-amz-meta-*) on uploaded
+	// objects. Keys are converted to lower case, and the total size of
+	// keys and values must not exceed 2KiB.
+	Metadata map[string]string
+	// ExpiresAfter marks uploaded objects for deletion after the duration:
+	// the objects are tagged with the ExpiryTag (the duration in days,
+	// rounded up) and the intended deletion time is recorded in the
+	// x-amz-meta-expires-at metadata. The objects are only deleted by a
+	// bucket lifecycle rule matching the tag; without such a rule the
+	// objects are kept. Not supported with DeduplicateByHash.
+	ExpiresAfter *time.Duration
 
 	// DefaultExpire is the fallback presign expire duration
 	// (defaults to 15min).
 	DefaultExpire *time.Duration
-	// BufferSize sets the buffer size allocated for uploads.
-	// This implicitly sets the upper limit for upload size:
-	// BufferSize * 10000 (defaults to: 5MiB).
+	// OperationTimeout sets the timeout for a single HTTP request to the
+	// s3 API. The timeout includes reading the response body, and
+	// therefore also limits the duration of object downloads.
+	// Does not affect the expiration of presigned requests.
+	OperationTimeout *time.Duration
+	// MaxRetries sets the maximum number of times a failed request is
+	// retried. Only throttling, timeouts and 5xx errors are retried.
+	// Setting either MaxRetries or RetryMaxBackoff enables the adaptive
+	// retry mode; the SDK standard retryer is used otherwise.
+	MaxRetries *int
+	// RetryMaxBackoff sets the upper bound for the exponential backoff
+	// between retries.
+	RetryMaxBackoff *time.Duration
+	// MaxConcurrentRequests limits the number of requests to the s3 API
+	// in flight; further operations wait for a free slot until their
+	// context is done. Presign operations are not limited.
+	// Defaults to: no limit.
+	MaxConcurrentRequests *int
+	// CircuitBreakerThreshold enables failing the operations fast with
+	// storage.ErrStorageUnavailable after that many consecutive operations
+	// failed within the CircuitBreakerWindow (defaults to: 1m), because the
+	// s3 API was unreachable or responded with server errors. After the
+	// CircuitBreakerProbeInterval (defaults to: 30s), one operation is sent
+	// as a probe; the circuit closes again once a probe succeeds.
+	// Presign operations are not affected.
+	CircuitBreakerThreshold     *int
+	CircuitBreakerWindow        *time.Duration
+	CircuitBreakerProbeInterval *time.Duration
+	// UploadRateLimit caps the bytes per second sent by all uploads of the
+	// client together (PutObject and the parts of multipart uploads), so
+	// that uploads do not saturate a shared link. Throttled uploads stop
+	// waiting when their context is done.
+	// Defaults to: no limit.
+	UploadRateLimit *int
+	// BufferSize sets the buffer size allocated for uploads. Objects that
+	// fit in the buffer are uploaded in a single request, larger objects
+	// are uploaded using the multipart API.
+	// Unless PartSize is set, this implicitly sets the upper limit for
+	// upload size: BufferSize * 10000 (defaults to: 10MiB). The buffer
+	// size must be between 5MiB and 5GiB, the part size limits of S3.
 	BufferSize *int
+	// MaxObjectSize is the size of the largest objects expected, e.g. the
+	// maximum artifact size. Uploads are limited to 10000 parts of the
+	// part size (PartSize or BufferSize); New logs a warning if objects
+	// of MaxObjectSize exceed the limit.
+	MaxObjectSize *int64
+	// PartSize sets the size of the parts for multipart uploads
+	// (5MiB - 5GiB, defaults to: BufferSize). The upper limit for upload
+	// size becomes PartSize * 10000. Parts are streamed through the same
+	// buffer, which is the larger of BufferSize and PartSize.
+	PartSize *int
+	// BufferPoolSize limits the number of upload buffers allocated;
+	// concurrent uploads wait for a free buffer until their context is
+	// done. The memory used by uploads is then bounded by BufferPoolSize
+	// times the buffer size, regardless of the object sizes.
+	// Defaults to: no limit (buffers are allocated on demand and reused).
+	BufferPoolSize *int
+	// UploadConcurrency is the number of parts of a multipart upload that
+	// are uploaded in parallel. Higher values use more of the bandwidth of
+	// fast links, lower values spare constrained ones. Streams are
+	// uploaded one part at a time through the upload buffer, unless they
+	// are spilled to disk (see SpillToDisk); other sources must implement
+	// io.ReaderAt, like files, to upload parts in parallel.
+	// Defaults to: 1
+	UploadConcurrency *int
+	// SpillToDisk writes streamed uploads larger than BufferSize to a
+	// temporary file in TempDir and uploads the parts from the file, so
+	// the upload buffer is only held while receiving the stream instead
+	// of for the whole upload; failed parts are retried from the file.
+	// The file is removed when the upload returns, whether it succeeded,
+	// failed or was canceled. Seekable sources are always uploaded
+	// directly from the source.
+	// Defaults to: false (streams are uploaded through the buffer).
+	SpillToDisk *bool
+	// TempDir is the directory of the temporary files of SpillToDisk. The
+	// directory must be writable when the client is created.
+	// Defaults to: the system temporary directory (os.TempDir).
+	TempDir *string
+	// DeduplicateByHash stores identical objects once: the data is
+	// uploaded to a key derived from its SHA256 sum, unless an object with
+	// the same size and sum exists, and the object path refers to it.
+	// Streams larger than BufferSize are only deduplicated with
+	// SpillToDisk. The content is kept when the referring objects are
+	// deleted, as other objects may refer to it.
+	DeduplicateByHash *bool
+	// StoreSHA256 stores the SHA256 sum of uploaded objects in their
+	// metadata, so that GetObjectVerified can verify downloads without
+	// an expected sum. Like DeduplicateByHash, the sum is computed before
+	// the upload: streams larger than BufferSize only get a sum with
+	// SpillToDisk. Deduplicated objects always have a sum.
+	StoreSHA256 *bool
+	// ResumableUploads records multipart uploads in the UploadStore and
+	// keeps failed uploads, so that uploading the object again, e.g. after
+	// a restart, continues the upload: the parts S3 lists with the same
+	// size and MD5 sum are not uploaded again. Uploads that are not
+	// resumed are left to CleanupAbandonedUploads.
+	ResumableUploads *bool
+	// UploadStore persists the state of the uploads; required with
+	// ResumableUploads.
+	UploadStore UploadStore `json:"-"`
 
 	// UnsignedHeaders forces the driver to skip the named headers from the
-	// being signed.
+	// being signed. NewOptions merges the headers of all options.
 	UnsignedHeaders []string
+	// APIMiddleware adds middleware to the stack of every operation,
+	// including presign operations. NewOptions appends the middleware of
+	// all options. The functions run after the built-in middleware is
+	// added: middleware added to the Build step, or inserted before
+	// "Signing" in the Finalize step, modifies the request before it is
+	// signed. Headers set this way are always signed, even if listed in
+	// UnsignedHeaders.
+	APIMiddleware []func(*middleware.Stack) error `json:"-"`
+	// PresignQuery adds query parameters to presigned links, for
+	// instance parameters a CDN in front of the bucket expects. The
+	// parameters are added before signing: the signature covers them, so
+	// they must reach the bucket unchanged. Names starting with X-Amz-
+	// are reserved for the signature.
+	PresignQuery map[string]string
+	// PresignHooks are called with the presigned links after signing,
+	// e.g. for layering the signature of a CDN (see PresignHook).
+	// NewOptions appends the hooks of all options.
+	PresignHooks []PresignHook `json:"-"`
 
 	// Transport sets an alternative RoundTripper used by the Go HTTP
 	// client.
-	Transport http.RoundTripper
+	Transport http.RoundTripper `json:"-"`
+	// ProxyURL sets the proxy (http, https or socks5) used for requests
+	// to the s3 API. Proxy credentials can be embedded in the URL.
+	// Defaults to the proxy from the environment (HTTPS_PROXY/NO_PROXY).
+	// Ignored if Transport is set.
+	ProxyURL *string
+	// CABundle contains PEM encoded CA certificates trusted in addition
+	// to the system root pool. Ignored if Transport is set.
+	CABundle []byte
+	// InsecureSkipVerify disables verification of the server certificate.
+	// Only intended for development against self-signed endpoints; not
+	// allowed for AWS endpoints. Ignored if Transport is set.
+	InsecureSkipVerify *bool
+	// MaxIdleConns limits the number of idle (keep-alive) connections
+	// kept open; 0 means no limit (defaults to: 100).
+	// Ignored if Transport is set.
+	MaxIdleConns *int
+	// MaxIdleConnsPerHost limits the number of idle connections kept
+	// open to each host (defaults to: 100). Ignored if Transport is set.
+	MaxIdleConnsPerHost *int
+	// IdleConnTimeout is the time an idle connection is kept open before
+	// closing it (defaults to: 90s). Ignored if Transport is set.
+	IdleConnTimeout *time.Duration
+	// ExpectContinueTimeout enables "Expect: 100-continue" for uploads of
+	// at least 2MiB: the body is only sent once the server accepted the
+	// request, or after the timeout passed without a response, so that
+	// rejected uploads (e.g. on authentication) are not transferred.
+	// Some S3 compatible servers mishandle the header.
+	// Defaults to: disabled. If Transport is set, the header is sent but
+	// the transport decides how long to wait.
+	ExpectContinueTimeout *time.Duration
+
+	// RequestLogging enables logging of every request to the s3 API and
+	// the response status. Credentials and signatures are redacted.
+	RequestLogging *bool
+	// UserAgentSuffix is appended to the User-Agent header of the SDK for
+	// every s3 request, e.g. to identify the service to the provider.
+	UserAgentSuffix *string
+	// EnableMetrics enables recording the duration and outcome of every
+	// s3 operation, including presign operations, with the Metrics
+	// recorder.
+	// Defaults to: disabled.
+	EnableMetrics *bool
+	// Metrics is the recorder of the metrics if EnableMetrics is set.
+	// Defaults to: DefaultPrometheusRecorder().
+	Metrics MetricsRecorder `json:"-"`
+	// EnableTracing enables creating a span with the Tracer for every s3
+	// operation, including presign operations, as child of the span in the
+	// context of the operation.
+	// Defaults to: disabled.
+	EnableTracing *bool
+	// Tracer is the tracer of the spans if EnableTracing is set.
+	// Defaults to: DefaultOTelTracer().
+	Tracer Tracer `json:"-"`
+	// CacheSize enables an in-memory LRU cache of at most CacheSize bytes
+	// for small object reads (GetObject and GetObjectRange) and StatObject,
+	// e.g. for repeatedly reading the header of the same artifact.
+	// Bodies larger than CacheMaxItemSize are never cached. Hits are
+	// revalidated with a conditional request on the cached ETag, so objects
+	// replaced by other writers are never read stale; the cache saves the
+	// transfer of unchanged bodies. Entries are dropped after CacheTTL,
+	// when a response with a different ETag of the object is seen, and
+	// when the object is modified through the storage. If metrics are
+	// enabled and the recorder implements CacheMetricsRecorder, the hits
+	// and misses are recorded.
+	// Defaults to: disabled.
+	CacheSize *int64
+	// CacheTTL is the time entries are kept in the cache. Requires
+	// CacheSize.
+	// Defaults to: DefaultCacheTTL (1min).
+	CacheTTL *time.Duration
+	// CacheMaxItemSize is the size of the largest body cached. Requires
+	// CacheSize.
+	// Defaults to: DefaultCacheMaxItemSize (64KiB).
+	CacheMaxItemSize *int64
+	// PingWrite makes Ping (and HealthCheck) verify that the bucket is
+	// writable by uploading and deleting a small object under ".ping/".
+	PingWrite *bool
+	// VerifyIntegrity makes PutObject send the Content-MD5 of every
+	// single-part upload and multipart part, and compare the ETag of the
+	// uploaded object with the MD5 sums of the data read. On mismatch the
+	// upload is aborted (or the object removed) and ErrIntegrityMismatch
+	// is returned. The ETag is not compared for objects encrypted with
+	// SSE-KMS or SSE-C, since it is not derived from the data.
+	VerifyIntegrity *bool
+	// RequestPayer sends the "x-amz-request-payer: requester" header
+	// with the read operations (GetObject, HeadObject and ListObjects)
+	// and deletes, as required by Requester Pays buckets. Presigned GET
+	// requests include the request payer in the query. Uploads are not
+	// affected.
+	RequestPayer *bool
+	// EnableClockSkewCorrection signs the requests and presigned links
+	// with the local time corrected by the offset of the S3 API clock, as
+	// measured from the Date header of the responses, for hosts with a
+	// drifting clock. A request rejected as RequestTimeTooSkewed is retried
+	// once with the measured offset. The offset is measured again if no
+	// response was received for ten minutes.
+	EnableClockSkewCorrection *bool
+}
+
+// MarshalJSON marshals the options with the credentials, the SSE-C key
+// and the proxy password redacted; the middleware, the transport and the
+// metrics recorder are omitted.
+func (opts Options) MarshalJSON() ([]byte, error) {
+	type options Options
+	ret := struct {
+		options
+		SSECustomerKey string `json:",omitempty"`
+	}{options: options(opts)}
+	if len(opts.SSECustomerKey) > 0 {
+		ret.SSECustomerKey = redacted
+	}
+	if opts.ProxyURL != nil {
+		if u, err := url.Parse(*opts.ProxyURL); err == nil {
+			ret.ProxyURL = aws.String(u.Redacted())
+		} else {
+			ret.ProxyURL = aws.String(redacted)
+		}
+	}
+	return json.Marshal(ret)
+}
+
+// String returns the options as redacted JSON (see MarshalJSON), so
+// that the options can be logged.
+func (opts Options) String() string {
+	b, err := opts.MarshalJSON()
+	if err != nil {
+		return "s3.Options{" + err.Error() + "}"
+	}
+	return string(b)
+}
+
+func (opts Options) GoString() string {
+	return "s3.Options" + opts.String()
 }
 
 func NewOptions(opts ...*Options) *Options {
@@ -90,44 +565,486 @@ func NewOptions(opts ...*Options) *Options {
 		if opt.StaticCredentials != nil {
 			ret.StaticCredentials = opt.StaticCredentials
 		}
+		if opt.CredentialsResolver != nil {
+			ret.CredentialsResolver = opt.CredentialsResolver
+		}
+		if opt.CredentialsCacheTTL != nil {
+			ret.CredentialsCacheTTL = opt.CredentialsCacheTTL
+		}
+		if opt.AssumeRoleARN != nil {
+			ret.AssumeRoleARN = opt.AssumeRoleARN
+		}
+		if opt.ExternalID != nil {
+			ret.ExternalID = opt.ExternalID
+		}
+		if opt.RoleSessionName != nil {
+			ret.RoleSessionName = opt.RoleSessionName
+		}
+		if opt.WebIdentityTokenFile != nil {
+			ret.WebIdentityTokenFile = opt.WebIdentityTokenFile
+		}
+		if opt.WebIdentityRoleARN != nil {
+			ret.WebIdentityRoleARN = opt.WebIdentityRoleARN
+		}
+		if opt.CredentialSource != nil {
+			ret.CredentialSource = opt.CredentialSource
+		}
+		if opt.MinPresignCredTTL != nil {
+			ret.MinPresignCredTTL = opt.MinPresignCredTTL
+		}
 		if opt.Region != nil {
 			ret.Region = opt.Region
 		}
+		if opt.Profile != nil {
+			ret.Profile = opt.Profile
+		}
+		if opt.FallbackRegions != nil {
+			ret.FallbackRegions = opt.FallbackRegions
+		}
+		if opt.SigningRegion != nil {
+			ret.SigningRegion = opt.SigningRegion
+		}
+		if opt.SignatureVersion != nil {
+			ret.SignatureVersion = opt.SignatureVersion
+		}
+		if opt.KeyPrefix != nil {
+			ret.KeyPrefix = opt.KeyPrefix
+		}
+		if opt.KeyStrategy != nil {
+			ret.KeyStrategy = opt.KeyStrategy
+		}
 		if opt.ContentType != nil {
 			ret.ContentType = opt.ContentType
 		}
+		if opt.ContentDisposition != nil {
+			ret.ContentDisposition = opt.ContentDisposition
+		}
+		if opt.CacheControl != nil {
+			ret.CacheControl = opt.CacheControl
+		}
+		if opt.ContentEncoding != nil {
+			ret.ContentEncoding = opt.ContentEncoding
+		}
+		if opt.CompressOnUpload != nil {
+			ret.CompressOnUpload = opt.CompressOnUpload
+		}
 		if opt.ExternalURI != nil {
 			ret.ExternalURI = opt.ExternalURI
 		}
 		if opt.URI != nil {
 			ret.URI = opt.URI
 		}
-		if opt.ForcePathStyle != ret.ForcePathStyle {
+		if opt.DiscoveryURL != nil {
+			ret.DiscoveryURL = opt.DiscoveryURL
+		}
+		if opt.DiscoveryInterval != nil {
+			ret.DiscoveryInterval = opt.DiscoveryInterval
+		}
+		if opt.Provider != nil {
+			ret.Provider = opt.Provider
+		}
+		if opt.ForcePathStyle != nil {
 			ret.ForcePathStyle = opt.ForcePathStyle
 		}
-		if opt.UseAccelerate != ret.UseAccelerate {
+		if opt.UseAccelerate != nil {
 			ret.UseAccelerate = opt.UseAccelerate
 		}
+		if opt.AccelerateFallback != nil {
+			ret.AccelerateFallback = opt.AccelerateFallback
+		}
+		if opt.UseDualStack != nil {
+			ret.UseDualStack = opt.UseDualStack
+		}
+		if opt.SSEAlgorithm != nil {
+			ret.SSEAlgorithm = opt.SSEAlgorithm
+		}
+		if opt.SSEKMSKeyID != nil {
+			ret.SSEKMSKeyID = opt.SSEKMSKeyID
+		}
+		if opt.SSECustomerKey != nil {
+			ret.SSECustomerKey = opt.SSECustomerKey
+		}
+		if opt.StorageClass != nil {
+			ret.StorageClass = opt.StorageClass
+		}
+		if opt.ACL != nil {
+			ret.ACL = opt.ACL
+		}
+		if opt.ObjectLockMode != nil {
+			ret.ObjectLockMode = opt.ObjectLockMode
+		}
+		if opt.ObjectLockRetention != nil {
+			ret.ObjectLockRetention = opt.ObjectLockRetention
+		}
+		if opt.ChecksumAlgorithm != nil {
+			ret.ChecksumAlgorithm = opt.ChecksumAlgorithm
+		}
+		if opt.Tags != nil {
+			ret.Tags = opt.Tags
+		}
+		if opt.Metadata != nil {
+			ret.Metadata = opt.Metadata
+		}
+		if opt.ExpiresAfter != nil {
+			ret.ExpiresAfter = opt.ExpiresAfter
+		}
 		if opt.DefaultExpire != nil {
 			ret.DefaultExpire = opt.DefaultExpire
 		}
+		if opt.OperationTimeout != nil {
+			ret.OperationTimeout = opt.OperationTimeout
+		}
+		if opt.MaxRetries != nil {
+			ret.MaxRetries = opt.MaxRetries
+		}
+		if opt.RetryMaxBackoff != nil {
+			ret.RetryMaxBackoff = opt.RetryMaxBackoff
+		}
+		if opt.MaxConcurrentRequests != nil {
+			ret.MaxConcurrentRequests = opt.MaxConcurrentRequests
+		}
+		if opt.CircuitBreakerThreshold != nil {
+			ret.CircuitBreakerThreshold = opt.CircuitBreakerThreshold
+		}
+		if opt.CircuitBreakerWindow != nil {
+			ret.CircuitBreakerWindow = opt.CircuitBreakerWindow
+		}
+		if opt.CircuitBreakerProbeInterval != nil {
+			ret.CircuitBreakerProbeInterval = opt.CircuitBreakerProbeInterval
+		}
+		if opt.UploadRateLimit != nil {
+			ret.UploadRateLimit = opt.UploadRateLimit
+		}
 		if opt.BufferSize != nil {
 			ret.BufferSize = opt.BufferSize
 		}
+		if opt.MaxObjectSize != nil {
+			ret.MaxObjectSize = opt.MaxObjectSize
+		}
+		if opt.PartSize != nil {
+			ret.PartSize = opt.PartSize
+		}
+		if opt.BufferPoolSize != nil {
+			ret.BufferPoolSize = opt.BufferPoolSize
+		}
+		if opt.UploadConcurrency != nil {
+			ret.UploadConcurrency = opt.UploadConcurrency
+		}
+		if opt.SpillToDisk != nil {
+			ret.SpillToDisk = opt.SpillToDisk
+		}
+		if opt.TempDir != nil {
+			ret.TempDir = opt.TempDir
+		}
+		if opt.DeduplicateByHash != nil {
+			ret.DeduplicateByHash = opt.DeduplicateByHash
+		}
+		if opt.StoreSHA256 != nil {
+			ret.StoreSHA256 = opt.StoreSHA256
+		}
+		if opt.ResumableUploads != nil {
+			ret.ResumableUploads = opt.ResumableUploads
+		}
+		if opt.UploadStore != nil {
+			ret.UploadStore = opt.UploadStore
+		}
 		if opt.UnsignedHeaders != nil {
-			ret.UnsignedHeaders = opt.UnsignedHeaders
+			ret.UnsignedHeaders = mergeHeaderNames(
+				ret.UnsignedHeaders, opt.UnsignedHeaders,
+			)
+		}
+		if opt.APIMiddleware != nil {
+			ret.APIMiddleware = append(ret.APIMiddleware, opt.APIMiddleware...)
+		}
+		if opt.PresignQuery != nil {
+			ret.PresignQuery = opt.PresignQuery
+		}
+		if opt.PresignHooks != nil {
+			ret.PresignHooks = append(ret.PresignHooks, opt.PresignHooks...)
 		}
 		if opt.Transport != nil {
 			ret.Transport = opt.Transport
 		}
+		if opt.ProxyURL != nil {
+			ret.ProxyURL = opt.ProxyURL
+		}
+		if opt.CABundle != nil {
+			ret.CABundle = opt.CABundle
+		}
+		if opt.InsecureSkipVerify != nil {
+			ret.InsecureSkipVerify = opt.InsecureSkipVerify
+		}
+		if opt.AllowInsecureTransport != nil {
+			ret.AllowInsecureTransport = opt.AllowInsecureTransport
+		}
+		if opt.MaxIdleConns != nil {
+			ret.MaxIdleConns = opt.MaxIdleConns
+		}
+		if opt.MaxIdleConnsPerHost != nil {
+			ret.MaxIdleConnsPerHost = opt.MaxIdleConnsPerHost
+		}
+		if opt.IdleConnTimeout != nil {
+			ret.IdleConnTimeout = opt.IdleConnTimeout
+		}
+		if opt.ExpectContinueTimeout != nil {
+			ret.ExpectContinueTimeout = opt.ExpectContinueTimeout
+		}
+		if opt.RequestLogging != nil {
+			ret.RequestLogging = opt.RequestLogging
+		}
+		if opt.UserAgentSuffix != nil {
+			ret.UserAgentSuffix = opt.UserAgentSuffix
+		}
+		if opt.PingWrite != nil {
+			ret.PingWrite = opt.PingWrite
+		}
+		if opt.VerifyIntegrity != nil {
+			ret.VerifyIntegrity = opt.VerifyIntegrity
+		}
+		if opt.RequestPayer != nil {
+			ret.RequestPayer = opt.RequestPayer
+		}
+		if opt.EnableClockSkewCorrection != nil {
+			ret.EnableClockSkewCorrection = opt.EnableClockSkewCorrection
+		}
+		if opt.EnableMetrics != nil {
+			ret.EnableMetrics = opt.EnableMetrics
+		}
+		if opt.Metrics != nil {
+			ret.Metrics = opt.Metrics
+		}
+		if opt.EnableTracing != nil {
+			ret.EnableTracing = opt.EnableTracing
+		}
+		if opt.Tracer != nil {
+			ret.Tracer = opt.Tracer
+		}
+		if opt.CacheSize != nil {
+			ret.CacheSize = opt.CacheSize
+		}
+		if opt.CacheTTL != nil {
+			ret.CacheTTL = opt.CacheTTL
+		}
+		if opt.CacheMaxItemSize != nil {
+			ret.CacheMaxItemSize = opt.CacheMaxItemSize
+		}
+	}
+	return ret
+}
+
+// mergeHeaderNames returns the union of the canonicalized header names in
+// the order of their first occurrence.
+func mergeHeaderNames(headers, add []string) []string {
+	ret := make([]string, 0, len(headers)+len(add))
+	seen := make(map[string]struct{}, len(headers)+len(add))
+	for _, names := range [][]string{headers, add} {
+		for _, name := range names {
+			name = textproto.CanonicalMIMEHeaderKey(name)
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			ret = append(ret, name)
+		}
 	}
 	return ret
 }
 
 func (opts Options) Validate() error {
+	useKMS := opts.SSEAlgorithm != nil &&
+		*opts.SSEAlgorithm == string(types.ServerSideEncryptionAwsKms)
 	return validation.ValidateStruct(&opts,
 		validation.Field(&opts.StaticCredentials),
-		validation.Field(&opts.BufferSize, validAtLeast5MiB),
+		validation.Field(&opts.AssumeRoleARN, validation.By(validateRoleARN)),
+		validation.Field(&opts.ExternalID, validation.When(opts.AssumeRoleARN == nil,
+			validation.Nil.Error("requires AssumeRoleARN"),
+		)),
+		validation.Field(&opts.RoleSessionName, validation.When(
+			opts.AssumeRoleARN == nil && opts.WebIdentityRoleARN == nil,
+			validation.Nil.Error("requires AssumeRoleARN or WebIdentityRoleARN"),
+		)),
+		validation.Field(&opts.WebIdentityRoleARN,
+			validation.When(opts.WebIdentityTokenFile != nil,
+				validation.Required.Error("required with WebIdentityTokenFile"),
+			),
+			validation.By(validateRoleARN),
+		),
+		validation.Field(&opts.WebIdentityTokenFile,
+			validation.When(opts.WebIdentityRoleARN != nil,
+				validation.Required.Error("required with WebIdentityRoleARN"),
+			),
+		),
+		validation.Field(&opts.MinPresignCredTTL, validPositiveDuration),
+		validation.Field(&opts.CredentialsCacheTTL, validPositiveDuration),
+		validation.Field(&opts.CredentialSource, validCredentialSource,
+			validation.When(
+				aws.ToString(opts.CredentialSource) == CredentialSourceStatic &&
+					opts.StaticCredentials == nil,
+				validation.Nil.Error("requires StaticCredentials"),
+			),
+			validation.When(
+				aws.ToString(opts.CredentialSource) == CredentialSourceWebIdentity &&
+					opts.WebIdentityTokenFile == nil,
+				validation.Nil.Error("requires WebIdentityTokenFile"),
+			),
+		),
+		validation.Field(&opts.SSEAlgorithm, validSSEAlgorithm,
+			validation.When(len(opts.SSECustomerKey) > 0,
+				validation.Nil.Error("cannot be combined with SSECustomerKey"),
+			),
+		),
+		validation.Field(&opts.SSEKMSKeyID, validation.When(!useKMS,
+			validation.Nil.Error("requires SSEAlgorithm aws:kms"),
+		)),
+		validation.Field(&opts.SSECustomerKey, validSSECustomerKeyLength),
+		validation.Field(&opts.KeyPrefix, validation.By(validateKeyPrefix)),
+		validation.Field(&opts.ContentDisposition, validation.By(validateHeaderValue)),
+		validation.Field(&opts.CacheControl, validation.By(validateHeaderValue)),
+		validation.Field(&opts.UserAgentSuffix, validation.By(validateHeaderValue)),
+		validation.Field(&opts.ContentEncoding, validation.By(validateHeaderValue),
+			validation.When(aws.ToBool(opts.CompressOnUpload),
+				validation.Nil.Error("cannot be combined with CompressOnUpload"),
+			),
+		),
+		validation.Field(&opts.StorageClass, validStorageClass),
+		validation.Field(&opts.ACL, validACL),
+		validation.Field(&opts.ChecksumAlgorithm, validChecksumAlgorithm),
+		validation.Field(&opts.ObjectLockMode, validObjectLockMode),
+		validation.Field(&opts.ObjectLockRetention,
+			validation.When(opts.ObjectLockMode != nil,
+				validation.Required.Error("required with ObjectLockMode"),
+			).Else(
+				validation.Nil.Error("requires ObjectLockMode"),
+			),
+			validPositiveDuration,
+		),
+		validation.Field(&opts.Tags, validation.By(validateTagsRule)),
+		validation.Field(&opts.PresignQuery, validation.By(validatePresignQuery)),
+		validation.Field(&opts.Metadata, validation.By(validateMetadata)),
+		validation.Field(&opts.ExpiresAfter,
+			validation.NilOrNotEmpty.Error("must be a positive duration"),
+			validPositiveDuration,
+			validation.When(aws.ToBool(opts.DeduplicateByHash),
+				validation.Nil.Error("not supported with DeduplicateByHash"),
+			)),
+		validation.Field(&opts.UploadStore, validation.When(aws.ToBool(opts.ResumableUploads),
+			validation.Required.Error("required with ResumableUploads"),
+		)),
+		validation.Field(&opts.CacheSize,
+			validation.NilOrNotEmpty.Error("must be positive"),
+			validation.Min(int64(1)),
+		),
+		validation.Field(&opts.CacheTTL,
+			validation.When(opts.CacheSize == nil,
+				validation.Nil.Error("requires CacheSize"),
+			),
+			validation.NilOrNotEmpty.Error("must be a positive duration"),
+			validPositiveDuration,
+		),
+		validation.Field(&opts.CacheMaxItemSize,
+			validation.When(opts.CacheSize == nil,
+				validation.Nil.Error("requires CacheSize"),
+			),
+			validation.NilOrNotEmpty.Error("must be positive"),
+			validation.Min(int64(1)),
+		),
+		validation.Field(&opts.OperationTimeout, validPositiveDuration),
+		validation.Field(&opts.MaxRetries, validation.Min(0)),
+		validation.Field(&opts.RetryMaxBackoff, validPositiveDuration),
+		validation.Field(&opts.MaxConcurrentRequests,
+			validation.NilOrNotEmpty.Error("must be positive"),
+			validation.Min(1),
+		),
+		validation.Field(&opts.CircuitBreakerThreshold,
+			validation.NilOrNotEmpty.Error("must be positive"),
+			validation.Min(1),
+		),
+		validation.Field(&opts.CircuitBreakerWindow,
+			validation.NilOrNotEmpty.Error("must be a positive duration"),
+			validPositiveDuration,
+		),
+		validation.Field(&opts.CircuitBreakerProbeInterval,
+			validation.NilOrNotEmpty.Error("must be a positive duration"),
+			validPositiveDuration,
+		),
+		validation.Field(&opts.UploadRateLimit,
+			validation.NilOrNotEmpty.Error("must be positive"),
+			validation.Min(1),
+		),
+		validation.Field(&opts.BufferSize, validAtLeast5MiB, validAtMost5GiB),
+		validation.Field(&opts.MaxObjectSize, validation.NilOrNotEmpty,
+			validation.Min(int64(1))),
+		validation.Field(&opts.PartSize, validAtLeast5MiB, validAtMost5GiB),
+		validation.Field(&opts.UploadConcurrency, validation.NilOrNotEmpty,
+			validation.Min(1)),
+		validation.Field(&opts.TempDir, validation.NilOrNotEmpty),
+		validation.Field(&opts.BufferPoolSize,
+			validation.NilOrNotEmpty.Error("must be positive"),
+			validation.Min(1),
+		),
+		validation.Field(&opts.FallbackRegions, validation.By(validateFallbackRegions)),
+		validation.Field(&opts.Profile, validation.NilOrNotEmpty),
+		validation.Field(&opts.SigningRegion,
+			validation.NilOrNotEmpty,
+			validation.When(opts.URI == nil,
+				validation.Nil.Error("requires URI"),
+			),
+		),
+		validation.Field(&opts.SignatureVersion, validSignatureVersion,
+			validation.When(opts.isSignatureVersion2() &&
+				(opts.ChecksumAlgorithm != nil || opts.ObjectLockMode != nil),
+				validation.Nil.Error("v2 cannot be combined with "+
+					"ChecksumAlgorithm or ObjectLockMode"),
+			),
+		),
+		validation.Field(&opts.ExternalURI, validation.By(validateAbsoluteURL)),
+		validation.Field(&opts.URI,
+			validation.By(validateAbsoluteURL),
+			validation.By(validatePlainHTTP(aws.ToBool(opts.AllowInsecureTransport))),
+			validation.When(opts.isProvider(ProviderMinIO),
+				validation.Required.Error("required for MinIO"),
+			),
+		),
+		validation.Field(&opts.DiscoveryURL,
+			validation.By(validateAbsoluteURL),
+			validation.By(validatePlainHTTP(aws.ToBool(opts.AllowInsecureTransport))),
+		),
+		validation.Field(&opts.DiscoveryInterval,
+			validation.NilOrNotEmpty.Error("must be a positive duration"),
+			validPositiveDuration,
+		),
+		validation.Field(&opts.Provider, validation.By(validateProvider)),
+		validation.Field(&opts.UseAccelerate,
+			validation.When(aws.ToBool(opts.ForcePathStyle),
+				validation.Empty.Error("cannot be combined with ForcePathStyle"),
+			),
+			validation.When(opts.URI != nil,
+				validation.Empty.Error("cannot be combined with a custom URI"),
+			),
+			validation.When(opts.DiscoveryURL != nil,
+				validation.Empty.Error("cannot be combined with DiscoveryURL"),
+			),
+		),
+		validation.Field(&opts.ProxyURL, validation.By(validateProxyURL)),
+		validation.Field(&opts.MaxIdleConns, validation.Min(0)),
+		validation.Field(&opts.MaxIdleConnsPerHost,
+			validation.NilOrNotEmpty.Error("must be positive"),
+			validation.Min(1),
+		),
+		validation.Field(&opts.IdleConnTimeout, validPositiveDuration),
+		validation.Field(&opts.ExpectContinueTimeout,
+			validation.NilOrNotEmpty.Error("must be positive"),
+			validPositiveDuration,
+		),
+		validation.Field(&opts.CABundle, validation.By(validateCABundle)),
+		validation.Field(&opts.InsecureSkipVerify,
+			validation.When(len(opts.CABundle) > 0,
+				validation.Empty.Error("cannot be combined with CABundle"),
+			),
+			validation.When(opts.isAWSEndpoint(),
+				validation.Empty.Error("not allowed for AWS endpoints"),
+			),
+		),
 	)
 }
 
@@ -140,11 +1057,82 @@ func (opts *Options) SetStaticCredentials(key, secret, sessionToken string) *Opt
 	return opts
 }
 
+func (opts *Options) SetCredentialsResolver(resolver CredentialsResolver) *Options {
+	opts.CredentialsResolver = resolver
+	return opts
+}
+
+func (opts *Options) SetCredentialsCacheTTL(ttl time.Duration) *Options {
+	opts.CredentialsCacheTTL = &ttl
+	return opts
+}
+
+func (opts *Options) SetAssumeRoleARN(roleARN string) *Options {
+	opts.AssumeRoleARN = &roleARN
+	return opts
+}
+
+func (opts *Options) SetExternalID(externalID string) *Options {
+	opts.ExternalID = &externalID
+	return opts
+}
+
+func (opts *Options) SetRoleSessionName(sessionName string) *Options {
+	opts.RoleSessionName = &sessionName
+	return opts
+}
+
+func (opts *Options) SetWebIdentity(tokenFile, roleARN string) *Options {
+	opts.WebIdentityTokenFile = &tokenFile
+	opts.WebIdentityRoleARN = &roleARN
+	return opts
+}
+
+func (opts *Options) SetCredentialSource(source string) *Options {
+	opts.CredentialSource = &source
+	return opts
+}
+
+func (opts *Options) SetMinPresignCredTTL(ttl time.Duration) *Options {
+	opts.MinPresignCredTTL = &ttl
+	return opts
+}
+
 func (opts *Options) SetRegion(region string) *Options {
 	opts.Region = &region
 	return opts
 }
 
+func (opts *Options) SetProfile(profile string) *Options {
+	opts.Profile = &profile
+	return opts
+}
+
+func (opts *Options) SetFallbackRegions(regions []string) *Options {
+	opts.FallbackRegions = regions
+	return opts
+}
+
+func (opts *Options) SetSigningRegion(signingRegion string) *Options {
+	opts.SigningRegion = &signingRegion
+	return opts
+}
+
+func (opts *Options) SetSignatureVersion(version string) *Options {
+	opts.SignatureVersion = &version
+	return opts
+}
+
+func (opts *Options) SetKeyPrefix(prefix string) *Options {
+	opts.KeyPrefix = &prefix
+	return opts
+}
+
+func (opts *Options) SetKeyStrategy(strategy KeyStrategy) *Options {
+	opts.KeyStrategy = strategy
+	return opts
+}
+
 func (opts *Options) SetContentType(contentType string) *Options {
 	opts.ContentType = &contentType
 	return opts
@@ -155,6 +1143,26 @@ func (opts *Options) SetFilenameSuffix(suffix string) *Options {
 	return opts
 }
 
+func (opts *Options) SetContentDisposition(contentDisposition string) *Options {
+	opts.ContentDisposition = &contentDisposition
+	return opts
+}
+
+func (opts *Options) SetCacheControl(cacheControl string) *Options {
+	opts.CacheControl = &cacheControl
+	return opts
+}
+
+func (opts *Options) SetContentEncoding(contentEncoding string) *Options {
+	opts.ContentEncoding = &contentEncoding
+	return opts
+}
+
+func (opts *Options) SetCompressOnUpload(enable bool) *Options {
+	opts.CompressOnUpload = &enable
+	return opts
+}
+
 func (opts *Options) SetExternalURI(externalURI string) *Options {
 	opts.ExternalURI = &externalURI
 	return opts
@@ -165,13 +1173,89 @@ func (opts *Options) SetURI(URI string) *Options {
 	return opts
 }
 
+func (opts *Options) SetDiscoveryURL(discoveryURL string) *Options {
+	opts.DiscoveryURL = &discoveryURL
+	return opts
+}
+
+func (opts *Options) SetDiscoveryInterval(interval time.Duration) *Options {
+	opts.DiscoveryInterval = &interval
+	return opts
+}
+
+func (opts *Options) SetProvider(provider string) *Options {
+	opts.Provider = &provider
+	return opts
+}
+
 func (opts *Options) SetForcePathStyle(forcePathStyle bool) *Options {
-	opts.ForcePathStyle = forcePathStyle
+	opts.ForcePathStyle = &forcePathStyle
 	return opts
 }
 
 func (opts *Options) SetUseAccelerate(useAccelerate bool) *Options {
-	opts.UseAccelerate = useAccelerate
+	opts.UseAccelerate = &useAccelerate
+	return opts
+}
+
+func (opts *Options) SetAccelerateFallback(fallback bool) *Options {
+	opts.AccelerateFallback = &fallback
+	return opts
+}
+
+func (opts *Options) SetUseDualStack(useDualStack bool) *Options {
+	opts.UseDualStack = &useDualStack
+	return opts
+}
+
+func (opts *Options) SetSSEAlgorithm(algorithm string) *Options {
+	opts.SSEAlgorithm = &algorithm
+	return opts
+}
+
+func (opts *Options) SetSSEKMSKeyID(keyID string) *Options {
+	opts.SSEKMSKeyID = &keyID
+	return opts
+}
+
+func (opts *Options) SetSSECustomerKey(key []byte) *Options {
+	opts.SSECustomerKey = key
+	return opts
+}
+
+func (opts *Options) SetStorageClass(storageClass string) *Options {
+	opts.StorageClass = &storageClass
+	return opts
+}
+
+func (opts *Options) SetACL(acl string) *Options {
+	opts.ACL = &acl
+	return opts
+}
+
+func (opts *Options) SetObjectLock(mode string, retention time.Duration) *Options {
+	opts.ObjectLockMode = &mode
+	opts.ObjectLockRetention = &retention
+	return opts
+}
+
+func (opts *Options) SetChecksumAlgorithm(algorithm string) *Options {
+	opts.ChecksumAlgorithm = &algorithm
+	return opts
+}
+
+func (opts *Options) SetTags(tags map[string]string) *Options {
+	opts.Tags = tags
+	return opts
+}
+
+func (opts *Options) SetMetadata(metadata map[string]string) *Options {
+	opts.Metadata = metadata
+	return opts
+}
+
+func (opts *Options) SetExpiresAfter(expiresAfter time.Duration) *Options {
+	opts.ExpiresAfter = &expiresAfter
 	return opts
 }
 
@@ -180,28 +1264,300 @@ func (opts *Options) SetDefaultExpire(defaultExpire time.Duration) *Options {
 	return opts
 }
 
+func (opts *Options) SetOperationTimeout(timeout time.Duration) *Options {
+	opts.OperationTimeout = &timeout
+	return opts
+}
+
+func (opts *Options) SetMaxRetries(maxRetries int) *Options {
+	opts.MaxRetries = &maxRetries
+	return opts
+}
+
+func (opts *Options) SetRetryMaxBackoff(maxBackoff time.Duration) *Options {
+	opts.RetryMaxBackoff = &maxBackoff
+	return opts
+}
+
+func (opts *Options) SetMaxConcurrentRequests(maxRequests int) *Options {
+	opts.MaxConcurrentRequests = &maxRequests
+	return opts
+}
+
+// SetCircuitBreaker enables the circuit breaker, opening after threshold
+// consecutive failures within window.
+func (opts *Options) SetCircuitBreaker(threshold int, window time.Duration) *Options {
+	opts.CircuitBreakerThreshold = &threshold
+	opts.CircuitBreakerWindow = &window
+	return opts
+}
+
+func (opts *Options) SetCircuitBreakerProbeInterval(interval time.Duration) *Options {
+	opts.CircuitBreakerProbeInterval = &interval
+	return opts
+}
+
+func (opts *Options) SetUploadRateLimit(bytesPerSec int) *Options {
+	opts.UploadRateLimit = &bytesPerSec
+	return opts
+}
+
 func (opts *Options) SetBufferSize(bufferSize int) *Options {
 	opts.BufferSize = &bufferSize
 	return opts
 }
 
+func (opts *Options) SetMaxObjectSize(size int64) *Options {
+	opts.MaxObjectSize = &size
+	return opts
+}
+
+func (opts *Options) SetPartSize(partSize int) *Options {
+	opts.PartSize = &partSize
+	return opts
+}
+
+func (opts *Options) SetBufferPoolSize(poolSize int) *Options {
+	opts.BufferPoolSize = &poolSize
+	return opts
+}
+
+func (opts *Options) SetUploadConcurrency(concurrency int) *Options {
+	opts.UploadConcurrency = &concurrency
+	return opts
+}
+
+func (opts *Options) SetSpillToDisk(spill bool) *Options {
+	opts.SpillToDisk = &spill
+	return opts
+}
+
+func (opts *Options) SetTempDir(dir string) *Options {
+	opts.TempDir = &dir
+	return opts
+}
+
+// spillDir returns the directory of the temporary files of spilled
+// uploads, or nil if uploads are not spilled.
+func (opts *Options) spillDir() *string {
+	switch {
+	case !aws.ToBool(opts.SpillToDisk):
+		return nil
+	case opts.TempDir != nil:
+		return opts.TempDir
+	default:
+		dir := os.TempDir()
+		return &dir
+	}
+}
+
+func (opts *Options) SetDeduplicateByHash(deduplicate bool) *Options {
+	opts.DeduplicateByHash = &deduplicate
+	return opts
+}
+
+func (opts *Options) SetStoreSHA256(store bool) *Options {
+	opts.StoreSHA256 = &store
+	return opts
+}
+
+func (opts *Options) SetResumableUploads(resumable bool) *Options {
+	opts.ResumableUploads = &resumable
+	return opts
+}
+
+func (opts *Options) SetUploadStore(uploads UploadStore) *Options {
+	opts.UploadStore = uploads
+	return opts
+}
+
 func (opts *Options) SetUnsignedHeaders(unsignedHeaders []string) *Options {
 	opts.UnsignedHeaders = unsignedHeaders
 	return opts
 }
 
+func (opts *Options) SetPresignQuery(params map[string]string) *Options {
+	opts.PresignQuery = params
+	return opts
+}
+
+func (opts *Options) AddPresignHook(hooks ...PresignHook) *Options {
+	opts.PresignHooks = append(opts.PresignHooks, hooks...)
+	return opts
+}
+
+func (opts *Options) AddAPIMiddleware(fn ...func(*middleware.Stack) error) *Options {
+	opts.APIMiddleware = append(opts.APIMiddleware, fn...)
+	return opts
+}
+
 func (opts *Options) SetTransport(transport http.RoundTripper) *Options {
 	opts.Transport = transport
 	return opts
 }
 
+func (opts *Options) SetProxyURL(proxyURL string) *Options {
+	opts.ProxyURL = &proxyURL
+	return opts
+}
+
+func (opts *Options) SetCABundle(pemCerts []byte) *Options {
+	opts.CABundle = pemCerts
+	return opts
+}
+
+func (opts *Options) SetInsecureSkipVerify(insecure bool) *Options {
+	opts.InsecureSkipVerify = &insecure
+	return opts
+}
+
+func (opts *Options) SetAllowInsecureTransport(allow bool) *Options {
+	opts.AllowInsecureTransport = &allow
+	return opts
+}
+
+func (opts *Options) SetMaxIdleConns(maxIdleConns int) *Options {
+	opts.MaxIdleConns = &maxIdleConns
+	return opts
+}
+
+func (opts *Options) SetMaxIdleConnsPerHost(maxIdleConns int) *Options {
+	opts.MaxIdleConnsPerHost = &maxIdleConns
+	return opts
+}
+
+func (opts *Options) SetIdleConnTimeout(timeout time.Duration) *Options {
+	opts.IdleConnTimeout = &timeout
+	return opts
+}
+
+func (opts *Options) SetExpectContinueTimeout(timeout time.Duration) *Options {
+	opts.ExpectContinueTimeout = &timeout
+	return opts
+}
+
+func (opts *Options) SetRequestLogging(enable bool) *Options {
+	opts.RequestLogging = &enable
+	return opts
+}
+
+func (opts *Options) SetUserAgentSuffix(suffix string) *Options {
+	opts.UserAgentSuffix = &suffix
+	return opts
+}
+
+func (opts *Options) SetEnableMetrics(enable bool) *Options {
+	opts.EnableMetrics = &enable
+	return opts
+}
+
+func (opts *Options) SetMetrics(recorder MetricsRecorder) *Options {
+	opts.Metrics = recorder
+	return opts
+}
+
+func (opts *Options) SetCache(size int64, ttl time.Duration) *Options {
+	opts.CacheSize = &size
+	opts.CacheTTL = &ttl
+	return opts
+}
+
+func (opts *Options) SetCacheMaxItemSize(size int64) *Options {
+	opts.CacheMaxItemSize = &size
+	return opts
+}
+
+func (opts *Options) SetEnableTracing(enable bool) *Options {
+	opts.EnableTracing = &enable
+	return opts
+}
+
+func (opts *Options) SetTracer(tracer Tracer) *Options {
+	opts.Tracer = tracer
+	return opts
+}
+
+func (opts *Options) SetPingWrite(enable bool) *Options {
+	opts.PingWrite = &enable
+	return opts
+}
+
+func (opts *Options) SetVerifyIntegrity(enable bool) *Options {
+	opts.VerifyIntegrity = &enable
+	return opts
+}
+
+func (opts *Options) SetRequestPayer(enable bool) *Options {
+	opts.RequestPayer = &enable
+	return opts
+}
+
+func (opts *Options) SetEnableClockSkewCorrection(enable bool) *Options {
+	opts.EnableClockSkewCorrection = &enable
+	return opts
+}
+
 type apiOptions func(*middleware.Stack) error
 
+const gcsHostname = "storage.googleapis.com"
+
+// isGCSEndpoint returns true if the URI points at the Google Cloud Storage
+// S3 compatible API.
+func isGCSEndpoint(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	return host == gcsHostname || strings.HasSuffix(host, "."+gcsHostname)
+}
+
+const awsHostname = "amazonaws.com"
+
+// isAWSEndpoint returns true if the API or the external URI points at a
+// public AWS endpoint. The API defaults to AWS if the URI is not set.
+func (opts *Options) isAWSEndpoint() bool {
+	if opts.URI == nil {
+		return true
+	}
+	for _, uri := range []*string{opts.URI, opts.ExternalURI} {
+		if uri == nil {
+			continue
+		}
+		u, err := url.Parse(*uri)
+		if err != nil {
+			continue
+		}
+		if isAWSHost(u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+func isAWSHost(hostname string) bool {
+	host := strings.TrimSuffix(hostname, ".cn")
+	return host == awsHostname || strings.HasSuffix(host, "."+awsHostname)
+}
+
+// plainHTTP returns true if the requests to the URI are sent unencrypted.
+func (opts *Options) plainHTTP() bool {
+	if opts.URI == nil || !aws.ToBool(opts.AllowInsecureTransport) {
+		return false
+	}
+	u, err := url.Parse(*opts.URI)
+	return err == nil && u.Scheme == "http"
+}
+
 // Google Cloud Storage does not tolerate signing the Accept-Encoding header
-func unsignedHeadersMiddleware(headers []string) apiOptions {
+//
+// The names are canonicalized into a copy, so that the UnsignedHeaders of
+// options shared by concurrently built clients are never modified.
+func unsignedHeadersMiddleware(names []string) apiOptions {
 	signMiddlewareID := (&v4.SignHTTPRequestMiddleware{}).ID()
-	for i := range headers {
-		headers[i] = textproto.CanonicalMIMEHeaderKey(headers[i])
+	headers := make([]string, len(names))
+	for i, name := range names {
+		headers[i] = textproto.CanonicalMIMEHeaderKey(name)
 	}
 	return func(stack *middleware.Stack) error {
 		if _, ok := stack.Finalize.Get("Signing"); !ok {
@@ -245,44 +1601,351 @@ func unsignedHeadersMiddleware(headers []string) apiOptions {
 	}
 }
 
+var errInvalidHeaderValue = errors.New(
+	"must be a non-empty header value without control characters",
+)
+
+func validateHeaderValue(value interface{}) error {
+	headerValue, _ := value.(*string)
+	if headerValue == nil {
+		return nil
+	}
+	if strings.TrimSpace(*headerValue) == "" {
+		return errInvalidHeaderValue
+	}
+	for _, c := range *headerValue {
+		if c < ' ' || c == 0x7F {
+			return errInvalidHeaderValue
+		}
+	}
+	return nil
+}
+
+var errInvalidURL = errors.New("must be an absolute URL")
+
+func validateAbsoluteURL(value interface{}) error {
+	uri, _ := value.(*string)
+	if uri == nil {
+		return nil
+	}
+	u, err := url.Parse(*uri)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return errInvalidURL
+	}
+	return nil
+}
+
+var (
+	errPlainHTTPNotAllowed = errors.New("plain HTTP requires AllowInsecureTransport")
+	errPlainHTTPAWS        = errors.New("plain HTTP is not allowed for AWS endpoints")
+)
+
+func validatePlainHTTP(allow bool) validation.RuleFunc {
+	return func(value interface{}) error {
+		uri, _ := value.(*string)
+		if uri == nil {
+			return nil
+		}
+		u, err := url.Parse(*uri)
+		if err != nil || u.Scheme != "http" {
+			return nil
+		} else if isAWSHost(u.Hostname()) {
+			return errPlainHTTPAWS
+		} else if !allow {
+			return errPlainHTTPNotAllowed
+		}
+		return nil
+	}
+}
+
+var errInvalidProxyURL = errors.New(
+	"must be an absolute URL with scheme http, https or socks5",
+)
+
+func validateProxyURL(value interface{}) error {
+	proxyURL, _ := value.(*string)
+	if proxyURL == nil {
+		return nil
+	}
+	u, err := url.Parse(*proxyURL)
+	if err != nil || u.Host == "" {
+		return errInvalidProxyURL
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return errInvalidProxyURL
+	}
+	return nil
+}
+
+// proxy returns the proxy function for the default transport. The ProxyURL
+// is assumed to be validated.
+func (opts *Options) proxy() func(*http.Request) (*url.URL, error) {
+	if opts.ProxyURL == nil {
+		return http.ProxyFromEnvironment
+	}
+	proxyURL, _ := url.Parse(*opts.ProxyURL)
+	return http.ProxyURL(proxyURL)
+}
+
+var errInvalidCABundle = errors.New("must contain at least one PEM encoded certificate")
+
+func validateCABundle(value interface{}) error {
+	pemCerts, _ := value.([]byte)
+	if len(pemCerts) == 0 {
+		return nil
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(pemCerts) {
+		return errInvalidCABundle
+	}
+	return nil
+}
+
+// rootCAs returns the root pool for the default transport extended with
+// the certificates from the CABundle.
+func (opts *Options) rootCAs() *x509.CertPool {
+	rootCAs := storage.GetRootCAs()
+	if len(opts.CABundle) > 0 {
+		rootCAs.AppendCertsFromPEM(opts.CABundle)
+	}
+	return rootCAs
+}
+
+// transport returns the default transport used if no Transport is set.
+func (opts *Options) transport() *http.Transport {
+	transport := &http.Transport{
+		Proxy: opts.proxy(),
+		TLSClientConfig: &tls.Config{
+			RootCAs: opts.rootCAs(),
+			//nolint:gosec
+			InsecureSkipVerify: aws.ToBool(opts.InsecureSkipVerify),
+		},
+		MaxIdleConns:        DefaultMaxIdleConns,
+		MaxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     DefaultIdleConnTimeout,
+	}
+	if opts.MaxIdleConns != nil {
+		transport.MaxIdleConns = *opts.MaxIdleConns
+	}
+	if opts.MaxIdleConnsPerHost != nil {
+		transport.MaxIdleConnsPerHost = *opts.MaxIdleConnsPerHost
+	}
+	if opts.IdleConnTimeout != nil {
+		transport.IdleConnTimeout = *opts.IdleConnTimeout
+	}
+	if opts.ExpectContinueTimeout != nil {
+		transport.ExpectContinueTimeout = *opts.ExpectContinueTimeout
+	}
+	if opts.plainHTTP() {
+		// No TLS is negotiated with the s3 API.
+		transport.TLSClientConfig = nil
+	}
+	return transport
+}
+
+// metricsRecorder returns the recorder of the operations, or nil if
+// metrics are disabled.
+func (opts *Options) metricsRecorder() MetricsRecorder {
+	if !aws.ToBool(opts.EnableMetrics) {
+		return nil
+	}
+	if opts.Metrics != nil {
+		return opts.Metrics
+	}
+	return DefaultPrometheusRecorder()
+}
+
+// tracer returns the tracer of the operations, or nil if tracing is
+// disabled.
+func (opts *Options) tracer() Tracer {
+	if !aws.ToBool(opts.EnableTracing) {
+		return nil
+	}
+	if opts.Tracer != nil {
+		return opts.Tracer
+	}
+	return DefaultOTelTracer()
+}
+
+func (opts *Options) retryer() aws.Retryer {
+	return retry.NewAdaptiveMode(func(ao *retry.AdaptiveModeOptions) {
+		ao.StandardOptions = append(ao.StandardOptions,
+			func(so *retry.StandardOptions) {
+				if opts.MaxRetries != nil {
+					so.MaxAttempts = *opts.MaxRetries + 1
+				}
+				if opts.RetryMaxBackoff != nil {
+					so.MaxBackoff = *opts.RetryMaxBackoff
+				}
+			},
+		)
+	})
+}
+
 func (opts *Options) toS3Options() (
 	clientOpts func(*s3.Options),
 	presignOpts func(*s3.PresignOptions),
 ) {
+	var (
+		slots chan struct{}
+		// credentialsCache of the client, shared with the presign client.
+		credentialsCache *aws.CredentialsCache
+		// tenantCache of the client, shared with the presign client.
+		tenantCache *tenantCredentials
+		skew        *clockSkew
+		limiter     *rateLimiter
+		discovery   *endpointDiscovery
+		breaker     *circuitBreaker
+	)
+	if opts.MaxConcurrentRequests != nil {
+		slots = make(chan struct{}, *opts.MaxConcurrentRequests)
+	}
+	if opts.UploadRateLimit != nil {
+		limiter = newRateLimiter(*opts.UploadRateLimit)
+	}
+	if opts.DiscoveryURL != nil {
+		discovery = newEndpointDiscovery(opts)
+	}
+	if opts.CircuitBreakerThreshold != nil {
+		breaker = newCircuitBreaker(opts)
+	}
+	if aws.ToBool(opts.EnableClockSkewCorrection) {
+		skew = newClockSkew()
+	}
 	clientOpts = func(s3Opts *s3.Options) {
-		if opts.StaticCredentials != nil {
-			s3Opts.Credentials = *opts.StaticCredentials
-		}
 		if opts.Region != nil {
 			s3Opts.Region = *opts.Region
 		}
-		if len(opts.UnsignedHeaders) > 0 {
+		unsignedHeaders := opts.UnsignedHeaders
+		if len(opts.SSECustomerKey) > 0 && opts.isGCS() {
+			unsignedHeaders = append(
+				append([]string{}, unsignedHeaders...),
+				sseCustomerHeaders...,
+			)
+		}
+		if aws.ToBool(opts.CompressOnUpload) && opts.isGCS() {
+			// GCS does not tolerate signing the Accept-Encoding header,
+			// which decides whether gzip encoded objects are decoded;
+			// also for GCS endpoints detected from the URI only.
+			unsignedHeaders = mergeHeaderNames(
+				unsignedHeaders, []string{"Accept-Encoding"},
+			)
+		}
+		if len(unsignedHeaders) > 0 {
 			s3Opts.APIOptions = append(
 				s3Opts.APIOptions,
-				unsignedHeadersMiddleware(opts.UnsignedHeaders),
+				unsignedHeadersMiddleware(unsignedHeaders),
 			)
 		}
+		if aws.ToBool(opts.RequestPayer) {
+			s3Opts.APIOptions = append(s3Opts.APIOptions, requestPayerMiddleware)
+		}
+		if opts.ACL != nil {
+			s3Opts.APIOptions = append(s3Opts.APIOptions,
+				aclMiddleware(types.ObjectCannedACL(*opts.ACL)))
+		}
+		if opts.ExpectContinueTimeout != nil {
+			s3Opts.APIOptions = append(s3Opts.APIOptions, expectContinueMiddleware)
+		}
+		s3Opts.APIOptions = append(s3Opts.APIOptions, putConditionMiddleware)
+		if len(opts.PresignQuery) > 0 {
+			s3Opts.APIOptions = append(s3Opts.APIOptions,
+				presignQueryMiddleware(opts.PresignQuery))
+		}
+		if opts.UserAgentSuffix != nil {
+			s3Opts.APIOptions = append(s3Opts.APIOptions,
+				awsmiddleware.AddUserAgentKey(*opts.UserAgentSuffix))
+		}
+		s3Opts.APIOptions = append(s3Opts.APIOptions, opts.APIMiddleware...)
+		if aws.ToBool(opts.RequestLogging) {
+			s3Opts.APIOptions = append(s3Opts.APIOptions, requestLoggingMiddleware)
+		}
+		if recorder := opts.metricsRecorder(); recorder != nil {
+			s3Opts.APIOptions = append(s3Opts.APIOptions, metricsMiddleware(recorder))
+		}
+		if tracer := opts.tracer(); tracer != nil {
+			s3Opts.APIOptions = append(s3Opts.APIOptions, tracingMiddleware(tracer))
+		}
+		if slots != nil {
+			s3Opts.APIOptions = append(s3Opts.APIOptions, concurrencyLimitMiddleware(slots))
+		}
+		if breaker != nil {
+			// Added after the concurrency limit, so that operations do not
+			// wait for a slot only to fail fast.
+			s3Opts.APIOptions = append(s3Opts.APIOptions, circuitBreakerMiddleware(breaker))
+		}
+		if limiter != nil {
+			s3Opts.APIOptions = append(s3Opts.APIOptions, uploadRateLimitMiddleware(limiter))
+		}
 		if opts.URI != nil {
-			endpointURI := *opts.URI
-			s3Opts.EndpointResolver = s3.EndpointResolverFromURL(endpointURI,
-				func(ep *aws.Endpoint) {
-					ep.HostnameImmutable = opts.ForcePathStyle
-				},
+			s3Opts.EndpointResolver = endpointResolver(*opts.URI,
+				aws.ToBool(opts.ForcePathStyle),
+				aws.ToString(opts.SigningRegion),
 			)
 		}
+		if discovery != nil {
+			s3Opts.EndpointResolver = discovery
+			s3Opts.APIOptions = append(s3Opts.APIOptions, discoveryMiddleware(discovery))
+		}
 		roundTripper := opts.Transport
 		if roundTripper == nil {
-			roundTripper = &http.Transport{
-				TLSClientConfig: &tls.Config{
-					RootCAs: storage.GetRootCAs(),
-				},
-			}
+			roundTripper = opts.transport()
 		}
-		s3Opts.UsePathStyle = opts.ForcePathStyle
-		s3Opts.UseAccelerate = opts.UseAccelerate
-		s3Opts.HTTPClient = &http.Client{
+		if opts.MaxRetries != nil || opts.RetryMaxBackoff != nil {
+			s3Opts.Retryer = opts.retryer()
+		}
+		s3Opts.UsePathStyle = aws.ToBool(opts.ForcePathStyle)
+		s3Opts.UseAccelerate = aws.ToBool(opts.UseAccelerate)
+		if aws.ToBool(opts.UseDualStack) && opts.URI == nil {
+			s3Opts.EndpointOptions.UseDualStackEndpoint = aws.DualStackEndpointStateEnabled
+		}
+		httpClient := &http.Client{
 			Transport: roundTripper,
 		}
+		if opts.OperationTimeout != nil {
+			httpClient.Timeout = *opts.OperationTimeout
+		}
+		s3Opts.HTTPClient = httpClient
+		if discovery != nil {
+			discovery.client = httpClient
+		}
+		if opts.isSignatureVersion2() {
+			s3Opts.HTTPSignerV4 = sigV2Signer{}
+			s3Opts.APIOptions = append(s3Opts.APIOptions, sigV2ResourceMiddleware)
+		}
+		if skew != nil {
+			skew.client = httpClient
+			s3Opts.HTTPSignerV4 = clockSkewSigner{
+				HTTPSignerV4: s3Opts.HTTPSignerV4,
+				skew:         skew,
+			}
+			s3Opts.APIOptions = append(s3Opts.APIOptions, clockSkewMiddleware(skew))
+		}
+		s3Opts.Credentials = opts.credentialsProvider(s3Opts)
+		if opts.AssumeRoleARN != nil {
+			s3Opts.Credentials = opts.assumeRoleProvider(s3Opts)
+		}
+		s3Opts.Credentials = cachedCredentials(s3Opts.Credentials)
+		if cache, ok := s3Opts.Credentials.(*aws.CredentialsCache); ok {
+			credentialsCache = cache
+			s3Opts.APIOptions = append(
+				s3Opts.APIOptions,
+				refreshCredentialsMiddleware(cache),
+			)
+		}
+		if opts.CredentialsResolver != nil {
+			if tenantCache == nil {
+				ttl := DefaultCredentialsCacheTTL
+				if opts.CredentialsCacheTTL != nil {
+					ttl = *opts.CredentialsCacheTTL
+				}
+				tenantCache = newTenantCredentials(
+					opts.CredentialsResolver, s3Opts.Credentials, ttl,
+				)
+			}
+			s3Opts.Credentials = tenantCache
+		}
 	}
 
 	expires := DefaultExpire
@@ -291,12 +1954,36 @@ func (opts *Options) toS3Options() (
 	}
 	presignOpts = func(s3Opts *s3.PresignOptions) {
 		s3.WithPresignExpires(expires)(s3Opts)
+		if opts.isSignatureVersion2() {
+			s3Opts.Presigner = sigV2Signer{}
+		}
+		if skew != nil {
+			presigner := s3Opts.Presigner
+			if presigner == nil {
+				presigner = v4.NewSigner(func(so *v4.SignerOptions) {
+					so.DisableURIPathEscaping = true
+				})
+			}
+			s3Opts.Presigner = clockSkewPresigner{
+				HTTPPresignerV4: presigner,
+				skew:            skew,
+			}
+		}
+		if opts.MinPresignCredTTL != nil {
+			s3.WithPresignClientFromClientOptions(func(o *s3.Options) {
+				o.Credentials = minTTLCredentials{
+					CredentialsProvider: o.Credentials,
+					minTTL:              *opts.MinPresignCredTTL,
+					cache: func() *aws.CredentialsCache {
+						return credentialsCache
+					},
+				}
+			})(s3Opts)
+		}
 		if opts.ExternalURI != nil {
-			presignURL := *opts.ExternalURI
-			resolver := s3.EndpointResolverFromURL(presignURL,
-				func(ep *aws.Endpoint) {
-					ep.HostnameImmutable = opts.ForcePathStyle
-				},
+			resolver := endpointResolver(*opts.ExternalURI,
+				aws.ToBool(opts.ForcePathStyle),
+				aws.ToString(opts.SigningRegion),
 			)
 			s3.WithPresignClientFromClientOptions(
 				s3.WithEndpointResolver(resolver),
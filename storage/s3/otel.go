@@ -0,0 +1,84 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const otelInstrumentationName = "github.com/mendersoftware/deployments/storage/s3"
+
+// NewOTelTracer adapts the OpenTelemetry TracerProvider to a Tracer. The
+// spans are client spans and children of the span in the context of the
+// operation, e.g. the span of the incoming request.
+func NewOTelTracer(provider trace.TracerProvider) Tracer {
+	return otelTracer{tracer: provider.Tracer(otelInstrumentationName)}
+}
+
+// DefaultOTelTracer returns the Tracer of the global OpenTelemetry
+// TracerProvider (otel.SetTracerProvider). It is used if EnableTracing is
+// set without a Tracer.
+func DefaultOTelTracer() Tracer {
+	return NewOTelTracer(otel.GetTracerProvider())
+}
+
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+func (t otelTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	return ctx, otelSpan{span: span}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s otelSpan) SetAttribute(key string, value interface{}) {
+	var attr attribute.KeyValue
+	switch v := value.(type) {
+	case string:
+		attr = attribute.String(key, v)
+	case bool:
+		attr = attribute.Bool(key, v)
+	case int:
+		attr = attribute.Int(key, v)
+	case int32:
+		attr = attribute.Int64(key, int64(v))
+	case int64:
+		attr = attribute.Int64(key, v)
+	case float64:
+		attr = attribute.Float64(key, v)
+	default:
+		attr = attribute.String(key, fmt.Sprint(v))
+	}
+	s.span.SetAttributes(attr)
+}
+
+func (s otelSpan) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s otelSpan) End() {
+	s.span.End()
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsHttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/google/uuid"
+)
+
+const (
+	pingTimeout = 5 * time.Second
+	// pingObjectPrefix is the key prefix of the objects written by Ping.
+	pingObjectPrefix = ".ping/"
+)
+
+var (
+	ErrPingUnauthorized   = errors.New("s3: not authorized to access the bucket")
+	ErrPingBucketNotFound = errors.New("s3: bucket does not exist")
+	ErrPingUnreachable    = errors.New("s3: storage endpoint unreachable")
+)
+
+// PingError is the error returned by Ping. Use errors.Is with one of the
+// ErrPing* errors to determine the cause, if known.
+type PingError struct {
+	// Kind is one of ErrPingUnauthorized, ErrPingBucketNotFound or
+	// ErrPingUnreachable, or nil if the error is not classified.
+	Kind error
+	Op   string
+	Err  error
+}
+
+func (err *PingError) Error() string {
+	if err.Kind != nil {
+		return err.Kind.Error() + ": " + err.Op + ": " + err.Err.Error()
+	}
+	return "s3: " + err.Op + ": " + err.Err.Error()
+}
+
+func (err *PingError) Unwrap() error {
+	return err.Err
+}
+
+func (err *PingError) Is(target error) bool {
+	return err.Kind != nil && target == err.Kind
+}
+
+func newPingError(op string, err error) error {
+	pingErr := &PingError{Op: op, Err: err}
+	var (
+		sendErr *smithyhttp.RequestSendError
+		rspErr  *awsHttp.ResponseError
+	)
+	switch {
+	case errors.As(err, &sendErr), errors.Is(err, context.DeadlineExceeded):
+		pingErr.Kind = ErrPingUnreachable
+	case errors.As(err, &rspErr):
+		switch rspErr.HTTPStatusCode() {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			pingErr.Kind = ErrPingUnauthorized
+		case http.StatusNotFound:
+			pingErr.Kind = ErrPingBucketNotFound
+		}
+	}
+	return pingErr
+}
+
+// Ping checks that the bucket is reachable and accessible using HeadBucket.
+// If the PingWrite option is set, Ping also verifies that the bucket is
+// writable by uploading and deleting a small object. Ping gives up after
+// 5 seconds, or earlier if ctx expires. The returned error is a *PingError.
+func (s *SimpleStorageService) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	bucket, opts, err := s.optionsFromContext(ctx, false)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(bucket),
+	}, opts)
+	if err != nil {
+		return newPingError("HeadBucket", err)
+	}
+	if !s.pingWrite {
+		return nil
+	}
+	key := s.objectKey(path.Join(pingObjectPrefix, uuid.NewString()))
+	putParams := &s3.PutObjectInput{
+		Bucket:        aws.String(bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader([]byte("ping")),
+		ContentLength: 4,
+
+		ServerSideEncryption: s.sseAlgorithm,
+		SSEKMSKeyId:          s.sseKMSKeyID,
+	}
+	putParams.SSECustomerAlgorithm,
+		putParams.SSECustomerKey,
+		putParams.SSECustomerKeyMD5 = s.sseCustomerKey.params()
+	_, err = s.client.PutObject(ctx, putParams, opts)
+	if err != nil {
+		return newPingError("PutObject", err)
+	}
+	_, err = s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, opts)
+	if err != nil {
+		return newPingError("DeleteObject", err)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/storage"
+)
+
+const (
+	postPolicyAlgorithm  = "AWS4-HMAC-SHA256"
+	postPolicyService    = "s3"
+	postPolicyTerminator = "aws4_request"
+	postPolicyFilename   = "${filename}"
+)
+
+var ErrPostPolicySSECustomerKey = errors.New(
+	"s3: presigned POST is not supported with customer-provided encryption keys",
+)
+
+type postPolicy struct {
+	Expiration string        `json:"expiration"`
+	Conditions []interface{} `json:"conditions"`
+}
+
+func deriveSigningKey(secret, date, region string) []byte {
+	hmacSHA256 := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		_, _ = h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, postPolicyService)
+	return hmacSHA256(key, postPolicyTerminator)
+}
+
+// postEndpoint resolves the bucket URL for presigned POST requests and the
+// credentials and region used for signing the policy.
+func (s *SimpleStorageService) postEndpoint(
+	ctx context.Context,
+	bucket string,
+	opts func(*s3.Options),
+) (endpoint string, credentials aws.Credentials, region string, err error) {
+	var provider aws.CredentialsProvider
+	req, err := s.presignClient.PresignHeadBucket(ctx,
+		&s3.HeadBucketInput{Bucket: aws.String(bucket)},
+		s3.WithPresignClientFromClientOptions(opts, func(o *s3.Options) {
+			provider = o.Credentials
+			region = o.Region
+		}),
+	)
+	if err != nil {
+		return "", credentials, "", err
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return "", credentials, "", err
+	}
+	u.RawQuery = ""
+	if provider == nil {
+		return "", credentials, "", errors.New("s3: no credentials configured")
+	}
+	credentials, err = provider.Retrieve(ctx)
+	return u.String(), credentials, region, err
+}
+
+// PostRequest generates a presigned HTML form (POST) upload for keys with
+// the given prefix. The policy restricts the upload to the same size as
+// PutObject: PartSize * 10000 bytes; note that S3 limits POST uploads to
+// 5GB regardless. If expireAfter is zero, the DefaultExpire is used.
+func (s *SimpleStorageService) PostRequest(
+	ctx context.Context,
+	keyPrefix string,
+	expireAfter time.Duration,
+) (*model.PostLink, error) {
+	if s.sseCustomerKey != nil {
+		return nil, ErrPostPolicySSECustomerKey
+	}
+	if _, ok := storage.ResponseHeadersFromContext(ctx); ok {
+		return nil, storage.ErrResponseHeadersNotGET
+	}
+	expireAfter, err := s.presignExpire(expireAfter)
+	if err != nil {
+		return nil, err
+	}
+	keyPrefix = s.objectKey(keyPrefix)
+	bucket, opts, err := s.optionsFromContext(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	endpoint, creds, region, err := s.postEndpoint(ctx, bucket, opts)
+	if err != nil {
+		return nil, errors.WithMessage(err, "s3: failed to presign POST request")
+	}
+
+	signDate := time.Now().UTC()
+	shortDate := signDate.Format("20060102")
+	credential := strings.Join([]string{
+		creds.AccessKeyID, shortDate, region,
+		postPolicyService, postPolicyTerminator,
+	}, "/")
+
+	fields := map[string]string{
+		"key":              keyPrefix + postPolicyFilename,
+		"x-amz-algorithm":  postPolicyAlgorithm,
+		"x-amz-credential": credential,
+		"x-amz-date":       signDate.Format(paramAmzDateFormat),
+	}
+	if creds.SessionToken != "" {
+		fields["x-amz-security-token"] = creds.SessionToken
+	}
+	if s.contentType != nil {
+		fields["Content-Type"] = *s.contentType
+	}
+	if s.cacheControl != nil {
+		fields["Cache-Control"] = *s.cacheControl
+	}
+	if s.contentEncoding != nil {
+		fields["Content-Encoding"] = *s.contentEncoding
+	}
+	if s.sseAlgorithm != "" {
+		fields["x-amz-server-side-encryption"] = string(s.sseAlgorithm)
+	}
+	if s.sseKMSKeyID != nil {
+		fields["x-amz-server-side-encryption-aws-kms-key-id"] = *s.sseKMSKeyID
+	}
+	if s.storageClass != "" {
+		fields["x-amz-storage-class"] = string(s.storageClass)
+	}
+
+	conditions := []interface{}{
+		map[string]string{"bucket": bucket},
+		[]interface{}{"starts-with", "$key", keyPrefix},
+		[]interface{}{"content-length-range", 0,
+			int64(s.partSize) * MultipartMaxParts},
+	}
+	for key, value := range fields {
+		if key == "key" {
+			continue
+		}
+		conditions = append(conditions, map[string]string{key: value})
+	}
+	policy, err := json.Marshal(postPolicy{
+		Expiration: signDate.Add(expireAfter).Format(time.RFC3339),
+		Conditions: conditions,
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "s3: failed to encode POST policy")
+	}
+	encodedPolicy := base64.StdEncoding.EncodeToString(policy)
+	signature := hmac.New(sha256.New,
+		deriveSigningKey(creds.SecretAccessKey, shortDate, region))
+	_, _ = signature.Write([]byte(encodedPolicy))
+
+	fields["policy"] = encodedPolicy
+	fields["x-amz-signature"] = hex.EncodeToString(signature.Sum(nil))
+
+	return &model.PostLink{
+		Uri:    endpoint,
+		Expire: signDate.Add(expireAfter),
+		Method: http.MethodPost,
+		Fields: fields,
+	}, nil
+}
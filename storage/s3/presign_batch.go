@@ -0,0 +1,91 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+// PresignBatchConcurrency is the number of links PresignBatch signs
+// concurrently.
+const PresignBatchConcurrency = 16
+
+// PresignBatchResult lists the outcome of PresignBatch per object path.
+type PresignBatchResult struct {
+	Links  map[string]*model.Link
+	Errors map[string]error
+}
+
+// PresignBatch presigns GET requests for the objects at paths, like
+// GetRequest without a filename, using up to PresignBatchConcurrency
+// workers; besides signing, every link requires a HEAD request checking
+// that the object exists. The paths that could not be presigned, e.g. since the object
+// does not exist, are listed in the result's Errors; the returned error is
+// only set if the batch fails as a whole, e.g. for an invalid expire.
+func (s *SimpleStorageService) PresignBatch(
+	ctx context.Context,
+	paths []string,
+	expire time.Duration,
+) (*PresignBatchResult, error) {
+	if _, err := s.presignExpire(expire); err != nil {
+		return nil, err
+	}
+	if _, _, err := s.optionsFromContext(ctx, true); err != nil {
+		return nil, err
+	}
+	result := &PresignBatchResult{
+		Links:  make(map[string]*model.Link, len(paths)),
+		Errors: make(map[string]error),
+	}
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		pending = make(chan string)
+	)
+	workers := PresignBatchConcurrency
+	if len(paths) < workers {
+		workers = len(paths)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range pending {
+				link, err := s.GetRequest(ctx, path, "", expire)
+				mu.Lock()
+				if err != nil {
+					result.Errors[path] = err
+				} else {
+					result.Links[path] = link
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	seen := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		if _, ok := seen[path]; !ok {
+			seen[path] = struct{}{}
+			pending <- path
+		}
+	}
+	close(pending)
+	wg.Wait()
+	return result, nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/storage"
+)
+
+const headerContentType = "Content-Type"
+
+var ErrPresignExpireTooLong = errors.New(
+	"s3: presigned requests cannot be valid for more than 7 days",
+)
+
+// PresignPut returns a presigned PUT request for uploading an object
+// directly to the bucket. The content type is part of the signature, so the
+// upload must be sent with the headers of the returned link; if contentType
+// is empty, the configured ContentType is used. If expire is zero, the
+// DefaultExpire is used; negative expiry or expiry beyond ExpireMaxLimit is
+// rejected.
+func (s *SimpleStorageService) PresignPut(
+	ctx context.Context,
+	path string,
+	expire time.Duration,
+	contentType string,
+) (*model.Link, error) {
+	if _, ok := storage.ResponseHeadersFromContext(ctx); ok {
+		return nil, storage.ErrResponseHeadersNotGET
+	}
+	if expire > ExpireMaxLimit {
+		return nil, ErrPresignExpireTooLong
+	}
+	expire, err := s.presignExpire(expire)
+	if err != nil {
+		return nil, err
+	}
+	typ := s.contentType
+	if contentType != "" {
+		if err := validateHeaderValue(&contentType); err != nil {
+			return nil, errors.WithMessage(err, "s3: invalid content type")
+		}
+		typ = &contentType
+	}
+	return s.presignPut(ctx, path, expire, typ)
+}
+
+// keepContentTypeHeader removes the middleware dropping the Content-Type
+// header from presigned PUT requests (the request has no body when signing),
+// so the content type is included in the signature.
+func keepContentTypeHeader(stack *middleware.Stack) error {
+	_, err := stack.Build.Remove("RemoveContentTypeHeader")
+	return err
+}
+
+func (s *SimpleStorageService) presignPut(
+	ctx context.Context,
+	path string,
+	expireAfter time.Duration,
+	contentType *string,
+) (*model.Link, error) {
+	bucket, opts, err := s.optionsFromContext(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	params := &s3.PutObjectInput{
+		// Required
+		Bucket: aws.String(bucket),
+		Key:    aws.String(s.objectKey(path)),
+
+		ContentType: contentType,
+	}
+	params.SSECustomerAlgorithm,
+		params.SSECustomerKey,
+		params.SSECustomerKeyMD5 = s.sseCustomerKey.params()
+
+	clientOpts := []func(*s3.Options){opts}
+	if contentType != nil {
+		clientOpts = append(clientOpts, func(o *s3.Options) {
+			o.APIOptions = append(o.APIOptions, keepContentTypeHeader)
+		})
+	}
+	signDate := time.Now()
+	req, err := s.presignClient.PresignPutObject(
+		ctx,
+		params,
+		s3.WithPresignExpires(expireAfter),
+		s3.WithPresignClientFromClientOptions(clientOpts...),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if date, err := time.Parse(
+		req.SignedHeader.Get(paramAmzDate), paramAmzDateFormat,
+	); err == nil {
+		signDate = date
+	}
+
+	header := s.sseCustomerKey.headers()
+	if contentType != nil {
+		if header == nil {
+			header = make(map[string]string, 1)
+		}
+		header[headerContentType] = *contentType
+	}
+	return s.presigned(ctx, path, &model.Link{
+		Uri:    req.URL,
+		Expire: signDate.Add(expireAfter),
+		Method: http.MethodPut,
+		Header: header,
+	})
+}
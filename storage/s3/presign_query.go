@@ -0,0 +1,91 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+var errPresignQueryEmptyKey = errors.New("query parameter names cannot be empty")
+
+// PresignHook is called with every presigned GET, PUT and DELETE link
+// before it is returned, for instance to append the token of a CDN in
+// front of the bucket to the URL. Hooks run in order, so a hook may sign
+// the URL including the parameters added by the previous hooks.
+//
+// The link is signed before the hooks run, and the SigV4 signature covers
+// all query parameters: S3 rejects requests with parameters added by a
+// hook, so the CDN must remove them before forwarding the request to the
+// bucket. Parameters the bucket must receive belong in PresignQuery.
+type PresignHook func(ctx context.Context, objectPath string, link *model.Link) error
+
+func validatePresignQuery(value interface{}) error {
+	params, _ := value.(map[string]string)
+	for name := range params {
+		if name == "" {
+			return errPresignQueryEmptyKey
+		} else if strings.HasPrefix(strings.ToLower(name), "x-amz-") {
+			return fmt.Errorf("query parameter %q is reserved for the signature", name)
+		}
+	}
+	return nil
+}
+
+// presignQueryMiddleware adds the query parameters to presigned requests
+// before they are signed.
+func presignQueryMiddleware(params map[string]string) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		if _, presign := stack.Finalize.Get(presignMiddlewareID); !presign {
+			return nil
+		}
+		return stack.Build.Add(middleware.BuildMiddlewareFunc(
+			"PresignQuery", func(
+				ctx context.Context,
+				in middleware.BuildInput,
+				next middleware.BuildHandler,
+			) (middleware.BuildOutput, middleware.Metadata, error) {
+				if req, ok := in.Request.(*smithyhttp.Request); ok {
+					q := req.URL.Query()
+					for name, value := range params {
+						q.Set(name, value)
+					}
+					req.URL.RawQuery = q.Encode()
+				}
+				return next.HandleBuild(ctx, in)
+			}), middleware.After)
+	}
+}
+
+// presigned runs the PresignHooks on the link.
+func (s *SimpleStorageService) presigned(
+	ctx context.Context,
+	objectPath string,
+	link *model.Link,
+) (*model.Link, error) {
+	for _, hook := range s.presignHooks {
+		if err := hook(ctx, objectPath, link); err != nil {
+			return nil, fmt.Errorf("s3: presign hook failed: %w", err)
+		}
+	}
+	return link, nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "deployments_s3"
+
+// PrometheusRecorder is a MetricsRecorder and CacheMetricsRecorder exporting
+// the metrics of the s3 operations to Prometheus:
+//
+//   - deployments_s3_operation_duration_seconds: histogram of the duration
+//     of the operations labeled by operation and status_class.
+//   - deployments_s3_operation_errors_total: counter of the failed
+//     operations (status class 4xx, 5xx or error) labeled by operation and
+//     status_class. Not modified responses (3xx) of revalidated cache hits
+//     are not errors.
+//   - deployments_s3_cache_requests_total: counter of the object cache
+//     lookups labeled by operation and result ("hit" or "miss").
+//
+// Presign operations are local and have the "presign" status class and the
+// "Presign" operation prefix, so they are never mixed up with the network
+// operations. The recorder is a prometheus.Collector and must be registered.
+type PrometheusRecorder struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+	cache    *prometheus.CounterVec
+}
+
+// NewPrometheusRecorder initializes a PrometheusRecorder.
+func NewPrometheusRecorder() *PrometheusRecorder {
+	return &PrometheusRecorder{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of the s3 operations, including retries.",
+			// 0.5ms (presign) up to ~65s (multipart uploads).
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 18),
+		}, []string{"operation", "status_class"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "operation_errors_total",
+			Help:      "Number of failed s3 operations.",
+		}, []string{"operation", "status_class"}),
+		cache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_requests_total",
+			Help:      "Number of lookups in the s3 object cache.",
+		}, []string{"operation", "result"}),
+	}
+}
+
+var (
+	defaultRecorder     *PrometheusRecorder
+	defaultRecorderOnce sync.Once
+)
+
+// DefaultPrometheusRecorder returns the PrometheusRecorder registered with
+// the prometheus.DefaultRegisterer. It is used if EnableMetrics is set
+// without a Metrics recorder.
+func DefaultPrometheusRecorder() *PrometheusRecorder {
+	defaultRecorderOnce.Do(func() {
+		defaultRecorder = NewPrometheusRecorder()
+		prometheus.MustRegister(defaultRecorder)
+	})
+	return defaultRecorder
+}
+
+func (r *PrometheusRecorder) ObserveOperation(
+	operation, statusClass string,
+	duration time.Duration,
+) {
+	r.duration.WithLabelValues(operation, statusClass).
+		Observe(duration.Seconds())
+	switch statusClass {
+	case "4xx", "5xx", StatusClassError:
+		r.errors.WithLabelValues(operation, statusClass).Inc()
+	}
+}
+
+func (r *PrometheusRecorder) ObserveCache(operation string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	r.cache.WithLabelValues(operation, result).Inc()
+}
+
+// Describe implements prometheus.Collector.
+func (r *PrometheusRecorder) Describe(ch chan<- *prometheus.Desc) {
+	r.duration.Describe(ch)
+	r.errors.Describe(ch)
+	r.cache.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (r *PrometheusRecorder) Collect(ch chan<- prometheus.Metric) {
+	r.duration.Collect(ch)
+	r.errors.Collect(ch)
+	r.cache.Collect(ch)
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Providers of S3 compatible APIs with known quirks.
+const (
+	ProviderAWS   = "AWS"
+	ProviderGCS   = "GCS"
+	ProviderMinIO = "MinIO"
+)
+
+const (
+	gcsURI    = "https://" + gcsHostname
+	gcsRegion = "auto"
+)
+
+var errInvalidProvider = errors.New("must be one of AWS, GCS or MinIO")
+
+func validateProvider(value interface{}) error {
+	provider, _ := value.(*string)
+	if provider == nil {
+		return nil
+	}
+	for _, name := range []string{ProviderAWS, ProviderGCS, ProviderMinIO} {
+		if strings.EqualFold(*provider, name) {
+			return nil
+		}
+	}
+	return errInvalidProvider
+}
+
+// isProvider returns true if the Provider is set to name (case insensitive).
+func (opts *Options) isProvider(name string) bool {
+	return opts.Provider != nil && strings.EqualFold(*opts.Provider, name)
+}
+
+// isGCS returns true if the API is Google Cloud Storage, either configured
+// explicitly with the Provider or detected from the URI.
+func (opts *Options) isGCS() bool {
+	return opts.isProvider(ProviderGCS) ||
+		(opts.URI != nil && isGCSEndpoint(*opts.URI))
+}
+
+// applyProvider sets the options required by the Provider (see
+// Options.Provider) unless they are set explicitly.
+func (opts *Options) applyProvider() {
+	switch {
+	case opts.isProvider(ProviderGCS):
+		if opts.URI == nil {
+			uri := gcsURI
+			opts.URI = &uri
+		}
+		if opts.Region == nil {
+			region := gcsRegion
+			opts.Region = &region
+		}
+		if opts.ForcePathStyle == nil {
+			opts.ForcePathStyle = aws.Bool(true)
+		}
+		opts.UnsignedHeaders = mergeHeaderNames(
+			opts.UnsignedHeaders, []string{"Accept-Encoding"},
+		)
+	case opts.isProvider(ProviderMinIO):
+		if opts.ForcePathStyle == nil {
+			opts.ForcePathStyle = aws.Bool(true)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// replicationPollInterval is the initial interval between the polls of
+// WaitForReplication; it doubles up to waitMaxPollInterval.
+const replicationPollInterval = time.Second
+
+// ReplicationStatusCompleted is the status S3 reports for objects replicated
+// to all destinations of a rule with multiple destinations; with a single
+// destination it reports types.ReplicationStatusComplete.
+const ReplicationStatusCompleted types.ReplicationStatus = "COMPLETED"
+
+var (
+	ErrReplicationFailed = errors.New("s3: object replication failed")
+	ErrNotReplicated     = errors.New("s3: object is not replicated")
+)
+
+// ReplicationStatus returns the replication status of the object at path
+// (the x-amz-replication-status header): PENDING, COMPLETE (or COMPLETED)
+// or FAILED for objects in a bucket with a replication rule applying to
+// them, REPLICA for the copies in the destination bucket and an empty
+// status for objects that are not replicated.
+func (s *SimpleStorageService) ReplicationStatus(
+	ctx context.Context,
+	path string,
+) (types.ReplicationStatus, error) {
+	_, rsp, err := s.headObject(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	return rsp.ReplicationStatus, nil
+}
+
+// WaitForReplication polls the replication status of the object at path
+// until the object is replicated, e.g. before considering an artifact
+// available to devices in all regions. The interval between the polls
+// starts at one second and doubles up to 30 seconds; use a context with a
+// timeout to bound the wait, the context error is returned once it is
+// done.
+//
+// ErrReplicationFailed is returned if S3 failed to replicate the object
+// and ErrNotReplicated if no replication rule applies to it. Replicas
+// (status REPLICA) are considered replicated.
+func (s *SimpleStorageService) WaitForReplication(ctx context.Context, path string) error {
+	backoff := s.replicationPollInterval
+	for {
+		status, err := s.ReplicationStatus(ctx, path)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			return err
+		}
+		switch status {
+		case types.ReplicationStatusComplete,
+			ReplicationStatusCompleted,
+			types.ReplicationStatusReplica:
+			return nil
+		case types.ReplicationStatusFailed:
+			return fmt.Errorf("%w: %s", ErrReplicationFailed, path)
+		case "":
+			return fmt.Errorf("%w: %s", ErrNotReplicated, path)
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		if backoff *= 2; backoff > waitMaxPollInterval {
+			backoff = waitMaxPollInterval
+		}
+	}
+}
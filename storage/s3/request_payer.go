@@ -0,0 +1,67 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+const (
+	headerRequestPayer = "X-Amz-Request-Payer"
+	paramRequestPayer  = "x-amz-request-payer"
+	requestPayer       = "requester"
+)
+
+// requestPayerOperations are the read and delete operations sent with the
+// request payer for Requester Pays buckets.
+var requestPayerOperations = map[string]struct{}{
+	"GetObject":     {},
+	"HeadObject":    {},
+	"ListObjects":   {},
+	"ListObjectsV2": {},
+	"DeleteObject":  {},
+	"DeleteObjects": {},
+}
+
+// requestPayerMiddleware acknowledges that the requester is charged for
+// read and delete operations on Requester Pays buckets. Presigned requests carry the
+// request payer in the query, since the devices following the links do not
+// send any extra headers.
+func requestPayerMiddleware(stack *middleware.Stack) error {
+	_, presign := stack.Finalize.Get(presignMiddlewareID)
+	return stack.Build.Add(middleware.BuildMiddlewareFunc(
+		"RequestPayer", func(
+			ctx context.Context,
+			in middleware.BuildInput,
+			next middleware.BuildHandler,
+		) (middleware.BuildOutput, middleware.Metadata, error) {
+			_, read := requestPayerOperations[awsmiddleware.GetOperationName(ctx)]
+			if req, ok := in.Request.(*smithyhttp.Request); ok && read {
+				if presign {
+					req.Header.Del(headerRequestPayer)
+					q := req.URL.Query()
+					q.Set(paramRequestPayer, requestPayer)
+					req.URL.RawQuery = q.Encode()
+				} else {
+					req.Header.Set(headerRequestPayer, requestPayer)
+				}
+			}
+			return next.HandleBuild(ctx, in)
+		}), middleware.After)
+}
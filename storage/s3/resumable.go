@@ -0,0 +1,175 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+// UploadStore persists the state of multipart uploads for ResumableUploads.
+type UploadStore interface {
+	InsertMultipartUpload(ctx context.Context, upload *model.MultipartUpload) error
+	AddMultipartUploadPart(
+		ctx context.Context,
+		uploadID string,
+		part model.MultipartUploadPart,
+	) error
+	// FindMultipartUpload returns nil if the object has no upload.
+	FindMultipartUpload(ctx context.Context, bucket, key string) (*model.MultipartUpload, error)
+	DeleteMultipartUpload(ctx context.Context, uploadID string) error
+}
+
+func isNoSuchUpload(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchUpload"
+}
+
+// keepForResume returns true if the multipart upload failing with err can
+// be resumed by uploading the object again. Uploads with corrupted or too
+// many parts are aborted.
+func keepForResume(err error) bool {
+	return !errors.Is(err, ErrTooManyParts) &&
+		!errors.Is(mapError(err), ErrIntegrityMismatch) &&
+		!isNoSuchUpload(err)
+}
+
+// resumeMultipart returns the recorded multipart upload of the object and
+// the parts S3 lists for it, or a nil upload if there is none to resume.
+// Uploads that no longer exist, e.g. aborted by CleanupAbandonedUploads,
+// are forgotten and the object is uploaded from scratch.
+func (s *SimpleStorageService) resumeMultipart(
+	ctx context.Context,
+	bucket, key string,
+	opts func(*s3.Options),
+) (*model.MultipartUpload, map[int32]types.Part, error) {
+	upload, err := s.uploads.FindMultipartUpload(ctx, bucket, key)
+	if err != nil || upload == nil {
+		return nil, nil, err
+	}
+	params := &s3.ListPartsInput{
+		Bucket:   &bucket,
+		Key:      &key,
+		UploadId: &upload.UploadID,
+	}
+	params.SSECustomerAlgorithm,
+		params.SSECustomerKey,
+		params.SSECustomerKeyMD5 = s.sseCustomerKey.params()
+	parts := make(map[int32]types.Part)
+	for {
+		rsp, err := s.client.ListParts(ctx, params, opts)
+		if isNoSuchUpload(err) {
+			return nil, nil, s.uploads.DeleteMultipartUpload(ctx, upload.UploadID)
+		} else if err != nil {
+			return nil, nil, err
+		}
+		for _, part := range rsp.Parts {
+			parts[part.PartNumber] = part
+		}
+		if !rsp.IsTruncated {
+			break
+		}
+		params.PartNumberMarker = rsp.NextPartNumberMarker
+	}
+	return upload, parts, nil
+}
+
+// recordedParts returns the last recorded part of each part number.
+func recordedParts(upload *model.MultipartUpload) map[int32]model.MultipartUploadPart {
+	parts := make(map[int32]model.MultipartUploadPart)
+	if upload != nil {
+		for _, part := range upload.Parts {
+			parts[part.PartNumber] = part
+		}
+	}
+	return parts
+}
+
+// partUploaded returns true if the part listed by S3 holds size bytes with
+// the MD5 sum. The sum is compared to the sum recorded with the part, or
+// else to the ETag if it is the MD5 sum of the part; parts that cannot be
+// verified are uploaded again.
+func (s *SimpleStorageService) partUploaded(
+	part types.Part,
+	recorded model.MultipartUploadPart,
+	size int64,
+	sum []byte,
+) bool {
+	if part.Size != size {
+		return false
+	}
+	sumHex := hex.EncodeToString(sum)
+	if recorded.ETag != "" && verifyETag(part.ETag, strings.Trim(recorded.ETag, `"`)) == nil {
+		return strings.EqualFold(recorded.MD5, sumHex)
+	}
+	return s.etagIsMD5() && verifyETag(part.ETag, sumHex) == nil
+}
+
+// uploadedPart returns the part listed by S3 to complete the upload with.
+func uploadedPart(part types.Part) types.CompletedPart {
+	return types.CompletedPart{
+		ETag:       part.ETag,
+		PartNumber: part.PartNumber,
+
+		ChecksumCRC32:  part.ChecksumCRC32,
+		ChecksumCRC32C: part.ChecksumCRC32C,
+		ChecksumSHA1:   part.ChecksumSHA1,
+		ChecksumSHA256: part.ChecksumSHA256,
+	}
+}
+
+// recordPart records the uploaded part of a resumable upload.
+func (s *SimpleStorageService) recordPart(
+	ctx context.Context,
+	uploadID string,
+	rsp *s3.UploadPartOutput,
+	partNum int32,
+	size int64,
+	sum []byte,
+) error {
+	return s.uploads.AddMultipartUploadPart(ctx, uploadID, model.MultipartUploadPart{
+		PartNumber: partNum,
+		Size:       size,
+		ETag:       aws.ToString(rsp.ETag),
+		MD5:        hex.EncodeToString(sum),
+	})
+}
+
+// forgetMultipart removes the record of a completed or aborted upload. Like
+// aborting the upload, the request is detached from the context of the
+// upload.
+func (s *SimpleStorageService) forgetMultipart(ctx context.Context, uploadID string) {
+	l := log.FromContext(ctx)
+	ctx, cancel := context.WithTimeout(
+		log.WithContext(context.Background(), l),
+		abortMultipartTimeout,
+	)
+	defer cancel()
+	if err := s.uploads.DeleteMultipartUpload(ctx, uploadID); err != nil {
+		l.Warnf("s3: failed to remove record of multipart upload %q: %s",
+			uploadID, err.Error())
+	}
+}
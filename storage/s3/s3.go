@@ -17,10 +17,17 @@ package s3
 import (
 	"bytes"
 	"context"
+	"crypto/md5" //nolint:gosec
+	"encoding/hex"
+	"encoding/json"
 	stderr "errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -31,6 +38,8 @@ import (
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/pkg/errors"
 
+	"github.com/mendersoftware/go-lib-micro/log"
+
 	"github.com/mendersoftware/deployments/model"
 	"github.com/mendersoftware/deployments/storage"
 )
@@ -41,6 +50,9 @@ const (
 
 	MultipartMaxParts = 10000
 	MultipartMinSize  = 5 * mib
+	MultipartMaxSize  = 5 * gib
+
+	abortMultipartTimeout = 30 * time.Second
 
 	// Constants not exposed by aws-sdk-go
 	// from /aws/signer/v4/internal/v4
@@ -48,7 +60,11 @@ const (
 	paramAmzDateFormat = "20060102T150405Z"
 )
 
-var ErrClientEmpty = stderr.New("s3: storage client credentials not configured")
+var (
+	ErrClientEmpty = stderr.New("s3: storage client credentials not configured")
+
+	ErrPresignExpireNegative = stderr.New("s3: presign expiry must not be negative")
+)
 
 // SimpleStorageService - AWS S3 client.
 // Data layer for file storage.
@@ -57,10 +73,58 @@ type SimpleStorageService struct {
 	client        *s3.Client
 	presignClient *s3.PresignClient
 	bucket        string
+	region        string
+	replicas      []replica
+	keyPrefix     string
+	keyStrategy   KeyStrategy
 	bufferSize    int
-	contentType   *string
+	partSize      int
+	buffers       *bufferPool
+	defaultExpire time.Duration
+	// replicationPollInterval is the initial interval between the polls
+	// of WaitForReplication.
+	replicationPollInterval time.Duration
+
+	contentType                *string
+	contentEncoding            *string
+	compressOnUpload           bool
+	cacheControl               *string
+	contentDispositionTemplate *string
+
+	sseAlgorithm   types.ServerSideEncryption
+	sseKMSKeyID    *string
+	sseCustomerKey *sseCustomerKey
+	storageClass   types.StorageClass
+	checksum       types.ChecksumAlgorithm
+	tags           map[string]string
+	metadata       map[string]string
+	expiresAfter   time.Duration
+
+	objectLockMode      types.ObjectLockMode
+	objectLockRetention time.Duration
+
+	pingWrite         bool
+	verifyIntegrity   bool
+	uploadSpillDir    *string
+	deduplicate       bool
+	uploadConcurrency int
+	storeSHA256       bool
+	resumable         bool
+	uploads           UploadStore
+	presignHooks      []PresignHook
+	cache             *objectCache
+
+	useAccelerate      bool
+	accelerateFallback bool
+	accelerate         *accelerateCache
 }
 
+var (
+	_ storage.ObjectStorage      = &SimpleStorageService{}
+	_ storage.Presigner          = &SimpleStorageService{}
+	_ storage.ResumablePresigner = &SimpleStorageService{}
+)
+
 type StaticCredentials struct {
 	Key    string `json:"key"`
 	Secret string `json:"secret"`
@@ -74,6 +138,40 @@ func (creds StaticCredentials) Validate() error {
 	)
 }
 
+// redact returns the credentials with the secret and the
+// session token redacted. Only the first and last four characters of the
+// access key are kept, which identifies the key in use.
+func (creds StaticCredentials) redact() StaticCredentials {
+	ret := StaticCredentials{Key: "****"}
+	if len(creds.Key) >= 16 {
+		ret.Key = creds.Key[:4] + "****" + creds.Key[len(creds.Key)-4:]
+	}
+	if creds.Secret != "" {
+		ret.Secret = redacted
+	}
+	if creds.Token != "" {
+		ret.Token = redacted
+	}
+	return ret
+}
+
+// String returns the redacted credentials, so that the credentials can be
+// logged.
+func (creds StaticCredentials) String() string {
+	r := creds.redact()
+	return fmt.Sprintf("{Key:%s Secret:%s Token:%s}", r.Key, r.Secret, r.Token)
+}
+
+func (creds StaticCredentials) GoString() string {
+	return "s3.StaticCredentials" + creds.String()
+}
+
+// MarshalJSON marshals the redacted credentials.
+func (creds StaticCredentials) MarshalJSON() ([]byte, error) {
+	type credentials StaticCredentials
+	return json.Marshal(credentials(creds.redact()))
+}
+
 func (creds StaticCredentials) awsCredentials() aws.Credentials {
 	return aws.Credentials{
 		AccessKeyID:     creds.Key,
@@ -92,6 +190,7 @@ func newClient(
 	withCredentials bool,
 	opt *Options,
 ) (*SimpleStorageService, error) {
+	opt.applyProvider()
 	if err := opt.Validate(); err != nil {
 		return nil, errors.WithMessage(err, "s3: invalid configuration")
 	}
@@ -101,9 +200,20 @@ func newClient(
 	)
 
 	if withCredentials {
-		cfg, err = awsConfig.LoadDefaultConfig(ctx)
+		var loadOpts []func(*awsConfig.LoadOptions) error
+		if opt.Profile != nil {
+			err = checkProfile(ctx, *opt.Profile)
+			loadOpts = append(loadOpts, awsConfig.WithSharedConfigProfile(*opt.Profile))
+		}
+		if err == nil {
+			cfg, err = awsConfig.LoadDefaultConfig(ctx, loadOpts...)
+		}
 	} else {
 		opt.StaticCredentials = nil
+		opt.CredentialSource = nil
+		opt.AssumeRoleARN = nil
+		opt.WebIdentityTokenFile = nil
+		opt.Profile = nil
 		cfg, err = awsConfig.LoadDefaultConfig(ctx,
 			awsConfig.WithCredentialsProvider(aws.AnonymousCredentials{}),
 		)
@@ -112,17 +222,142 @@ func newClient(
 		return nil, err
 	}
 
+	if aws.ToBool(opt.InsecureSkipVerify) && opt.Transport == nil {
+		log.FromContext(ctx).Warn(
+			"s3: TLS certificate verification is disabled " +
+				"(InsecureSkipVerify); do not use this in production!",
+		)
+	}
+	if opt.plainHTTP() {
+		log.FromContext(ctx).Warn(
+			"s3: requests to the s3 API are not encrypted " +
+				"(AllowInsecureTransport)",
+		)
+	}
+	if opt.ACL != nil && isPublicACL(*opt.ACL) {
+		log.FromContext(ctx).Warnf(
+			"s3: uploaded objects are publicly accessible (ACL %s); "+
+				"anyone can download them without authorization!",
+			*opt.ACL,
+		)
+	}
 	clientOpts, presignOpts := opt.toS3Options()
 	client := s3.NewFromConfig(cfg, clientOpts)
 	presignClient := s3.NewPresignClient(client, presignOpts)
 
-	return &SimpleStorageService{
+	sss := &SimpleStorageService{
 		client:        client,
 		presignClient: presignClient,
 
-		bufferSize:  *opt.BufferSize,
-		contentType: opt.ContentType,
-	}, nil
+		bufferSize:              *opt.BufferSize,
+		partSize:                *opt.BufferSize,
+		defaultExpire:           DefaultExpire,
+		replicationPollInterval: replicationPollInterval,
+		keyPrefix:               normalizeKeyPrefix(aws.ToString(opt.KeyPrefix)),
+		keyStrategy:             opt.KeyStrategy,
+
+		contentType:                opt.ContentType,
+		contentEncoding:            opt.ContentEncoding,
+		cacheControl:               opt.CacheControl,
+		contentDispositionTemplate: opt.ContentDisposition,
+
+		sseKMSKeyID:    opt.SSEKMSKeyID,
+		sseCustomerKey: newSSECustomerKey(opt.SSECustomerKey),
+		tags:           opt.Tags,
+		metadata:       normalizeMetadata(opt.Metadata),
+
+		pingWrite:       aws.ToBool(opt.PingWrite),
+		verifyIntegrity: aws.ToBool(opt.VerifyIntegrity),
+		uploadSpillDir:  opt.spillDir(),
+		deduplicate:     aws.ToBool(opt.DeduplicateByHash),
+		storeSHA256:     aws.ToBool(opt.StoreSHA256),
+		resumable:       aws.ToBool(opt.ResumableUploads),
+		uploads:         opt.UploadStore,
+		presignHooks:    opt.PresignHooks,
+		cache:           newObjectCache(opt),
+
+		useAccelerate:      aws.ToBool(opt.UseAccelerate),
+		accelerateFallback: aws.ToBool(opt.AccelerateFallback),
+		accelerate:         &accelerateCache{},
+	}
+	if opt.SSEAlgorithm != nil {
+		sss.sseAlgorithm = types.ServerSideEncryption(*opt.SSEAlgorithm)
+	}
+	if opt.StorageClass != nil {
+		sss.storageClass = types.StorageClass(*opt.StorageClass)
+	}
+	if opt.ChecksumAlgorithm != nil {
+		sss.checksum = types.ChecksumAlgorithm(*opt.ChecksumAlgorithm)
+	}
+	if opt.ObjectLockMode != nil {
+		sss.objectLockMode = types.ObjectLockMode(*opt.ObjectLockMode)
+		sss.objectLockRetention = *opt.ObjectLockRetention
+		// S3 requires an integrity checksum for uploads with retention.
+		if sss.checksum == "" {
+			sss.checksum = types.ChecksumAlgorithmCrc32
+		}
+	}
+	if opt.PartSize != nil {
+		sss.partSize = *opt.PartSize
+	}
+	if aws.ToBool(opt.CompressOnUpload) {
+		sss.compressOnUpload = !isCompressedContentType(aws.ToString(opt.ContentType))
+	}
+	if opt.ExpiresAfter != nil {
+		sss.expiresAfter = *opt.ExpiresAfter
+	}
+	sss.region = aws.ToString(opt.Region)
+	for _, entry := range opt.FallbackRegions {
+		r, _ := parseReplica(entry)
+		sss.replicas = append(sss.replicas, r)
+	}
+	maxUploadSize := sss.maxUploadSize()
+	if opt.MaxObjectSize != nil && *opt.MaxObjectSize > maxUploadSize {
+		log.FromContext(ctx).Warnf(
+			"s3: uploads are limited to %d bytes (%d parts of %d bytes), "+
+				"less than the maximum object size of %d bytes; "+
+				"increase the part size to upload the largest objects",
+			maxUploadSize, MultipartMaxParts, sss.partSize,
+			*opt.MaxObjectSize,
+		)
+	}
+	sss.uploadConcurrency = 1
+	if opt.UploadConcurrency != nil {
+		sss.uploadConcurrency = *opt.UploadConcurrency
+	}
+	bufferSize := sss.bufferSize
+	if sss.partSize > bufferSize {
+		bufferSize = sss.partSize
+	}
+	sss.buffers = newBufferPool(bufferSize, opt.BufferPoolSize)
+	if sss.uploadSpillDir != nil {
+		if err := checkSpillDir(*sss.uploadSpillDir); err != nil {
+			return nil, errors.WithMessage(err,
+				"s3: invalid configuration: temporary directory not writable")
+		}
+	}
+	if opt.DefaultExpire != nil {
+		sss.defaultExpire = *opt.DefaultExpire
+	}
+	return sss, nil
+}
+
+// Kind is the kind of the s3 storage in storage.New.
+const Kind = "aws"
+
+func init() {
+	storage.Register(Kind, func(
+		ctx context.Context,
+		bucket string,
+		options interface{},
+	) (storage.ObjectStorage, error) {
+		opt, ok := options.(*Options)
+		if !ok && options != nil {
+			return nil, fmt.Errorf("%w: expected *s3.Options, got %T",
+				storage.ErrInvalidOptions, options)
+		}
+		return New(ctx, bucket, opt)
+	})
 }
 
 // NewEmpty initializes a new s3 client that does not implicitly load
@@ -141,6 +376,12 @@ func New(ctx context.Context, bucket string, opts ...*Options) (storage.ObjectSt
 	}
 	s3c.bucket = bucket
 
+	if s3c.useAccelerate {
+		// Check the acceleration status up front; the result is cached.
+		if _, err = s3c.accelerateOptions(ctx, bucket, noOpts); err != nil {
+			return nil, err
+		}
+	}
 	err = s3c.init(ctx)
 	if err != nil {
 		return nil, errors.WithMessage(err, "s3: failed to check bucket preconditions")
@@ -148,13 +389,27 @@ func New(ctx context.Context, bucket string, opts ...*Options) (storage.ObjectSt
 	return s3c, nil
 }
 
+// WithBucket returns a handle to the storage using bucket as the default
+// bucket. The handle shares the client (and credentials) with s, which is
+// safe for concurrent use. Unlike New, the bucket is not checked to exist.
+// Storage settings from the context still take precedence.
+func (s *SimpleStorageService) WithBucket(bucket string) *SimpleStorageService {
+	ret := *s
+	ret.bucket = bucket
+	return &ret
+}
+
 func (s *SimpleStorageService) init(ctx context.Context) error {
+	_, opts, err := s.optionsFromContext(ctx, false)
+	if err != nil {
+		return err
+	}
 	hparams := &s3.HeadBucketInput{
 		Bucket: aws.String(s.bucket),
 	}
 	var rspErr *awsHttp.ResponseError
 
-	_, err := s.client.HeadBucket(ctx, hparams)
+	_, err = s.client.HeadBucket(ctx, hparams, opts)
 	if err == nil {
 		// bucket exists and have permission to access it
 		return nil
@@ -176,7 +431,7 @@ func (s *SimpleStorageService) init(ctx context.Context) error {
 		Bucket: aws.String(s.bucket),
 	}
 
-	_, err = s.client.CreateBucket(ctx, cparams)
+	_, err = s.client.CreateBucket(ctx, cparams, opts)
 	if err != nil {
 		var errBucket *types.BucketAlreadyOwnedByYou
 		if !errors.As(err, errBucket) {
@@ -187,7 +442,7 @@ func (s *SimpleStorageService) init(ctx context.Context) error {
 	if deadline, ok := ctx.Deadline(); ok {
 		waitTime = time.Until(deadline)
 	}
-	err = s3.NewBucketExistsWaiter(s.client).
+	err = s3.NewBucketExistsWaiter(headBucketClient{s.client, opts}).
 		Wait(ctx, &s3.HeadBucketInput{Bucket: &s.bucket}, waitTime)
 	return err
 }
@@ -195,31 +450,45 @@ func (s *SimpleStorageService) init(ctx context.Context) error {
 func noOpts(*s3.Options) {
 }
 
+// headBucketClient applies opts to the HeadBucket requests of a waiter.
+type headBucketClient struct {
+	*s3.Client
+	opts func(*s3.Options)
+}
+
+func (c headBucketClient) HeadBucket(
+	ctx context.Context,
+	params *s3.HeadBucketInput,
+	optFns ...func(*s3.Options),
+) (*s3.HeadBucketOutput, error) {
+	return c.Client.HeadBucket(ctx, params, append([]func(*s3.Options){c.opts}, optFns...)...)
+}
+
 func (s *SimpleStorageService) optionsFromContext(
 	ctx context.Context,
 	presign bool,
 ) (bucket string, clientOptions func(*s3.Options), err error) {
+	useAccelerate := s.useAccelerate
 	if settings := settingsFromContext(ctx); settings != nil {
 		bucket = settings.Bucket
 		clientOptions, err = settings.getOptions(presign)
+		useAccelerate = settings.UseAccelerate
 	} else if s.bucket == "" {
 		return "", nil, ErrClientEmpty
+	} else if region, ok := regionFromContext(ctx); ok {
+		bucket, clientOptions, err = s.regionOptions(region)
 	} else {
 		bucket = s.bucket
 		clientOptions = noOpts
 	}
+	if err == nil && useAccelerate {
+		clientOptions, err = s.accelerateOptions(ctx, bucket, clientOptions)
+	}
 	return bucket, clientOptions, err
 }
 
 func (s *SimpleStorageService) HealthCheck(ctx context.Context) error {
-	bucket, opts, err := s.optionsFromContext(ctx, false)
-	if err != nil {
-		return err
-	}
-	_, err = s.client.HeadBucket(ctx, &s3.HeadBucketInput{
-		Bucket: aws.String(bucket),
-	}, opts)
-	return err
+	return s.Ping(ctx)
 }
 
 type objectReader struct {
@@ -231,38 +500,118 @@ func (obj objectReader) Length() int64 {
 	return obj.length
 }
 
+type rangeReader struct {
+	objectReader
+	contentRange string
+}
+
+func (obj rangeReader) ContentRange() string {
+	return obj.contentRange
+}
+
 func (s *SimpleStorageService) GetObject(
 	ctx context.Context,
 	path string,
 ) (io.ReadCloser, error) {
+	obj, _, err := s.getObjectCached(ctx, path, "", s.getObjectFunc(path, nil))
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *SimpleStorageService) GetObjectRange(
+	ctx context.Context,
+	path string,
+	offset, length int64,
+) (storage.RangeReader, error) {
+	byteRange, err := storage.ValidateRange(offset, length)
+	if err != nil {
+		return nil, errors.WithMessage(err, "s3: failed to get object")
+	}
+	obj, contentRange, err := s.getObjectCached(ctx, path, byteRange,
+		s.getObjectFunc(path, &byteRange))
+	if err != nil {
+		return nil, err
+	}
+	return rangeReader{
+		objectReader: obj,
+		contentRange: contentRange,
+	}, nil
+}
+
+// getObjectFunc returns a function getting the object at path, or the
+// range, with failover.
+func (s *SimpleStorageService) getObjectFunc(
+	path string,
+	byteRange *string,
+) func(context.Context) (io.ReadCloser, int64, string, string, error) {
+	return func(ctx context.Context) (io.ReadCloser, int64, string, string, error) {
+		var out *s3.GetObjectOutput
+		err := s.readWithFailover(ctx, func(ctx context.Context) (err error) {
+			out, err = s.getObject(ctx, path, byteRange)
+			return err
+		})
+		if err != nil {
+			return nil, 0, "", "", err
+		}
+		return out.Body, out.ContentLength,
+			aws.ToString(out.ETag), aws.ToString(out.ContentRange), nil
+	}
+}
+
+func (s *SimpleStorageService) getObject(
+	ctx context.Context,
+	path string,
+	byteRange *string,
+) (*s3.GetObjectOutput, error) {
 	bucket, opts, err := s.optionsFromContext(ctx, false)
 	if err != nil {
 		return nil, err
 	}
 	params := &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
-		Key:    aws.String(path),
-
-		RequestPayer: types.RequestPayerRequester,
+		Key:    aws.String(s.objectKey(path)),
+		Range:  byteRange,
+	}
+	params.SSECustomerAlgorithm,
+		params.SSECustomerKey,
+		params.SSECustomerKeyMD5 = s.sseCustomerKey.params()
+	params.IfNoneMatch = ifNoneMatchFromContext(ctx)
+	if params.IfNoneMatch == nil {
+		params.IfNoneMatch = revalidateFromContext(ctx)
 	}
 
 	out, err := s.client.GetObject(ctx, params, opts)
 	var rspErr *awsHttp.ResponseError
-	if errors.As(err, &rspErr) {
-		if rspErr.Response.StatusCode == http.StatusNotFound {
-			err = storage.ErrObjectNotFound
+	if params.IfNoneMatch != nil && errors.As(err, &rspErr) &&
+		rspErr.Response.StatusCode == http.StatusNotImplemented {
+		// The backend does not support conditional requests;
+		// fall back to downloading the object.
+		params.IfNoneMatch = nil
+		out, err = s.client.GetObject(ctx, params, opts)
+	}
+	if err == nil && out.Metadata[metaContentRef] != "" {
+		// A reference to deduplicated content.
+		out.Body.Close()
+		params.Key = aws.String(s.contentKey(out.Metadata[metaContentRef]))
+		out, err = s.client.GetObject(ctx, params, opts)
+	} else if s.deduplicate && byteRange != nil &&
+		errors.Is(mapError(err), storage.ErrInvalidRange) {
+		// Ranges are not satisfiable on (empty) references.
+		key, _, errStat := s.statObject(ctx, path)
+		if errStat == nil && key != *params.Key {
+			params.Key = aws.String(key)
+			out, err = s.client.GetObject(ctx, params, opts)
 		}
 	}
 	if err != nil {
 		return nil, errors.WithMessage(
-			err,
+			mapError(err),
 			"s3: failed to get object",
 		)
 	}
-	return objectReader{
-		ReadCloser: out.Body,
-		length:     out.ContentLength,
-	}, nil
+	return out, nil
 }
 
 // Delete removes deleted file from storage.
@@ -272,27 +621,19 @@ func (s *SimpleStorageService) DeleteObject(ctx context.Context, path string) er
 	if err != nil {
 		return err
 	}
+	defer s.invalidateCache(ctx, path)
 
 	params := &s3.DeleteObjectInput{
 		// Required
 		Bucket: aws.String(bucket),
-		Key:    aws.String(path),
-
-		// Optional
-		RequestPayer: types.RequestPayerRequester,
+		Key:    aws.String(s.objectKey(path)),
 	}
 
 	// ignore return response which contains charing info
 	// and file versioning data which are not in interest
 	_, err = s.client.DeleteObject(ctx, params, opts)
-	var rspErr *awsHttp.ResponseError
-	if errors.As(err, &rspErr) {
-		if rspErr.Response.StatusCode == http.StatusNotFound {
-			err = storage.ErrObjectNotFound
-		}
-	}
 	if err != nil {
-		return errors.WithMessage(err, "s3: error deleting object")
+		return errors.WithMessage(mapError(err), "s3: error deleting object")
 	}
 
 	return nil
@@ -303,32 +644,14 @@ func (s *SimpleStorageService) StatObject(
 	ctx context.Context,
 	path string,
 ) (*storage.ObjectInfo, error) {
-
-	bucket, opts, err := s.optionsFromContext(ctx, false)
-	if err != nil {
-		return nil, err
-	}
-
-	params := &s3.HeadObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(path),
-	}
-	rsp, err := s.client.HeadObject(ctx, params, opts)
-	var rspErr *awsHttp.ResponseError
-	if errors.As(err, &rspErr) {
-		if rspErr.Response.StatusCode == http.StatusNotFound {
-			err = storage.ErrObjectNotFound
-		}
-	}
-	if err != nil {
-		return nil, errors.WithMessage(err, "s3: error getting object info")
-	}
-
-	return &storage.ObjectInfo{
-		Path:         path,
-		LastModified: rsp.LastModified,
-		Size:         &rsp.ContentLength,
-	}, nil
+	return s.statObjectCached(ctx, path, func(ctx context.Context) (*storage.ObjectInfo, error) {
+		var info *storage.ObjectInfo
+		err := s.readWithFailover(ctx, func(ctx context.Context) (err error) {
+			_, info, err = s.statObject(ctx, path)
+			return err
+		})
+		return info, err
+	})
 }
 
 func fillBuffer(b []byte, r io.Reader) (int, error) {
@@ -340,255 +663,748 @@ func fillBuffer(b []byte, r io.Reader) (int, error) {
 	return offset, err
 }
 
-// uploadMultipart uploads an artifact using the multipart API.
+const (
+	headerIfMatch     = "If-Match"
+	headerIfNoneMatch = "If-None-Match"
+)
+
+// ifNoneMatchFromContext returns the ETag for conditional requests from
+// the context; the ETag is quoted if necessary.
+func ifNoneMatchFromContext(ctx context.Context) *string {
+	etag, ok := storage.IfNoneMatchFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if etag != "*" && !strings.HasSuffix(etag, `"`) {
+		etag = `"` + etag + `"`
+	}
+	return &etag
+}
+
+// completedPart returns the part to list in the CompleteMultipartUpload
+// request. If the part was uploaded with a checksum, the checksum must be
+// included for S3 to accept the completion.
+func completedPart(rsp *s3.UploadPartOutput, partNum int32) types.CompletedPart {
+	return types.CompletedPart{
+		ETag:       rsp.ETag,
+		PartNumber: partNum,
+
+		ChecksumCRC32:  rsp.ChecksumCRC32,
+		ChecksumCRC32C: rsp.ChecksumCRC32C,
+		ChecksumSHA1:   rsp.ChecksumSHA1,
+		ChecksumSHA256: rsp.ChecksumSHA256,
+	}
+}
+
+// uploadMultipart uploads an artifact using the multipart API, in the
+// parts returned by next. Up to concurrency parts are uploaded in parallel,
+// so the bodies of the parts must stay valid until they are uploaded if
+// concurrency is greater than one.
+//
+// With ResumableUploads, the upload and its parts are recorded in the
+// UploadStore and a failed upload is kept: uploading the object again
+// resumes the upload, skipping the parts S3 lists with the same size and
+// MD5 sum.
 func (s *SimpleStorageService) uploadMultipart(
 	ctx context.Context,
-	buf []byte,
 	objectPath string,
-	artifact io.Reader,
+	next nextPart,
+	concurrency int,
 ) error {
 	const maxPartNum = 10000
-	var partNum int32 = 1
-	var rspUpload *s3.UploadPartOutput
 	bucket, opts, err := s.optionsFromContext(ctx, true)
 	if err != nil {
 		return err
 	}
-
-	// Pre-allocate 100 completed part (generous guesstimate)
-	completedParts := make([]types.CompletedPart, 0, 100)
-
-	// Initiate Multipart upload
-	createParams := &s3.CreateMultipartUploadInput{
-		Bucket:      &bucket,
-		Key:         &objectPath,
-		ContentType: s.contentType,
-	}
-	rspCreate, err := s.client.CreateMultipartUpload(
-		ctx, createParams, opts,
-	)
+	tagging, err := s.taggingFromContext(ctx)
 	if err != nil {
 		return err
 	}
-	uploadParams := &s3.UploadPartInput{
-		Bucket:     &bucket,
-		Key:        &objectPath,
-		UploadId:   rspCreate.UploadId,
-		PartNumber: partNum,
-	}
 
-	// Upload the first chunk already stored in buffer
-	r := bytes.NewReader(buf)
-	// Readjust upload parameters
-	uploadParams.Body = r
-	rspUpload, err = s.client.UploadPart(
-		ctx,
-		uploadParams,
-		opts,
+	var (
+		upload   *model.MultipartUpload
+		uploaded map[int32]types.Part
 	)
-	if err != nil {
-		return err
+	if s.resumable {
+		upload, uploaded, err = s.resumeMultipart(ctx, bucket, objectPath, opts)
+		if err != nil {
+			return errors.WithMessage(err, "s3: failed to resume multipart upload")
+		}
 	}
-	completedParts = append(
-		completedParts,
-		types.CompletedPart{
-			ETag:       rspUpload.ETag,
-			PartNumber: partNum,
-		},
-	)
+	recorded := recordedParts(upload)
+	if upload == nil {
+		upload, err = s.createMultipart(ctx, bucket, objectPath, tagging, opts)
+		if err != nil {
+			return err
+		}
+	}
+	uploadID := &upload.UploadID
+	uploadParams := &s3.UploadPartInput{
+		Bucket:   &bucket,
+		Key:      &objectPath,
+		UploadId: uploadID,
 
-	// The following is loop is very similar to io.Copy except the
-	// destination is the s3 bucket.
-	for partNum++; partNum < maxPartNum; partNum++ {
-		// Read next chunk from stream (fill the whole buffer)
-		offset, eRead := fillBuffer(buf, artifact)
-		if offset > 0 {
-			r := bytes.NewReader(buf[:offset])
-			// Readjust upload parameters
-			uploadParams.PartNumber = partNum
-			uploadParams.Body = r
-			rspUpload, err = s.client.UploadPart(
-				ctx,
-				uploadParams,
-				opts,
-			)
-			if err != nil {
-				break
-			}
-			completedParts = append(
-				completedParts,
-				types.CompletedPart{
-					ETag:       rspUpload.ETag,
-					PartNumber: partNum,
-				},
-			)
-		} else {
-			// Read did not return any bytes
+		ChecksumAlgorithm: s.checksum,
+	}
+	uploadParams.SSECustomerAlgorithm,
+		uploadParams.SSECustomerKey,
+		uploadParams.SSECustomerKeyMD5 = s.sseCustomerKey.params()
+
+	// Parts are uploaded by up to concurrency goroutines; the next part
+	// is only read once a slot is free, so that buffered parts are not
+	// overwritten while in flight. The first error cancels the other parts.
+	ctxParts, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg             sync.WaitGroup
+		mu             sync.Mutex
+		completedParts []types.CompletedPart
+		sums           [][]byte
+	)
+	fail := func(errPart error) {
+		mu.Lock()
+		if err == nil {
+			err = errPart
+			cancel()
+		}
+		mu.Unlock()
+	}
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return err != nil
+	}
+	slots := make(chan struct{}, concurrency)
+	var read int64
+	for partNum := int32(1); ; partNum++ {
+		slots <- struct{}{}
+		if errCtx := ctx.Err(); errCtx != nil {
+			// Stop reading parts once the upload is canceled.
+			fail(errCtx)
+		}
+		if failed() {
 			break
 		}
-		if eRead != nil {
-			err = eRead
+		body, size, errNext := next()
+		if errNext != nil {
+			fail(errNext)
+			break
+		} else if body == nil {
+			break
+		}
+		read += size
+		if partNum > maxPartNum {
+			fail(&ObjectTooLargeError{Size: read, Limit: s.maxUploadSize()})
 			break
 		}
+		mu.Lock()
+		completedParts = append(completedParts, types.CompletedPart{})
+		sums = append(sums, nil)
+		mu.Unlock()
+		wg.Add(1)
+		go func(partNum int32) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			part, sum, errPart := s.uploadPart(ctxParts, uploadParams,
+				partNum, body, size, uploaded, recorded, opts)
+			if errPart != nil {
+				fail(errPart)
+				return
+			}
+			mu.Lock()
+			completedParts[partNum-1] = part
+			sums[partNum-1] = sum
+			mu.Unlock()
+		}(partNum)
+	}
+	wg.Wait()
+	var partSums []byte
+	if s.verifyIntegrity {
+		partSums = bytes.Join(sums, nil)
 	}
-	if err == nil || err == io.EOF {
+	if err == nil {
 		// Complete upload
 		uploadParams := &s3.CompleteMultipartUploadInput{
 			Bucket:   &bucket,
 			Key:      &objectPath,
-			UploadId: rspCreate.UploadId,
+			UploadId: uploadID,
 			MultipartUpload: &types.CompletedMultipartUpload{
 				Parts: completedParts,
 			},
 		}
-		_, err = s.client.CompleteMultipartUpload(
+		var rspComplete *s3.CompleteMultipartUploadOutput
+		rspComplete, err = s.client.CompleteMultipartUpload(
 			ctx,
 			uploadParams,
 			opts,
 		)
-	} else {
+		if err == nil && s.resumable {
+			s.forgetMultipart(ctx, *uploadID)
+		}
+		if err == nil && s.verifyIntegrity && s.etagIsMD5() {
+			err = verifyETag(rspComplete.ETag,
+				multipartETag(partSums, len(completedParts)))
+			if err != nil {
+				s.removeCorrupted(ctx, bucket, objectPath, opts)
+				return err
+			}
+		}
+	}
+	switch {
+	case err == nil:
+	case s.resumable && isNoSuchUpload(err):
+		// Aborted in the meantime, e.g. by CleanupAbandonedUploads.
+		s.forgetMultipart(ctx, *uploadID)
+	case s.resumable && keepForResume(err):
+		// Resumed by the next upload of the object, or aborted by
+		// CleanupAbandonedUploads.
+	default:
 		// Abort multipart upload!
-		uploadParams := &s3.AbortMultipartUploadInput{
+		s.abortMultipart(ctx, bucket, objectPath, uploadID, opts)
+	}
+	return err
+}
+
+// uploadPart uploads the body as part partNum of a multipart upload with
+// the parameters of template, unless S3 listed the part as uploaded before
+// the upload was interrupted (see ResumableUploads). The MD5 sum of the
+// part is returned with VerifyIntegrity.
+func (s *SimpleStorageService) uploadPart(
+	ctx context.Context,
+	template *s3.UploadPartInput,
+	partNum int32,
+	body io.ReadSeeker,
+	size int64,
+	uploaded map[int32]types.Part,
+	recorded map[int32]model.MultipartUploadPart,
+	opts func(*s3.Options),
+) (types.CompletedPart, []byte, error) {
+	params := *template
+	params.PartNumber = partNum
+	params.Body = body
+	params.ContentLength = size
+	var sum []byte
+	if s.verifyIntegrity || s.resumable {
+		var (
+			contentMD5 *string
+			err        error
+		)
+		contentMD5, sum, err = contentMD5Seeker(body)
+		if err != nil {
+			return types.CompletedPart{}, nil, err
+		}
+		if s.verifyIntegrity {
+			params.ContentMD5 = contentMD5
+		}
+	}
+	if part, ok := uploaded[partNum]; ok &&
+		s.partUploaded(part, recorded[partNum], size, sum) {
+		// Uploaded before the upload was interrupted.
+		return uploadedPart(part), s.integritySum(sum), nil
+	}
+	rsp, err := s.client.UploadPart(ctx, &params, opts)
+	if err == nil && s.verifyIntegrity && s.etagIsMD5() {
+		err = verifyETag(rsp.ETag, hex.EncodeToString(sum))
+	}
+	if err == nil && s.resumable {
+		err = s.recordPart(ctx, *params.UploadId, rsp, partNum, size, sum)
+	}
+	if err != nil {
+		return types.CompletedPart{}, nil, err
+	}
+	return completedPart(rsp, partNum), s.integritySum(sum), nil
+}
+
+// integritySum returns the MD5 sum of a part for verifying the ETag of the
+// completed upload with VerifyIntegrity.
+func (s *SimpleStorageService) integritySum(sum []byte) []byte {
+	if !s.verifyIntegrity {
+		return nil
+	}
+	return sum
+}
+
+// createMultipart initiates the multipart upload of the object; the upload
+// is recorded for ResumableUploads.
+func (s *SimpleStorageService) createMultipart(
+	ctx context.Context,
+	bucket, objectPath string,
+	tagging *string,
+	opts func(*s3.Options),
+) (*model.MultipartUpload, error) {
+	createParams := s.createMultipartInput(ctx, bucket, objectPath, tagging)
+	rspCreate, err := s.client.CreateMultipartUpload(
+		ctx, createParams, opts,
+	)
+	if err != nil {
+		return nil, s.objectLockError(err)
+	}
+	upload := &model.MultipartUpload{
+		UploadID: aws.ToString(rspCreate.UploadId),
+		Bucket:   bucket,
+		Key:      objectPath,
+	}
+	if s.resumable {
+		if err = s.uploads.InsertMultipartUpload(ctx, upload); err != nil {
+			s.abortMultipart(ctx, bucket, objectPath, rspCreate.UploadId, opts)
+			return nil, errors.WithMessage(err, "s3: failed to record multipart upload")
+		}
+	}
+	return upload, nil
+}
+
+// createMultipartInput returns the parameters initiating a multipart upload
+// of the object with the configured properties.
+func (s *SimpleStorageService) createMultipartInput(
+	ctx context.Context,
+	bucket, objectPath string,
+	tagging *string,
+) *s3.CreateMultipartUploadInput {
+	createParams := &s3.CreateMultipartUploadInput{
+		Bucket:          &bucket,
+		Key:             &objectPath,
+		ContentType:     s.contentType,
+		ContentEncoding: s.contentEncodingFromContext(ctx),
+		CacheControl:    s.cacheControl,
+
+		ServerSideEncryption: s.sseAlgorithm,
+		SSEKMSKeyId:          s.sseKMSKeyID,
+		StorageClass:         s.storageClass,
+		ChecksumAlgorithm:    s.checksum,
+		Tagging:              tagging,
+		Metadata:             s.metadataFromContext(ctx),
+
+		ObjectLockMode:            s.objectLockMode,
+		ObjectLockRetainUntilDate: s.objectLockRetainUntil(),
+	}
+	createParams.SSECustomerAlgorithm,
+		createParams.SSECustomerKey,
+		createParams.SSECustomerKeyMD5 = s.sseCustomerKey.params()
+	return createParams
+}
+
+// abortMultipart aborts the multipart upload and discards the uploaded
+// parts. The abort request is detached from the context of the upload,
+// since the upload may have failed because the context was canceled.
+func (s *SimpleStorageService) abortMultipart(
+	ctx context.Context,
+	bucket, objectPath string,
+	uploadID *string,
+	opts func(*s3.Options),
+) {
+	l := log.FromContext(ctx)
+	ctx, cancel := context.WithTimeout(
+		log.WithContext(context.Background(), l),
+		abortMultipartTimeout,
+	)
+	defer cancel()
+	_, err := s.client.AbortMultipartUpload(ctx,
+		&s3.AbortMultipartUploadInput{
 			Bucket:   &bucket,
 			Key:      &objectPath,
-			UploadId: rspCreate.UploadId,
+			UploadId: uploadID,
+		},
+		opts,
+	)
+	if err != nil {
+		l.Warnf("s3: failed to abort multipart upload for %q: %s",
+			objectPath, err.Error())
+	}
+	if s.resumable {
+		s.forgetMultipart(ctx, aws.ToString(uploadID))
+	}
+}
+
+// CleanupAbandonedUploads aborts the multipart uploads in the bucket that
+// were initiated more than olderThan ago, and returns the number of aborted
+// uploads.
+func (s *SimpleStorageService) CleanupAbandonedUploads(
+	ctx context.Context,
+	olderThan time.Duration,
+) (int, error) {
+	bucket, opts, err := s.optionsFromContext(ctx, false)
+	if err != nil {
+		return 0, err
+	}
+	threshold := time.Now().Add(-olderThan)
+	var aborted int
+	params := &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(bucket),
+	}
+	if s.keyPrefix != "" {
+		params.Prefix = aws.String(s.keyPrefix)
+	}
+	for {
+		rsp, err := s.client.ListMultipartUploads(ctx, params, opts)
+		if err != nil {
+			return aborted, errors.WithMessage(err,
+				"s3: error listing multipart uploads")
 		}
-		_, _ = s.client.AbortMultipartUpload(
-			ctx,
-			uploadParams,
-			opts,
-		)
+		for _, upload := range rsp.Uploads {
+			if upload.Initiated == nil || !upload.Initiated.Before(threshold) {
+				continue
+			}
+			_, err = s.client.AbortMultipartUpload(ctx,
+				&s3.AbortMultipartUploadInput{
+					Bucket:   aws.String(bucket),
+					Key:      upload.Key,
+					UploadId: upload.UploadId,
+				},
+				opts,
+			)
+			var noSuchUpload *types.NoSuchUpload
+			if errors.As(err, &noSuchUpload) {
+				// Completed or aborted in the meantime
+				continue
+			} else if err != nil {
+				return aborted, errors.WithMessage(err,
+					"s3: error aborting multipart upload")
+			}
+			if s.resumable {
+				s.forgetMultipart(ctx, aws.ToString(upload.UploadId))
+			}
+			aborted++
+		}
+		if !rsp.IsTruncated {
+			break
+		}
+		params.KeyMarker = rsp.NextKeyMarker
+		params.UploadIdMarker = rsp.NextUploadIdMarker
 	}
-	return err
+	return aborted, nil
 }
 
 // UploadArtifact uploads given artifact into the file server (AWS S3 or minio)
 // using objectID as a key. If the artifact is larger than 5 MiB, the file is
 // uploaded using the s3 multipart API, otherwise the object is created in a
 // single request.
+//
+// Seekable sources (io.ReadSeeker, e.g. files) are uploaded in sections
+// without buffering, and failed requests are retried from the start of the
+// section. Streams are read through a single buffer from the pool, so the
+// memory used does not depend on the artifact size; with the SpillToDisk
+// option, streams larger than the buffer are written to a temporary file
+// first and uploaded as seekable source, holding the buffer only while
+// spilling.
+//
+// With DeduplicateByHash, seekable sources, buffered and spilled streams are
+// stored once per content (see putDeduplicated); other streams are
+// uploaded as is. With StoreSHA256, the same sources are uploaded with
+// their SHA256 sum in the metadata. Sources implementing
+// storage.ObjectReader are uploaded in a single request of Length bytes.
+//
+// With CompressOnUpload, all sources are compressed and uploaded as
+// streams.
 func (s *SimpleStorageService) PutObject(
 	ctx context.Context,
 	path string,
 	src io.Reader,
 ) error {
-	var (
-		r   io.Reader
-		l   int64
-		n   int
-		err error
-		buf []byte
-	)
+	key := s.objectKey(path)
+	defer s.invalidateCache(ctx, path)
+	putSeekable := s.putSeekable
+	if s.deduplicate {
+		putSeekable = s.putDeduplicated
+	} else if s.storeSHA256 {
+		putSeekable = s.putWithSHA256
+	}
+	if s.compressOnUpload {
+		var compressed io.ReadCloser
+		ctx, compressed = s.compressUpload(ctx, src)
+		defer compressed.Close()
+		src = compressed
+	}
+	if rs, ok := src.(io.ReadSeeker); ok {
+		if start, size, err := seekableSize(rs); err == nil {
+			if err := s.checkUploadSize(size); err != nil {
+				return err
+			}
+			return mapError(putSeekable(ctx, key, rs, start, size))
+		}
+	}
 	if objReader, ok := src.(storage.ObjectReader); ok {
-		r = objReader
-		l = objReader.Length()
-	} else {
-		// Peek payload
-		buf = make([]byte, s.bufferSize)
-		n, err = fillBuffer(buf, src)
-		if err == io.EOF {
-			r = bytes.NewReader(buf[:n])
-			l = int64(n)
+		if size := objReader.Length(); size > MultipartMaxSize {
+			// The object is uploaded in a single request.
+			return &ObjectTooLargeError{Size: size, Limit: MultipartMaxSize}
 		}
+		return mapError(s.putObject(ctx, key, objReader, objReader.Length()))
 	}
 
-	// If only one part, use PutObject API.
-	if r != nil {
+	// Peek payload
+	src = contextReader{ctx: ctx, r: src}
+	buf, err := s.buffers.get(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if buf != nil {
+			s.buffers.put(buf)
+		}
+	}()
+	n, err := fillBuffer(buf[:s.bufferSize], src)
+	switch {
+	case err == io.EOF:
+		// If only one part, use PutObject API.
+		err = putSeekable(ctx, key, bytes.NewReader(buf[:n]), 0, int64(n))
+	case err != nil:
+	case s.uploadSpillDir != nil:
 		var (
-			bucket string
-			opts   func(*s3.Options)
+			f    *os.File
+			size int64
 		)
-		bucket, opts, err = s.optionsFromContext(ctx, true)
+		// Spill at most one byte more than the upload limit.
+		f, size, err = spill(ctx, *s.uploadSpillDir, buf[:n],
+			io.LimitReader(src, s.maxUploadSize()-int64(n)+1))
+		// The parts are uploaded from the file: release the buffer for
+		// other uploads.
+		s.buffers.put(buf)
+		buf = nil
 		if err != nil {
-			return err
+			return errors.WithMessage(err, "s3: failed to buffer upload")
 		}
-		// Ordinary single-file upload
-		uploadParams := &s3.PutObjectInput{
-			Body:          r,
-			Bucket:        &bucket,
-			Key:           &path,
-			ContentType:   s.contentType,
-			ContentLength: l,
+		defer func() {
+			f.Close()
+			os.Remove(f.Name())
+		}()
+		if err = s.checkUploadSize(size); err != nil {
+			return err
 		}
-		_, err = s.client.PutObject(
-			ctx,
-			uploadParams,
-			opts,
-		)
-	} else if err == nil {
-		err = s.uploadMultipart(ctx, buf, path, src)
+		err = putSeekable(ctx, key, f, 0, size)
+	default:
+		// Prepend the peeked payload to the remaining stream. The parts
+		// are read into the start of the same buffer: the peeked bytes
+		// are read back in place or moved towards the start, so they are
+		// never overwritten before they are read.
+		src = io.MultiReader(bytes.NewReader(buf[:n]), src)
+		err = s.uploadMultipart(ctx, key,
+			bufferedParts(buf[:s.partSize], src), 1)
 	}
-	return err
+	return mapError(err)
 }
 
-func (s *SimpleStorageService) PutRequest(
+// putSeekable uploads size bytes of rs starting at start, in a single
+// request if the object fits in the buffer size.
+func (s *SimpleStorageService) putSeekable(
 	ctx context.Context,
-	path string,
-	expireAfter time.Duration,
-) (*model.Link, error) {
+	key string,
+	rs io.ReadSeeker,
+	start, size int64,
+) error {
+	if size <= int64(s.bufferSize) {
+		return s.putObject(ctx, key, newSection(rs, start, size), size)
+	}
+	concurrency := 1
+	if _, ok := rs.(io.ReaderAt); ok {
+		// Sections of readers at an offset can be read concurrently.
+		concurrency = s.uploadConcurrency
+	}
+	return s.uploadMultipart(ctx, key,
+		seekableParts(rs, start, size, int64(s.partSize)), concurrency)
+}
 
-	expireAfter = capDurationToLimits(expireAfter).Truncate(time.Second)
+// putObject uploads the object in a single request.
+func (s *SimpleStorageService) putObject(
+	ctx context.Context,
+	key string,
+	body io.Reader,
+	size int64,
+) error {
 	bucket, opts, err := s.optionsFromContext(ctx, true)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	params := &s3.PutObjectInput{
-		// Required
-		Bucket: aws.String(bucket),
-		Key:    aws.String(path),
+	tagging, err := s.taggingFromContext(ctx)
+	if err != nil {
+		return err
 	}
-
-	signDate := time.Now()
-	req, err := s.presignClient.PresignPutObject(
+	// Ordinary single-file upload
+	uploadParams := &s3.PutObjectInput{
+		Body:          body,
+		Bucket:        &bucket,
+		Key:           &key,
+		ContentType:   s.contentType,
+		ContentLength: size,
+
+		ContentEncoding: s.contentEncodingFromContext(ctx),
+		CacheControl:    s.cacheControl,
+
+		ServerSideEncryption: s.sseAlgorithm,
+		SSEKMSKeyId:          s.sseKMSKeyID,
+		StorageClass:         s.storageClass,
+		ChecksumAlgorithm:    s.checksum,
+		Tagging:              tagging,
+		Metadata:             s.metadataFromContext(ctx),
+
+		ObjectLockMode:            s.objectLockMode,
+		ObjectLockRetainUntilDate: s.objectLockRetainUntil(),
+	}
+	uploadParams.SSECustomerAlgorithm,
+		uploadParams.SSECustomerKey,
+		uploadParams.SSECustomerKeyMD5 = s.sseCustomerKey.params()
+	var (
+		sum    []byte
+		digest hash.Hash
+	)
+	if rs, ok := body.(io.ReadSeeker); ok && s.verifyIntegrity {
+		// S3 rejects the upload if the data does not match the
+		// Content-MD5.
+		uploadParams.ContentMD5, sum, err = contentMD5Seeker(rs)
+		if err != nil {
+			return err
+		}
+	} else if s.verifyIntegrity {
+		digest = md5.New() //nolint:gosec
+		uploadParams.Body = io.TeeReader(body, digest)
+	}
+	rsp, err := s.client.PutObject(
 		ctx,
-		params,
-		s3.WithPresignExpires(expireAfter),
-		s3.WithPresignClientFromClientOptions(opts),
+		uploadParams,
+		opts,
 	)
+	if err == nil && s.verifyIntegrity && s.etagIsMD5() {
+		if digest != nil {
+			sum = digest.Sum(nil)
+		}
+		err = verifyETag(rsp.ETag, hex.EncodeToString(sum))
+		if err != nil {
+			s.removeCorrupted(ctx, bucket, key, opts)
+		}
+	}
+	return s.objectLockError(err)
+}
+
+func (s *SimpleStorageService) PutRequest(
+	ctx context.Context,
+	path string,
+	expireAfter time.Duration,
+) (*model.Link, error) {
+	if _, ok := storage.ResponseHeadersFromContext(ctx); ok {
+		return nil, storage.ErrResponseHeadersNotGET
+	}
+	expireAfter, err := s.presignExpire(expireAfter)
 	if err != nil {
 		return nil, err
 	}
-	if date, err := time.Parse(
-		req.SignedHeader.Get(paramAmzDate), paramAmzDateFormat,
-	); err == nil {
-		signDate = date
-	}
-
-	return &model.Link{
-		Uri:    req.URL,
-		Expire: signDate.Add(expireAfter),
-		Method: http.MethodPut,
-	}, nil
+	return s.presignPut(ctx, path, expireAfter, nil)
 }
 
-// GetRequest duration is limited to 7 days (AWS limitation)
+// GetRequest duration is limited to 7 days (AWS limitation); the
+// DefaultExpire is used if the duration is zero.
 func (s *SimpleStorageService) GetRequest(
 	ctx context.Context,
 	objectPath string,
 	filename string,
 	expireAfter time.Duration,
 ) (*model.Link, error) {
+	return s.PresignGet(ctx, objectPath, storage.PresignOptions{
+		Expire:   expireAfter,
+		Filename: filename,
+	})
+}
 
-	expireAfter = capDurationToLimits(expireAfter).Truncate(time.Second)
-	bucket, opts, err := s.optionsFromContext(ctx, true)
+// PresignGet implements storage.Presigner; like GetRequest, the expiry is
+// limited to 7 days. The response headers of the options take precedence
+// over the ones from the context.
+func (s *SimpleStorageService) PresignGet(
+	ctx context.Context,
+	objectPath string,
+	presignOpts storage.PresignOptions,
+) (*model.Link, error) {
+	link, _, err := s.presignGet(ctx, objectPath, presignOpts, false)
+	return link, err
+}
+
+// PresignResumable implements storage.ResumablePresigner: the link is
+// signed with an If-Match header for the ETag of the object, so that S3
+// rejects the (range) requests with 412 Precondition Failed once the
+// object is replaced.
+func (s *SimpleStorageService) PresignResumable(
+	ctx context.Context,
+	objectPath string,
+	presignOpts storage.PresignOptions,
+) (*storage.ResumableLink, error) {
+	link, info, err := s.presignGet(ctx, objectPath, presignOpts, true)
 	if err != nil {
 		return nil, err
 	}
+	ret := &storage.ResumableLink{Link: *link}
+	if info.ETag != nil {
+		ret.ETag = *info.ETag
+	}
+	if info.Size != nil {
+		ret.Size = *info.Size
+	}
+	return ret, nil
+}
 
-	if _, err := s.StatObject(ctx, objectPath); err != nil {
-		return nil, errors.WithMessage(err, "s3: head object")
+// presignGet presigns a GET request of the object at path, returning the
+// link and the info of the object signed for; if ifMatch is set, the
+// request is conditional on the ETag of the object.
+func (s *SimpleStorageService) presignGet(
+	ctx context.Context,
+	objectPath string,
+	presignOpts storage.PresignOptions,
+	ifMatch bool,
+) (*model.Link, *storage.ObjectInfo, error) {
+	expireAfter, err := s.presignExpire(presignOpts.Expire)
+	if err != nil {
+		return nil, nil, err
+	}
+	bucket, opts, err := s.optionsFromContext(ctx, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, info, err := s.statObject(ctx, objectPath)
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "s3: head object")
+	}
+	if err = storage.CheckMaxBytes(info, presignOpts.MaxBytes); err != nil {
+		return nil, nil, err
+	}
+	if ifMatch && (info.ETag == nil || *info.ETag == "") {
+		return nil, nil, storage.ErrResumeNotSupported
 	}
 
 	params := &s3.GetObjectInput{
-		Bucket:              aws.String(bucket),
-		Key:                 aws.String(objectPath),
-		ResponseContentType: s.contentType,
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(key),
+		ResponseContentType:  s.contentType,
+		ResponseCacheControl: s.cacheControl,
 	}
+	params.SSECustomerAlgorithm,
+		params.SSECustomerKey,
+		params.SSECustomerKeyMD5 = s.sseCustomerKey.params()
 
-	if filename != "" {
-		contentDisposition := fmt.Sprintf("attachment; filename=\"%s\"", filename)
+	contentDisposition := s.contentDisposition(presignOpts.Filename)
+	if contentDisposition != "" {
 		params.ResponseContentDisposition = &contentDisposition
 	}
+	if hdr, ok := storage.ResponseHeadersFromContext(ctx); ok {
+		if err := applyResponseHeaders(params, hdr); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := applyResponseHeaders(params, presignOpts.ResponseHeaders); err != nil {
+		return nil, nil, err
+	}
+	header := s.sseCustomerKey.headers()
+	if params.IfNoneMatch = ifNoneMatchFromContext(ctx); params.IfNoneMatch != nil {
+		// The header is signed, so the client must send it as is.
+		if header == nil {
+			header = make(map[string]string, 1)
+		}
+		header[headerIfNoneMatch] = *params.IfNoneMatch
+	}
+	if ifMatch {
+		params.IfMatch = info.ETag
+		if header == nil {
+			header = make(map[string]string, 1)
+		}
+		header[headerIfMatch] = *info.ETag
+	}
 
 	signDate := time.Now()
 	req, err := s.presignClient.PresignGetObject(ctx,
@@ -596,7 +1412,7 @@ func (s *SimpleStorageService) GetRequest(
 		s3.WithPresignExpires(expireAfter),
 		s3.WithPresignClientFromClientOptions(opts))
 	if err != nil {
-		return nil, errors.WithMessage(err, "s3: failed to sign GET request")
+		return nil, nil, errors.WithMessage(err, "s3: failed to sign GET request")
 	}
 	if date, err := time.Parse(
 		req.SignedHeader.Get(paramAmzDate), paramAmzDateFormat,
@@ -604,11 +1420,31 @@ func (s *SimpleStorageService) GetRequest(
 		signDate = date
 	}
 
-	return &model.Link{
+	link, err := s.presigned(ctx, objectPath, &model.Link{
 		Uri:    req.URL,
 		Expire: signDate.Add(expireAfter),
 		Method: http.MethodGet,
-	}, nil
+		Header: header,
+	})
+	return link, info, err
+}
+
+// applyResponseHeaders overrides the response headers of a presigned GET
+// request; fields not set in hdr keep the configured defaults.
+func applyResponseHeaders(params *s3.GetObjectInput, hdr storage.ResponseHeaders) error {
+	if hdr.ContentType != "" {
+		if err := validateHeaderValue(&hdr.ContentType); err != nil {
+			return errors.WithMessage(err, "s3: invalid response content type")
+		}
+		params.ResponseContentType = aws.String(hdr.ContentType)
+	}
+	if hdr.ContentDisposition != "" {
+		if err := validateHeaderValue(&hdr.ContentDisposition); err != nil {
+			return errors.WithMessage(err, "s3: invalid response content disposition")
+		}
+		params.ResponseContentDisposition = aws.String(hdr.ContentDisposition)
+	}
+	return nil
 }
 
 // DeleteRequest returns a presigned deletion request
@@ -617,8 +1453,13 @@ func (s *SimpleStorageService) DeleteRequest(
 	path string,
 	expireAfter time.Duration,
 ) (*model.Link, error) {
-
-	expireAfter = capDurationToLimits(expireAfter).Truncate(time.Second)
+	if _, ok := storage.ResponseHeadersFromContext(ctx); ok {
+		return nil, storage.ErrResponseHeadersNotGET
+	}
+	expireAfter, err := s.presignExpire(expireAfter)
+	if err != nil {
+		return nil, err
+	}
 	bucket, opts, err := s.optionsFromContext(ctx, true)
 	if err != nil {
 		return nil, err
@@ -626,7 +1467,7 @@ func (s *SimpleStorageService) DeleteRequest(
 
 	params := &s3.DeleteObjectInput{
 		Bucket: aws.String(bucket),
-		Key:    aws.String(path),
+		Key:    aws.String(s.objectKey(path)),
 	}
 
 	signDate := time.Now()
@@ -643,11 +1484,23 @@ func (s *SimpleStorageService) DeleteRequest(
 		signDate = date
 	}
 
-	return &model.Link{
+	return s.presigned(ctx, path, &model.Link{
 		Uri:    req.URL,
 		Expire: signDate.Add(expireAfter),
 		Method: http.MethodDelete,
-	}, nil
+	})
+}
+
+// presignExpire returns the expiry of a presigned request: the
+// DefaultExpire if expire is zero, limited to ExpireMinLimit and
+// ExpireMaxLimit (7 days). Negative expiry is rejected.
+func (s *SimpleStorageService) presignExpire(expire time.Duration) (time.Duration, error) {
+	if expire < 0 {
+		return 0, ErrPresignExpireNegative
+	} else if expire == 0 {
+		expire = s.defaultExpire
+	}
+	return capDurationToLimits(expire).Truncate(time.Second), nil
 }
 
 // presign requests are limited to 7 days
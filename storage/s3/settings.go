@@ -20,7 +20,6 @@ import (
 	"github.com/mendersoftware/deployments/model"
 	"github.com/mendersoftware/deployments/storage"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/pkg/errors"
 )
@@ -32,23 +31,17 @@ func settingsFromContext(ctx context.Context) *settings {
 	return (*settings)(s)
 }
 
+// endpointResolver resolves the endpoint of the settings' Uri, or the AWS
+// endpoint of the region if no Uri is set.
 func (s settings) endpointResolver(presign bool) (resolver s3.EndpointResolver) {
-	if s.Uri != "" {
-		uri := s.Uri
-		if s.ExternalUri != "" && presign {
-			uri = s.ExternalUri
-		}
-		resolver = s3.EndpointResolverFromURL(
-			uri,
-			func(ep *aws.Endpoint) {
-				ep.HostnameImmutable = s.ForcePathStyle
-				if s.Region != "" {
-					ep.SigningRegion = s.Region
-				}
-			},
-		)
+	if s.Uri == "" {
+		return s3.NewDefaultEndpointResolver()
 	}
-	return resolver
+	uri := s.Uri
+	if s.ExternalUri != "" && presign {
+		uri = s.ExternalUri
+	}
+	return endpointResolver(uri, s.ForcePathStyle, s.Region)
 }
 
 func (s settings) credentials() StaticCredentials {
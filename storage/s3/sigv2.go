@@ -0,0 +1,242 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// Signature versions of the SignatureVersion option.
+const (
+	SignatureVersion2 = "v2"
+	SignatureVersion4 = "v4"
+)
+
+var (
+	validSignatureVersion = validation.In(SignatureVersion2, SignatureVersion4).
+				Error("must be one of v2 or v4")
+
+	errSigV2MissingResource = errors.New("s3: missing resource for signature version 2")
+)
+
+// sigV2SubResources are the query parameters included in the canonicalized
+// resource of signature version 2.
+var sigV2SubResources = map[string]struct{}{
+	"acl":                          {},
+	"cors":                         {},
+	"delete":                       {},
+	"lifecycle":                    {},
+	"location":                     {},
+	"logging":                      {},
+	"notification":                 {},
+	"partNumber":                   {},
+	"policy":                       {},
+	"requestPayment":               {},
+	"restore":                      {},
+	"tagging":                      {},
+	"torrent":                      {},
+	"uploadId":                     {},
+	"uploads":                      {},
+	"versionId":                    {},
+	"versioning":                   {},
+	"versions":                     {},
+	"website":                      {},
+	"response-cache-control":       {},
+	"response-content-disposition": {},
+	"response-content-encoding":    {},
+	"response-content-language":    {},
+	"response-content-type":        {},
+	"response-expires":             {},
+}
+
+// isSignatureVersion2 returns true if the requests are signed with the
+// signature version 2.
+func (opts *Options) isSignatureVersion2() bool {
+	return aws.ToString(opts.SignatureVersion) == SignatureVersion2
+}
+
+type sigV2ResourceKey struct{}
+
+// sigV2ResourceMiddleware records the path of the request before the bucket
+// is moved to the host of virtual-hosted-style requests: signature version
+// 2 signs the path-style resource, /<bucket>/<key>.
+func sigV2ResourceMiddleware(stack *middleware.Stack) error {
+	return stack.Serialize.Insert(middleware.SerializeMiddlewareFunc(
+		"SigV2Resource",
+		func(
+			ctx context.Context,
+			in middleware.SerializeInput,
+			next middleware.SerializeHandler,
+		) (middleware.SerializeOutput, middleware.Metadata, error) {
+			if req, ok := in.Request.(*smithyhttp.Request); ok {
+				ctx = middleware.WithStackValue(ctx,
+					sigV2ResourceKey{}, req.URL.EscapedPath())
+			}
+			return next.HandleSerialize(ctx, in)
+		}), "S3:UpdateEndpoint", middleware.Before)
+}
+
+// sigV2Signer signs requests with the legacy signature version 2 of S3
+// (HMAC-SHA1 of the request), for S3 compatible stores that do not support
+// signature version 4. It implements the version 4 signer interfaces of the
+// s3 client; the payload hash, service and region are not signed.
+type sigV2Signer struct{}
+
+// stringToSign returns the StringToSign of the request; date is the Date
+// header, or the expiry of presigned requests.
+func (sigV2Signer) stringToSign(ctx context.Context, r *http.Request, date string) (string, error) {
+	resource, _ := middleware.GetStackValue(ctx, sigV2ResourceKey{}).(string)
+	if resource == "" {
+		return "", errSigV2MissingResource
+	}
+	var sb strings.Builder
+	sb.WriteString(r.Method + "\n")
+	sb.WriteString(r.Header.Get("Content-MD5") + "\n")
+	sb.WriteString(r.Header.Get("Content-Type") + "\n")
+	sb.WriteString(date + "\n")
+
+	var amzHeaders []string
+	for name, values := range r.Header {
+		name = strings.ToLower(name)
+		if !strings.HasPrefix(name, "x-amz-") {
+			continue
+		}
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.TrimSpace(value)
+		}
+		amzHeaders = append(amzHeaders, name+":"+strings.Join(trimmed, ","))
+	}
+	sort.Strings(amzHeaders)
+	for _, header := range amzHeaders {
+		sb.WriteString(header + "\n")
+	}
+
+	sb.WriteString(resource)
+	query := r.URL.Query()
+	var subResources []string
+	for name := range query {
+		if _, ok := sigV2SubResources[name]; !ok {
+			continue
+		}
+		if value := query.Get(name); value != "" {
+			subResources = append(subResources, name+"="+value)
+		} else {
+			subResources = append(subResources, name)
+		}
+	}
+	sort.Strings(subResources)
+	if len(subResources) > 0 {
+		sb.WriteString("?" + strings.Join(subResources, "&"))
+	}
+	return sb.String(), nil
+}
+
+func (sigV2Signer) signature(credentials aws.Credentials, stringToSign string) string {
+	mac := hmac.New(sha1.New, []byte(credentials.SecretAccessKey))
+	_, _ = mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s sigV2Signer) SignHTTP(
+	ctx context.Context,
+	credentials aws.Credentials,
+	r *http.Request,
+	payloadHash, service, region string,
+	signingTime time.Time,
+	optFns ...func(*v4.SignerOptions),
+) error {
+	r.Header.Del("Authorization")
+	r.Header.Del("X-Amz-Date")
+	r.Header.Set("Date", signingTime.UTC().Format(http.TimeFormat))
+	if credentials.SessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+	stringToSign, err := s.stringToSign(ctx, r, r.Header.Get("Date"))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", "AWS "+credentials.AccessKeyID+":"+
+		s.signature(credentials, stringToSign))
+	return nil
+}
+
+// PresignHTTP presigns the request with the expiry of the X-Amz-Expires
+// query parameter. The headers signed (the x-amz-* headers, Content-MD5 and
+// Content-Type) must be sent with the presigned request.
+func (s sigV2Signer) PresignHTTP(
+	ctx context.Context,
+	credentials aws.Credentials,
+	r *http.Request,
+	payloadHash, service, region string,
+	signingTime time.Time,
+	optFns ...func(*v4.SignerOptions),
+) (string, http.Header, error) {
+	query := r.URL.Query()
+	expires := DefaultExpire
+	if seconds, err := strconv.ParseInt(query.Get("X-Amz-Expires"), 10, 64); err == nil {
+		expires = time.Duration(seconds) * time.Second
+	}
+	query.Del("X-Amz-Expires")
+	expiresAt := strconv.FormatInt(signingTime.Add(expires).Unix(), 10)
+
+	header := r.Header.Clone()
+	if credentials.SessionToken != "" {
+		// The token is signed as header and sent in the query.
+		header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+	stringToSign, err := s.stringToSign(ctx, &http.Request{
+		Method: r.Method,
+		URL:    &url.URL{RawQuery: query.Encode()},
+		Header: header,
+	}, expiresAt)
+	if err != nil {
+		return "", nil, err
+	}
+	if credentials.SessionToken != "" {
+		query.Set("x-amz-security-token", credentials.SessionToken)
+	}
+	query.Set("AWSAccessKeyId", credentials.AccessKeyID)
+	query.Set("Expires", expiresAt)
+	query.Set("Signature", s.signature(credentials, stringToSign))
+
+	u := *r.URL
+	u.RawQuery = query.Encode()
+	signedHeader := make(http.Header)
+	for name, values := range r.Header {
+		switch lower := strings.ToLower(name); {
+		case strings.HasPrefix(lower, "x-amz-"),
+			lower == "content-md5", lower == "content-type":
+			signedHeader[name] = values
+		}
+	}
+	return u.String(), signedHeader, nil
+}
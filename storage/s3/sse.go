@@ -0,0 +1,75 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"crypto/md5" //nolint:gosec
+	"encoding/base64"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	headerSSECustomerAlgorithm = "X-Amz-Server-Side-Encryption-Customer-Algorithm"
+	headerSSECustomerKey       = "X-Amz-Server-Side-Encryption-Customer-Key"
+	headerSSECustomerKeyMD5    = "X-Amz-Server-Side-Encryption-Customer-Key-Md5"
+)
+
+var sseCustomerHeaders = []string{
+	headerSSECustomerAlgorithm,
+	headerSSECustomerKey,
+	headerSSECustomerKeyMD5,
+}
+
+// sseCustomerKey holds the encoded SSE-C request parameters. The parameters
+// are derived once from the raw key when the client is initialized.
+type sseCustomerKey struct {
+	algorithm string
+	key       string
+	keyMD5    string
+}
+
+func newSSECustomerKey(key []byte) *sseCustomerKey {
+	if len(key) == 0 {
+		return nil
+	}
+	sum := md5.Sum(key) //nolint:gosec
+	return &sseCustomerKey{
+		algorithm: string(types.ServerSideEncryptionAes256),
+		key:       base64.StdEncoding.EncodeToString(key),
+		keyMD5:    base64.StdEncoding.EncodeToString(sum[:]),
+	}
+}
+
+// params returns the SSECustomer(Algorithm|Key|KeyMD5) input parameters.
+func (k *sseCustomerKey) params() (algorithm, key, keyMD5 *string) {
+	if k == nil {
+		return nil, nil, nil
+	}
+	return aws.String(k.algorithm), aws.String(k.key), aws.String(k.keyMD5)
+}
+
+// headers returns the headers required for presigned requests.
+func (k *sseCustomerKey) headers() map[string]string {
+	if k == nil {
+		return nil
+	}
+	return map[string]string{
+		headerSSECustomerAlgorithm: k.algorithm,
+		headerSSECustomerKey:       k.key,
+		headerSSECustomerKeyMD5:    k.keyMD5,
+	}
+}
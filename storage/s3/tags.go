@@ -0,0 +1,87 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deployments/storage"
+)
+
+const (
+	tagsMaxCount       = 10
+	tagsMaxKeyLength   = 128
+	tagsMaxValueLength = 256
+)
+
+func validateTags(tags map[string]string) error {
+	if len(tags) > tagsMaxCount {
+		return fmt.Errorf("cannot contain more than %d tags", tagsMaxCount)
+	}
+	for key, value := range tags {
+		if key == "" || utf8.RuneCountInString(key) > tagsMaxKeyLength {
+			return fmt.Errorf(
+				"tag keys must be between 1 and %d characters", tagsMaxKeyLength,
+			)
+		}
+		if utf8.RuneCountInString(value) > tagsMaxValueLength {
+			return fmt.Errorf(
+				"tag %q value must not exceed %d characters",
+				key, tagsMaxValueLength,
+			)
+		}
+	}
+	return nil
+}
+
+func validateTagsRule(value interface{}) error {
+	tags, _ := value.(map[string]string)
+	return validateTags(tags)
+}
+
+// taggingFromContext returns the URL-encoded tag-set for an upload combining
+// the tags from the options with the tags attached to the context, and the
+// ExpiryTag if configured.
+func (s *SimpleStorageService) taggingFromContext(ctx context.Context) (*string, error) {
+	ctxTags, _ := storage.ObjectTagsFromContext(ctx)
+	expiry := s.expiryTag()
+	if len(s.tags) == 0 && len(ctxTags) == 0 && expiry == "" {
+		return nil, nil
+	}
+	tags := make(map[string]string, len(s.tags)+len(ctxTags)+1)
+	for key, value := range s.tags {
+		tags[key] = value
+	}
+	for key, value := range ctxTags {
+		tags[key] = value
+	}
+	if expiry != "" {
+		tags[ExpiryTag] = expiry
+	}
+	if err := validateTags(tags); err != nil {
+		return nil, errors.WithMessage(err, "s3: invalid object tags")
+	}
+	q := make(url.Values, len(tags))
+	for key, value := range tags {
+		q.Set(key, value)
+	}
+	tagging := q.Encode()
+	return &tagging, nil
+}
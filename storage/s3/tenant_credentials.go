@@ -0,0 +1,128 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+// DefaultCredentialsCacheTTL is the duration the credentials returned by
+// the CredentialsResolver are cached for.
+const DefaultCredentialsCacheTTL = 5 * time.Minute
+
+// ErrNoTenantCredentials is returned by a CredentialsResolver for tenants
+// without their own credentials; the operations of the tenant then use the
+// credentials of the storage.
+var ErrNoTenantCredentials = errors.New("s3: no credentials for tenant")
+
+// CredentialsResolver returns the credentials for the operations of the
+// tenant.
+type CredentialsResolver func(ctx context.Context, tenantID string) (aws.Credentials, error)
+
+type tenantCredentialsEntry struct {
+	mu          sync.Mutex
+	credentials aws.Credentials
+	fallback    bool
+	expires     time.Time
+}
+
+// tenantCredentials provides the credentials for the tenant in the
+// identity of the operation context, as resolved by the CredentialsResolver
+// and cached for the ttl, or until shortly before the credentials expire.
+// The credentials are resolved at most once per tenant at a time; other
+// operations of the tenant wait for the result, while the operations of
+// other tenants proceed. Operations without a tenant use the fallback.
+type tenantCredentials struct {
+	resolve  CredentialsResolver
+	fallback aws.CredentialsProvider
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*tenantCredentialsEntry
+}
+
+func newTenantCredentials(
+	resolve CredentialsResolver,
+	fallback aws.CredentialsProvider,
+	ttl time.Duration,
+) *tenantCredentials {
+	return &tenantCredentials{
+		resolve:  resolve,
+		fallback: fallback,
+		ttl:      ttl,
+		entries:  make(map[string]*tenantCredentialsEntry),
+	}
+}
+
+func (c *tenantCredentials) entry(tenantID string) *tenantCredentialsEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[tenantID]
+	if !ok {
+		entry = &tenantCredentialsEntry{}
+		c.entries[tenantID] = entry
+	}
+	return entry
+}
+
+func (c *tenantCredentials) retrieveFallback(ctx context.Context) (aws.Credentials, error) {
+	if c.fallback == nil {
+		return aws.Credentials{}, ErrNoTenantCredentials
+	}
+	return c.fallback.Retrieve(ctx)
+}
+
+func (c *tenantCredentials) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	id := identity.FromContext(ctx)
+	if id == nil || id.Tenant == "" {
+		return c.retrieveFallback(ctx)
+	}
+	entry := c.entry(id.Tenant)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	now := time.Now()
+	if now.Before(entry.expires) {
+		if entry.fallback {
+			return c.retrieveFallback(ctx)
+		}
+		return entry.credentials, nil
+	}
+	credentials, err := c.resolve(ctx, id.Tenant)
+	if errors.Is(err, ErrNoTenantCredentials) {
+		entry.fallback = true
+		entry.expires = now.Add(c.ttl)
+		return c.retrieveFallback(ctx)
+	} else if err != nil {
+		return aws.Credentials{}, fmt.Errorf(
+			"s3: failed to resolve credentials for tenant %s: %w", id.Tenant, err,
+		)
+	}
+	entry.credentials = credentials
+	entry.fallback = false
+	entry.expires = now.Add(c.ttl)
+	if credentials.CanExpire {
+		if expires := credentials.Expires.Add(-credentialsExpiryWindow); expires.Before(entry.expires) {
+			entry.expires = expires
+		}
+	}
+	return credentials, nil
+}
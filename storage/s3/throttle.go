@@ -0,0 +1,147 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// throttleChunkSize is the largest number of bytes a throttled upload sends
+// at once, so that concurrent uploads share the rate evenly.
+const throttleChunkSize = 32 * kib
+
+// rateLimiter is a token bucket shared by the uploads of a client: tokens
+// (bytes) accrue at rate per second, up to one second worth of tokens.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSec int) *rateLimiter {
+	return &rateLimiter{
+		rate:   float64(bytesPerSec),
+		tokens: float64(bytesPerSec),
+		last:   time.Now(),
+	}
+}
+
+// add adds n tokens, or takes them if n is negative, and returns the time
+// until the bucket is no longer in debt.
+func (l *rateLimiter) add(n float64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds()*l.rate + n
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// wait takes n tokens and blocks until they are available, or returns the
+// error of the context once it is done; the tokens are returned then.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	delay := l.add(-float64(n))
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.add(float64(n))
+		return ctx.Err()
+	}
+}
+
+// chunkSize returns the number of bytes to send at once: at most a tenth
+// of a second worth of tokens, so that slow rates are not bursty.
+func (l *rateLimiter) chunkSize() int {
+	chunk := int(l.rate / 10)
+	if chunk > throttleChunkSize {
+		chunk = throttleChunkSize
+	} else if chunk < 1 {
+		chunk = 1
+	}
+	return chunk
+}
+
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (r *throttledReader) Read(b []byte) (int, error) {
+	if chunk := r.limiter.chunkSize(); len(b) > chunk {
+		b = b[:chunk]
+	}
+	n, err := r.r.Read(b)
+	if n > 0 {
+		if errWait := r.limiter.wait(r.ctx, n); errWait != nil {
+			return 0, errWait
+		}
+	}
+	return n, err
+}
+
+// uploadRateLimitMiddleware throttles the bodies of uploads to the rate of
+// the limiter. The body is wrapped for every attempt after the retry
+// middleware, which rewinds the original body.
+func uploadRateLimitMiddleware(limiter *rateLimiter) apiOptions {
+	return func(stack *middleware.Stack) error {
+		if _, presign := stack.Finalize.Get(presignMiddlewareID); presign {
+			return nil
+		}
+		return stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc(
+			"UploadRateLimit", func(
+				ctx context.Context,
+				in middleware.DeserializeInput,
+				next middleware.DeserializeHandler,
+			) (middleware.DeserializeOutput, middleware.Metadata, error) {
+				switch awsmiddleware.GetOperationName(ctx) {
+				case "PutObject", "UploadPart":
+					req, ok := in.Request.(*smithyhttp.Request)
+					if ok && req.GetStream() != nil {
+						req, err := req.SetStream(&throttledReader{
+							ctx:     ctx,
+							r:       req.GetStream(),
+							limiter: limiter,
+						})
+						if err != nil {
+							return middleware.DeserializeOutput{}, middleware.Metadata{}, err
+						}
+						in.Request = req
+					}
+				}
+				return next.HandleDeserialize(ctx, in)
+			}), middleware.After)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Span attributes following the OpenTelemetry semantic conventions.
+const (
+	AttributeRPCSystem        = "rpc.system"
+	AttributeRPCService       = "rpc.service"
+	AttributeRPCMethod        = "rpc.method"
+	AttributeBucket           = "aws.s3.bucket"
+	AttributeKey              = "aws.s3.key"
+	AttributeStatusCode       = "http.response.status_code"
+	AttributeRequestBodySize  = "http.request.body.size"
+	AttributeResponseBodySize = "http.response.body.size"
+)
+
+// Tracer starts the spans of s3 operations. The interface mirrors the
+// subset of the OpenTelemetry trace API used by the storage (see
+// NewOTelTracer).
+type Tracer interface {
+	// Start starts a span as child of the span in ctx, and returns the
+	// context holding the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	// RecordError records the error and sets the status of the span to
+	// error.
+	RecordError(err error)
+	End()
+}
+
+// inputField returns the value of the named field of the operation input,
+// e.g. the Bucket or Key, if set to a non-zero value.
+func inputField(params interface{}, name string) (interface{}, bool) {
+	v := reflect.Indirect(reflect.ValueOf(params))
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+	field := v.FieldByName(name)
+	if !field.IsValid() || field.IsZero() {
+		return nil, false
+	}
+	field = reflect.Indirect(field)
+	if field.IsZero() {
+		return nil, false
+	}
+	return field.Interface(), true
+}
+
+// tracingMiddleware creates a span with the tracer for every operation,
+// including retries. The span is named after the operation, with the
+// "Presign" prefix for presign operations, and has the bucket, key, HTTP
+// status and transferred bytes as attributes.
+func tracingMiddleware(tracer Tracer) apiOptions {
+	return func(stack *middleware.Stack) error {
+		_, presign := stack.Finalize.Get(presignMiddlewareID)
+		mw := middleware.InitializeMiddlewareFunc(
+			"Tracing", func(
+				ctx context.Context,
+				in middleware.InitializeInput,
+				next middleware.InitializeHandler,
+			) (middleware.InitializeOutput, middleware.Metadata, error) {
+				operation := awsmiddleware.GetOperationName(ctx)
+				if presign {
+					operation = "Presign" + operation
+				}
+				ctx, span := tracer.Start(ctx, "S3."+operation)
+				defer span.End()
+				span.SetAttribute(AttributeRPCSystem, "aws-api")
+				span.SetAttribute(AttributeRPCService, "S3")
+				span.SetAttribute(AttributeRPCMethod, operation)
+				for attr, field := range map[string]string{
+					AttributeBucket:          "Bucket",
+					AttributeKey:             "Key",
+					AttributeRequestBodySize: "ContentLength",
+				} {
+					if value, ok := inputField(in.Parameters, field); ok {
+						span.SetAttribute(attr, value)
+					}
+				}
+
+				out, md, err := next.HandleInitialize(ctx, in)
+				var rspErr *smithyhttp.ResponseError
+				if rsp, ok := awsmiddleware.GetRawResponse(md).(*smithyhttp.Response); ok {
+					span.SetAttribute(AttributeStatusCode, rsp.StatusCode)
+					if rsp.ContentLength >= 0 {
+						span.SetAttribute(AttributeResponseBodySize, rsp.ContentLength)
+					}
+				} else if errors.As(err, &rspErr) && rspErr.HTTPStatusCode() > 0 {
+					span.SetAttribute(AttributeStatusCode, rspErr.HTTPStatusCode())
+				}
+				if err != nil {
+					span.RecordError(err)
+				}
+				return out, md, err
+			})
+		metadataID := (&awsmiddleware.RegisterServiceMetadata{}).ID()
+		if _, ok := stack.Initialize.Get(metadataID); ok {
+			return stack.Initialize.Insert(mw, metadataID, middleware.After)
+		}
+		return stack.Initialize.Add(mw, middleware.Before)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	// ErrTooManyParts is returned by PutObject if the object does not fit
+	// in the maximum number of parts of a multipart upload.
+	ErrTooManyParts = errors.New("s3: object exceeds the maximum number of upload parts")
+	// ErrObjectTooLarge is matched by the ObjectTooLargeError returned by
+	// PutObject for objects exceeding the upload limit.
+	ErrObjectTooLarge = errors.New("s3: object too large")
+)
+
+// ObjectTooLargeError is returned by PutObject if the object exceeds the
+// upload limit of MultipartMaxParts parts of PartSize bytes. Objects of
+// known size are rejected before anything is uploaded; streams are aborted
+// once the limit is exceeded. errors.Is matches both ErrObjectTooLarge and
+// ErrTooManyParts.
+type ObjectTooLargeError struct {
+	// Size of the object, or the bytes read from a stream of unknown size
+	// when the limit was exceeded.
+	Size int64
+	// Limit is the maximum size of an upload in bytes.
+	Limit int64
+}
+
+func (err *ObjectTooLargeError) Error() string {
+	return fmt.Sprintf("s3: object size of %d bytes exceeds the upload limit of %d bytes",
+		err.Size, err.Limit)
+}
+
+func (err *ObjectTooLargeError) Is(target error) bool {
+	return target == ErrObjectTooLarge || target == ErrTooManyParts
+}
+
+// maxUploadSize returns the size limit of multipart uploads.
+func (s *SimpleStorageService) maxUploadSize() int64 {
+	return int64(s.partSize) * MultipartMaxParts
+}
+
+// checkUploadSize returns an ObjectTooLargeError if an object of size bytes
+// exceeds the upload limit.
+func (s *SimpleStorageService) checkUploadSize(size int64) error {
+	if limit := s.maxUploadSize(); size > limit {
+		return &ObjectTooLargeError{Size: size, Limit: limit}
+	}
+	return nil
+}
+
+// nextPart returns the body of the next part of a multipart upload and its
+// size, or a nil body after the last part. The body is seekable, so that
+// the SDK can rewind it to retry the request.
+type nextPart func() (body io.ReadSeeker, size int64, err error)
+
+// bufferedParts reads the parts from a stream into buf.
+func bufferedParts(buf []byte, src io.Reader) nextPart {
+	var done bool
+	return func() (io.ReadSeeker, int64, error) {
+		if done {
+			return nil, 0, nil
+		}
+		n, err := fillBuffer(buf, src)
+		if err == io.EOF {
+			done, err = true, nil
+		}
+		if err != nil || n == 0 {
+			return nil, 0, err
+		}
+		return bytes.NewReader(buf[:n]), int64(n), nil
+	}
+}
+
+// seekableParts returns consecutive sections of size bytes starting at
+// start of rs as parts of at most partSize bytes; the parts are not
+// buffered.
+func seekableParts(rs io.ReadSeeker, start, size, partSize int64) nextPart {
+	var offset int64
+	return func() (io.ReadSeeker, int64, error) {
+		if offset >= size {
+			return nil, 0, nil
+		}
+		n := size - offset
+		if n > partSize {
+			n = partSize
+		}
+		part := newSection(rs, start+offset, n)
+		offset += n
+		return part, n, nil
+	}
+}
+
+// seekableSize returns the current position of rs and the number of bytes
+// remaining from there. An error is returned if rs cannot seek, e.g. if it
+// is a pipe.
+func seekableSize(rs io.ReadSeeker) (start, size int64, err error) {
+	start, err = rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, 0, err
+	}
+	_, err = rs.Seek(start, io.SeekStart)
+	return start, end - start, err
+}
+
+// newSection returns a reader for size bytes of rs starting at offset.
+// Readers implementing io.ReaderAt are read without seeking.
+func newSection(rs io.ReadSeeker, offset, size int64) io.ReadSeeker {
+	if ra, ok := rs.(io.ReaderAt); ok {
+		return io.NewSectionReader(ra, offset, size)
+	}
+	return &seekSection{rs: rs, base: offset, size: size}
+}
+
+// seekSection is a section of a reader that only implements io.Seeker.
+// The underlying reader is positioned before the first read after a seek,
+// so sections of the same reader must not be read concurrently.
+type seekSection struct {
+	rs         io.ReadSeeker
+	base, size int64
+	pos        int64
+	positioned bool
+}
+
+func (s *seekSection) Read(b []byte) (int, error) {
+	if s.pos >= s.size {
+		return 0, io.EOF
+	}
+	if !s.positioned {
+		if _, err := s.rs.Seek(s.base+s.pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+		s.positioned = true
+	}
+	if remaining := s.size - s.pos; int64(len(b)) > remaining {
+		b = b[:remaining]
+	}
+	n, err := s.rs.Read(b)
+	s.pos += int64(n)
+	if err == io.EOF && s.pos < s.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (s *seekSection) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, errors.New("s3: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("s3: negative position")
+	}
+	s.pos = offset
+	s.positioned = false
+	return offset, nil
+}
+
+const spillPattern = "deployments-upload-*"
+
+// checkSpillDir verifies that temporary files can be created in dir.
+func checkSpillDir(dir string) error {
+	f, err := os.CreateTemp(dir, spillPattern)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// contextReader fails reads once the context is done, so that streamed and
+// spilled uploads stop reading the source when the upload is canceled. A
+// read blocked in the source is not interrupted.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(b []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(b)
+}
+
+// spill writes the peeked bytes and the rest of src to a temporary file in
+// dir. The file is positioned at the start; the caller must close and
+// remove it. The file is removed if spilling fails or ctx is done.
+func spill(
+	ctx context.Context,
+	dir string,
+	peeked []byte,
+	src io.Reader,
+) (f *os.File, size int64, err error) {
+	f, err = os.CreateTemp(dir, spillPattern)
+	if err != nil {
+		return nil, 0, err
+	}
+	n, err := f.Write(peeked)
+	size = int64(n)
+	if err == nil {
+		var copied int64
+		copied, err = io.Copy(f, contextReader{ctx: ctx, r: src})
+		size += copied
+		if err == nil {
+			_, err = f.Seek(0, io.SeekStart)
+		}
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, 0, err
+	}
+	return f, size, nil
+}
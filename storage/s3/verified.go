@@ -0,0 +1,118 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// ErrChecksumUnknown is returned by GetObjectVerified if no SHA256 sum is
+// expected and none is stored with the object.
+var ErrChecksumUnknown = errors.New("s3: no SHA256 sum to verify the object")
+
+// putWithSHA256 uploads like putSeekable, storing the SHA256 sum of the
+// data in the object metadata.
+func (s *SimpleStorageService) putWithSHA256(
+	ctx context.Context,
+	key string,
+	rs io.ReadSeeker,
+	start, size int64,
+) error {
+	sum, err := sectionSHA256(rs, start, size)
+	if err != nil {
+		return err
+	}
+	return s.putSeekable(
+		withUploadMetadata(ctx, metaContentSHA256, sum),
+		key, rs, start, size,
+	)
+}
+
+// verifiedReader hashes the object while it is read and fails the read
+// reaching the end of the object if the sum does not match.
+type verifiedReader struct {
+	io.ReadCloser
+	length   int64
+	digest   hash.Hash
+	expected string
+	err      error
+}
+
+func (r *verifiedReader) Length() int64 {
+	return r.length
+}
+
+func (r *verifiedReader) Read(b []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.ReadCloser.Read(b)
+	_, _ = r.digest.Write(b[:n])
+	if err == io.EOF {
+		sum := hex.EncodeToString(r.digest.Sum(nil))
+		if sum != r.expected {
+			err = fmt.Errorf("%w: expected SHA256 %q, got %q",
+				ErrIntegrityMismatch, r.expected, sum)
+		}
+	}
+	r.err = err
+	return n, err
+}
+
+// GetObjectVerified returns the object at path like GetObject and hashes
+// the data while it is read. Reading the end of the object returns
+// ErrIntegrityMismatch instead of io.EOF if the SHA256 sum of the data
+// does not match expectedSHA256 (hex encoded); the caller must not use the
+// data before reading it to the end. If expectedSHA256 is empty, the sum
+// stored with the object on upload (see StoreSHA256) is expected.
+//
+// If both sums are known and differ, the stored object is corrupted and
+// ErrIntegrityMismatch is returned without reading the object.
+func (s *SimpleStorageService) GetObjectVerified(
+	ctx context.Context,
+	path string,
+	expectedSHA256 string,
+) (io.ReadCloser, error) {
+	out, err := s.getObject(ctx, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	expected := strings.ToLower(expectedSHA256)
+	stored := out.Metadata[metaContentSHA256]
+	switch {
+	case expected == "" && stored == "":
+		out.Body.Close()
+		return nil, ErrChecksumUnknown
+	case expected == "":
+		expected = stored
+	case stored != "" && stored != expected:
+		out.Body.Close()
+		return nil, fmt.Errorf("%w: expected SHA256 %q, stored %q",
+			ErrIntegrityMismatch, expected, stored)
+	}
+	return &verifiedReader{
+		ReadCloser: out.Body,
+		length:     out.ContentLength,
+		digest:     sha256.New(),
+		expected:   expected,
+	}, nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	"github.com/mendersoftware/deployments/storage"
+)
+
+// waitMaxPollInterval limits the backoff between the polls of
+// WaitForObject.
+const waitMaxPollInterval = 30 * time.Second
+
+var (
+	ErrWaitTimeout = errors.New("s3: timed out waiting for the object")
+
+	errPollInterval = errors.New("s3: poll interval must be positive")
+)
+
+// WaitForObject polls the object at path until it exists and returns its
+// properties, e.g. to learn when an upload through a presigned PUT link
+// finished without bucket event notifications. The interval between the
+// polls starts at pollInterval and doubles up to 30 seconds (or
+// pollInterval, if longer) while the object does not exist. Since S3 compatible services may be eventually
+// consistent, the object is only returned once two consecutive polls,
+// pollInterval apart, report the same size and ETag.
+//
+// ErrWaitTimeout is returned if the object does not appear within timeout;
+// a timeout of zero waits until ctx is done.
+func (s *SimpleStorageService) WaitForObject(
+	ctx context.Context,
+	path string,
+	pollInterval, timeout time.Duration,
+) (*storage.ObjectInfo, error) {
+	if pollInterval <= 0 {
+		return nil, errPollInterval
+	}
+	parent := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	maxBackoff := waitMaxPollInterval
+	if pollInterval > maxBackoff {
+		maxBackoff = pollInterval
+	}
+	var (
+		backoff = pollInterval
+		last    *storage.ObjectInfo
+	)
+	for {
+		wait := pollInterval
+		info, err := s.StatObject(ctx, path)
+		switch {
+		case ctx.Err() != nil:
+			return nil, waitError(parent, path)
+		case err == nil:
+			if last != nil && sameObject(last, info) {
+				return info, nil
+			}
+			// Check again soon whether the object is stable.
+			last, backoff = info, pollInterval
+		case errors.Is(err, storage.ErrObjectNotFound):
+			if last == nil {
+				wait = backoff
+				if backoff *= 2; backoff > maxBackoff {
+					backoff = maxBackoff
+				}
+			}
+			last = nil
+		default:
+			return nil, err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, waitError(parent, path)
+		}
+	}
+}
+
+func sameObject(a, b *storage.ObjectInfo) bool {
+	return aws.ToInt64(a.Size) == aws.ToInt64(b.Size) &&
+		aws.ToString(a.ETag) == aws.ToString(b.ETag)
+}
+
+// waitError returns ErrWaitTimeout if ctx expired and the context of the
+// caller is not done.
+func waitError(parent context.Context, path string) error {
+	if parent.Err() == nil {
+		return fmt.Errorf("%w: %s", ErrWaitTimeout, path)
+	}
+	return parent.Err()
+}
@@ -0,0 +1,181 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const contentTypeDefault = "application/octet-stream"
+
+// ServeObject streams the object at path from objStore to w in response to
+// the request r. The object is served as stored, with the Content-Encoding
+// of the object; ranges refer to the encoded data, as in HTTP. A single
+// byte range in the Range header is honored, unless an If-Range header does
+// not match the ETag or modification time of the object; multiple ranges
+// are ignored and the whole object is served. An unsatisfiable range is
+// answered with 416 Range Not Satisfiable.
+//
+// Errors from the storage, such as ErrObjectNotFound, are returned before
+// anything is written to w, so the caller can write the error response.
+// Errors while streaming the object are returned after the response has
+// been started; the caller can only log them.
+func ServeObject(
+	ctx context.Context,
+	objStore ObjectStorage,
+	w http.ResponseWriter,
+	r *http.Request,
+	path string,
+) error {
+	info, err := objStore.StatObject(ctx, path)
+	if err != nil {
+		return err
+	}
+	var size int64
+	if info.Size != nil {
+		size = *info.Size
+	}
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader != "" && !ifRangeMatches(r.Header.Get("If-Range"), info) {
+		rangeHeader = ""
+	}
+	offset, length, ok := parseRange(rangeHeader, size)
+	hdr := w.Header()
+	if !ok {
+		setObjectHeaders(hdr, info)
+		hdr.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return nil
+	}
+
+	var (
+		body         io.ReadCloser
+		status       = http.StatusOK
+		contentRange string
+	)
+	if length < 0 {
+		body, err = objStore.GetObject(ctx, path)
+		length = size
+	} else {
+		var rd RangeReader
+		rd, err = objStore.GetObjectRange(ctx, path, offset, length)
+		if err == nil {
+			body = rd
+			length = rd.Length()
+			status = http.StatusPartialContent
+			contentRange = rd.ContentRange()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	setObjectHeaders(hdr, info)
+	if contentRange != "" {
+		hdr.Set("Content-Range", contentRange)
+	}
+	hdr.Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	_, err = io.Copy(w, body)
+	return err
+}
+
+func setObjectHeaders(hdr http.Header, info *ObjectInfo) {
+	hdr.Set("Accept-Ranges", "bytes")
+	if info.ETag != nil && *info.ETag != "" {
+		hdr.Set("ETag", *info.ETag)
+	}
+	if info.LastModified != nil {
+		hdr.Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	}
+	contentType := contentTypeDefault
+	if info.ContentType != nil && *info.ContentType != "" {
+		contentType = *info.ContentType
+	}
+	hdr.Set("Content-Type", contentType)
+	if info.ContentEncoding != nil && *info.ContentEncoding != "" {
+		hdr.Set("Content-Encoding", *info.ContentEncoding)
+	}
+}
+
+// ifRangeMatches returns true if the If-Range header value is empty or
+// matches the strong ETag or the modification time of the object.
+func ifRangeMatches(ifRange string, info *ObjectInfo) bool {
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) {
+		return info.ETag != nil && ifRange == *info.ETag
+	}
+	t, err := http.ParseTime(ifRange)
+	return err == nil && info.LastModified != nil &&
+		info.LastModified.Truncate(time.Second).Equal(t)
+}
+
+// parseRange parses the Range header for an object of size bytes, returning
+// the offset and length of the range; a negative length selects the whole
+// object. Unsupported ranges select the whole object, ok is false if the
+// range cannot be satisfied.
+func parseRange(rangeHeader string, size int64) (offset, length int64, ok bool) {
+	if !strings.HasPrefix(rangeHeader, "bytes=") ||
+		strings.Contains(rangeHeader, ",") {
+		return 0, -1, true
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(rangeHeader, "bytes="))
+	first, last, found := strings.Cut(spec, "-")
+	if !found {
+		return 0, -1, true
+	}
+	if first == "" {
+		// Suffix range: the last bytes of the object.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, -1, true
+		} else if n == 0 || size == 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true
+	}
+	offset, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, -1, true
+	} else if offset >= size {
+		return 0, 0, false
+	}
+	if last == "" {
+		return offset, size - offset, true
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil || end < offset {
+		return 0, -1, true
+	}
+	if end >= size {
+		end = size - 1
+	}
+	return offset, end - offset + 1, true
+}
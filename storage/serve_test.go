@@ -0,0 +1,229 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memObjectStorage struct {
+	ObjectStorage
+	data    []byte
+	etag    string
+	modTime time.Time
+}
+
+func (m *memObjectStorage) StatObject(ctx context.Context, path string) (*ObjectInfo, error) {
+	if path != "artifact" {
+		return nil, ErrObjectNotFound
+	}
+	size := int64(len(m.data))
+	return &ObjectInfo{
+		Path:         path,
+		Size:         &size,
+		ETag:         &m.etag,
+		LastModified: &m.modTime,
+	}, nil
+}
+
+type memRangeReader struct {
+	io.ReadCloser
+	length       int64
+	contentRange string
+}
+
+func (r memRangeReader) Length() int64        { return r.length }
+func (r memRangeReader) ContentRange() string { return r.contentRange }
+
+func (m *memObjectStorage) GetObject(ctx context.Context, path string) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(m.data)), nil
+}
+
+func (m *memObjectStorage) GetObjectRange(
+	ctx context.Context,
+	path string,
+	offset, length int64,
+) (RangeReader, error) {
+	end := offset + length
+	return memRangeReader{
+		ReadCloser:   io.NopCloser(bytes.NewReader(m.data[offset:end])),
+		length:       length,
+		contentRange: fmt.Sprintf("bytes %d-%d/%d", offset, end-1, len(m.data)),
+	}, nil
+}
+
+func TestServeObject(t *testing.T) {
+	t.Parallel()
+	modTime := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	objStore := &memObjectStorage{
+		data:    []byte("0123456789"),
+		etag:    `"etag"`,
+		modTime: modTime,
+	}
+
+	testCases := []struct {
+		Name    string
+		Path    string
+		Method  string
+		Headers map[string]string
+
+		Status       int
+		Body         string
+		ContentRange string
+		Error        error
+	}{{
+		Name:   "full download",
+		Status: http.StatusOK,
+		Body:   "0123456789",
+	}, {
+		Name:    "partial range",
+		Headers: map[string]string{"Range": "bytes=2-5"},
+
+		Status:       http.StatusPartialContent,
+		Body:         "2345",
+		ContentRange: "bytes 2-5/10",
+	}, {
+		Name:    "open range",
+		Headers: map[string]string{"Range": "bytes=7-"},
+
+		Status:       http.StatusPartialContent,
+		Body:         "789",
+		ContentRange: "bytes 7-9/10",
+	}, {
+		Name:    "suffix range",
+		Headers: map[string]string{"Range": "bytes=-3"},
+
+		Status:       http.StatusPartialContent,
+		Body:         "789",
+		ContentRange: "bytes 7-9/10",
+	}, {
+		Name:    "range past the end",
+		Headers: map[string]string{"Range": "bytes=8-20"},
+
+		Status:       http.StatusPartialContent,
+		Body:         "89",
+		ContentRange: "bytes 8-9/10",
+	}, {
+		Name:    "multiple ranges serve the object",
+		Headers: map[string]string{"Range": "bytes=0-1,4-5"},
+
+		Status: http.StatusOK,
+		Body:   "0123456789",
+	}, {
+		Name:    "unsatisfiable range",
+		Headers: map[string]string{"Range": "bytes=10-"},
+
+		Status:       http.StatusRequestedRangeNotSatisfiable,
+		ContentRange: "bytes */10",
+	}, {
+		Name: "If-Range ETag matches",
+		Headers: map[string]string{
+			"Range":    "bytes=2-5",
+			"If-Range": `"etag"`,
+		},
+
+		Status:       http.StatusPartialContent,
+		Body:         "2345",
+		ContentRange: "bytes 2-5/10",
+	}, {
+		Name: "If-Range ETag changed",
+		Headers: map[string]string{
+			"Range":    "bytes=2-5",
+			"If-Range": `"other"`,
+		},
+
+		Status: http.StatusOK,
+		Body:   "0123456789",
+	}, {
+		Name: "If-Range date matches",
+		Headers: map[string]string{
+			"Range":    "bytes=2-5",
+			"If-Range": modTime.Format(http.TimeFormat),
+		},
+
+		Status:       http.StatusPartialContent,
+		Body:         "2345",
+		ContentRange: "bytes 2-5/10",
+	}, {
+		Name: "If-Range date changed",
+		Headers: map[string]string{
+			"Range":    "bytes=2-5",
+			"If-Range": modTime.Add(-time.Hour).Format(http.TimeFormat),
+		},
+
+		Status: http.StatusOK,
+		Body:   "0123456789",
+	}, {
+		Name:    "HEAD request",
+		Method:  http.MethodHead,
+		Headers: map[string]string{"Range": "bytes=2-5"},
+
+		Status:       http.StatusPartialContent,
+		ContentRange: "bytes 2-5/10",
+	}, {
+		Name: "error/object not found",
+		Path: "missing",
+
+		Error: ErrObjectNotFound,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			method := tc.Method
+			if method == "" {
+				method = http.MethodGet
+			}
+			path := tc.Path
+			if path == "" {
+				path = "artifact"
+			}
+			req := httptest.NewRequest(method, "/download", nil)
+			for key, value := range tc.Headers {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			err := ServeObject(context.Background(), objStore, w, req, path)
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+				assert.Empty(t, w.Header())
+				return
+			}
+			assert.NoError(t, err)
+			rsp := w.Result()
+			assert.Equal(t, tc.Status, rsp.StatusCode)
+			assert.Equal(t, tc.Body, w.Body.String())
+			assert.Equal(t, tc.ContentRange, rsp.Header.Get("Content-Range"))
+			assert.Equal(t, "bytes", rsp.Header.Get("Accept-Ranges"))
+			assert.Equal(t, `"etag"`, rsp.Header.Get("ETag"))
+			if tc.Status != http.StatusRequestedRangeNotSatisfiable {
+				assert.Equal(t, contentTypeDefault, rsp.Header.Get("Content-Type"))
+				if method == http.MethodGet {
+					assert.Equal(t, fmt.Sprint(len(tc.Body)),
+						rsp.Header.Get("Content-Length"))
+				}
+			}
+		})
+	}
+}
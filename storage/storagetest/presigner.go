@@ -0,0 +1,131 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package storagetest implements conformance tests of the contracts in
+// package storage, to be run by the tests of the storage backends.
+package storagetest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/storage"
+)
+
+// TestPresigner runs the conformance tests of the storage.Presigner
+// contract against p. The object at path must exist with the content and
+// client must reach the URLs of the presigned links. The storage must use
+// its default content-disposition for downloads.
+func TestPresigner(
+	t *testing.T,
+	p storage.Presigner,
+	client *http.Client,
+	path string,
+	content []byte,
+) {
+	ctx := context.Background()
+	download := func(t *testing.T, link *model.Link) *http.Response {
+		req, err := http.NewRequest(link.Method, link.Uri, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, value := range link.Header {
+			req.Header.Set(key, value)
+		}
+		rsp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { rsp.Body.Close() })
+		return rsp
+	}
+
+	t.Run("expire", func(t *testing.T) {
+		before := time.Now()
+		link, err := p.PresignGet(ctx, path, storage.PresignOptions{
+			Expire: time.Hour,
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.MethodGet, link.Method)
+		// The expiry is absolute and may be truncated to seconds.
+		assert.WithinRange(t, link.Expire,
+			before.Add(time.Hour-2*time.Second), time.Now().Add(time.Hour))
+
+		rsp := download(t, link)
+		body, err := io.ReadAll(rsp.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rsp.StatusCode)
+		assert.Equal(t, content, body)
+	})
+
+	t.Run("default expire", func(t *testing.T) {
+		link, err := p.PresignGet(ctx, path, storage.PresignOptions{})
+		if assert.NoError(t, err) {
+			assert.True(t, link.Expire.After(time.Now()),
+				"link expired at %s", link.Expire)
+		}
+	})
+
+	t.Run("filename", func(t *testing.T) {
+		const filename = `bär "1".mender`
+		link, err := p.PresignGet(ctx, path, storage.PresignOptions{
+			Filename: filename,
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+		rsp := download(t, link)
+		assert.Equal(t, http.StatusOK, rsp.StatusCode)
+		assert.Equal(t, storage.AttachmentDisposition(filename),
+			rsp.Header.Get("Content-Disposition"))
+	})
+
+	t.Run("response headers", func(t *testing.T) {
+		link, err := p.PresignGet(ctx, path, storage.PresignOptions{
+			Filename: "bar.mender",
+			ResponseHeaders: storage.ResponseHeaders{
+				ContentType:        "application/vnd.mender-artifact",
+				ContentDisposition: "inline",
+			},
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+		rsp := download(t, link)
+		assert.Equal(t, http.StatusOK, rsp.StatusCode)
+		assert.Equal(t, "application/vnd.mender-artifact", rsp.Header.Get("Content-Type"))
+		assert.Equal(t, "inline", rsp.Header.Get("Content-Disposition"))
+	})
+
+	t.Run("max bytes", func(t *testing.T) {
+		size := int64(len(content))
+		_, err := p.PresignGet(ctx, path, storage.PresignOptions{MaxBytes: size})
+		assert.NoError(t, err)
+		_, err = p.PresignGet(ctx, path, storage.PresignOptions{MaxBytes: size - 1})
+		assert.ErrorIs(t, err, storage.ErrMaxBytesExceeded)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := p.PresignGet(ctx, path+".missing", storage.PresignOptions{})
+		assert.ErrorIs(t, err, storage.ErrObjectNotFound)
+	})
+}
@@ -0,0 +1,31 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package storage
+
+import "context"
+
+type objectTagsContextKey struct{}
+
+// ObjectTagsWithContext attaches tags to the objects uploaded with the
+// returned context. The tags are merged with (and take precedence over) the
+// tags configured for the storage backend.
+func ObjectTagsWithContext(ctx context.Context, tags map[string]string) context.Context {
+	return context.WithValue(ctx, objectTagsContextKey{}, tags)
+}
+
+func ObjectTagsFromContext(ctx context.Context) (map[string]string, bool) {
+	tags, ok := ctx.Value(objectTagsContextKey{}).(map[string]string)
+	return tags, ok
+}
@@ -0,0 +1,34 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrListingNotSupported = errors.New("storage does not support listing objects")
+
+// ObjectWalker is implemented by the object storages that can list their
+// objects, for maintenance of the stored objects.
+type ObjectWalker interface {
+	// WalkObjects calls fn for each object with a path starting with
+	// prefix, in lexicographical order of the paths, fetching the
+	// objects a page at a time. At most maxKeys objects are visited;
+	// maxKeys <= 0 visits all objects. If fn returns an error, the walk
+	// stops and the error is returned.
+	WalkObjects(ctx context.Context, prefix string, maxKeys int,
+		fn func(*ObjectInfo) error) error
+}
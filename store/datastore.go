@@ -47,6 +47,9 @@ type DataStore interface {
 		deviceTypesCompatible []string) (bool, error)
 	DeleteImage(ctx context.Context, id string) error
 	ListImages(ctx context.Context, filt *model.ReleaseOrImageFilter) ([]*model.Image, int, error)
+	// FindImageIDs returns an iterator over the images in ascending order
+	// of their ID; only the ID, size and modification time are decoded.
+	FindImageIDs(ctx context.Context) (Iterator[model.Image], error)
 
 	//artifact getter
 	ImagesByName(ctx context.Context,
@@ -378,6 +378,29 @@ func (_m *DataStore) FindImageByID(ctx context.Context, id string) (*model.Image
 	return r0, r1
 }
 
+// FindImageIDs provides a mock function with given fields: ctx
+func (_m *DataStore) FindImageIDs(ctx context.Context) (store.Iterator[model.Image], error) {
+	ret := _m.Called(ctx)
+
+	var r0 store.Iterator[model.Image]
+	if rf, ok := ret.Get(0).(func(context.Context) store.Iterator[model.Image]); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(store.Iterator[model.Image])
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // FindLatestInactiveDeviceDeployment provides a mock function with given fields: ctx, deviceID
 func (_m *DataStore) FindLatestInactiveDeviceDeployment(ctx context.Context, deviceID string) (*model.DeviceDeployment, error) {
 	ret := _m.Called(ctx, deviceID)
@@ -47,6 +47,7 @@ const (
 	CollectionDevicesLastStatus    = "devices_last_status"
 	CollectionStorageSettings      = "settings"
 	CollectionUploadIntents        = "uploads"
+	CollectionMultipartUploads     = "multipart_uploads"
 )
 
 const DefaultDocumentLimit = 20
@@ -88,6 +89,9 @@ var (
 	// Indexes 1.2.13
 	IndexArtifactProvidesName = "artifact_provides"
 
+	// Indexes 1.2.15
+	IndexMultipartUploadObjectName = "multipart_upload_object"
+
 	_false         = false
 	_true          = true
 	StorageIndexes = mongo.IndexModel{
@@ -910,6 +914,25 @@ func (db *DataStoreMongo) FindUploadLinks(
 	return IteratorFromCursor[model.UploadLink](cur), err
 }
 
+// FindImageIDs returns an iterator over the images sorted by ID, decoding
+// only the ID, size and modification time, for scanning all images without
+// loading them into memory.
+func (db *DataStoreMongo) FindImageIDs(
+	ctx context.Context,
+) (store.Iterator[model.Image], error) {
+	database := db.client.Database(mstore.DbFromContext(ctx, DatabaseName))
+	collImg := database.Collection(CollectionImages)
+
+	findOptions := mopts.Find().
+		SetProjection(bson.M{
+			StorageKeyImageSize: 1,
+			"modified":          1,
+		}).
+		SetSort(bson.D{{Key: "_id", Value: 1}})
+	cur, err := collImg.Find(ctx, bson.D{}, findOptions)
+	return IteratorFromCursor[model.Image](cur), err
+}
+
 // FindImageByID search storage for image with ID, returns nil if not found
 func (db *DataStoreMongo) FindImageByID(ctx context.Context,
 	id string) (*model.Image, error) {
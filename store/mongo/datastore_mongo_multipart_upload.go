@@ -0,0 +1,99 @@
+// Copyright 2023 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/store"
+)
+
+// InsertMultipartUpload records a multipart upload to resume it later.
+func (db *DataStoreMongo) InsertMultipartUpload(
+	ctx context.Context,
+	upload *model.MultipartUpload,
+) error {
+	collUploads := db.client.
+		Database(DatabaseName).
+		Collection(CollectionMultipartUploads)
+	now := time.Now()
+	upload.CreatedTS = now
+	upload.UpdatedTS = now
+	if upload.Parts == nil {
+		upload.Parts = []model.MultipartUploadPart{}
+	}
+	_, err := collUploads.InsertOne(ctx, upload)
+	return err
+}
+
+// AddMultipartUploadPart appends an uploaded part to the multipart upload.
+func (db *DataStoreMongo) AddMultipartUploadPart(
+	ctx context.Context,
+	uploadID string,
+	part model.MultipartUploadPart,
+) error {
+	collUploads := db.client.
+		Database(DatabaseName).
+		Collection(CollectionMultipartUploads)
+	res, err := collUploads.UpdateOne(ctx, bson.D{
+		{Key: "_id", Value: uploadID},
+	}, bson.D{
+		{Key: "$push", Value: bson.D{{Key: "parts", Value: part}}},
+		{Key: "$set", Value: bson.D{{Key: "updated_ts", Value: time.Now()}}},
+	})
+	if err != nil {
+		return err
+	} else if res.MatchedCount == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+// FindMultipartUpload returns the multipart upload of the object, or nil
+// if there is none.
+func (db *DataStoreMongo) FindMultipartUpload(
+	ctx context.Context,
+	bucket, key string,
+) (*model.MultipartUpload, error) {
+	collUploads := db.client.
+		Database(DatabaseName).
+		Collection(CollectionMultipartUploads)
+	var upload model.MultipartUpload
+	err := collUploads.FindOne(ctx, bson.D{
+		{Key: "bucket", Value: bucket},
+		{Key: "key", Value: key},
+	}).Decode(&upload)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// DeleteMultipartUpload removes the multipart upload; removing an upload
+// that does not exist is not an error.
+func (db *DataStoreMongo) DeleteMultipartUpload(ctx context.Context, uploadID string) error {
+	collUploads := db.client.
+		Database(DatabaseName).
+		Collection(CollectionMultipartUploads)
+	_, err := collUploads.DeleteOne(ctx, bson.D{{Key: "_id", Value: uploadID}})
+	return err
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/store"
+)
+
+func TestMultipartUploads(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMultipartUploads in short mode.")
+	}
+	db.Wipe()
+
+	ctx := context.Background()
+	ds := NewDataStoreMongoWithClient(db.Client())
+
+	upload, err := ds.FindMultipartUpload(ctx, "bucket", "foo")
+	assert.NoError(t, err)
+	assert.Nil(t, upload)
+
+	err = ds.InsertMultipartUpload(ctx, &model.MultipartUpload{
+		UploadID: "upload",
+		Bucket:   "bucket",
+		Key:      "foo",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	parts := []model.MultipartUploadPart{{
+		PartNumber: 1,
+		Size:       5,
+		ETag:       `"etag-1"`,
+		MD5:        "md5-1",
+	}, {
+		PartNumber: 2,
+		Size:       3,
+		ETag:       `"etag-2"`,
+		MD5:        "md5-2",
+	}}
+	for _, part := range parts {
+		assert.NoError(t, ds.AddMultipartUploadPart(ctx, "upload", part))
+	}
+	err = ds.AddMultipartUploadPart(ctx, "unknown", parts[0])
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	upload, err = ds.FindMultipartUpload(ctx, "bucket", "foo")
+	if assert.NoError(t, err) && assert.NotNil(t, upload) {
+		assert.Equal(t, "upload", upload.UploadID)
+		assert.Equal(t, parts, upload.Parts)
+		assert.False(t, upload.UpdatedTS.Before(upload.CreatedTS))
+	}
+	upload, err = ds.FindMultipartUpload(ctx, "other", "foo")
+	assert.NoError(t, err)
+	assert.Nil(t, upload)
+
+	assert.NoError(t, ds.DeleteMultipartUpload(ctx, "upload"))
+	assert.NoError(t, ds.DeleteMultipartUpload(ctx, "upload"))
+	upload, err = ds.FindMultipartUpload(ctx, "bucket", "foo")
+	assert.NoError(t, err)
+	assert.Nil(t, upload)
+}
@@ -567,3 +567,63 @@ func TestListImages(t *testing.T) {
 		})
 	}
 }
+
+func TestFindImageIDs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestFindImageIDs in short mode.")
+	}
+	db.Wipe()
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "tenant",
+	})
+	ds := NewDataStoreMongoWithClient(db.Client())
+	ids := []string{
+		"6d4f6e27-c3bb-438c-ad9c-d9de30e59d82",
+		"1ea293ad-c94b-44b7-a137-af1dd9d6b126",
+		"94a89c91-a905-4c3a-8bfa-62a362851c1f",
+	}
+	for _, id := range ids {
+		err := ds.InsertImage(ctx, &model.Image{
+			Id: id,
+			ArtifactMeta: &model.ArtifactMeta{
+				Name:                  id,
+				DeviceTypesCompatible: []string{"foo"},
+				Updates:               []model.Update{},
+			},
+			Size:     1024,
+			Modified: timePtr("2010-09-22T22:00:00+00:00"),
+		})
+		if !assert.NoError(t, err) {
+			assert.FailNow(t, "error setting up image collection for testing")
+		}
+	}
+
+	it, err := ds.FindImageIDs(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer it.Close(ctx)
+	var found []string
+	for more, err := it.Next(ctx); more; more, err = it.Next(ctx) {
+		assert.NoError(t, err)
+		var img model.Image
+		if assert.NoError(t, it.Decode(&img)) {
+			assert.Equal(t, int64(1024), img.Size)
+			assert.NotNil(t, img.Modified)
+			assert.Nil(t, img.ArtifactMeta, "only the ID, size and "+
+				"modification time are decoded")
+			found = append(found, img.Id)
+		}
+	}
+	assert.Equal(t, []string{ids[1], ids[2], ids[0]}, found)
+
+	// The images of other tenants are not scanned.
+	it, err = ds.FindImageIDs(context.Background())
+	if assert.NoError(t, err) {
+		more, err := it.Next(ctx)
+		assert.NoError(t, err)
+		assert.False(t, more)
+		it.Close(ctx)
+	}
+}
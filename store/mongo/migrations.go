@@ -24,7 +24,7 @@ import (
 )
 
 const (
-	DbVersion = "1.2.14"
+	DbVersion = "1.2.15"
 	DbName    = "deployment_service"
 )
 
@@ -129,6 +129,10 @@ func MigrateSingle(ctx context.Context,
 			client: client,
 			db:     db,
 		},
+		&migration_1_2_15{
+			client: client,
+			db:     db,
+		},
 	}
 
 	err = m.Apply(ctx, *ver, migrations)